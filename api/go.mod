@@ -12,6 +12,7 @@ require (
 	github.com/razorpay/razorpay-go v1.4.0
 	go.uber.org/zap v1.26.0
 	golang.org/x/crypto v0.23.0
+	golang.org/x/oauth2 v0.18.0
 )
 
 require (
@@ -62,7 +63,6 @@ require (
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/oauth2 v0.18.0 // indirect
 	golang.org/x/sync v0.6.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
@@ -0,0 +1,175 @@
+// Package address validates and normalises Indian postal addresses.
+package address
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Country is the only country we ship to; it is stored in this form.
+const Country = "India"
+
+var (
+	ErrInvalidPincode = errors.New("pincode must be 6 digits and cannot start with 0")
+	ErrUnknownState   = errors.New("unknown Indian state or union territory")
+	ErrPincodeState   = errors.New("pincode does not belong to the given state")
+	ErrInvalidPhone   = errors.New("phone must be a 10-digit Indian mobile number")
+	ErrUnsupported    = errors.New("only addresses in India are supported")
+)
+
+// pincodeRe excludes the leading 0 (unused) and 9 (Army Postal Service, not deliverable by couriers)
+var pincodeRe = regexp.MustCompile(`^[1-8][0-9]{5}$`)
+
+var mobileRe = regexp.MustCompile(`^[6-9][0-9]{9}$`)
+
+type state struct {
+	name string
+	code string // ISO 3166-2:IN subdivision code
+	// zones are the first digits of the pincodes used in the state
+	zones string
+}
+
+var states = []state{
+	{"Andaman and Nicobar Islands", "AN", "7"},
+	{"Andhra Pradesh", "AP", "5"},
+	{"Arunachal Pradesh", "AR", "7"},
+	{"Assam", "AS", "7"},
+	{"Bihar", "BR", "8"},
+	{"Chandigarh", "CH", "1"},
+	{"Chhattisgarh", "CG", "4"},
+	{"Dadra and Nagar Haveli and Daman and Diu", "DH", "3"},
+	{"Delhi", "DL", "1"},
+	{"Goa", "GA", "4"},
+	{"Gujarat", "GJ", "3"},
+	{"Haryana", "HR", "1"},
+	{"Himachal Pradesh", "HP", "1"},
+	{"Jammu and Kashmir", "JK", "1"},
+	{"Jharkhand", "JH", "8"},
+	{"Karnataka", "KA", "5"},
+	{"Kerala", "KL", "6"},
+	{"Ladakh", "LA", "1"},
+	{"Lakshadweep", "LD", "6"},
+	{"Madhya Pradesh", "MP", "4"},
+	{"Maharashtra", "MH", "4"},
+	{"Manipur", "MN", "7"},
+	{"Meghalaya", "ML", "7"},
+	{"Mizoram", "MZ", "7"},
+	{"Nagaland", "NL", "7"},
+	{"Odisha", "OD", "7"},
+	{"Puducherry", "PY", "56"}, // Yanam lies inside Andhra Pradesh
+	{"Punjab", "PB", "1"},
+	{"Rajasthan", "RJ", "3"},
+	{"Sikkim", "SK", "7"},
+	{"Tamil Nadu", "TN", "6"},
+	{"Telangana", "TG", "5"},
+	{"Tripura", "TR", "7"},
+	{"Uttar Pradesh", "UP", "2"},
+	{"Uttarakhand", "UK", "2"},
+	{"West Bengal", "WB", "7"},
+}
+
+// aliases maps older or informal names to the current official name
+var aliases = map[string]string{
+	"orissa":                 "Odisha",
+	"pondicherry":            "Puducherry",
+	"uttaranchal":            "Uttarakhand",
+	"new delhi":              "Delhi",
+	"nct of delhi":           "Delhi",
+	"jammu & kashmir":        "Jammu and Kashmir",
+	"andaman & nicobar":      "Andaman and Nicobar Islands",
+	"andaman and nicobar":    "Andaman and Nicobar Islands",
+	"dadra and nagar haveli": "Dadra and Nagar Haveli and Daman and Diu",
+	"daman and diu":          "Dadra and Nagar Haveli and Daman and Diu",
+	// ISO codes replaced in 2023
+	"ct": "Chhattisgarh",
+	"or": "Odisha",
+	"ts": "Telangana",
+	"ut": "Uttarakhand",
+}
+
+var statesByKey = func() map[string]state {
+	m := make(map[string]state, len(states)*2+len(aliases))
+	for _, s := range states {
+		m[strings.ToLower(s.name)] = s
+		m[strings.ToLower(s.code)] = s
+	}
+	for alias, name := range aliases {
+		m[alias] = m[strings.ToLower(name)]
+	}
+	return m
+}()
+
+// States returns the official names of all states and union territories.
+func States() []string {
+	names := make([]string, len(states))
+	for i, s := range states {
+		names[i] = s.name
+	}
+	return names
+}
+
+// NormalizeState accepts a state name, common alias or ISO code in any case and returns the official name.
+func NormalizeState(v string) (string, error) {
+	s, ok := statesByKey[strings.ToLower(strings.Join(strings.Fields(v), " "))]
+	if !ok {
+		return "", ErrUnknownState
+	}
+	return s.name, nil
+}
+
+// ValidatePincode checks the format of a PIN code and that it falls in the postal zone of the state.
+func ValidatePincode(pincode, stateName string) error {
+	if !pincodeRe.MatchString(pincode) {
+		return ErrInvalidPincode
+	}
+	s, ok := statesByKey[strings.ToLower(stateName)]
+	if !ok {
+		return ErrUnknownState
+	}
+	if !strings.ContainsRune(s.zones, rune(pincode[0])) {
+		return ErrPincodeState
+	}
+	return nil
+}
+
+// NormalizePhone strips separators and the +91/0 prefix and returns the 10-digit mobile number.
+func NormalizePhone(v string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '(' || r == ')' || r == '.' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(v))
+	digits = strings.TrimPrefix(digits, "+91")
+	if len(digits) == 12 && strings.HasPrefix(digits, "91") {
+		digits = digits[2:]
+	}
+	if len(digits) == 11 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	if !mobileRe.MatchString(digits) {
+		return "", ErrInvalidPhone
+	}
+	return digits, nil
+}
+
+// NormalizeCountry accepts an empty value, "IN" or "India" and returns Country.
+func NormalizeCountry(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "in", "ind", "india":
+		return Country, nil
+	}
+	return "", ErrUnsupported
+}
+
+// PincodeProximity scores how near two PIN codes are by the length of their common prefix:
+// 1 is the same postal zone, 2 the same sub-zone, 3 the same sorting district and 6 the same post office.
+// It is only a rough stand-in for distance, but needs no geographic data.
+func PincodeProximity(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/database"
+)
+
+// Actor identifies who performed an audited action and from where.
+type Actor struct {
+	UserID    int64
+	Email     string
+	IP        string
+	UserAgent string
+	RequestID string
+	APIKeyID  int64 // set instead of UserID when an integration authenticated with an API key
+}
+
+// Change is the before and after value of a single field.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Recorder writes audit log entries. Failures are logged but never fail the audited request.
+type Recorder struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+func NewRecorder(db *database.DB, logger *zap.Logger) *Recorder {
+	return &Recorder{db: db, logger: logger}
+}
+
+// Snapshot runs a query returning a single JSON column and decodes it into a map.
+// It returns nil if the row does not exist or cannot be read.
+func (r *Recorder) Snapshot(query string, args ...interface{}) map[string]interface{} {
+	var raw []byte
+	if err := r.db.QueryRow(query, args...).Scan(&raw); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			r.logger.Warn("Failed to load audit snapshot", zap.Error(err))
+		}
+		return nil
+	}
+	var snap map[string]interface{}
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		r.logger.Warn("Failed to decode audit snapshot", zap.Error(err))
+		return nil
+	}
+	return snap
+}
+
+// Record stores an audit entry. before and after may be nil, maps or any JSON-serialisable value.
+func (r *Recorder) Record(actor Actor, action, entityType string, entityID interface{}, before, after interface{}) {
+	beforeMap := toMap(before)
+	afterMap := toMap(after)
+
+	var diffJSON interface{}
+	if diff := Diff(beforeMap, afterMap); len(diff) > 0 {
+		diffJSON = mustJSON(diff)
+	}
+
+	var actorID, apiKeyID interface{}
+	if actor.UserID != 0 {
+		actorID = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		apiKeyID = actor.APIKeyID
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO audit_log (actor_id, actor_email, action, entity_type, entity_id, before_json, after_json, diff_json, ip, user_agent, request_id, api_key_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		actorID, nullIfEmpty(actor.Email), action, entityType, fmt.Sprint(entityID),
+		jsonOrNil(beforeMap), jsonOrNil(afterMap), diffJSON,
+		nullIfEmpty(actor.IP), nullIfEmpty(actor.UserAgent), nullIfEmpty(actor.RequestID), apiKeyID,
+	)
+	if err != nil {
+		r.logger.Error("Failed to write audit log entry",
+			zap.Error(err),
+			zap.String("action", action),
+			zap.String("entity_type", entityType),
+			zap.Any("entity_id", entityID),
+			zap.Int64("actor_id", actor.UserID),
+		)
+	}
+}
+
+// Diff returns the fields whose values differ between before and after.
+func Diff(before, after map[string]interface{}) map[string]Change {
+	diff := make(map[string]Change)
+	for k, b := range before {
+		a, ok := after[k]
+		if !ok || !reflect.DeepEqual(a, b) {
+			diff[k] = Change{From: b, To: a}
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			diff[k] = Change{From: nil, To: a}
+		}
+	}
+	return diff
+}
+
+// toMap normalises a value to its JSON object form so snapshots and request structs compare uniformly
+func toMap(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		return m
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+func jsonOrNil(m map[string]interface{}) interface{} {
+	if m == nil {
+		return nil
+	}
+	return mustJSON(m)
+}
+
+func mustJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"finspeed/api/internal/database"
+)
+
+// Purposes for single-use action tokens.
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeEmailChange       = "email_change"
+	PurposeAccountDeletion   = "account_deletion"
+)
+
+// ErrActionTokenInvalid is returned when an action token is unknown, expired, already used or issued for another purpose.
+var ErrActionTokenInvalid = errors.New("action token is invalid")
+
+// ActionTokenStore manages single-use, expiring tokens sent to users by email or handed out mid-login.
+type ActionTokenStore struct {
+	db *database.DB
+}
+
+func NewActionTokenStore(db *database.DB) *ActionTokenStore {
+	return &ActionTokenStore{db: db}
+}
+
+// Issue creates a new token for the purpose and invalidates any earlier unused ones.
+// The returned plaintext value is never stored.
+func (s *ActionTokenStore) Issue(userID int64, purpose string, ttl time.Duration) (string, error) {
+	value, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"UPDATE user_action_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, purpose,
+	); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO user_action_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, purpose, HashToken(value), time.Now().Add(ttl),
+	); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// Consume marks the token as used within tx and returns the user it was issued to.
+func (s *ActionTokenStore) Consume(tx *sql.Tx, value, purpose string) (int64, error) {
+	var userID int64
+	err := tx.QueryRow(
+		`UPDATE user_action_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		HashToken(value), purpose,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrActionTokenInvalid
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Lookup returns the user a valid token was issued to without using it up.
+func (s *ActionTokenStore) Lookup(value, purpose string) (int64, error) {
+	var userID int64
+	err := s.db.QueryRow(
+		"SELECT user_id FROM user_action_tokens WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()",
+		HashToken(value), purpose,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrActionTokenInvalid
+		}
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/database"
+)
+
+// apiKeyPrefix marks Finspeed API keys so they are recognisable in logs and secret scanners.
+const apiKeyPrefix = "fsk_"
+
+// ErrAPIKeyInvalid is returned for unknown, revoked or expired API keys.
+var ErrAPIKeyInvalid = errors.New("api key is invalid")
+
+// ErrAPIKeyNotFound is returned when revoking a key that does not exist or is already revoked.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a stored key without its secret.
+type APIKey struct {
+	ID                 int64      `json:"id"`
+	Name               string     `json:"name"`
+	Prefix             string     `json:"prefix"`
+	Scopes             []string   `json:"scopes"`
+	RateLimitPerMinute *int       `json:"rate_limit_per_minute,omitempty"`
+	CreatedBy          *int64     `json:"created_by,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP         *string    `json:"last_used_ip,omitempty"`
+	RevokedAt          *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the key was granted perm.
+func (k *APIKey) HasScope(perm string) bool {
+	for _, s := range k.Scopes {
+		if s == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKeyScope reports whether perm may be granted to an API key. Keys cannot hold the wildcard
+// or manage roles and other keys, so a leaked key cannot escalate itself.
+func IsAPIKeyScope(perm string) bool {
+	switch perm {
+	case PermissionAll, PermRolesManage, PermAPIKeysManage:
+		return false
+	}
+	return IsKnownPermission(perm)
+}
+
+// APIKeyStore creates, authenticates and revokes API keys.
+type APIKeyStore struct {
+	db *database.DB
+}
+
+func NewAPIKeyStore(db *database.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+const apiKeyColumns = `id, name, key_prefix, scopes, rate_limit_per_minute, created_by, expires_at,
+	last_used_at, last_used_ip, revoked_at, created_at`
+
+// Create stores a new key and returns it with the plaintext value, which is never stored.
+func (s *APIKeyStore) Create(name string, scopes []string, rateLimit *int, expiresAt *time.Time, createdBy int64) (*APIKey, string, error) {
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, "", err
+	}
+	value := apiKeyPrefix + secret
+
+	var creator interface{}
+	if createdBy != 0 {
+		creator = createdBy
+	}
+
+	row := s.db.QueryRow(
+		`INSERT INTO api_keys (name, key_prefix, key_hash, scopes, rate_limit_per_minute, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+apiKeyColumns,
+		name, value[:len(apiKeyPrefix)+8], HashToken(value), pq.Array(scopes), rateLimit, creator, expiresAt,
+	)
+	key, err := scanAPIKey(row)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, value, nil
+}
+
+// List returns every key, newest first, including revoked ones.
+func (s *APIKeyStore) List() ([]APIKey, error) {
+	rows, err := s.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Get returns a key by ID.
+func (s *APIKeyStore) Get(id int64) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// Authenticate resolves a presented key value to an active key.
+func (s *APIKeyStore) Authenticate(value string) (*APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())",
+		HashToken(value),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyInvalid
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchLastUsed records when and from where the key was used, at most once a minute per key.
+func (s *APIKeyStore) TouchLastUsed(id int64, ip string) error {
+	_, err := s.db.Exec(
+		`UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $2
+		 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		id, ip,
+	)
+	return err
+}
+
+// Revoke disables a key immediately.
+func (s *APIKeyStore) Revoke(id int64) error {
+	res, err := s.db.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var k APIKey
+	var rateLimit sql.NullInt64
+	var createdBy sql.NullInt64
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	var lastUsedIP sql.NullString
+	if err := row.Scan(
+		&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &rateLimit, &createdBy, &expiresAt,
+		&lastUsedAt, &lastUsedIP, &revokedAt, &k.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if rateLimit.Valid {
+		v := int(rateLimit.Int64)
+		k.RateLimitPerMinute = &v
+	}
+	if createdBy.Valid {
+		k.CreatedBy = &createdBy.Int64
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if lastUsedIP.Valid {
+		k.LastUsedIP = &lastUsedIP.String
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	if k.Scopes == nil {
+		k.Scopes = []string{}
+	}
+	return &k, nil
+}
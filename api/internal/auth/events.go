@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"go.uber.org/zap"
+)
+
+// Security event names emitted by the auth flows.
+const (
+	EventLoginSucceeded   = "login_succeeded"
+	EventLoginFailed      = "login_failed"
+	EventLoginRateLimited = "login_rate_limited"
+	EventAccountLocked    = "account_locked"
+	EventLoginWhileLocked = "login_while_locked"
+
+	EventTwoFactorFailed       = "two_factor_failed"
+	EventTwoFactorEnabled      = "two_factor_enabled"
+	EventTwoFactorDisabled     = "two_factor_disabled"
+	EventRecoveryCodeUsed      = "recovery_code_used"
+	EventRecoveryCodesReissued = "recovery_codes_reissued"
+
+	EventAPIKeyRejected = "api_key_rejected"
+
+	EventIdentityLinked   = "identity_linked"
+	EventIdentityUnlinked = "identity_unlinked"
+
+	EventPasswordChanged = "password_changed"
+	EventEmailChanged    = "email_changed"
+	EventAccountErased   = "account_erased"
+)
+
+// LogSecurityEvent writes a structured security event. Callers must never pass secrets such as passwords.
+func LogSecurityEvent(logger *zap.Logger, event string, fields ...zap.Field) {
+	fields = append([]zap.Field{zap.String("security_event", event)}, fields...)
+	if event == EventLoginSucceeded {
+		logger.Info("Security event", fields...)
+		return
+	}
+	logger.Warn("Security event", fields...)
+}
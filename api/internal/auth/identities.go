@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/oauth2"
+
+	"finspeed/api/internal/database"
+)
+
+var (
+	// ErrLoginStateInvalid is returned for unknown, expired or already used OIDC state values.
+	ErrLoginStateInvalid = errors.New("oidc login state is invalid")
+	// ErrIdentityNotFound is returned when no user is linked to an external identity.
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrIdentityLinked is returned when an external identity already belongs to another user.
+	ErrIdentityLinked = errors.New("identity is linked to another account")
+)
+
+// Identity is an external account linked to a user.
+type Identity struct {
+	ID          int64      `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       *string    `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OIDCLoginState is the server-side half of an authorization request.
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   int64 // set when a signed-in user is linking an identity rather than logging in
+}
+
+// IdentityStore links external identities to users and tracks in-flight OIDC logins.
+type IdentityStore struct {
+	db *database.DB
+}
+
+func NewIdentityStore(db *database.DB) *IdentityStore {
+	return &IdentityStore{db: db}
+}
+
+// BeginLogin stores a new login state and returns the opaque state value to send to the provider.
+func (s *IdentityStore) BeginLogin(provider string, linkUserID int64, ttl time.Duration) (string, *OIDCLoginState, error) {
+	value, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", nil, err
+	}
+	st := &OIDCLoginState{
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		LinkUserID:   linkUserID,
+	}
+
+	var link interface{}
+	if linkUserID != 0 {
+		link = linkUserID
+	}
+
+	// Opportunistically prune abandoned logins
+	if _, err := s.db.Exec("DELETE FROM oidc_login_states WHERE expires_at < NOW()"); err != nil {
+		return "", nil, err
+	}
+	if _, err := s.db.Exec(
+		`INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		HashToken(value), provider, st.Nonce, st.CodeVerifier, link, time.Now().Add(ttl),
+	); err != nil {
+		return "", nil, err
+	}
+	return value, st, nil
+}
+
+// ConsumeLogin returns and deletes the state so a callback can only be redeemed once.
+func (s *IdentityStore) ConsumeLogin(value string) (*OIDCLoginState, error) {
+	var st OIDCLoginState
+	var link sql.NullInt64
+	err := s.db.QueryRow(
+		`DELETE FROM oidc_login_states WHERE state_hash = $1 AND expires_at > NOW()
+		 RETURNING provider, nonce, code_verifier, link_user_id`,
+		HashToken(value),
+	).Scan(&st.Provider, &st.Nonce, &st.CodeVerifier, &link)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLoginStateInvalid
+		}
+		return nil, err
+	}
+	st.LinkUserID = link.Int64
+	return &st, nil
+}
+
+// FindUser returns the user linked to the provider subject and records the login.
+func (s *IdentityStore) FindUser(provider, subject string) (int64, error) {
+	var userID int64
+	err := s.db.QueryRow(
+		"UPDATE user_identities SET last_login_at = NOW() WHERE provider = $1 AND subject = $2 RETURNING user_id",
+		provider, subject,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrIdentityNotFound
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Link attaches the provider subject to the user. Linking the same identity twice to one user is a no-op.
+func (s *IdentityStore) Link(tx *sql.Tx, userID int64, provider, subject, email string) error {
+	var owner int64
+	err := tx.QueryRow(
+		`INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		 ON CONFLICT (provider, subject) DO UPDATE SET last_login_at = NOW()
+		 RETURNING user_id`,
+		userID, provider, subject, email,
+	).Scan(&owner)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrIdentityLinked
+		}
+		return err
+	}
+	if owner != userID {
+		return ErrIdentityLinked
+	}
+	return nil
+}
+
+// List returns the identities linked to the user.
+func (s *IdentityStore) List(userID int64) ([]Identity, error) {
+	rows, err := s.db.Query(
+		"SELECT id, provider, email, last_login_at, created_at FROM user_identities WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.ID, &i.Provider, &i.Email, &i.LastLoginAt, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+// Unlink removes an identity unless it is the user's only way to sign in.
+// It reports false when the identity does not exist or cannot be removed.
+func (s *IdentityStore) Unlink(userID, identityID int64) (bool, error) {
+	res, err := s.db.Exec(
+		`DELETE FROM user_identities i
+		 WHERE i.id = $1 AND i.user_id = $2
+		   AND (EXISTS (SELECT 1 FROM users u WHERE u.id = i.user_id AND u.password_hash IS NOT NULL)
+		        OR EXISTS (SELECT 1 FROM user_identities o WHERE o.user_id = i.user_id AND o.id <> i.id))`,
+		identityID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
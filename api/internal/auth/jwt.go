@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the application claims carried by access tokens.
+type Claims struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager signs and verifies access tokens with a rotating set of asymmetric keys.
+type TokenManager struct {
+	keys         map[string]*SigningKey
+	active       *SigningKey
+	issuer       string
+	audience     string
+	ttl          time.Duration
+	legacySecret []byte
+}
+
+// NewTokenManager builds a manager that signs with the key identified by activeKID.
+// If legacySecret is non-empty, HS256 tokens without a kid are still accepted so sessions
+// issued before the switch to asymmetric keys stay valid until they expire.
+func NewTokenManager(keys []*SigningKey, activeKID, issuer, audience string, ttl time.Duration, legacySecret string) (*TokenManager, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no JWT signing keys configured")
+	}
+
+	m := &TokenManager{
+		keys:     make(map[string]*SigningKey, len(keys)),
+		issuer:   issuer,
+		audience: audience,
+		ttl:      ttl,
+	}
+	for _, k := range keys {
+		if _, dup := m.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate JWT key id %q", k.ID)
+		}
+		m.keys[k.ID] = k
+	}
+
+	if activeKID == "" {
+		// Default to the last signing-capable key; key files are sorted by name, so date-prefixed kids rotate naturally.
+		for i := len(keys) - 1; i >= 0; i-- {
+			if keys[i].CanSign() {
+				m.active = keys[i]
+				break
+			}
+		}
+	} else {
+		m.active = m.keys[activeKID]
+	}
+	if m.active == nil || !m.active.CanSign() {
+		return nil, fmt.Errorf("active JWT key %q not found or has no private key", activeKID)
+	}
+
+	if legacySecret != "" {
+		m.legacySecret = []byte(legacySecret)
+	}
+	return m, nil
+}
+
+// ActiveKeyID returns the kid new tokens are signed with.
+func (m *TokenManager) ActiveKeyID() string {
+	return m.active.ID
+}
+
+// Issue signs a new access token for the user and returns it with its jti and expiry.
+func (m *TokenManager) Issue(userID int64, email, role string) (token string, jti string, expiresAt time.Time, err error) {
+	now := time.Now()
+	expiresAt = now.Add(m.ttl)
+
+	jti, err = NewTokenID()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	claims := Claims{
+		UserID: userID,
+		Email:  email,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   fmt.Sprint(userID),
+			Issuer:    m.issuer,
+			Audience:  jwt.ClaimStrings{m.audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	t := jwt.NewWithClaims(m.active.Method, claims)
+	t.Header["kid"] = m.active.ID
+	token, err = t.SignedString(m.active.PrivateKey)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return token, jti, expiresAt, nil
+}
+
+// Parse verifies the signature, expiry, issuer and audience of a token and returns its claims.
+func (m *TokenManager) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "HS256"}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Legacy HS256 tokens predate the aud claim; everything else must carry it.
+	if token.Method != jwt.SigningMethodHS256 && !audienceContains(claims.Audience, m.audience) {
+		return nil, errors.New("token has invalid audience")
+	}
+	return claims, nil
+}
+
+func (m *TokenManager) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if t.Method == jwt.SigningMethodHS256 && m.legacySecret != nil {
+			return m.legacySecret, nil
+		}
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %q", t.Method.Alg(), kid)
+	}
+	return key.PublicKey, nil
+}
+
+func audienceContains(aud jwt.ClaimStrings, want string) bool {
+	for _, a := range aud {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+// JWK is a JSON Web Key as published in the JWKS document.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519) and EC
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every configured key, including retired ones.
+func (m *TokenManager) JWKS() JWKS {
+	kids := make([]string, 0, len(m.keys))
+	for kid := range m.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		k := m.keys[kid]
+		jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+		switch pub := k.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one entry of the key set. Retired keys may carry only a public key;
+// they keep verifying tokens they signed until the file is removed.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool {
+	return k.PrivateKey != nil
+}
+
+// LoadKeysFromDir reads every *.pem file in dir. The file name without extension becomes the key ID.
+// Files may contain a PKCS#8 or PKCS#1 private key (RSA or Ed25519) or a PKIX public key.
+func LoadKeysFromDir(dir string) ([]*SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []*SigningKey
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", p, err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		key, err := ParseKeyPEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", p, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParseKeyPEM parses a single PEM-encoded key.
+func ParseKeyPEM(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, PublicKey: k}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: k, PublicKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, PublicKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (expected RSA or Ed25519)", parsed)
+	}
+}
+
+// GenerateEphemeralKey creates an in-memory Ed25519 key. Tokens signed with it do not survive a restart.
+func GenerateEphemeralKey(kid string) (*SigningKey, error) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: priv, PublicKey: priv.Public()}, nil
+}
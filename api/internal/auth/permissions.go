@@ -0,0 +1,60 @@
+package auth
+
+// Permissions granted to roles. The wildcard grants every permission.
+const (
+	PermissionAll = "*"
+
+	PermProductsWrite     = "products:write"
+	PermCategoriesWrite   = "categories:write"
+	PermInventoryManage   = "inventory:manage"
+	PermPurchasingManage  = "purchasing:manage"
+	PermPurchasingApprove = "purchasing:approve"
+	PermOrdersRead        = "orders:read"
+	PermOrdersWrite       = "orders:write"
+	PermOrdersRefund      = "orders:refund"
+	PermBookingsManage    = "bookings:manage"
+	PermPaymentsRead      = "payments:read"
+	PermUsersRead         = "users:read"
+	PermUsersWrite        = "users:write"
+	PermUsersDelete       = "users:delete"
+	PermRolesManage       = "roles:manage"
+	PermAuditRead         = "audit:read"
+	PermAPIKeysManage     = "api_keys:manage"
+)
+
+// Permission describes a grantable permission for the admin UI.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions lists every permission that can be assigned to a role.
+var AllPermissions = []Permission{
+	{PermissionAll, "Every permission, including ones added later"},
+	{PermProductsWrite, "Create, update and delete products and their images"},
+	{PermCategoriesWrite, "Create, update and delete categories"},
+	{PermInventoryManage, "Manage stock locations, record stock movements and receive purchase orders"},
+	{PermPurchasingManage, "Manage suppliers and draft purchase orders"},
+	{PermPurchasingApprove, "Approve purchase orders for sending to suppliers"},
+	{PermOrdersRead, "View all customer orders"},
+	{PermOrdersWrite, "Update orders and fulfilment"},
+	{PermOrdersRefund, "Issue refunds"},
+	{PermBookingsManage, "Manage service types, booking hours and customer bookings"},
+	{PermPaymentsRead, "View payment records"},
+	{PermUsersRead, "View user accounts"},
+	{PermUsersWrite, "Update user accounts and revoke their sessions"},
+	{PermUsersDelete, "Delete user accounts"},
+	{PermRolesManage, "Manage roles and their permissions"},
+	{PermAuditRead, "View the audit log of admin changes"},
+	{PermAPIKeysManage, "Create and revoke API keys for integrations"},
+}
+
+// IsKnownPermission reports whether name is in AllPermissions.
+func IsKnownPermission(name string) bool {
+	for _, p := range AllPermissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/database"
+)
+
+// RoleCustomer is the role assigned to self-registered users.
+const RoleCustomer = "customer"
+
+// roleCacheTTL bounds how long another instance's role edits take to be picked up.
+const roleCacheTTL = 30 * time.Second
+
+// ErrRoleNotFound is returned for unknown role names.
+var ErrRoleNotFound = errors.New("role not found")
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description,omitempty"`
+	IsSystem    bool     `json:"is_system"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleStore resolves role permissions with a short-lived in-memory cache.
+type RoleStore struct {
+	db *database.DB
+
+	mu       sync.RWMutex
+	cache    map[string]map[string]bool
+	loadedAt time.Time
+}
+
+func NewRoleStore(db *database.DB) *RoleStore {
+	return &RoleStore{db: db}
+}
+
+// HasPermission reports whether the role grants perm, directly or through the wildcard.
+func (s *RoleStore) HasPermission(role, perm string) (bool, error) {
+	perms, err := s.permissions(role)
+	if err != nil {
+		return false, err
+	}
+	return perms[PermissionAll] || perms[perm], nil
+}
+
+// IsStaff reports whether the role grants any permission, i.e. may use the admin area.
+func (s *RoleStore) IsStaff(role string) (bool, error) {
+	perms, err := s.permissions(role)
+	if err != nil {
+		return false, err
+	}
+	return len(perms) > 0, nil
+}
+
+// Exists reports whether a role with the given name exists.
+func (s *RoleStore) Exists(role string) (bool, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.cache[role]
+	return ok, nil
+}
+
+// List returns all roles with their permissions, sorted by name.
+func (s *RoleStore) List() ([]Role, error) {
+	rows, err := s.db.Query(
+		`SELECT r.name, r.description, r.is_system,
+		        COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		 FROM roles r LEFT JOIN role_permissions rp ON rp.role = r.name
+		 GROUP BY r.name, r.description, r.is_system
+		 ORDER BY r.name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var r Role
+		if err := rows.Scan(&r.Name, &r.Description, &r.IsSystem, pq.Array(&r.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// Get returns a single role.
+func (s *RoleStore) Get(name string) (*Role, error) {
+	roles, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		if roles[i].Name == name {
+			return &roles[i], nil
+		}
+	}
+	return nil, ErrRoleNotFound
+}
+
+// Save creates or updates a role and replaces its permission set.
+func (s *RoleStore) Save(name string, description *string, permissions []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO roles (name, description) VALUES ($1, $2)
+		 ON CONFLICT (name) DO UPDATE SET description = COALESCE(EXCLUDED.description, roles.description)`,
+		name, description,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = $1", name); err != nil {
+		return err
+	}
+	for _, p := range permissions {
+		if _, err := tx.Exec(
+			"INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			name, p,
+		); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.Invalidate()
+	return nil
+}
+
+// Delete removes a non-system role that is not assigned to any user.
+func (s *RoleStore) Delete(name string) error {
+	if _, err := s.db.Exec("DELETE FROM roles WHERE name = $1", name); err != nil {
+		return err
+	}
+	s.Invalidate()
+	return nil
+}
+
+// Invalidate drops the cache so the next lookup reloads from the database.
+func (s *RoleStore) Invalidate() {
+	s.mu.Lock()
+	s.cache = nil
+	s.mu.Unlock()
+}
+
+func (s *RoleStore) permissions(role string) (map[string]bool, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cache[role], nil
+}
+
+func (s *RoleStore) ensureLoaded() error {
+	s.mu.RLock()
+	fresh := s.cache != nil && time.Since(s.loadedAt) < roleCacheTTL
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	rows, err := s.db.Query("SELECT r.name, rp.permission FROM roles r LEFT JOIN role_permissions rp ON rp.role = r.name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cache := make(map[string]map[string]bool)
+	for rows.Next() {
+		var name string
+		var perm sql.NullString
+		if err := rows.Scan(&name, &perm); err != nil {
+			return err
+		}
+		if cache[name] == nil {
+			cache[name] = make(map[string]bool)
+		}
+		if perm.Valid {
+			cache[name][perm.String] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cache = cache
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
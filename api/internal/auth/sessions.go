@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/database"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned when a refresh token is unknown, expired or revoked.
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	// The whole token family is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// SessionStore persists refresh tokens and the access token deny list.
+type SessionStore struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+// RefreshToken is a freshly issued refresh token. Value is only available at issue time;
+// the database stores a SHA-256 hash of it.
+type RefreshToken struct {
+	Value     string
+	UserID    int64
+	FamilyID  string
+	ExpiresAt time.Time
+}
+
+// ClientInfo describes the client a refresh token was issued to.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+func NewSessionStore(db *database.DB, logger *zap.Logger) *SessionStore {
+	return &SessionStore{db: db, logger: logger}
+}
+
+// NewTokenID returns a random identifier suitable for a JWT "jti" claim.
+func NewTokenID() (string, error) {
+	return randomHex(16)
+}
+
+// IssueRefreshToken creates a refresh token starting a new token family.
+func (s *SessionStore) IssueRefreshToken(userID int64, ttl time.Duration, client ClientInfo) (*RefreshToken, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rt, _, err := insertRefreshToken(tx, userID, familyID, ttl, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// RotateRefreshToken exchanges a valid refresh token for a new one in the same family.
+// Presenting a token that was already rotated revokes the entire family.
+func (s *SessionStore) RotateRefreshToken(value string, ttl time.Duration, client ClientInfo) (*RefreshToken, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id        int64
+		userID    int64
+		familyID  string
+		expiresAt time.Time
+		revokedAt sql.NullTime
+	)
+	err = tx.QueryRow(
+		`SELECT id, user_id, family_id, expires_at, revoked_at
+		 FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`,
+		HashToken(value),
+	).Scan(&id, &userID, &familyID, &expiresAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		// A rotated token is being replayed: assume it was stolen and kill the family.
+		if _, err := tx.Exec(
+			"UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL",
+			familyID,
+		); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		s.logger.Warn("Refresh token reuse detected, revoked token family",
+			zap.Int64("user_id", userID), zap.String("family_id", familyID))
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(expiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	rt, newID, err := insertRefreshToken(tx, userID, familyID, ttl, client)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2",
+		newID, id,
+	); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// RevokeRefreshToken revokes the family the given refresh token belongs to.
+// Unknown tokens are ignored so logout stays idempotent.
+func (s *SessionStore) RevokeRefreshToken(value string, userID int64) error {
+	_, err := s.db.Exec(
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE revoked_at IS NULL AND user_id = $2 AND family_id = (
+		     SELECT family_id FROM refresh_tokens WHERE token_hash = $1
+		 )`,
+		HashToken(value), userID,
+	)
+	return err
+}
+
+// RevokeAccessToken adds an access token's jti to the deny list until it expires.
+func (s *SessionStore) RevokeAccessToken(jti string, userID int64, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	if _, err := s.db.Exec(
+		`INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (jti) DO NOTHING`,
+		jti, userID, expiresAt,
+	); err != nil {
+		return err
+	}
+	// Opportunistically prune entries for tokens that have expired anyway.
+	if _, err := s.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		s.logger.Warn("Failed to prune revoked tokens", zap.Error(err))
+	}
+	return nil
+}
+
+// RevokeAllSessions invalidates every refresh token and every access token issued to the user so far.
+func (s *SessionStore) RevokeAllSessions(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET sessions_revoked_at = NOW() WHERE id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsAccessTokenRevoked reports whether the token was explicitly revoked or issued
+// before the user's last "log out all sessions".
+func (s *SessionStore) IsAccessTokenRevoked(jti string, userID int64, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		     OR EXISTS(SELECT 1 FROM users WHERE id = $2 AND sessions_revoked_at IS NOT NULL
+		                AND date_trunc('second', sessions_revoked_at) > $3)`,
+		jti, userID, issuedAt,
+	).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// HashToken returns the hex-encoded SHA-256 digest used to store opaque tokens.
+func HashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func insertRefreshToken(tx *sql.Tx, userID int64, familyID string, ttl time.Duration, client ClientInfo) (*RefreshToken, int64, error) {
+	value, err := randomHex(32)
+	if err != nil {
+		return nil, 0, err
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	var id int64
+	err = tx.QueryRow(
+		`INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, user_agent, ip)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		userID, HashToken(value), familyID, expiresAt, client.UserAgent, client.IP,
+	).Scan(&id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &RefreshToken{Value: value, UserID: userID, FamilyID: familyID, ExpiresAt: expiresAt}, id, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/30); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / 30
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := func(s int64) string { return totpCode(key, s) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, code(step), step, true},
+		{"previous step within skew", rfcSecret, code(step - 1), step - 1, true},
+		{"next step within skew", rfcSecret, code(step + 1), step + 1, true},
+		{"two steps back", rfcSecret, code(step - 2), 0, false},
+		{"two steps ahead", rfcSecret, code(step + 2), 0, false},
+		{"surrounding spaces", rfcSecret, " " + code(step) + " ", step, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code(step), step, true},
+		{"too short", rfcSecret, code(step)[:5], 0, false},
+		{"too long", rfcSecret, code(step) + "0", 0, false},
+		{"wrong code", rfcSecret, "000000", 0, false},
+		{"invalid secret", "not base32!", code(step), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("ValidateTOTP = (%d, %v), want (%d, %v)", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// A code stays valid while its step is within the skew, but the step it reports does not move, so the
+// caller's "newer than the last accepted step" check rejects it the second time.
+func TestValidateTOTPReplayWindow(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Unix(1234567890, 0)
+	step := issued.Unix() / 30
+	code := totpCode(key, step)
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		wantOK bool
+	}{
+		{"when issued", issued, true},
+		{"one period later", issued.Add(30 * time.Second), true},
+		{"two periods later", issued.Add(60 * time.Second), false},
+		{"one period earlier", issued.Add(-30 * time.Second), true},
+		{"two periods earlier", issued.Add(-60 * time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(rfcSecret, code, tt.at)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != step {
+				t.Errorf("ValidateTOTP step = %d, want the issuing step %d", got, step)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret is %d bytes, want 20", len(key))
+	}
+	if _, ok := ValidateTOTP(secret, totpCode(key, time.Now().Unix()/30), time.Now()); !ok {
+		t.Error("a code for the generated secret did not validate")
+	}
+}
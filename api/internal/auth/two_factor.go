@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"finspeed/api/internal/database"
+)
+
+// Purposes for the short-lived challenge tokens issued between the password and second login step.
+const (
+	PurposeTwoFactorChallenge  = "two_factor_challenge"
+	PurposeTwoFactorEnrollment = "two_factor_enrollment"
+)
+
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolling   = errors.New("no two-factor enrolment in progress")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorCodeInvalid    = errors.New("two-factor code is invalid")
+)
+
+// TwoFactorStatus summarises a user's second factor for display.
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorStore manages TOTP secrets and recovery codes.
+type TwoFactorStore struct {
+	db *database.DB
+}
+
+func NewTwoFactorStore(db *database.DB) *TwoFactorStore {
+	return &TwoFactorStore{db: db}
+}
+
+// IsEnabled reports whether the user has completed TOTP enrolment.
+func (s *TwoFactorStore) IsEnabled(userID int64) (bool, error) {
+	var enabled bool
+	err := s.db.QueryRow("SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// Status returns whether TOTP is enabled and how many recovery codes are left.
+func (s *TwoFactorStore) Status(userID int64) (TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	var enabledAt sql.NullTime
+	err := s.db.QueryRow(
+		`SELECT totp_enabled_at,
+		        (SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = users.id AND used_at IS NULL)
+		 FROM users WHERE id = $1`,
+		userID,
+	).Scan(&enabledAt, &status.RecoveryCodesRemaining)
+	if err != nil {
+		return status, err
+	}
+	if enabledAt.Valid {
+		status.Enabled = true
+		status.EnabledAt = &enabledAt.Time
+	}
+	return status, nil
+}
+
+// BeginEnrollment stores a new pending secret for the user, replacing any earlier unconfirmed one.
+func (s *TwoFactorStore) BeginEnrollment(userID int64) (string, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	res, err := s.db.Exec(
+		"UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2 AND totp_enabled_at IS NULL",
+		secret, userID,
+	)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrTwoFactorAlreadyEnabled
+	}
+	return secret, nil
+}
+
+// ConfirmEnrollment enables TOTP once the user proves their app generates valid codes,
+// and returns a fresh set of recovery codes.
+func (s *TwoFactorStore) ConfirmEnrollment(userID int64, code string) ([]string, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := s.db.QueryRow("SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&secret, &enabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	step, ok := ValidateTOTP(secret.String, code, time.Now())
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE id = $2 AND totp_secret = $3 AND totp_enabled_at IS NULL",
+		step, userID, secret.String,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// A concurrent setup replaced the secret or another request finished enrolment
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyCode checks a TOTP code for an enrolled user. Each time step is accepted only once.
+func (s *TwoFactorStore) VerifyCode(userID int64, code string) error {
+	var secret sql.NullString
+	err := s.db.QueryRow("SELECT totp_secret FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL", userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+	step, ok := ValidateTOTP(secret.String, code, time.Now())
+	if !ok {
+		return ErrTwoFactorCodeInvalid
+	}
+	res, err := s.db.Exec(
+		"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)",
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes one of the user's unused recovery codes.
+func (s *TwoFactorStore) UseRecoveryCode(userID int64, code string) error {
+	var id int64
+	err := s.db.QueryRow(
+		"UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL RETURNING id",
+		userID, HashToken(normalizeRecoveryCode(code)),
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTwoFactorCodeInvalid
+		}
+		return err
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes invalidates all existing recovery codes and returns new ones.
+func (s *TwoFactorStore) RegenerateRecoveryCodes(userID int64) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes the user's TOTP secret and recovery codes.
+func (s *TwoFactorStore) Disable(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1",
+		userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int64) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, HashToken(normalizeRecoveryCode(code)),
+		); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7m2p-x9qhr" using an alphabet without look-alike characters.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,102 @@
+// Package bookings schedules workshop services and test rides at locations. Each location opens for
+// bookings of a kind on set weekdays, cut into slots; capacity limits how many bookings run at once.
+package bookings
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/database"
+)
+
+// Kind is what a booking is for. Services and test rides have separate hours and capacity.
+type Kind string
+
+const (
+	KindService  Kind = "service"
+	KindTestRide Kind = "test_ride"
+)
+
+// Prepayment says whether a service type is paid for when booking.
+type Prepayment string
+
+const (
+	PrepaymentNone     Prepayment = "none"
+	PrepaymentOptional Prepayment = "optional"
+	PrepaymentRequired Prepayment = "required" // the booking holds its slot unconfirmed until paid
+)
+
+// Status is the lifecycle state of a booking.
+type Status string
+
+const (
+	StatusPendingPayment Status = "pending_payment"
+	StatusConfirmed      Status = "confirmed"
+	StatusCompleted      Status = "completed"
+	StatusNoShow         Status = "no_show"
+	StatusCancelled      Status = "cancelled"
+)
+
+// MaxAdvance is how far ahead customers can book.
+const MaxAdvance = 60 * 24 * time.Hour
+
+// Zone is the time zone of booking hours. All locations are in India, which has no daylight saving.
+var Zone = time.FixedZone("IST", 5*3600+30*60)
+
+var (
+	ErrDuplicateCode  = errors.New("service type code already exists")
+	ErrInactive       = errors.New("service type is not available for booking")
+	ErrNoHours        = errors.New("the location does not take bookings of this kind")
+	ErrClosed         = errors.New("the location is closed on this day")
+	ErrInvalidSlot    = errors.New("the time is not a bookable slot")
+	ErrSlotFull       = errors.New("the slot is fully booked")
+	ErrTooFarAhead    = errors.New("the slot is too far ahead")
+	ErrTooLate        = errors.New("the booking can no longer be changed")
+	ErrWrongStatus    = errors.New("booking status does not allow this")
+	ErrNotStarted     = errors.New("the booking has not started yet")
+	ErrNotPayable     = errors.New("the booking has nothing to pay")
+	ErrPaymentTaken   = errors.New("the payment is already recorded for another booking")
+	ErrUnknownProduct = errors.New("unknown product")
+)
+
+// ValidKind reports whether k is a known kind.
+func ValidKind(k Kind) bool {
+	return k == KindService || k == KindTestRide
+}
+
+// ValidPrepayment reports whether p is a known prepayment option.
+func ValidPrepayment(p Prepayment) bool {
+	switch p {
+	case PrepaymentNone, PrepaymentOptional, PrepaymentRequired:
+		return true
+	}
+	return false
+}
+
+// ValidStatus reports whether s is a known status.
+func ValidStatus(s Status) bool {
+	switch s {
+	case StatusPendingPayment, StatusConfirmed, StatusCompleted, StatusNoShow, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Store reads and writes service types, booking hours and bookings. Bookings awaiting payment hold their
+// slot for holdFor after they are made.
+type Store struct {
+	db      *database.DB
+	holdFor time.Duration
+}
+
+func NewStore(db *database.DB, holdFor time.Duration) *Store {
+	return &Store{db: db, holdFor: holdFor}
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
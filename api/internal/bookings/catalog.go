@@ -0,0 +1,269 @@
+package bookings
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ServiceType is something customers can book. Locations lists where it can be booked.
+type ServiceType struct {
+	ID              int64      `json:"id"`
+	Code            string     `json:"code"`
+	Name            string     `json:"name"`
+	Kind            Kind       `json:"kind"`
+	Description     *string    `json:"description,omitempty"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Price           float64    `json:"price"`
+	Prepayment      Prepayment `json:"prepayment"`
+	IsActive        bool       `json:"is_active"`
+	CreatedAt       string     `json:"created_at"`
+	UpdatedAt       *string    `json:"updated_at,omitempty"`
+	Locations       []Location `json:"locations,omitempty"`
+}
+
+// Location is a place that takes bookings.
+type Location struct {
+	ID       int64   `json:"id"`
+	Name     string  `json:"name"`
+	Address1 *string `json:"address1,omitempty"`
+	City     string  `json:"city"`
+	State    string  `json:"state"`
+	Pincode  string  `json:"pincode"`
+}
+
+// Hours are the booking hours of one weekday, 0 being Sunday. Times are HH:MM in Zone.
+type Hours struct {
+	Weekday     int    `json:"weekday"`
+	OpensAt     string `json:"opens_at"`
+	ClosesAt    string `json:"closes_at"`
+	SlotMinutes int    `json:"slot_minutes"`
+	Capacity    int    `json:"capacity"`
+}
+
+// Closure is a day a location takes no bookings.
+type Closure struct {
+	ID         int64   `json:"id"`
+	LocationID int64   `json:"location_id"`
+	Date       string  `json:"date"`
+	Reason     *string `json:"reason,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+const serviceTypeColumns = `id, code, name, kind, description, duration_minutes, price, prepayment, is_active, created_at, updated_at`
+
+func scanServiceType(row interface{ Scan(...interface{}) error }) (*ServiceType, error) {
+	var t ServiceType
+	err := row.Scan(&t.ID, &t.Code, &t.Name, &t.Kind, &t.Description, &t.DurationMinutes, &t.Price, &t.Prepayment,
+		&t.IsActive, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ServiceTypes lists service types by kind and name. With activeOnly it lists what customers can book,
+// each with the active locations that have booking hours for its kind.
+func (s *Store) ServiceTypes(activeOnly bool) ([]ServiceType, error) {
+	rows, err := s.db.Query(
+		"SELECT "+serviceTypeColumns+" FROM service_types WHERE is_active OR NOT $1 ORDER BY kind, name",
+		activeOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	list := []ServiceType{}
+	for rows.Next() {
+		t, err := scanServiceType(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !activeOnly {
+		return list, nil
+	}
+
+	locations := map[Kind][]Location{}
+	for _, k := range []Kind{KindService, KindTestRide} {
+		if locations[k], err = s.locations(k); err != nil {
+			return nil, err
+		}
+	}
+	for i := range list {
+		list[i].Locations = locations[list[i].Kind]
+	}
+	return list, nil
+}
+
+// locations lists the active locations with booking hours for kind
+func (s *Store) locations(kind Kind) ([]Location, error) {
+	rows, err := s.db.Query(
+		`SELECT l.id, l.name, l.address1, l.city, l.state, l.pincode FROM locations l
+		 WHERE l.is_active AND EXISTS (SELECT 1 FROM booking_hours h WHERE h.location_id = l.id AND h.kind = $1)
+		 ORDER BY l.priority, l.id`,
+		kind,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Location
+	for rows.Next() {
+		var l Location
+		if err := rows.Scan(&l.ID, &l.Name, &l.Address1, &l.City, &l.State, &l.Pincode); err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+	return list, rows.Err()
+}
+
+// ServiceType returns a service type, or sql.ErrNoRows.
+func (s *Store) ServiceType(id int64) (*ServiceType, error) {
+	return scanServiceType(s.db.QueryRow("SELECT "+serviceTypeColumns+" FROM service_types WHERE id = $1", id))
+}
+
+// SaveServiceType creates the service type when its ID is zero and updates it otherwise. Existing
+// bookings keep the duration and price they were made with.
+func (s *Store) SaveServiceType(t *ServiceType) error {
+	var err error
+	if t.ID == 0 {
+		err = s.db.QueryRow(
+			`INSERT INTO service_types (code, name, kind, description, duration_minutes, price, prepayment, is_active)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			t.Code, t.Name, t.Kind, t.Description, t.DurationMinutes, t.Price, t.Prepayment, t.IsActive,
+		).Scan(&t.ID)
+	} else {
+		var res sql.Result
+		res, err = s.db.Exec(
+			`UPDATE service_types SET code = $2, name = $3, kind = $4, description = $5, duration_minutes = $6,
+			        price = $7, prepayment = $8, is_active = $9, updated_at = NOW()
+			 WHERE id = $1`,
+			t.ID, t.Code, t.Name, t.Kind, t.Description, t.DurationMinutes, t.Price, t.Prepayment, t.IsActive,
+		)
+		if err == nil {
+			if n, _ := res.RowsAffected(); n == 0 {
+				return sql.ErrNoRows
+			}
+		}
+	}
+	if isUniqueViolation(err) {
+		return ErrDuplicateCode
+	}
+	return err
+}
+
+// Hours returns a location's weekly booking hours for kind, by weekday.
+func (s *Store) Hours(locationID int64, kind Kind) ([]Hours, error) {
+	rows, err := s.db.Query(
+		`SELECT weekday, to_char(opens_at, 'HH24:MI'), to_char(closes_at, 'HH24:MI'), slot_minutes, capacity
+		 FROM booking_hours WHERE location_id = $1 AND kind = $2 ORDER BY weekday`,
+		locationID, kind,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Hours{}
+	for rows.Next() {
+		var h Hours
+		if err := rows.Scan(&h.Weekday, &h.OpensAt, &h.ClosesAt, &h.SlotMinutes, &h.Capacity); err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// SetHours replaces a location's weekly booking hours for kind; weekdays left out take no bookings.
+// Existing bookings are kept. It returns sql.ErrNoRows for an unknown location.
+func (s *Store) SetHours(locationID int64, kind Kind, hours []Hours) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the location so concurrent edits of its hours apply one after the other
+	if err := tx.QueryRow("SELECT id FROM locations WHERE id = $1 FOR UPDATE", locationID).Scan(&locationID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM booking_hours WHERE location_id = $1 AND kind = $2", locationID, kind); err != nil {
+		return err
+	}
+	for _, h := range hours {
+		_, err := tx.Exec(
+			`INSERT INTO booking_hours (location_id, kind, weekday, opens_at, closes_at, slot_minutes, capacity)
+			 VALUES ($1, $2, $3, $4::time, $5::time, $6, $7)`,
+			locationID, kind, h.Weekday, h.OpensAt, h.ClosesAt, h.SlotMinutes, h.Capacity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Closures returns a location's closures from the given date (YYYY-MM-DD) on.
+func (s *Store) Closures(locationID int64, from string) ([]Closure, error) {
+	rows, err := s.db.Query(
+		`SELECT id, location_id, date::text, reason, created_at FROM booking_closures
+		 WHERE location_id = $1 AND date >= $2::date ORDER BY date`,
+		locationID, from,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Closure{}
+	for rows.Next() {
+		var c Closure
+		if err := rows.Scan(&c.ID, &c.LocationID, &c.Date, &c.Reason, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// AddClosure closes a location for bookings on a date. Bookings already made for that day are kept.
+// It returns ErrClosed if the location is already closed then and sql.ErrNoRows for an unknown location.
+func (s *Store) AddClosure(locationID int64, date string, reason *string) (*Closure, error) {
+	var c Closure
+	err := s.db.QueryRow(
+		`INSERT INTO booking_closures (location_id, date, reason) VALUES ($1, $2::date, $3)
+		 RETURNING id, location_id, date::text, reason, created_at`,
+		locationID, date, reason,
+	).Scan(&c.ID, &c.LocationID, &c.Date, &c.Reason, &c.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrClosed
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteClosure reopens the day. It returns sql.ErrNoRows for an unknown closure.
+func (s *Store) DeleteClosure(id int64) error {
+	res, err := s.db.Exec("DELETE FROM booking_closures WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package bookings
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/mailer"
+)
+
+// When formats the booking's start for customer emails, e.g. "Sat 14 Mar 2026 at 10:30".
+func (b *Booking) When() string {
+	return b.StartsAt.In(Zone).Format("Mon 2 Jan 2006 at 15:04")
+}
+
+// reminderLockKey is the advisory lock that lets one instance at a time run the reminder check
+const reminderLockKey = 4202
+
+// lockReminders waits for the reminder check lock and returns the transaction holding it. Ending the
+// transaction releases the lock.
+func (s *Store) lockReminders() (*sql.Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", reminderLockKey); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Reminder periodically cancels bookings whose payment hold has run out and emails customers about
+// confirmed bookings starting within the lead time. A failed email is retried on the next check. Instances
+// take turns, so a customer is never reminded twice.
+type Reminder struct {
+	store  *Store
+	mailer mailer.Mailer
+	logger *zap.Logger
+	lead   time.Duration
+}
+
+func NewReminder(store *Store, m mailer.Mailer, logger *zap.Logger, lead time.Duration) *Reminder {
+	return &Reminder{store: store, mailer: m, logger: logger, lead: lead}
+}
+
+// Run checks immediately and then every interval until ctx is cancelled.
+func (r *Reminder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Check(ctx); err != nil {
+			r.logger.Error("Booking reminder check failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a single pass.
+func (r *Reminder) Check(ctx context.Context) error {
+	// Held until the reminders are marked sent, so another instance cannot pick them up meanwhile
+	lock, err := r.store.lockReminders()
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	expired, err := r.store.ExpireUnpaid()
+	if err != nil {
+		return fmt.Errorf("expire unpaid bookings: %w", err)
+	}
+	if expired > 0 {
+		r.logger.Info("Unpaid bookings cancelled", zap.Int64("count", expired))
+	}
+
+	due, err := r.store.DueReminders(r.lead)
+	if err != nil {
+		return fmt.Errorf("load due reminders: %w", err)
+	}
+	for _, b := range due {
+		msg := mailer.Message{
+			To:      b.CustomerEmail,
+			Subject: fmt.Sprintf("Reminder: your Finspeed %s on %s", b.ServiceName, b.When()),
+			Body: fmt.Sprintf("This is a reminder of your booking #%d for %s at %s on %s.\n\n"+
+				"If you can no longer make it, please cancel the booking from your account.\n",
+				b.ID, b.ServiceName, b.LocationName, b.When()),
+		}
+		if err := r.mailer.Send(ctx, msg); err != nil {
+			r.logger.Error("Failed to send booking reminder", zap.Error(err), zap.Int64("booking_id", b.ID))
+			continue
+		}
+		if err := r.store.MarkReminded(b.ID); err != nil {
+			return err
+		}
+	}
+	if len(due) > 0 {
+		r.logger.Info("Booking reminders processed", zap.Int("bookings", len(due)))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package bookings
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Slot is a time a service type can start at. Available is how many more bookings it takes.
+type Slot struct {
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Available int       `json:"available"`
+}
+
+// querier is the database or a transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// activeBooking matches bookings that take up their slot: all but cancelled ones and those whose payment
+// hold has run out. $1 is the hold in seconds.
+const activeBooking = `b.status <> 'cancelled'
+	AND (b.status <> 'pending_payment' OR b.created_at > NOW() - make_interval(secs => $1))`
+
+// Slots returns the times a service type can be booked at a location on a day, with how many bookings
+// each still takes. Closed days and days past MaxAdvance have none, and slots that have started are left
+// out. It returns ErrNoHours if the location takes no bookings of the service type's kind.
+func (s *Store) Slots(serviceTypeID, locationID int64, day time.Time) ([]Slot, error) {
+	t, err := s.ServiceType(serviceTypeID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.IsActive {
+		return nil, ErrInactive
+	}
+	day = startOfDay(day)
+	if day.After(time.Now().Add(MaxAdvance)) {
+		return []Slot{}, nil
+	}
+
+	h, err := s.dayHours(s.db, locationID, t.Kind, day, false)
+	if errors.Is(err, ErrClosed) {
+		return []Slot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.daySlots(s.db, t, locationID, day, h)
+	if err != nil {
+		return nil, err
+	}
+	slots := []Slot{}
+	now := time.Now()
+	for _, slot := range all {
+		if slot.StartsAt.After(now) {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// dayHours returns the location's booking hours for kind on day. It returns ErrNoHours if the location
+// is inactive or takes no bookings of kind, and ErrClosed if it takes none that day. With lock the hours
+// are locked so that bookings for the day are made one after the other.
+func (s *Store) dayHours(q querier, locationID int64, kind Kind, day time.Time, lock bool) (*Hours, error) {
+	query := `SELECT h.weekday, to_char(h.opens_at, 'HH24:MI'), to_char(h.closes_at, 'HH24:MI'), h.slot_minutes, h.capacity
+		 FROM booking_hours h JOIN locations l ON l.id = h.location_id
+		 WHERE h.location_id = $1 AND h.kind = $2 AND h.weekday = $3 AND l.is_active`
+	if lock {
+		query += " FOR UPDATE OF h"
+	}
+	var h Hours
+	err := q.QueryRow(query, locationID, kind, int(day.Weekday())).
+		Scan(&h.Weekday, &h.OpensAt, &h.ClosesAt, &h.SlotMinutes, &h.Capacity)
+	if errors.Is(err, sql.ErrNoRows) {
+		var open bool
+		err := q.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM booking_hours h JOIN locations l ON l.id = h.location_id
+			                WHERE h.location_id = $1 AND h.kind = $2 AND l.is_active)`,
+			locationID, kind,
+		).Scan(&open)
+		if err != nil {
+			return nil, err
+		}
+		if !open {
+			return nil, ErrNoHours
+		}
+		return nil, ErrClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var closed bool
+	err = q.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM booking_closures WHERE location_id = $1 AND date = $2::date)",
+		locationID, day.Format("2006-01-02"),
+	).Scan(&closed)
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, ErrClosed
+	}
+	return &h, nil
+}
+
+// daySlots lays out the day's slots for service type t. A booking covers as many slots as its duration
+// needs and must end by closing time; a slot is available to the extent the busiest slot it covers is.
+func (s *Store) daySlots(q querier, t *ServiceType, locationID int64, day time.Time, h *Hours) ([]Slot, error) {
+	opens, err := clock(day, h.OpensAt)
+	if err != nil {
+		return nil, err
+	}
+	closes, err := clock(day, h.ClosesAt)
+	if err != nil {
+		return nil, err
+	}
+	step := time.Duration(h.SlotMinutes) * time.Minute
+	duration := time.Duration(t.DurationMinutes) * time.Minute
+
+	var starts []time.Time
+	for at := opens; at.Before(closes); at = at.Add(step) {
+		starts = append(starts, at)
+	}
+	used := make([]int, len(starts))
+
+	rows, err := q.Query(
+		`SELECT b.starts_at, b.ends_at FROM bookings b JOIN service_types t ON t.id = b.service_type_id
+		 WHERE b.location_id = $2 AND t.kind = $3 AND b.starts_at < $5 AND b.ends_at > $4 AND `+activeBooking,
+		s.holdFor.Seconds(), locationID, t.Kind, opens, closes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var from, to time.Time
+		if err := rows.Scan(&from, &to); err != nil {
+			return nil, err
+		}
+		for i, at := range starts {
+			if from.Before(at.Add(step)) && to.After(at) {
+				used[i]++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	need := int((duration + step - 1) / step)
+	var slots []Slot
+	for i, at := range starts {
+		if at.Add(duration).After(closes) {
+			break
+		}
+		busiest := 0
+		for _, n := range used[i : i+need] {
+			if n > busiest {
+				busiest = n
+			}
+		}
+		available := h.Capacity - busiest
+		if available < 0 {
+			available = 0
+		}
+		slots = append(slots, Slot{StartsAt: at, EndsAt: at.Add(duration), Available: available})
+	}
+	return slots, nil
+}
+
+// startOfDay returns midnight in Zone of the day t falls on there
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(Zone).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, Zone)
+}
+
+// clock returns the time of day hhmm (HH:MM) on day
+func clock(day time.Time, hhmm string) (time.Time, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute), nil
+}
@@ -0,0 +1,386 @@
+package bookings
+
+import (
+	"time"
+)
+
+// Booking is a customer's booking of a service type at a location. PayBy is when an unpaid booking that
+// needs prepayment stops holding its slot, and RazorpayOrder is the Razorpay order created to pay for it.
+type Booking struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"user_id"`
+	CustomerName   *string    `json:"customer_name,omitempty"`
+	CustomerEmail  string     `json:"customer_email"`
+	ServiceTypeID  int64      `json:"service_type_id"`
+	ServiceName    string     `json:"service_name"`
+	Kind           Kind       `json:"kind"`
+	Prepayment     Prepayment `json:"prepayment"`
+	LocationID     int64      `json:"location_id"`
+	LocationName   string     `json:"location_name"`
+	ProductID      *int64     `json:"product_id,omitempty"`
+	ProductTitle   *string    `json:"product_title,omitempty"`
+	StartsAt       time.Time  `json:"starts_at"`
+	EndsAt         time.Time  `json:"ends_at"`
+	Status         Status     `json:"status"`
+	Price          float64    `json:"price"`
+	Notes          *string    `json:"notes,omitempty"`
+	PaymentID      *string    `json:"payment_id,omitempty"`
+	PaidAt         *string    `json:"paid_at,omitempty"`
+	PayBy          *time.Time `json:"pay_by,omitempty"`
+	RazorpayOrder  *string    `json:"razorpay_order_id,omitempty"`
+	RefundRef      *string    `json:"refund_ref,omitempty"`
+	RefundedAt     *string    `json:"refunded_at,omitempty"`
+	CancelReason   *string    `json:"cancel_reason,omitempty"`
+	CancelledAt    *string    `json:"cancelled_at,omitempty"`
+	ReminderSentAt *string    `json:"reminder_sent_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *string    `json:"updated_at,omitempty"`
+}
+
+// NewBooking is a customer's request to book a service type. StartsAt must be the start of an available slot.
+type NewBooking struct {
+	UserID        int64
+	ServiceTypeID int64
+	LocationID    int64
+	ProductID     *int64
+	StartsAt      time.Time
+	Notes         *string
+}
+
+const bookingSelect = `
+	SELECT b.id, b.user_id, u.name, u.email, b.service_type_id, t.name, t.kind, t.prepayment, b.location_id, l.name,
+	       b.product_id, p.title, b.starts_at, b.ends_at, b.status, b.price, b.notes, b.payment_id, b.paid_at,
+	       b.razorpay_order_id, b.refund_ref, b.refunded_at, b.cancel_reason, b.cancelled_at, b.reminder_sent_at,
+	       b.created_at, b.updated_at
+	FROM bookings b
+	JOIN users u ON u.id = b.user_id
+	JOIN service_types t ON t.id = b.service_type_id
+	JOIN locations l ON l.id = b.location_id
+	LEFT JOIN products p ON p.id = b.product_id`
+
+func (s *Store) scanBooking(row interface{ Scan(...interface{}) error }) (*Booking, error) {
+	var b Booking
+	err := row.Scan(&b.ID, &b.UserID, &b.CustomerName, &b.CustomerEmail, &b.ServiceTypeID, &b.ServiceName, &b.Kind,
+		&b.Prepayment, &b.LocationID, &b.LocationName, &b.ProductID, &b.ProductTitle, &b.StartsAt, &b.EndsAt,
+		&b.Status, &b.Price, &b.Notes, &b.PaymentID, &b.PaidAt, &b.RazorpayOrder, &b.RefundRef, &b.RefundedAt,
+		&b.CancelReason, &b.CancelledAt, &b.ReminderSentAt, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	b.StartsAt = b.StartsAt.In(Zone)
+	b.EndsAt = b.EndsAt.In(Zone)
+	b.CreatedAt = b.CreatedAt.In(Zone)
+	if b.Status == StatusPendingPayment {
+		payBy := b.CreatedAt.Add(s.holdFor)
+		b.PayBy = &payBy
+	}
+	return &b, nil
+}
+
+func (s *Store) queryBookings(query string, args ...interface{}) ([]Booking, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Booking{}
+	for rows.Next() {
+		b, err := s.scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *b)
+	}
+	return list, rows.Err()
+}
+
+// Booking returns a booking, limited to the customer's own when userID is non-zero. It returns
+// sql.ErrNoRows for an unknown booking.
+func (s *Store) Booking(id, userID int64) (*Booking, error) {
+	return s.scanBooking(s.db.QueryRow(
+		bookingSelect+" WHERE b.id = $1 AND ($2::bigint = 0 OR b.user_id = $2)",
+		id, userID,
+	))
+}
+
+// Bookings returns a page of a customer's bookings, latest start first, with the total count.
+func (s *Store) Bookings(userID int64, limit, offset int) ([]Booking, int, error) {
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM bookings WHERE user_id = $1", userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	list, err := s.queryBookings(
+		bookingSelect+" WHERE b.user_id = $1 ORDER BY b.starts_at DESC, b.id DESC LIMIT $2 OFFSET $3",
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// Calendar returns the bookings starting in [from, to) by start time. A zero locationID or an empty kind
+// or status matches all.
+func (s *Store) Calendar(from, to time.Time, locationID int64, kind Kind, status Status) ([]Booking, error) {
+	return s.queryBookings(
+		bookingSelect+`
+		 WHERE b.starts_at >= $1 AND b.starts_at < $2
+		   AND ($3::bigint = 0 OR b.location_id = $3)
+		   AND ($4 = '' OR t.kind = $4)
+		   AND ($5 = '' OR b.status = $5)
+		 ORDER BY b.starts_at, b.location_id, b.id`,
+		from, to, locationID, string(kind), string(status),
+	)
+}
+
+// Create books a slot. The booking waits for payment when its service type requires prepayment and is
+// confirmed otherwise; either way it keeps the service type's price at the time.
+func (s *Store) Create(n NewBooking) (*Booking, error) {
+	start := n.StartsAt.In(Zone)
+	if !start.After(time.Now()) {
+		return nil, ErrInvalidSlot
+	}
+	if start.After(time.Now().Add(MaxAdvance)) {
+		return nil, ErrTooFarAhead
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := scanServiceType(tx.QueryRow("SELECT "+serviceTypeColumns+" FROM service_types WHERE id = $1", n.ServiceTypeID))
+	if err != nil {
+		return nil, err
+	}
+	if !t.IsActive {
+		return nil, ErrInactive
+	}
+	if n.ProductID != nil {
+		var exists bool
+		err := tx.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM products WHERE id = $1 AND status <> 'draft')", *n.ProductID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrUnknownProduct
+		}
+	}
+
+	day := startOfDay(start)
+	h, err := s.dayHours(tx, n.LocationID, t.Kind, day, true)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := s.daySlots(tx, t, n.LocationID, day, h)
+	if err != nil {
+		return nil, err
+	}
+	var slot *Slot
+	for i := range slots {
+		if slots[i].StartsAt.Equal(start) {
+			slot = &slots[i]
+			break
+		}
+	}
+	if slot == nil {
+		return nil, ErrInvalidSlot
+	}
+	if slot.Available == 0 {
+		return nil, ErrSlotFull
+	}
+
+	status := StatusConfirmed
+	if t.Prepayment == PrepaymentRequired {
+		status = StatusPendingPayment
+	}
+	var id int64
+	err = tx.QueryRow(
+		`INSERT INTO bookings (user_id, service_type_id, location_id, product_id, starts_at, ends_at, status, price, notes)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		n.UserID, t.ID, n.LocationID, n.ProductID, slot.StartsAt, slot.EndsAt, status, t.Price, n.Notes,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Booking(id, 0)
+}
+
+// Cancel cancels a booking that is waiting for payment or confirmed. A non-zero userID limits it to that
+// customer's bookings and refuses confirmed bookings starting within cutoff. A paid booking is refunded in
+// full through refund, which returns the refund reference; if it fails the booking is left as it was.
+func (s *Store) Cancel(id, userID int64, cutoff time.Duration, reason *string,
+	refund func(paymentID string, amount float64) (string, error)) (*Booking, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status Status
+	var startsAt time.Time
+	var price float64
+	var paymentID, refundRef *string
+	err = tx.QueryRow(
+		`SELECT status, starts_at, price, payment_id, refund_ref FROM bookings
+		 WHERE id = $1 AND ($2::bigint = 0 OR user_id = $2) FOR UPDATE`,
+		id, userID,
+	).Scan(&status, &startsAt, &price, &paymentID, &refundRef)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusPendingPayment && status != StatusConfirmed {
+		return nil, ErrWrongStatus
+	}
+	if userID != 0 && status == StatusConfirmed && time.Until(startsAt) < cutoff {
+		return nil, ErrTooLate
+	}
+
+	if paymentID != nil && refundRef == nil && price > 0 {
+		ref, err := refund(*paymentID, price)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE bookings SET refund_ref = $2, refunded_at = NOW() WHERE id = $1", id, ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.Exec(
+		`UPDATE bookings SET status = 'cancelled', cancel_reason = $2, cancelled_at = NOW(), updated_at = NOW()
+		 WHERE id = $1`,
+		id, reason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Booking(id, 0)
+}
+
+// Complete marks a confirmed booking as done.
+func (s *Store) Complete(id int64) (*Booking, error) {
+	return s.finish(id, StatusCompleted, false)
+}
+
+// NoShow marks a confirmed booking whose customer did not turn up. It returns ErrNotStarted before the
+// booking's start.
+func (s *Store) NoShow(id int64) (*Booking, error) {
+	return s.finish(id, StatusNoShow, true)
+}
+
+func (s *Store) finish(id int64, status Status, mustHaveStarted bool) (*Booking, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current Status
+	var startsAt time.Time
+	err = tx.QueryRow("SELECT status, starts_at FROM bookings WHERE id = $1 FOR UPDATE", id).Scan(&current, &startsAt)
+	if err != nil {
+		return nil, err
+	}
+	if current != StatusConfirmed {
+		return nil, ErrWrongStatus
+	}
+	if mustHaveStarted && startsAt.After(time.Now()) {
+		return nil, ErrNotStarted
+	}
+	if _, err := tx.Exec("UPDATE bookings SET status = $2, updated_at = NOW() WHERE id = $1", id, status); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.Booking(id, 0)
+}
+
+// Payable returns a customer's booking if it can be paid for now: it is unpaid, has a price, offers
+// prepayment and has not started, and if it is waiting for payment its hold has not run out. Otherwise it
+// returns ErrNotPayable, or sql.ErrNoRows for another customer's booking.
+func (s *Store) Payable(id, userID int64) (*Booking, error) {
+	b, err := s.Booking(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b.PaymentID != nil, b.Price <= 0, b.Prepayment == PrepaymentNone, !b.StartsAt.After(time.Now()):
+		return nil, ErrNotPayable
+	case b.Status == StatusPendingPayment:
+		if b.PayBy.Before(time.Now()) {
+			return nil, ErrNotPayable
+		}
+	case b.Status != StatusConfirmed:
+		return nil, ErrNotPayable
+	}
+	return b, nil
+}
+
+// SetRazorpayOrder records the Razorpay order created to pay for a booking.
+func (s *Store) SetRazorpayOrder(id int64, razorpayOrderID string) error {
+	_, err := s.db.Exec("UPDATE bookings SET razorpay_order_id = $2, updated_at = NOW() WHERE id = $1", id, razorpayOrderID)
+	return err
+}
+
+// MarkPaid records a captured payment for a booking, confirming it if it was waiting for payment. The
+// payment must be for the booking's Razorpay order. It reports false when the booking was already paid, is
+// no longer active, has outlived its payment hold or was paid through another order; the caller decides
+// what to do with the money. It returns ErrPaymentTaken if the payment already paid for another booking.
+func (s *Store) MarkPaid(id int64, paymentID, razorpayOrderID string) (bool, error) {
+	// Once the hold runs out the slot is free for others, even before ExpireUnpaid cancels the booking
+	result, err := s.db.Exec(
+		`UPDATE bookings SET status = 'confirmed', payment_id = $2, paid_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND payment_id IS NULL AND status IN ('pending_payment', 'confirmed') AND razorpay_order_id = $3
+		   AND (status <> 'pending_payment' OR created_at > NOW() - make_interval(secs => $4))`,
+		id, paymentID, razorpayOrderID, s.holdFor.Seconds(),
+	)
+	if isUniqueViolation(err) {
+		return false, ErrPaymentTaken
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ExpireUnpaid cancels bookings whose payment hold has run out and returns how many it cancelled.
+func (s *Store) ExpireUnpaid() (int64, error) {
+	result, err := s.db.Exec(
+		`UPDATE bookings SET status = 'cancelled', cancel_reason = 'Payment not received',
+		        cancelled_at = NOW(), updated_at = NOW()
+		 WHERE status = 'pending_payment' AND created_at <= NOW() - make_interval(secs => $1)`,
+		s.holdFor.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DueReminders returns confirmed bookings starting within lead that have not been reminded of.
+func (s *Store) DueReminders(lead time.Duration) ([]Booking, error) {
+	return s.queryBookings(
+		bookingSelect+`
+		 WHERE b.status = 'confirmed' AND b.reminder_sent_at IS NULL
+		   AND b.starts_at > NOW() AND b.starts_at <= NOW() + make_interval(secs => $1)
+		 ORDER BY b.starts_at`,
+		lead.Seconds(),
+	)
+}
+
+// MarkReminded records that a booking's reminder was sent.
+func (s *Store) MarkReminded(id int64) error {
+	_, err := s.db.Exec("UPDATE bookings SET reminder_sent_at = NOW() WHERE id = $1", id)
+	return err
+}
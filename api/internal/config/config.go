@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,7 +16,57 @@ type Config struct {
 	Environment    string
 	LogLevel       string
 	MigrationsPath string
-	JWTSecret      string
+	// JWT signing
+	JWTKeysDir   string // directory of <kid>.pem keys
+	JWTActiveKID string // kid used to sign new tokens; defaults to the last key by name
+	JWTIssuer    string
+	JWTAudience  string
+	JWTSecret    string // legacy HS256 secret, accepted for verification only during migration
+	// Sessions
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Account emails
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	MailBackend          string // log|smtp
+	MailFrom             string
+	SMTPHost             string
+	SMTPPort             int
+	SMTPUsername         string
+	SMTPPassword         string
+	// Login throttling
+	RateLimitStore         string // memory|postgres
+	AuthRateLimitPerIP     int
+	LoginRateLimitPerEmail int
+	RateLimitWindow        time.Duration
+	LoginLockoutThreshold  int
+	LoginLockoutDuration   time.Duration
+	APIKeyRateLimit        int // default requests per minute for API keys without their own limit
+	// Staff notifications
+	AdminNotifyEmails     []string // recipients of operational notifications such as low-stock reports
+	AdminNotifyWebhookURL string   // optional Slack-style incoming webhook
+	LowStockCheckInterval time.Duration
+	// Courier aggregator
+	CourierProvider      string // none|fake|shiprocket
+	CourierWebhookSecret string // token the provider sends with tracking webhooks
+	ShiprocketBaseURL    string
+	ShiprocketEmail      string // API user created in the Shiprocket dashboard
+	ShiprocketPassword   string
+	// Returns
+	ReturnWindow time.Duration // how long after delivery customers can request a return; 0 means no limit
+	// Bookings
+	BookingCancelCutoff     time.Duration // customers cannot cancel confirmed bookings starting sooner than this
+	BookingPaymentWindow    time.Duration // how long a booking that needs prepayment holds its slot unpaid
+	BookingReminderLead     time.Duration // how long before the start customers are reminded
+	BookingReminderInterval time.Duration
+	// Two-factor authentication
+	TwoFactorRequiredForStaff bool // staff roles must enrol TOTP before getting a session
+	TwoFactorIssuer           string
+	TwoFactorChallengeTTL     time.Duration
+	// OpenID Connect login
+	OIDCProviders   []OIDCProvider
+	OIDCRedirectURL string // where providers send the browser back; the frontend posts code and state to the API
+	OIDCStateTTL    time.Duration
 	// Payments / Frontend
 	RazorpayKeyID        string
 	RazorpayKeySecret    string
@@ -26,6 +78,16 @@ type Config struct {
 	GCSBaseURL      string // optional, e.g., https://cdn.example.com
 }
 
+// OIDCProvider configures an OpenID Connect identity provider, read from OIDC_<NAME>_* variables.
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
 func Load() (*Config, error) {
 	// Load .env.local file if it exists
 	if err := godotenv.Load(".env.local"); err != nil {
@@ -39,7 +101,31 @@ func Load() (*Config, error) {
 		Environment:    getEnvWithDefault("ENVIRONMENT", "development"),
 		LogLevel:       getEnvWithDefault("LOG_LEVEL", "info"),
 		MigrationsPath: getEnvWithDefault("MIGRATIONS_PATH", "file:///app/db/migrations"),
-		JWTSecret:      getEnvWithDefault("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
+		JWTKeysDir:     getEnvWithDefault("JWT_KEYS_DIR", ""),
+		JWTActiveKID:   getEnvWithDefault("JWT_ACTIVE_KID", ""),
+		JWTIssuer:      getEnvWithDefault("JWT_ISSUER", "finspeed-api"),
+		JWTAudience:    getEnvWithDefault("JWT_AUDIENCE", "finspeed"),
+		JWTSecret:      getEnvWithDefault("JWT_SECRET", ""),
+		AccessTokenTTL:  getEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		PasswordResetTTL:     getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL: getEnvAsDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		MailBackend:          getEnvWithDefault("MAIL_BACKEND", "log"),
+		MailFrom:             getEnvWithDefault("MAIL_FROM", "Finspeed <no-reply@finspeed.online>"),
+		SMTPHost:             getEnvWithDefault("SMTP_HOST", ""),
+		SMTPPort:             getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:         getEnvWithDefault("SMTP_USERNAME", ""),
+		SMTPPassword:         getEnvWithDefault("SMTP_PASSWORD", ""),
+		RateLimitStore:         getEnvWithDefault("RATE_LIMIT_STORE", "memory"),
+		AuthRateLimitPerIP:     getEnvAsInt("AUTH_RATE_LIMIT_PER_IP", 30),
+		LoginRateLimitPerEmail: getEnvAsInt("LOGIN_RATE_LIMIT_PER_EMAIL", 10),
+		RateLimitWindow:        getEnvAsDuration("RATE_LIMIT_WINDOW", 15*time.Minute),
+		LoginLockoutThreshold:  getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		LoginLockoutDuration:   getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		APIKeyRateLimit:        getEnvAsInt("API_KEY_RATE_LIMIT", 120),
+		TwoFactorRequiredForStaff: getEnvAsBool("TWO_FACTOR_REQUIRED_FOR_STAFF", false),
+		TwoFactorIssuer:           getEnvWithDefault("TWO_FACTOR_ISSUER", "Finspeed"),
+		TwoFactorChallengeTTL:     getEnvAsDuration("TWO_FACTOR_CHALLENGE_TTL", 10*time.Minute),
 		RazorpayKeyID:        getEnvWithDefault("RAZORPAY_KEY_ID", ""),
 		RazorpayKeySecret:    getEnvWithDefault("RAZORPAY_KEY_SECRET", ""),
 		RazorpayWebhookSecret: getEnvWithDefault("RAZORPAY_WEBHOOK_SECRET", ""),
@@ -49,6 +135,23 @@ func Load() (*Config, error) {
 		GCSBaseURL:          getEnvWithDefault("GCS_BASE_URL", ""),
 	}
 
+	config.OIDCRedirectURL = getEnvWithDefault("OIDC_REDIRECT_URL", strings.TrimSuffix(config.FrontendBaseURL, "/")+"/auth/oidc/callback")
+	config.OIDCStateTTL = getEnvAsDuration("OIDC_STATE_TTL", 10*time.Minute)
+	config.OIDCProviders = loadOIDCProviders(getEnvWithDefault("OIDC_PROVIDERS", ""))
+	config.AdminNotifyEmails = strings.Fields(strings.ReplaceAll(getEnvWithDefault("ADMIN_NOTIFY_EMAILS", ""), ",", " "))
+	config.AdminNotifyWebhookURL = getEnvWithDefault("ADMIN_NOTIFY_WEBHOOK_URL", "")
+	config.LowStockCheckInterval = getEnvAsDuration("LOW_STOCK_CHECK_INTERVAL", time.Hour)
+	config.CourierProvider = getEnvWithDefault("COURIER_PROVIDER", "none")
+	config.CourierWebhookSecret = getEnvWithDefault("COURIER_WEBHOOK_SECRET", "")
+	config.ShiprocketBaseURL = getEnvWithDefault("SHIPROCKET_BASE_URL", "https://apiv2.shiprocket.in")
+	config.ShiprocketEmail = getEnvWithDefault("SHIPROCKET_EMAIL", "")
+	config.ShiprocketPassword = getEnvWithDefault("SHIPROCKET_PASSWORD", "")
+	config.ReturnWindow = getEnvAsDuration("RETURN_WINDOW", 30*24*time.Hour)
+	config.BookingCancelCutoff = getEnvAsDuration("BOOKING_CANCEL_CUTOFF", 2*time.Hour)
+	config.BookingPaymentWindow = getEnvAsDuration("BOOKING_PAYMENT_WINDOW", 30*time.Minute)
+	config.BookingReminderLead = getEnvAsDuration("BOOKING_REMINDER_LEAD", 24*time.Hour)
+	config.BookingReminderInterval = getEnvAsDuration("BOOKING_REMINDER_INTERVAL", 15*time.Minute)
+
 	if err := config.validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
@@ -63,6 +166,12 @@ func (c *Config) validate() error {
 	if c.Port == "" {
 		return fmt.Errorf("PORT is required")
 	}
+	if c.JWTKeysDir == "" && !c.IsDevelopment() {
+		return fmt.Errorf("JWT_KEYS_DIR is required outside development")
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		return fmt.Errorf("ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL must be positive durations")
+	}
 	// Validate storage backend
 	switch c.StorageBackend {
 	case "local":
@@ -74,6 +183,67 @@ func (c *Config) validate() error {
 	default:
 		return fmt.Errorf("invalid STORAGE_BACKEND: %s (expected 'local' or 'gcs')", c.StorageBackend)
 	}
+	// Validate rate limit store
+	switch c.RateLimitStore {
+	case "memory", "postgres":
+		// ok
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_STORE: %s (expected 'memory' or 'postgres')", c.RateLimitStore)
+	}
+	if c.TwoFactorChallengeTTL <= 0 {
+		return fmt.Errorf("TWO_FACTOR_CHALLENGE_TTL must be a positive duration")
+	}
+	for _, p := range c.OIDCProviders {
+		if p.DiscoveryURL == "" || p.ClientID == "" {
+			prefix := "OIDC_" + strings.ToUpper(p.Name)
+			return fmt.Errorf("%s_DISCOVERY_URL and %s_CLIENT_ID are required for OIDC provider %q", prefix, prefix, p.Name)
+		}
+	}
+	if c.APIKeyRateLimit < 1 {
+		return fmt.Errorf("API_KEY_RATE_LIMIT must be at least 1")
+	}
+	if c.LowStockCheckInterval < 0 {
+		return fmt.Errorf("LOW_STOCK_CHECK_INTERVAL cannot be negative")
+	}
+	if c.ReturnWindow < 0 {
+		return fmt.Errorf("RETURN_WINDOW cannot be negative")
+	}
+	if c.BookingCancelCutoff < 0 || c.BookingReminderLead < 0 || c.BookingReminderInterval < 0 {
+		return fmt.Errorf("BOOKING_CANCEL_CUTOFF, BOOKING_REMINDER_LEAD and BOOKING_REMINDER_INTERVAL cannot be negative")
+	}
+	if c.BookingPaymentWindow <= 0 {
+		return fmt.Errorf("BOOKING_PAYMENT_WINDOW must be a positive duration")
+	}
+	if c.LoginLockoutThreshold < 1 {
+		return fmt.Errorf("LOGIN_LOCKOUT_THRESHOLD must be at least 1")
+	}
+	// Validate mail backend
+	switch c.MailBackend {
+	case "log":
+		// ok
+	case "smtp":
+		if c.SMTPHost == "" {
+			return fmt.Errorf("SMTP_HOST is required when MAIL_BACKEND=smtp")
+		}
+	default:
+		return fmt.Errorf("invalid MAIL_BACKEND: %s (expected 'log' or 'smtp')", c.MailBackend)
+	}
+	// Validate courier provider
+	switch c.CourierProvider {
+	case "none":
+		// ok
+	case "fake":
+		// The fake accepts unsigned webhooks
+		if !c.IsDevelopment() {
+			return fmt.Errorf("COURIER_PROVIDER=fake is only allowed in development")
+		}
+	case "shiprocket":
+		if c.ShiprocketEmail == "" || c.ShiprocketPassword == "" || c.CourierWebhookSecret == "" {
+			return fmt.Errorf("SHIPROCKET_EMAIL, SHIPROCKET_PASSWORD and COURIER_WEBHOOK_SECRET are required when COURIER_PROVIDER=shiprocket")
+		}
+	default:
+		return fmt.Errorf("invalid COURIER_PROVIDER: %s (expected 'none', 'fake' or 'shiprocket')", c.CourierProvider)
+	}
 	return nil
 }
 
@@ -85,6 +255,31 @@ func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
 }
 
+// loadOIDCProviders reads OIDC_<NAME>_DISCOVERY_URL, _CLIENT_ID, _CLIENT_SECRET, _DISPLAY_NAME
+// and _SCOPES for each comma-separated name in OIDC_PROVIDERS
+func loadOIDCProviders(names string) []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := OIDCProvider{
+			Name:         name,
+			DisplayName:  getEnvWithDefault(prefix+"DISPLAY_NAME", name),
+			DiscoveryURL: getEnvWithDefault(prefix+"DISCOVERY_URL", ""),
+			ClientID:     getEnvWithDefault(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnvWithDefault(prefix+"CLIENT_SECRET", ""),
+		}
+		if scopes := getEnvWithDefault(prefix+"SCOPES", ""); scopes != "" {
+			p.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -101,3 +296,20 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,101 @@
+// Package courier books parcels with courier aggregators and reads their tracking updates.
+// Shipments are still created and tracked in the shipping package; a provider only takes
+// the paperwork off staff: it assigns an AWB number, produces the label and reports progress.
+package courier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Status is a tracking state reported by a courier, normalised across providers.
+type Status string
+
+const (
+	StatusPickedUp       Status = "picked_up"
+	StatusInTransit      Status = "in_transit"
+	StatusOutForDelivery Status = "out_for_delivery"
+	StatusDelivered      Status = "delivered"
+	StatusUndelivered    Status = "undelivered" // delivery attempt failed; the courier retries
+	StatusReturning      Status = "rto"         // return to origin, after repeated failed attempts
+	StatusCancelled      Status = "cancelled"
+)
+
+var (
+	ErrUnauthorized = errors.New("webhook request is not signed by the courier")
+	ErrRejected     = errors.New("courier rejected the request")
+)
+
+// Address is a delivery address and the person receiving the parcel.
+type Address struct {
+	Name     string
+	Phone    string
+	Email    string
+	Address1 string
+	Address2 string
+	City     string
+	State    string
+	Pincode  string
+	Country  string
+}
+
+type Item struct {
+	Name  string
+	SKU   string
+	Qty   int
+	Price float64
+}
+
+// Parcel is the packed size, which couriers price on.
+type Parcel struct {
+	WeightKG  float64
+	LengthCM  float64
+	BreadthCM float64
+	HeightCM  float64
+}
+
+// Request books one shipment. Reference must be unique per shipment; Pickup names the pickup
+// location registered with the provider.
+type Request struct {
+	Reference string
+	OrderedAt time.Time
+	Pickup    string
+	Customer  Address
+	Items     []Item
+	SubTotal  float64
+	Parcel    Parcel
+}
+
+// Booking is the provider's record of a booked shipment.
+type Booking struct {
+	Ref         string // the provider's shipment ID
+	Courier     string
+	AWBNumber   string
+	TrackingURL string
+}
+
+// Event is a tracking update for the parcel with the given AWB number.
+type Event struct {
+	AWBNumber   string
+	Status      Status
+	Description string
+	Location    string
+	OccurredAt  time.Time
+}
+
+// Provider is a courier aggregator. Implementations must be safe for concurrent use.
+type Provider interface {
+	// Name identifies the provider on stored bookings.
+	Name() string
+	// Book creates the shipment with the provider and assigns it a courier and AWB number.
+	Book(ctx context.Context, req Request) (*Booking, error)
+	// Label returns the shipping label as a PDF.
+	Label(ctx context.Context, b Booking) ([]byte, error)
+	// Cancel cancels a booking before pickup.
+	Cancel(ctx context.Context, b Booking) error
+	// ParseWebhook authenticates a tracking webhook and returns the updates it carries. Updates in
+	// states the provider does not map to a Status are left out.
+	ParseWebhook(header http.Header, body []byte) ([]Event, error)
+}
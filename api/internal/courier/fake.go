@@ -0,0 +1,89 @@
+package courier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Fake books shipments in memory, for local development without a courier account. Tracking updates
+// are simulated by posting {"awb", "status", "description", "location"} to the webhook; status is one
+// of the Status values.
+type Fake struct {
+	mu       sync.Mutex
+	next     int
+	bookings map[string]Booking
+}
+
+func NewFake() *Fake {
+	return &Fake{bookings: map[string]Booking{}}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Book(ctx context.Context, req Request) (*Booking, error) {
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrRejected)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next++
+	// The AWB number includes the time so bookings stay unique across restarts
+	b := Booking{
+		Ref:       fmt.Sprintf("FAKE-%d", f.next),
+		Courier:   "Fake Express",
+		AWBNumber: fmt.Sprintf("FX%d%03d", time.Now().Unix(), f.next%1000),
+	}
+	f.bookings[b.Ref] = b
+	return &b, nil
+}
+
+// fakeLabel is a one-page PDF saying "Fake label"; the viewer does not need exact offsets to open it
+const fakeLabel = "%PDF-1.4\n" +
+	"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+	"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+	"3 0 obj << /Type /Page /Parent 2 0 R /MediaBox [0 0 288 432] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >> endobj\n" +
+	"4 0 obj << /Length 41 >> stream\nBT /F1 18 Tf 36 380 Td (Fake label) Tj ET\nendstream endobj\n" +
+	"5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n" +
+	"trailer << /Root 1 0 R >>\n%%EOF\n"
+
+func (f *Fake) Label(ctx context.Context, b Booking) ([]byte, error) {
+	return []byte(fakeLabel), nil
+}
+
+func (f *Fake) Cancel(ctx context.Context, b Booking) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.bookings, b.Ref)
+	return nil
+}
+
+// ParseWebhook accepts unsigned updates; the fake is refused outside development
+func (f *Fake) ParseWebhook(header http.Header, body []byte) ([]Event, error) {
+	var payload struct {
+		AWB         string `json:"awb"`
+		Status      Status `json:"status"`
+		Description string `json:"description"`
+		Location    string `json:"location"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	switch payload.Status {
+	case StatusPickedUp, StatusInTransit, StatusOutForDelivery, StatusDelivered, StatusUndelivered, StatusReturning, StatusCancelled:
+	default:
+		return nil, nil
+	}
+	return []Event{{
+		AWBNumber:   payload.AWB,
+		Status:      payload.Status,
+		Description: payload.Description,
+		Location:    payload.Location,
+		OccurredAt:  time.Now(),
+	}}, nil
+}
@@ -0,0 +1,296 @@
+package courier
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Shiprocket tokens last ten days; renew a day early
+	shiprocketTokenTTL = 9 * 24 * time.Hour
+	// maxLabelSize bounds the label PDF downloaded from the provider
+	maxLabelSize = 10 << 20
+)
+
+// Shiprocket books shipments through the Shiprocket API. Pickup locations must be registered in the
+// Shiprocket dashboard under the same names that are passed as Request.Pickup.
+type Shiprocket struct {
+	baseURL       string
+	email         string
+	password      string
+	webhookSecret string
+	client        *http.Client
+
+	mu       sync.Mutex
+	token    string
+	tokenExp time.Time
+}
+
+// NewShiprocket creates the provider. webhookSecret is the token Shiprocket sends in the x-api-key
+// header of tracking webhooks.
+func NewShiprocket(baseURL, email, password, webhookSecret string) *Shiprocket {
+	return &Shiprocket{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		email:         email,
+		password:      password,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *Shiprocket) Name() string {
+	return "shiprocket"
+}
+
+func (s *Shiprocket) Book(ctx context.Context, req Request) (*Booking, error) {
+	items := make([]map[string]interface{}, 0, len(req.Items))
+	for _, it := range req.Items {
+		items = append(items, map[string]interface{}{
+			"name":          it.Name,
+			"sku":           it.SKU,
+			"units":         it.Qty,
+			"selling_price": it.Price,
+		})
+	}
+	first, last := splitName(req.Customer.Name)
+	order := map[string]interface{}{
+		"order_id":              req.Reference,
+		"order_date":            req.OrderedAt.Format("2006-01-02 15:04"),
+		"pickup_location":       req.Pickup,
+		"billing_customer_name": first,
+		"billing_last_name":     last,
+		"billing_address":       req.Customer.Address1,
+		"billing_address_2":     req.Customer.Address2,
+		"billing_city":          req.Customer.City,
+		"billing_pincode":       req.Customer.Pincode,
+		"billing_state":         req.Customer.State,
+		"billing_country":       req.Customer.Country,
+		"billing_email":         req.Customer.Email,
+		"billing_phone":         req.Customer.Phone,
+		"shipping_is_billing":   true,
+		"order_items":           items,
+		// Orders are paid online before they ship
+		"payment_method": "Prepaid",
+		"sub_total":      req.SubTotal,
+		"weight":         req.Parcel.WeightKG,
+		"length":         req.Parcel.LengthCM,
+		"breadth":        req.Parcel.BreadthCM,
+		"height":         req.Parcel.HeightCM,
+	}
+	var created struct {
+		ShipmentID json.Number `json:"shipment_id"`
+	}
+	if err := s.call(ctx, "/v1/external/orders/create/adhoc", order, &created); err != nil {
+		return nil, err
+	}
+	if created.ShipmentID == "" {
+		return nil, fmt.Errorf("%w: no shipment_id in response", ErrRejected)
+	}
+
+	var assigned struct {
+		Response struct {
+			Data struct {
+				AWBCode     string `json:"awb_code"`
+				CourierName string `json:"courier_name"`
+			} `json:"data"`
+		} `json:"response"`
+	}
+	if err := s.call(ctx, "/v1/external/courier/assign/awb", map[string]interface{}{"shipment_id": created.ShipmentID}, &assigned); err != nil {
+		return nil, err
+	}
+	data := assigned.Response.Data
+	if data.AWBCode == "" {
+		return nil, fmt.Errorf("%w: no AWB assigned to shipment %s", ErrRejected, created.ShipmentID)
+	}
+	return &Booking{
+		Ref:         created.ShipmentID.String(),
+		Courier:     data.CourierName,
+		AWBNumber:   data.AWBCode,
+		TrackingURL: "https://shiprocket.co/tracking/" + data.AWBCode,
+	}, nil
+}
+
+func (s *Shiprocket) Label(ctx context.Context, b Booking) ([]byte, error) {
+	var label struct {
+		LabelURL string `json:"label_url"`
+	}
+	if err := s.call(ctx, "/v1/external/courier/generate/label", map[string]interface{}{"shipment_id": []string{b.Ref}}, &label); err != nil {
+		return nil, err
+	}
+	if label.LabelURL == "" {
+		return nil, fmt.Errorf("%w: no label generated", ErrRejected)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, label.LabelURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("label download returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxLabelSize))
+}
+
+func (s *Shiprocket) Cancel(ctx context.Context, b Booking) error {
+	return s.call(ctx, "/v1/external/orders/cancel/shipment/awbs", map[string]interface{}{"awbs": []string{b.AWBNumber}}, nil)
+}
+
+// shiprocketStatuses maps Shiprocket's shipment statuses to ours
+var shiprocketStatuses = map[string]Status{
+	"PICKED UP":                  StatusPickedUp,
+	"SHIPPED":                    StatusInTransit,
+	"IN TRANSIT":                 StatusInTransit,
+	"REACHED AT DESTINATION HUB": StatusInTransit,
+	"OUT FOR DELIVERY":           StatusOutForDelivery,
+	"DELIVERED":                  StatusDelivered,
+	"UNDELIVERED":                StatusUndelivered,
+	"RTO INITIATED":              StatusReturning,
+	"CANCELED":                   StatusCancelled,
+	"CANCELLED":                  StatusCancelled,
+}
+
+func (s *Shiprocket) ParseWebhook(header http.Header, body []byte) ([]Event, error) {
+	key := header.Get("X-Api-Key")
+	if s.webhookSecret == "" || subtle.ConstantTimeCompare([]byte(key), []byte(s.webhookSecret)) != 1 {
+		return nil, ErrUnauthorized
+	}
+	var payload struct {
+		AWB              json.Number `json:"awb"`
+		CurrentStatus    string      `json:"current_status"`
+		CurrentTimestamp string      `json:"current_timestamp"`
+		Scans            []struct {
+			Location string `json:"location"`
+			Activity string `json:"activity"`
+		} `json:"scans"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	status, ok := shiprocketStatuses[strings.ToUpper(strings.TrimSpace(payload.CurrentStatus))]
+	if !ok || payload.AWB == "" {
+		return nil, nil
+	}
+
+	ev := Event{AWBNumber: payload.AWB.String(), Status: status, Description: payload.CurrentStatus, OccurredAt: time.Now()}
+	// Timestamps are India time without a zone, e.g. 23 05 2023 11:43:52
+	ist := time.FixedZone("IST", 5*3600+1800)
+	for _, layout := range []string{"02 01 2006 15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, payload.CurrentTimestamp, ist); err == nil {
+			ev.OccurredAt = t
+			break
+		}
+	}
+	if n := len(payload.Scans); n > 0 {
+		ev.Location = payload.Scans[n-1].Location
+		if a := payload.Scans[n-1].Activity; a != "" {
+			ev.Description = a
+		}
+	}
+	return []Event{ev}, nil
+}
+
+// call posts a JSON request with the API token, renewing the token once if it was rejected
+func (s *Shiprocket) call(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		token, err := s.authToken(ctx, attempt > 0)
+		if err != nil {
+			return err
+		}
+		status, data, err := s.post(ctx, path, token, body)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusUnauthorized && attempt == 0 {
+			continue
+		}
+		if status >= 300 {
+			return fmt.Errorf("%w: %s returned %d: %s", ErrRejected, path, status, truncate(data, 300))
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(data, out)
+	}
+}
+
+func (s *Shiprocket) post(ctx context.Context, path, token string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, data, err
+}
+
+// authToken returns the cached API token, logging in again when it expired or renew is set
+func (s *Shiprocket) authToken(ctx context.Context, renew bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !renew && s.token != "" && time.Now().Before(s.tokenExp) {
+		return s.token, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"email": s.email, "password": s.password})
+	if err != nil {
+		return "", err
+	}
+	status, data, err := s.post(ctx, "/v1/external/auth/login", "", body)
+	if err != nil {
+		return "", err
+	}
+	if status >= 300 {
+		return "", fmt.Errorf("%w: login returned %d", ErrRejected, status)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &login); err != nil || login.Token == "" {
+		return "", fmt.Errorf("%w: login returned no token", ErrRejected)
+	}
+	s.token = login.Token
+	s.tokenExp = time.Now().Add(shiprocketTokenTTL)
+	return s.token, nil
+}
+
+// splitName splits a full name into first and last name, as Shiprocket asks for them separately
+func splitName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, " "); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// truncate shortens a response body for error messages
+func truncate(data []byte, n int) string {
+	if len(data) > n {
+		return string(data[:n]) + "..."
+	}
+	return string(data)
+}
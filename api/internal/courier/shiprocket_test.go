@@ -0,0 +1,173 @@
+package courier
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShiprocketParseWebhookKey(t *testing.T) {
+	body := []byte(`{"awb": 123, "current_status": "DELIVERED"}`)
+	tests := []struct {
+		name    string
+		secret  string
+		key     string
+		wantErr error
+	}{
+		{"matching key", "s3cret", "s3cret", nil},
+		{"wrong key", "s3cret", "guess", ErrUnauthorized},
+		{"missing key", "s3cret", "", ErrUnauthorized},
+		{"prefix of the key", "s3cret", "s3cre", ErrUnauthorized},
+		{"no secret configured", "", "", ErrUnauthorized},
+		{"no secret configured, key sent", "", "anything", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewShiprocket("https://example.test", "", "", tt.secret)
+			header := http.Header{}
+			if tt.key != "" {
+				header.Set("X-Api-Key", tt.key)
+			}
+			_, err := s.ParseWebhook(header, body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseWebhook error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShiprocketParseWebhookStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   Status
+	}{
+		{"PICKED UP", StatusPickedUp},
+		{"SHIPPED", StatusInTransit},
+		{"IN TRANSIT", StatusInTransit},
+		{"REACHED AT DESTINATION HUB", StatusInTransit},
+		{"OUT FOR DELIVERY", StatusOutForDelivery},
+		{"DELIVERED", StatusDelivered},
+		{"UNDELIVERED", StatusUndelivered},
+		{"RTO INITIATED", StatusReturning},
+		{"CANCELED", StatusCancelled},
+		{"CANCELLED", StatusCancelled},
+		{" Delivered ", StatusDelivered},
+		{"out for delivery", StatusOutForDelivery},
+	}
+	s := NewShiprocket("https://example.test", "", "", "key")
+	header := http.Header{"X-Api-Key": {"key"}}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			events, err := s.ParseWebhook(header, []byte(`{"awb": "190412", "current_status": "`+tt.status+`"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Status != tt.want {
+				t.Fatalf("ParseWebhook = %+v, want one %s event", events, tt.want)
+			}
+			if events[0].AWBNumber != "190412" {
+				t.Errorf("AWBNumber = %q, want 190412", events[0].AWBNumber)
+			}
+		})
+	}
+}
+
+func TestShiprocketParseWebhookIgnored(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"unknown status", `{"awb": "190412", "current_status": "PICKUP SCHEDULED"}`},
+		{"no status", `{"awb": "190412"}`},
+		{"no AWB", `{"current_status": "DELIVERED"}`},
+	}
+	s := NewShiprocket("https://example.test", "", "", "key")
+	header := http.Header{"X-Api-Key": {"key"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := s.ParseWebhook(header, []byte(tt.body))
+			if err != nil || events != nil {
+				t.Errorf("ParseWebhook = (%+v, %v), want no events", events, err)
+			}
+		})
+	}
+}
+
+func TestShiprocketParseWebhookMalformed(t *testing.T) {
+	s := NewShiprocket("https://example.test", "", "", "key")
+	if _, err := s.ParseWebhook(http.Header{"X-Api-Key": {"key"}}, []byte(`{"awb":`)); err == nil {
+		t.Error("ParseWebhook accepted malformed JSON")
+	}
+}
+
+func TestShiprocketParseWebhookDetails(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	tests := []struct {
+		name string
+		body string
+		want Event
+	}{
+		{
+			name: "numeric AWB and day-first timestamp",
+			body: `{"awb": 19041211125783, "current_status": "IN TRANSIT", "current_timestamp": "23 05 2023 11:43:52"}`,
+			want: Event{AWBNumber: "19041211125783", Status: StatusInTransit, Description: "IN TRANSIT",
+				OccurredAt: time.Date(2023, 5, 23, 11, 43, 52, 0, ist)},
+		},
+		{
+			name: "ISO timestamp",
+			body: `{"awb": "190412", "current_status": "DELIVERED", "current_timestamp": "2023-05-23 18:05:00"}`,
+			want: Event{AWBNumber: "190412", Status: StatusDelivered, Description: "DELIVERED",
+				OccurredAt: time.Date(2023, 5, 23, 18, 5, 0, 0, ist)},
+		},
+		{
+			name: "last scan gives location and description",
+			body: `{"awb": "190412", "current_status": "OUT FOR DELIVERY", "current_timestamp": "2023-05-24 09:00:00",
+				"scans": [{"location": "Pune Hub", "activity": "Bag received"},
+				          {"location": "Mumbai DC", "activity": "Out for delivery with agent"}]}`,
+			want: Event{AWBNumber: "190412", Status: StatusOutForDelivery, Description: "Out for delivery with agent",
+				Location: "Mumbai DC", OccurredAt: time.Date(2023, 5, 24, 9, 0, 0, 0, ist)},
+		},
+		{
+			name: "scan without activity keeps the status",
+			body: `{"awb": "190412", "current_status": "DELIVERED", "current_timestamp": "2023-05-24 15:30:00",
+				"scans": [{"location": "Mumbai DC", "activity": ""}]}`,
+			want: Event{AWBNumber: "190412", Status: StatusDelivered, Description: "DELIVERED",
+				Location: "Mumbai DC", OccurredAt: time.Date(2023, 5, 24, 15, 30, 0, 0, ist)},
+		},
+	}
+	s := NewShiprocket("https://example.test", "", "", "key")
+	header := http.Header{"X-Api-Key": {"key"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := s.ParseWebhook(header, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("ParseWebhook returned %d events, want 1", len(events))
+			}
+			got := events[0]
+			if !got.OccurredAt.Equal(tt.want.OccurredAt) {
+				t.Errorf("OccurredAt = %v, want %v", got.OccurredAt, tt.want.OccurredAt)
+			}
+			got.OccurredAt = tt.want.OccurredAt
+			if got != tt.want {
+				t.Errorf("ParseWebhook = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiprocketParseWebhookUnparsedTimestamp(t *testing.T) {
+	s := NewShiprocket("https://example.test", "", "", "key")
+	before := time.Now()
+	events, err := s.ParseWebhook(http.Header{"X-Api-Key": {"key"}},
+		[]byte(`{"awb": "190412", "current_status": "DELIVERED", "current_timestamp": "yesterday"}`))
+	if err != nil || len(events) != 1 {
+		t.Fatalf("ParseWebhook = (%+v, %v)", events, err)
+	}
+	if at := events[0].OccurredAt; at.Before(before) || at.After(time.Now()) {
+		t.Errorf("OccurredAt = %v, want the time of receipt", at)
+	}
+}
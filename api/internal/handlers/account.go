@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/mailer"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPassword handles POST /api/v1/auth/password/forgot
+// The response is identical whether or not the email exists to avoid account enumeration.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	req.Email = normalizeEmail(req.Email)
+
+	var userID int64
+	err := h.db.QueryRow("SELECT id FROM users WHERE LOWER(email) = $1 AND archived_at IS NULL", req.Email).Scan(&userID)
+	if err == nil {
+		token, err := h.tokens.Issue(userID, auth.PurposePasswordReset, h.config.PasswordResetTTL)
+		if err != nil {
+			h.logger.Error("Failed to issue password reset token", zap.Error(err), zap.Int64("user_id", userID))
+		} else {
+			h.sendEmail(mailer.Message{
+				To:      req.Email,
+				Subject: "Reset your Finspeed password",
+				Body: fmt.Sprintf(
+					"We received a request to reset your password.\n\nReset it here: %s\n\nThis link expires in %s. If you did not request this, you can ignore this email.\n",
+					h.frontendLink("/auth/reset-password", token), h.config.PasswordResetTTL,
+				),
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// ResetPassword handles POST /api/v1/auth/password/reset
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		h.logger.Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := h.tokens.Consume(tx, req.Token, auth.PurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, auth.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		h.logger.Error("Failed to consume password reset token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Receiving the reset email proves ownership of the address as well
+	if _, err := tx.Exec(
+		`UPDATE users SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, NOW()),
+		     failed_login_count = 0, locked_until = NULL
+		 WHERE id = $2`,
+		string(hashedPassword), userID,
+	); err != nil {
+		h.logger.Error("Failed to update password", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit password reset", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Whoever knew the old password should not stay signed in
+	if err := h.sessions.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to revoke sessions after password reset", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	h.logger.Info("Password reset completed", zap.Int64("user_id", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// VerifyEmail handles POST /api/v1/auth/email/verify
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := h.tokens.Consume(tx, req.Token, auth.PurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, auth.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		h.logger.Error("Failed to consume verification token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1", userID); err != nil {
+		h.logger.Error("Failed to mark email verified", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit email verification", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	h.logger.Info("Email verified", zap.Int64("user_id", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification handles POST /api/v1/auth/email/resend (authenticated)
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+
+	var email string
+	var verified bool
+	err := h.db.QueryRow("SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&email, &verified)
+	if err != nil {
+		h.logger.Error("Failed to load user for verification", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already verified"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(userID, email); err != nil {
+		h.logger.Error("Failed to issue verification token", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// sendVerificationEmail issues a fresh verification token and emails it to the user
+func (h *AuthHandler) sendVerificationEmail(userID int64, email string) error {
+	token, err := h.tokens.Issue(userID, auth.PurposeEmailVerification, h.config.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	h.sendEmail(mailer.Message{
+		To:      email,
+		Subject: "Verify your Finspeed email address",
+		Body: fmt.Sprintf(
+			"Welcome to Finspeed!\n\nPlease confirm your email address: %s\n\nThis link expires in %s.\n",
+			h.frontendLink("/auth/verify-email", token), h.config.EmailVerificationTTL,
+		),
+	})
+	return nil
+}
+
+// sendEmail delivers the message in the background so response times do not reveal whether an email was sent
+func (h *AuthHandler) sendEmail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			h.logger.Error("Failed to send email", zap.Error(err), zap.String("subject", msg.Subject))
+		}
+	}()
+}
+
+// frontendLink builds a link into the storefront carrying a token query parameter
+func (h *AuthHandler) frontendLink(path, token string) string {
+	return strings.TrimRight(h.config.FrontendBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/address"
+	"finspeed/api/internal/database"
+)
+
+// maxSavedAddresses caps the address book size per user
+const maxSavedAddresses = 20
+
+type AddressHandler struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+type SavedAddress struct {
+	ID        int64     `json:"id"`
+	Label     *string   `json:"label,omitempty"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone"`
+	Address1  string    `json:"address1"`
+	Address2  *string   `json:"address2,omitempty"`
+	City      string    `json:"city"`
+	State     string    `json:"state"`
+	Pincode   string    `json:"pincode"`
+	Country   string    `json:"country"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AddressRequest struct {
+	Label     string `json:"label" binding:"max=50"`
+	Name      string `json:"name" binding:"required,max=100"`
+	Phone     string `json:"phone" binding:"required"`
+	Address1  string `json:"address1" binding:"required,max=200"`
+	Address2  string `json:"address2" binding:"max=200"`
+	City      string `json:"city" binding:"required,max=100"`
+	State     string `json:"state" binding:"required"`
+	Pincode   string `json:"pincode" binding:"required"`
+	Country   string `json:"country"`
+	IsDefault bool   `json:"is_default"`
+}
+
+const savedAddressColumns = `id, label, name, phone, address1, address2, city, state, pincode, country, is_default, created_at, updated_at`
+
+func NewAddressHandler(db *database.DB, logger *zap.Logger) *AddressHandler {
+	return &AddressHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// GetAddresses handles GET /api/v1/me/addresses
+func (h *AddressHandler) GetAddresses(c *gin.Context) {
+	rows, err := h.db.Query(
+		"SELECT "+savedAddressColumns+" FROM user_addresses WHERE user_id = $1 ORDER BY is_default DESC, updated_at DESC",
+		c.GetInt64("user_id"),
+	)
+	if err != nil {
+		h.logger.Error("Failed to fetch addresses", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+		return
+	}
+	defer rows.Close()
+
+	addresses := []SavedAddress{}
+	for rows.Next() {
+		a, err := scanSavedAddress(rows)
+		if err != nil {
+			h.logger.Error("Failed to scan address", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+			return
+		}
+		addresses = append(addresses, a)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"addresses": addresses})
+}
+
+// CreateAddress handles POST /api/v1/me/addresses
+// The first saved address becomes the default.
+func (h *AddressHandler) CreateAddress(c *gin.Context) {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	addr, err := req.normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent creates agree on the count and the default
+	var count int
+	if err := tx.QueryRow(
+		"SELECT (SELECT COUNT(*) FROM user_addresses WHERE user_id = $1) FROM users WHERE id = $1 FOR UPDATE",
+		userID,
+	).Scan(&count); err != nil {
+		h.logger.Error("Failed to count addresses", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+	if count >= maxSavedAddresses {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Address book is full", "max": maxSavedAddresses})
+		return
+	}
+
+	isDefault := req.IsDefault || count == 0
+	if isDefault {
+		if _, err := tx.Exec("UPDATE user_addresses SET is_default = false WHERE user_id = $1 AND is_default", userID); err != nil {
+			h.logger.Error("Failed to clear default address", zap.Error(err), zap.Int64("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+			return
+		}
+	}
+
+	a, err := scanSavedAddress(tx.QueryRow(
+		`INSERT INTO user_addresses (user_id, label, name, phone, address1, address2, city, state, pincode, country, is_default)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11)
+		 RETURNING `+savedAddressColumns,
+		userID, req.Label, addr.Name, addr.Phone, addr.Address1, addr.Address2, addr.City, addr.State, addr.Pincode, addr.Country, isDefault,
+	))
+	if err != nil {
+		h.logger.Error("Failed to create address", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit address", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// UpdateAddress handles PUT /api/v1/me/addresses/:id
+func (h *AddressHandler) UpdateAddress(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	addr, err := req.normalize()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Unsetting the default is done by choosing another address, so is_default=false leaves it unchanged
+	if req.IsDefault {
+		if _, err := tx.Exec("UPDATE user_addresses SET is_default = false WHERE user_id = $1 AND is_default AND id <> $2", userID, id); err != nil {
+			h.logger.Error("Failed to clear default address", zap.Error(err), zap.Int64("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+			return
+		}
+	}
+
+	a, err := scanSavedAddress(tx.QueryRow(
+		`UPDATE user_addresses
+		 SET label = NULLIF($1, ''), name = $2, phone = $3, address1 = $4, address2 = NULLIF($5, ''),
+		     city = $6, state = $7, pincode = $8, country = $9, is_default = is_default OR $10, updated_at = NOW()
+		 WHERE id = $11 AND user_id = $12
+		 RETURNING `+savedAddressColumns,
+		req.Label, addr.Name, addr.Phone, addr.Address1, addr.Address2, addr.City, addr.State, addr.Pincode, addr.Country, req.IsDefault,
+		id, userID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+		h.logger.Error("Failed to update address", zap.Error(err), zap.Int64("address_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit address", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// SetDefaultAddress handles PUT /api/v1/me/addresses/:id/default
+func (h *AddressHandler) SetDefaultAddress(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE user_addresses SET is_default = false WHERE user_id = $1 AND is_default AND id <> $2", userID, id); err != nil {
+		h.logger.Error("Failed to clear default address", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+		return
+	}
+	a, err := scanSavedAddress(tx.QueryRow(
+		"UPDATE user_addresses SET is_default = true, updated_at = NOW() WHERE id = $1 AND user_id = $2 RETURNING "+savedAddressColumns,
+		id, userID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+		h.logger.Error("Failed to set default address", zap.Error(err), zap.Int64("address_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit default address", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// DeleteAddress handles DELETE /api/v1/me/addresses/:id
+// Deleting the default promotes the most recently updated remaining address.
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+	defer tx.Rollback()
+
+	var wasDefault bool
+	err = tx.QueryRow("DELETE FROM user_addresses WHERE id = $1 AND user_id = $2 RETURNING is_default", id, userID).Scan(&wasDefault)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+		h.logger.Error("Failed to delete address", zap.Error(err), zap.Int64("address_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+	if wasDefault {
+		if _, err := tx.Exec(
+			`UPDATE user_addresses SET is_default = true
+			 WHERE id = (SELECT id FROM user_addresses WHERE user_id = $1 ORDER BY updated_at DESC LIMIT 1)`,
+			userID,
+		); err != nil {
+			h.logger.Error("Failed to promote default address", zap.Error(err), zap.Int64("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit address deletion", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
+
+// GetStates handles GET /api/v1/states
+func (h *AddressHandler) GetStates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"states": address.States()})
+}
+
+func (r AddressRequest) normalize() (ShippingAddr, error) {
+	return normalizeShippingAddr(ShippingAddr{
+		Name:     r.Name,
+		Phone:    r.Phone,
+		Address1: r.Address1,
+		Address2: r.Address2,
+		City:     r.City,
+		State:    r.State,
+		Pincode:  r.Pincode,
+		Country:  r.Country,
+	})
+}
+
+// normalizeShippingAddr trims every field and validates the phone, state and pincode of an Indian address
+func normalizeShippingAddr(a ShippingAddr) (ShippingAddr, error) {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Address1 = strings.TrimSpace(a.Address1)
+	a.Address2 = strings.TrimSpace(a.Address2)
+	a.City = strings.TrimSpace(a.City)
+	a.Pincode = strings.TrimSpace(a.Pincode)
+	if a.Name == "" || a.Address1 == "" || a.City == "" {
+		return a, errors.New("name, address1 and city are required")
+	}
+
+	var err error
+	if a.Country, err = address.NormalizeCountry(a.Country); err != nil {
+		return a, err
+	}
+	if a.Phone, err = address.NormalizePhone(a.Phone); err != nil {
+		return a, err
+	}
+	if a.State, err = address.NormalizeState(a.State); err != nil {
+		return a, err
+	}
+	if err := address.ValidatePincode(a.Pincode, a.State); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// loadSavedAddress returns one of the user's saved addresses as an order shipping address
+func loadSavedAddress(tx *sql.Tx, userID interface{}, id int64) (ShippingAddr, error) {
+	var a ShippingAddr
+	var address2 sql.NullString
+	err := tx.QueryRow(
+		"SELECT name, phone, address1, address2, city, state, pincode, country FROM user_addresses WHERE id = $1 AND user_id = $2",
+		id, userID,
+	).Scan(&a.Name, &a.Phone, &a.Address1, &address2, &a.City, &a.State, &a.Pincode, &a.Country)
+	a.Address2 = address2.String
+	return a, err
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSavedAddress(row rowScanner) (SavedAddress, error) {
+	var a SavedAddress
+	err := row.Scan(&a.ID, &a.Label, &a.Name, &a.Phone, &a.Address1, &a.Address2, &a.City, &a.State,
+		&a.Pincode, &a.Country, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/auth"
+)
+
+type APIKeyHandler struct {
+	logger *zap.Logger
+	keys   *auth.APIKeyStore
+	roles  *auth.RoleStore
+	audit  *audit.Recorder
+}
+
+type CreateAPIKeyRequest struct {
+	Name               string     `json:"name" binding:"required,max=100"`
+	Scopes             []string   `json:"scopes" binding:"required,min=1"`
+	RateLimitPerMinute *int       `json:"rate_limit_per_minute,omitempty" binding:"omitempty,min=1,max=100000"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey *auth.APIKey `json:"api_key"`
+	Key    string       `json:"key"`
+}
+
+func NewAPIKeyHandler(logger *zap.Logger, keys *auth.APIKeyStore, roles *auth.RoleStore, recorder *audit.Recorder) *APIKeyHandler {
+	return &APIKeyHandler{
+		logger: logger,
+		keys:   keys,
+		roles:  roles,
+		audit:  recorder,
+	}
+}
+
+// GetAPIKeys handles GET /api/v1/admin/api-keys
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.keys.List()
+	if err != nil {
+		h.logger.Error("Failed to fetch API keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// CreateAPIKey handles POST /api/v1/admin/api-keys. The key value is only returned in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	// Staff can only delegate permissions they hold themselves
+	role := c.GetString("user_role")
+	for _, scope := range req.Scopes {
+		if !auth.IsAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope cannot be granted to an API key", "scope": scope})
+			return
+		}
+		allowed, err := h.roles.HasPermission(role, scope)
+		if err != nil {
+			h.logger.Error("Failed to resolve role permissions", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant a scope you do not have", "scope": scope})
+			return
+		}
+	}
+
+	key, value, err := h.keys.Create(req.Name, req.Scopes, req.RateLimitPerMinute, req.ExpiresAt, c.GetInt64("user_id"))
+	if err != nil {
+		h.logger.Error("Failed to create API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	h.logger.Info("API key created", zap.Int64("api_key_id", key.ID), zap.String("name", key.Name), zap.Strings("scopes", key.Scopes))
+	h.audit.Record(auditActor(c), "api_key.create", "api_key", key.ID, nil, key)
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: key, Key: value})
+}
+
+// RevokeAPIKey handles DELETE /api/v1/admin/api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	before, err := h.keys.Get(id)
+	if err != nil && !errors.Is(err, auth.ErrAPIKeyNotFound) {
+		h.logger.Error("Failed to fetch API key", zap.Error(err), zap.Int64("api_key_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	if err := h.keys.Revoke(id); err != nil {
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		h.logger.Error("Failed to revoke API key", zap.Error(err), zap.Int64("api_key_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	after, _ := h.keys.Get(id)
+	h.logger.Info("API key revoked", zap.Int64("api_key_id", id))
+	h.audit.Record(auditActor(c), "api_key.revoke", "api_key", id, before, after)
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
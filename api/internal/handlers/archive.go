@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidArchivedFilter = errors.New("archived must be one of exclude, include or only")
+
+// archivedFilter turns the ?archived= query parameter of admin listings into a WHERE clause on column.
+// Archived rows are excluded by default; "include" returns no clause.
+func archivedFilter(c *gin.Context, column string) (string, error) {
+	switch c.DefaultQuery("archived", "exclude") {
+	case "exclude":
+		return column + " IS NULL", nil
+	case "only":
+		return column + " IS NOT NULL", nil
+	case "include":
+		return "", nil
+	}
+	return "", errInvalidArchivedFilter
+}
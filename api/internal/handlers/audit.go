@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/database"
+)
+
+type AuditHandler struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+type AuditEntry struct {
+	ID         int64                   `json:"id"`
+	ActorID    *int64                  `json:"actor_id,omitempty"`
+	ActorEmail *string                 `json:"actor_email,omitempty"`
+	APIKeyID   *int64                  `json:"api_key_id,omitempty"`
+	Action     string                  `json:"action"`
+	EntityType string                  `json:"entity_type"`
+	EntityID   string                  `json:"entity_id"`
+	Before     map[string]interface{}  `json:"before,omitempty"`
+	After      map[string]interface{}  `json:"after,omitempty"`
+	Diff       map[string]audit.Change `json:"diff,omitempty"`
+	IP         *string                 `json:"ip,omitempty"`
+	UserAgent  *string                 `json:"user_agent,omitempty"`
+	RequestID  *string                 `json:"request_id,omitempty"`
+	CreatedAt  string                  `json:"created_at"`
+}
+
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+}
+
+func NewAuditHandler(db *database.DB, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// GetAuditLog handles GET /api/v1/admin/audit
+// Filters: actor_id, api_key_id, entity_type, entity_id, action (prefix match, e.g. "product."), request_id, from, to (RFC3339)
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	offset := (page - 1) * limit
+
+	args := []interface{}{}
+	whereClauses := []string{}
+	argCount := 1
+
+	addFilter := func(clause string, value interface{}) {
+		whereClauses = append(whereClauses, strings.ReplaceAll(clause, "?", "$"+strconv.Itoa(argCount)))
+		args = append(args, value)
+		argCount++
+	}
+
+	if v := c.Query("actor_id"); v != "" {
+		actorID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return
+		}
+		addFilter("actor_id = ?", actorID)
+	}
+	if v := c.Query("api_key_id"); v != "" {
+		apiKeyID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid api_key_id"})
+			return
+		}
+		addFilter("api_key_id = ?", apiKeyID)
+	}
+	if v := c.Query("entity_type"); v != "" {
+		addFilter("entity_type = ?", v)
+	}
+	if v := c.Query("entity_id"); v != "" {
+		addFilter("entity_id = ?", v)
+	}
+	if v := c.Query("action"); v != "" {
+		addFilter("action LIKE ?", strings.ReplaceAll(v, "%", `\%`)+"%")
+	}
+	if v := c.Query("request_id"); v != "" {
+		addFilter("request_id = ?", v)
+	}
+	for _, bound := range []struct{ param, clause string }{{"from", "created_at >= ?"}, {"to", "created_at < ?"}} {
+		if v := c.Query(bound.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + " (expected RFC3339)"})
+				return
+			}
+			addFilter(bound.clause, t)
+		}
+	}
+
+	whereStatement := ""
+	if len(whereClauses) > 0 {
+		whereStatement = " WHERE " + strings.Join(whereClauses, " AND ")
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM audit_log"+whereStatement, args...).Scan(&total); err != nil {
+		h.logger.Error("Failed to count audit log entries", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	query := `SELECT id, actor_id, actor_email, api_key_id, action, entity_type, entity_id, before_json, after_json, diff_json,
+	                 ip, user_agent, request_id, created_at
+	          FROM audit_log` + whereStatement +
+		" ORDER BY created_at DESC, id DESC LIMIT $" + strconv.Itoa(argCount) + " OFFSET $" + strconv.Itoa(argCount+1)
+	args = append(args, limit, offset)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		h.logger.Error("Failed to fetch audit log", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var beforeRaw, afterRaw, diffRaw []byte
+		if err := rows.Scan(
+			&e.ID, &e.ActorID, &e.ActorEmail, &e.APIKeyID, &e.Action, &e.EntityType, &e.EntityID,
+			&beforeRaw, &afterRaw, &diffRaw, &e.IP, &e.UserAgent, &e.RequestID, &e.CreatedAt,
+		); err != nil {
+			h.logger.Error("Failed to scan audit log entry", zap.Error(err))
+			continue
+		}
+		if len(beforeRaw) > 0 {
+			_ = json.Unmarshal(beforeRaw, &e.Before)
+		}
+		if len(afterRaw) > 0 {
+			_ = json.Unmarshal(afterRaw, &e.After)
+		}
+		if len(diffRaw) > 0 {
+			_ = json.Unmarshal(diffRaw, &e.Diff)
+		}
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, AuditLogResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	})
+}
+
+// auditActor describes the authenticated user making the request for the audit log
+func auditActor(c *gin.Context) audit.Actor {
+	return audit.Actor{
+		UserID:    c.GetInt64("user_id"),
+		Email:     c.GetString("user_email"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString("request_id"),
+		APIKeyID:  c.GetInt64("api_key_id"),
+	}
+}
+
+// Snapshot queries used to capture audited entities. Users are listed field by field to keep secrets out of the log.
+const (
+	productSnapshotQuery      = "SELECT row_to_json(p) FROM products p WHERE p.id = $1"
+	productImageSnapshotQuery = "SELECT row_to_json(i) FROM product_images i WHERE i.id = $1"
+	categorySnapshotQuery     = "SELECT row_to_json(c) FROM categories c WHERE c.id = $1"
+	userSnapshotQuery         = "SELECT json_build_object('id', id, 'email', email, 'role', role, 'email_verified_at', email_verified_at, 'locked_until', locked_until, 'archived_at', archived_at) FROM users WHERE id = $1"
+)
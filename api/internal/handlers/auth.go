@@ -2,24 +2,43 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/auth"
 	"finspeed/api/internal/config"
 	"finspeed/api/internal/database"
+	"finspeed/api/internal/mailer"
+	"finspeed/api/internal/ratelimit"
 )
 
+// maxLockout caps the progressive account lockout
+const maxLockout = 24 * time.Hour
+
+// dummyPasswordHash is compared against when the email is unknown (bcrypt of a random string)
+var dummyPasswordHash = []byte("$2a$10$JlZs96.XONsTJQvlBTC7KuZ5idf1ooCu2XuFxziletZ/rN9y4FmZu")
+
 type AuthHandler struct {
-	db     *database.DB
-	logger *zap.Logger
-	config *config.Config
+	db           *database.DB
+	logger       *zap.Logger
+	config       *config.Config
+	jwt          *auth.TokenManager
+	roles        *auth.RoleStore
+	sessions     *auth.SessionStore
+	tokens       *auth.ActionTokenStore
+	twoFactor    *auth.TwoFactorStore
+	mailer       mailer.Mailer
+	loginLimiter *ratelimit.Limiter
+	audit        *audit.Recorder
 }
 
 type RegisterRequest struct {
@@ -32,16 +51,29 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type AuthResponse struct {
-	Token     string `json:"token"`
-	ExpiresAt int64  `json:"expires_at"`
-	User      User   `json:"user"`
+	Token            string `json:"token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+	User             User   `json:"user"`
 }
 
 type User struct {
-	ID    int64  `json:"id"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID            int64  `json:"id"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	// Only set in admin responses
+	ArchivedAt *string `json:"archived_at,omitempty"`
 }
 
 type UpdateUserRequest struct {
@@ -56,18 +88,19 @@ type UsersResponse struct {
 	Limit int    `json:"limit"`
 }
 
-type Claims struct {
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func NewAuthHandler(db *database.DB, logger *zap.Logger, config *config.Config) *AuthHandler {
+func NewAuthHandler(db *database.DB, logger *zap.Logger, config *config.Config, jwt *auth.TokenManager, roles *auth.RoleStore, sessions *auth.SessionStore, tokens *auth.ActionTokenStore, twoFactor *auth.TwoFactorStore, mail mailer.Mailer, loginLimiter *ratelimit.Limiter, recorder *audit.Recorder) *AuthHandler {
 	return &AuthHandler{
-		db:     db,
-		logger: logger,
-		config: config,
+		db:           db,
+		logger:       logger,
+		config:       config,
+		jwt:          jwt,
+		roles:        roles,
+		sessions:     sessions,
+		tokens:       tokens,
+		twoFactor:    twoFactor,
+		mailer:       mail,
+		loginLimiter: loginLimiter,
+		audit:        recorder,
 	}
 }
 
@@ -80,6 +113,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	req.Email = normalizeEmail(req.Email)
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -106,8 +141,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := h.generateToken(userID, email, role)
+	if err := h.sendVerificationEmail(userID, email); err != nil {
+		// The user can request another link later; registration itself succeeded
+		h.logger.Error("Failed to send verification email", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	// Issue access and refresh tokens
+	resp, err := h.issueSession(c, User{ID: userID, Email: email, Role: role})
 	if err != nil {
 		h.logger.Error("Failed to generate token", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -116,15 +156,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	h.logger.Info("User registered successfully", zap.Int64("user_id", userID), zap.String("email", email))
 
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User: User{
-			ID:    userID,
-			Email: email,
-			Role:  role,
-		},
-	})
+	c.JSON(http.StatusCreated, resp)
+}
+
+// normalizeEmail lowercases an address for storage and lookup; users are unique by lowercased email
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // Login handles user authentication
@@ -136,50 +173,325 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	h.logger.Info("Login attempt payload", zap.String("email", req.Email), zap.String("password", req.Password))
+	email := normalizeEmail(req.Email)
+	ctx := c.Request.Context()
+
+	// Per-email throttling; per-IP throttling is applied by middleware on the route
+	if res, err := h.loginLimiter.Allow(ctx, email); err != nil {
+		h.logger.Error("Login rate limit check failed", zap.Error(err))
+	} else if !res.Allowed {
+		auth.LogSecurityEvent(h.logger, auth.EventLoginRateLimited,
+			zap.String("scope", "email"), zap.String("email", email), zap.String("client_ip", c.ClientIP()))
+		c.Header("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts, please try again later"})
+		return
+	}
 
 	// Get user from database
 	var userID int64
-	var email, role, passwordHash string
+	var role string
+	var passwordHash sql.NullString
+	var emailVerified bool
+	var lockedUntil sql.NullTime
 	err := h.db.QueryRow(
-		"SELECT id, email, role, password_hash FROM users WHERE email = $1",
-		req.Email,
-	).Scan(&userID, &email, &role, &passwordHash)
+		"SELECT id, email, role, password_hash, email_verified_at IS NOT NULL, locked_until FROM users WHERE LOWER(email) = $1 AND archived_at IS NULL",
+		email,
+	).Scan(&userID, &email, &role, &passwordHash, &emailVerified, &lockedUntil)
 
 	if err != nil {
-		h.logger.Warn("Login attempt with invalid email", zap.String("email", req.Email))
+		if err != sql.ErrNoRows {
+			h.logger.Error("Failed to query user for login", zap.Error(err))
+		}
+		// Spend the same time as a real password check so response timing does not reveal unknown emails
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		auth.LogSecurityEvent(h.logger, auth.EventLoginFailed,
+			zap.String("reason", "unknown_email"), zap.String("email", email), zap.String("client_ip", c.ClientIP()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// A locked account answers exactly like a wrong password, so lockouts do not reveal which emails exist;
+	// the lock is only recorded in the log
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		auth.LogSecurityEvent(h.logger, auth.EventLoginWhileLocked,
+			zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()), zap.Time("locked_until", lockedUntil.Time))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// Accounts created through an identity provider have no password until one is set via reset
+	if !passwordHash.Valid {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		auth.LogSecurityEvent(h.logger, auth.EventLoginFailed,
+			zap.String("reason", "no_password"), zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+		h.registerFailedLogin(c, userID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
-		h.logger.Warn("Login attempt with invalid password", zap.String("email", req.Email))
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(req.Password)); err != nil {
+		auth.LogSecurityEvent(h.logger, auth.EventLoginFailed,
+			zap.String("reason", "invalid_password"), zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+		h.registerFailedLogin(c, userID)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := h.generateToken(userID, email, role)
+	user := User{ID: userID, Email: email, Role: role, EmailVerified: emailVerified}
+
+	// Failure counters are only reset once every factor has been checked, so a known
+	// password cannot be used to keep guessing second-factor codes
+	if h.startTwoFactor(c, user) {
+		return
+	}
+
+	resp, err := h.completeLogin(c, user)
 	if err != nil {
 		h.logger.Error("Failed to generate token", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	h.logger.Info("User logged in successfully", zap.Int64("user_id", userID), zap.String("email", email))
+	c.JSON(http.StatusOK, resp)
+}
+
+// completeLogin clears failed login state and issues a session once every required factor has passed
+func (h *AuthHandler) completeLogin(c *gin.Context, user User) (AuthResponse, error) {
+	if _, err := h.db.Exec(
+		"UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = $1 AND (failed_login_count <> 0 OR locked_until IS NOT NULL)",
+		user.ID,
+	); err != nil {
+		h.logger.Error("Failed to reset failed login count", zap.Error(err), zap.Int64("user_id", user.ID))
+	}
+	if err := h.loginLimiter.Reset(c.Request.Context(), strings.ToLower(user.Email)); err != nil {
+		h.logger.Warn("Failed to reset login rate limit", zap.Error(err))
+	}
+
+	// Issue access and refresh tokens
+	resp, err := h.issueSession(c, user)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	auth.LogSecurityEvent(h.logger, auth.EventLoginSucceeded, zap.Int64("user_id", user.ID), zap.String("client_ip", c.ClientIP()))
+	return resp, nil
+}
+
+// registerFailedLogin increments the user's failure counter and locks the account every
+// LoginLockoutThreshold failures, doubling the lock duration each time up to maxLockout
+func (h *AuthHandler) registerFailedLogin(c *gin.Context, userID int64) {
+	var failures int
+	if err := h.db.QueryRow(
+		"UPDATE users SET failed_login_count = failed_login_count + 1 WHERE id = $1 RETURNING failed_login_count",
+		userID,
+	).Scan(&failures); err != nil {
+		h.logger.Error("Failed to record failed login", zap.Error(err), zap.Int64("user_id", userID))
+		return
+	}
+
+	threshold := h.config.LoginLockoutThreshold
+	if failures%threshold != 0 {
+		return
+	}
+
+	lockFor := h.config.LoginLockoutDuration
+	for i := 1; i < failures/threshold && lockFor < maxLockout; i++ {
+		lockFor *= 2
+	}
+	if lockFor > maxLockout {
+		lockFor = maxLockout
+	}
+	lockedUntil := time.Now().Add(lockFor)
+
+	if _, err := h.db.Exec("UPDATE users SET locked_until = $1 WHERE id = $2", lockedUntil, userID); err != nil {
+		h.logger.Error("Failed to lock account", zap.Error(err), zap.Int64("user_id", userID))
+		return
+	}
+	auth.LogSecurityEvent(h.logger, auth.EventAccountLocked,
+		zap.Int64("user_id", userID), zap.Int("failed_attempts", failures),
+		zap.Duration("lock_duration", lockFor), zap.String("client_ip", c.ClientIP()))
+}
+
+// Refresh handles POST /api/v1/auth/refresh by rotating the refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	rt, err := h.sessions.RotateRefreshToken(req.RefreshToken, h.config.RefreshTokenTTL, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenInvalid) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		h.logger.Error("Failed to rotate refresh token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Reload the user so role changes take effect on refresh; archived users cannot refresh
+	var user User
+	err = h.db.QueryRow("SELECT id, email, role, email_verified_at IS NOT NULL FROM users WHERE id = $1 AND archived_at IS NULL", rt.UserID).Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		h.logger.Error("Failed to load user for refresh", zap.Error(err), zap.Int64("user_id", rt.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	token, expiresAt, err := h.generateToken(user.ID, user.Email, user.Role)
+	if err != nil {
+		h.logger.Error("Failed to generate token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User: User{
-			ID:    userID,
-			Email: email,
-			Role:  role,
-		},
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     rt.Value,
+		RefreshExpiresAt: rt.ExpiresAt.Unix(),
+		User:             user,
 	})
 }
 
+// Logout handles POST /api/v1/auth/logout by revoking the current access token
+// and, if supplied, the refresh token family
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+			return
+		}
+	}
+
+	userID := c.GetInt64("user_id")
+	if err := h.revokeCurrentAccessToken(c); err != nil {
+		h.logger.Error("Failed to revoke access token", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	if req.RefreshToken != "" {
+		if err := h.sessions.RevokeRefreshToken(req.RefreshToken, userID); err != nil {
+			h.logger.Error("Failed to revoke refresh token", zap.Error(err), zap.Int64("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	h.logger.Info("User logged out", zap.Int64("user_id", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll handles POST /api/v1/auth/logout-all by revoking every session of the current user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	if err := h.sessions.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to revoke sessions", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	// Tokens issued within the current second survive the sessions_revoked_at check,
+	// so deny the caller's own token explicitly.
+	if err := h.revokeCurrentAccessToken(c); err != nil {
+		h.logger.Warn("Failed to revoke current access token", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	h.logger.Info("All sessions revoked", zap.Int64("user_id", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions logged out"})
+}
+
+// RevokeUserSessions handles DELETE /api/v1/admin/users/:id/sessions
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.sessions.RevokeAllSessions(id); err != nil {
+		h.logger.Error("Failed to revoke sessions", zap.Error(err), zap.Int64("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	h.logger.Info("User sessions revoked by admin", zap.Int64("user_id", id), zap.Int64("admin_id", c.GetInt64("user_id")))
+	h.audit.Record(auditActor(c), "user.sessions_revoke", "user", id, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "User sessions revoked"})
+}
+
+// ArchiveUser handles DELETE /api/v1/admin/users/:id
+// The account is disabled but kept; DELETE /admin/users/:id/purge erases it.
+func (h *AuthHandler) ArchiveUser(c *gin.Context) {
+	h.setUserArchived(c, true)
+}
+
+// RestoreUser handles POST /api/v1/admin/users/:id/restore
+func (h *AuthHandler) RestoreUser(c *gin.Context) {
+	h.setUserArchived(c, false)
+}
+
+func (h *AuthHandler) setUserArchived(c *gin.Context, archive bool) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if archive && id == c.GetInt64("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot archive your own account"})
+		return
+	}
+
+	before := h.audit.Snapshot(userSnapshotQuery, id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Erased accounts stay archived for good
+	query := "UPDATE users SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL"
+	action, message := "user.archive", "User archived successfully"
+	if !archive {
+		query = "UPDATE users SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL AND deleted_at IS NULL"
+		action, message = "user.restore", "User restored successfully"
+	}
+
+	result, err := h.db.Exec(query, id)
+	if err != nil {
+		h.logger.Error("Failed to change user archive state", zap.Error(err), zap.Int64("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if archive {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already archived"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is not archived or has been erased"})
+		}
+		return
+	}
+
+	if archive {
+		if err := h.sessions.RevokeAllSessions(id); err != nil {
+			h.logger.Error("Failed to revoke sessions after archiving user", zap.Error(err), zap.Int64("user_id", id))
+		}
+	}
+
+	h.logger.Info(message, zap.Int64("user_id", id), zap.Int64("admin_id", c.GetInt64("user_id")))
+	h.audit.Record(auditActor(c), action, "user", id, before, h.audit.Snapshot(userSnapshotQuery, id))
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
 // generateToken creates a JWT token for the user
 // GetUsers handles fetching all users for admin
 // GetUser handles fetching a single user by ID
@@ -192,7 +504,7 @@ func (h *AuthHandler) GetUser(c *gin.Context) {
 	}
 
 	var user User
-	err = h.db.QueryRow("SELECT id, email, role FROM users WHERE id = $1", id).Scan(&user.ID, &user.Email, &user.Role)
+	err = h.db.QueryRow("SELECT id, email, role, email_verified_at IS NOT NULL, archived_at FROM users WHERE id = $1", id).Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified, &user.ArchivedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -221,14 +533,72 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Callers, API keys included, can only manage users whose role grants nothing they lack themselves,
+	// so users:write cannot take over a more privileged account or hand out more than the caller holds
+	var currentRole string
+	err = h.db.QueryRow("SELECT role FROM users WHERE id = $1", id).Scan(&currentRole)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to fetch user", zap.Error(err), zap.Int64("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	current, err := h.roles.Get(currentRole)
+	if err != nil {
+		h.logger.Error("Failed to fetch role", zap.Error(err), zap.String("role", currentRole))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	missing, err := ungrantedPermission(c, h.roles, current.Permissions)
+	if err != nil {
+		h.logger.Error("Failed to resolve role permissions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if missing != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot modify a user with a permission you do not have", "permission": missing})
+		return
+	}
+
 	var updates []string
 	var params []interface{}
 
 	if req.Email != nil {
-		params = append(params, *req.Email)
+		params = append(params, normalizeEmail(*req.Email))
 		updates = append(updates, "email = $"+strconv.Itoa(len(params)))
 	}
 	if req.Role != nil {
+		role, err := h.roles.Get(*req.Role)
+		if errors.Is(err, auth.ErrRoleNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role", "role": *req.Role})
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to validate role", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		if id == c.GetInt64("user_id") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+			return
+		}
+		required := role.Permissions
+		if role.Name == "admin" {
+			required = append(required, auth.PermissionAll)
+		}
+		missing, err := ungrantedPermission(c, h.roles, required)
+		if err != nil {
+			h.logger.Error("Failed to resolve role permissions", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		if missing != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant a role with a permission you do not have", "permission": missing})
+			return
+		}
 		params = append(params, *req.Role)
 		updates = append(updates, "role = $"+strconv.Itoa(len(params)))
 	}
@@ -241,16 +611,32 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 	params = append(params, id)
 	query := "UPDATE users SET " + strings.Join(updates, ", ") + " WHERE id = $" + strconv.Itoa(len(params))
 
+	before := h.audit.Snapshot(userSnapshotQuery, id)
+
 	_, err = h.db.Exec(query, params...)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to update user", zap.Error(err), zap.Int64("user_id", id))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
+	// A role change must not be outlived by tokens carrying the old role
+	if req.Role != nil {
+		if err := h.sessions.RevokeAllSessions(id); err != nil {
+			h.logger.Error("Failed to revoke sessions after role change", zap.Error(err), zap.Int64("user_id", id))
+		}
+	}
+
+	h.audit.Record(auditActor(c), "user.update", "user", id, before, h.audit.Snapshot(userSnapshotQuery, id))
+
 	// Fetch the updated user to return it
 	var updatedUser User
-	err = h.db.QueryRow("SELECT id, email, role FROM users WHERE id = $1", id).Scan(&updatedUser.ID, &updatedUser.Email, &updatedUser.Role)
+	err = h.db.QueryRow("SELECT id, email, role, email_verified_at IS NOT NULL FROM users WHERE id = $1", id).Scan(&updatedUser.ID, &updatedUser.Email, &updatedUser.Role, &updatedUser.EmailVerified)
 	if err != nil {
 		h.logger.Error("Failed to fetch updated user", zap.Error(err), zap.Int64("user_id", id))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated user details"})
@@ -260,25 +646,6 @@ func (h *AuthHandler) UpdateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, updatedUser)
 }
 
-// DeleteUser handles deleting a user
-func (h *AuthHandler) DeleteUser(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	_, err = h.db.Exec("DELETE FROM users WHERE id = $1", id)
-	if err != nil {
-		h.logger.Error("Failed to delete user", zap.Error(err), zap.Int64("user_id", id))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
-}
-
 func (h *AuthHandler) GetUsers(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -293,12 +660,21 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	baseQuery := "SELECT id, email, role FROM users"
+	baseQuery := "SELECT id, email, role, email_verified_at IS NOT NULL, archived_at FROM users"
 	countQuery := "SELECT COUNT(*) FROM users"
 	args := []interface{}{}
 	whereClauses := []string{}
 	argCount := 1
 
+	archived, err := archivedFilter(c, "archived_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if archived != "" {
+		whereClauses = append(whereClauses, archived)
+	}
+
 	if search != "" {
 		whereClauses = append(whereClauses, "email ILIKE $" + strconv.Itoa(argCount))
 		args = append(args, "%"+search+"%")
@@ -332,7 +708,7 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 	var users []User
 	for rows.Next() {
 		var user User
-		if err := rows.Scan(&user.ID, &user.Email, &user.Role); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified, &user.ArchivedAt); err != nil {
 			h.logger.Error("Failed to scan user row", zap.Error(err))
 			// Don't return on a single row scan error, just log and continue
 			continue
@@ -354,26 +730,52 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 	})
 }
 
-// generateToken creates a JWT token for the user
-func (h *AuthHandler) generateToken(userID int64, email, role string) (string, int64, error) {
-	expiresAt := time.Now().Add(24 * time.Hour).Unix()
+// issueSession creates an access token and a new refresh token family for the user
+func (h *AuthHandler) issueSession(c *gin.Context, user User) (AuthResponse, error) {
+	token, expiresAt, err := h.generateToken(user.ID, user.Email, user.Role)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	rt, err := h.sessions.IssueRefreshToken(user.ID, h.config.RefreshTokenTTL, clientInfo(c))
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	return AuthResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     rt.Value,
+		RefreshExpiresAt: rt.ExpiresAt.Unix(),
+		User:             user,
+	}, nil
+}
 
-	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Unix(expiresAt, 0)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "finspeed-api",
-		},
+// revokeCurrentAccessToken puts the jti of the request's access token on the deny list
+func (h *AuthHandler) revokeCurrentAccessToken(c *gin.Context) error {
+	jti := c.GetString("token_id")
+	expiresAt := c.GetTime("token_expires_at")
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(h.config.AccessTokenTTL)
 	}
+	return h.sessions.RevokeAccessToken(jti, c.GetInt64("user_id"), expiresAt)
+}
+
+func clientInfo(c *gin.Context) auth.ClientInfo {
+	return auth.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(h.config.JWTSecret))
+// generateToken creates a signed access token for the user
+func (h *AuthHandler) generateToken(userID int64, email, role string) (string, int64, error) {
+	token, _, expiresAt, err := h.jwt.Issue(userID, email, role)
 	if err != nil {
 		return "", 0, err
 	}
+	return token, expiresAt.Unix(), nil
+}
 
-	return tokenString, expiresAt, nil
+// JWKS handles GET /.well-known/jwks.json so other services can verify access tokens
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwt.JWKS())
 }
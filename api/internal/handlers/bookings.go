@@ -0,0 +1,707 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/razorpay/razorpay-go"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/bookings"
+	"finspeed/api/internal/config"
+	"finspeed/api/internal/mailer"
+)
+
+// maxCalendarDays caps the range of the admin booking calendar
+const maxCalendarDays = 62
+
+// BookingHandler serves service types, booking hours and bookings of workshop services and test rides
+type BookingHandler struct {
+	logger   *zap.Logger
+	bookings *bookings.Store
+	mailer   mailer.Mailer
+	cfg      *config.Config
+	audit    *audit.Recorder
+}
+
+// ServiceTypeRequest creates or updates a service type; prepayment defaults to none and is_active to true
+type ServiceTypeRequest struct {
+	Code            string  `json:"code" binding:"required,max=50"`
+	Name            string  `json:"name" binding:"required,max=200"`
+	Kind            string  `json:"kind" binding:"required"`
+	Description     *string `json:"description" binding:"omitempty,max=5000"`
+	DurationMinutes int     `json:"duration_minutes" binding:"required,gt=0,lte=480"`
+	Price           float64 `json:"price" binding:"gte=0"`
+	Prepayment      string  `json:"prepayment"`
+	IsActive        *bool   `json:"is_active"`
+}
+
+// BookingHoursRequest replaces a location's weekly hours for one kind of booking
+type BookingHoursRequest struct {
+	Kind  string                   `json:"kind" binding:"required"`
+	Hours []BookingHoursDayRequest `json:"hours" binding:"max=7,dive"`
+}
+
+// BookingHoursDayRequest is one weekday's booking hours; slot_minutes defaults to 30
+type BookingHoursDayRequest struct {
+	Weekday     int    `json:"weekday" binding:"min=0,max=6"`
+	OpensAt     string `json:"opens_at" binding:"required"`
+	ClosesAt    string `json:"closes_at" binding:"required"`
+	SlotMinutes int    `json:"slot_minutes" binding:"omitempty,min=5,max=240"`
+	Capacity    int    `json:"capacity" binding:"required,gt=0"`
+}
+
+// BookingClosureRequest closes a location for bookings on a date (YYYY-MM-DD)
+type BookingClosureRequest struct {
+	Date   string  `json:"date" binding:"required"`
+	Reason *string `json:"reason" binding:"omitempty,max=200"`
+}
+
+// BookingRequest books a slot; product_id names the bike to ride or service
+type BookingRequest struct {
+	ServiceTypeID int64     `json:"service_type_id" binding:"required"`
+	LocationID    int64     `json:"location_id" binding:"required"`
+	StartsAt      time.Time `json:"starts_at" binding:"required"`
+	ProductID     *int64    `json:"product_id"`
+	Notes         *string   `json:"notes" binding:"omitempty,max=2000"`
+}
+
+// CancelBookingRequest optionally says why a booking is cancelled
+type CancelBookingRequest struct {
+	Reason *string `json:"reason" binding:"omitempty,max=500"`
+}
+
+// CalendarDay is one day of the admin booking calendar
+type CalendarDay struct {
+	Date     string             `json:"date"`
+	Bookings []bookings.Booking `json:"bookings"`
+}
+
+func NewBookingHandler(logger *zap.Logger, store *bookings.Store, mail mailer.Mailer, cfg *config.Config, recorder *audit.Recorder) *BookingHandler {
+	return &BookingHandler{
+		logger:   logger,
+		bookings: store,
+		mailer:   mail,
+		cfg:      cfg,
+		audit:    recorder,
+	}
+}
+
+// respondBookingError maps store errors to responses; notFound names the missing entity and failed is
+// the message for unexpected errors
+func (h *BookingHandler) respondBookingError(c *gin.Context, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, bookings.ErrDuplicateCode):
+		c.JSON(http.StatusConflict, gin.H{"error": "A service type with this code already exists"})
+	case errors.Is(err, bookings.ErrInactive):
+		c.JSON(http.StatusConflict, gin.H{"error": "This service is not available for booking"})
+	case errors.Is(err, bookings.ErrNoHours):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The location does not take bookings for this service"})
+	case errors.Is(err, bookings.ErrClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "The location is closed on this day"})
+	case errors.Is(err, bookings.ErrInvalidSlot):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The time is not a bookable slot"})
+	case errors.Is(err, bookings.ErrTooFarAhead):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Bookings open at most %d days ahead", int(bookings.MaxAdvance.Hours()/24))})
+	case errors.Is(err, bookings.ErrSlotFull):
+		c.JSON(http.StatusConflict, gin.H{"error": "The slot is fully booked"})
+	case errors.Is(err, bookings.ErrUnknownProduct):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown product"})
+	case errors.Is(err, bookings.ErrTooLate):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Bookings cannot be cancelled online less than %s before they start", h.cfg.BookingCancelCutoff)})
+	case errors.Is(err, bookings.ErrWrongStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "The booking's status does not allow this"})
+	case errors.Is(err, bookings.ErrNotStarted):
+		c.JSON(http.StatusConflict, gin.H{"error": "The booking has not started yet"})
+	case errors.Is(err, errRefundFailed):
+		h.logger.Warn(failed, zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment provider refused the refund"})
+	default:
+		h.logger.Error(failed, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// bookingParamID parses the :id parameter, responding with an error naming what when it is invalid
+func bookingParamID(c *gin.Context, what string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + what + " ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetServiceTypes handles GET /api/v1/service-types
+// It lists what can be booked, each with the locations that take bookings for it.
+func (h *BookingHandler) GetServiceTypes(c *gin.Context) {
+	list, err := h.bookings.ServiceTypes(true)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to fetch service types")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service_types": list})
+}
+
+// GetSlots handles GET /api/v1/service-types/:id/slots
+// It takes ?location_id= and ?date= (YYYY-MM-DD, in India Standard Time) and lists the day's start times.
+func (h *BookingHandler) GetSlots(c *gin.Context) {
+	id, ok := bookingParamID(c, "service type")
+	if !ok {
+		return
+	}
+	locationID, err := strconv.ParseInt(c.Query("location_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_id"})
+		return
+	}
+	day, err := time.ParseInLocation("2006-01-02", c.Query("date"), bookings.Zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date; use YYYY-MM-DD"})
+		return
+	}
+
+	slots, err := h.bookings.Slots(id, locationID, day)
+	if err != nil {
+		h.respondBookingError(c, err, "Service type not found", "Failed to fetch slots")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"date": day.Format("2006-01-02"), "slots": slots})
+}
+
+// CreateBooking handles POST /api/v1/bookings
+// Bookings of services that require prepayment wait for payment and hold their slot for the payment
+// window; the others are confirmed straight away.
+func (h *BookingHandler) CreateBooking(c *gin.Context) {
+	var req BookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	b, err := h.bookings.Create(bookings.NewBooking{
+		UserID:        c.GetInt64("user_id"),
+		ServiceTypeID: req.ServiceTypeID,
+		LocationID:    req.LocationID,
+		ProductID:     req.ProductID,
+		StartsAt:      req.StartsAt,
+		Notes:         optionalString(req.Notes),
+	})
+	if err != nil {
+		h.respondBookingError(c, err, "Service type not found", "Failed to create booking")
+		return
+	}
+
+	h.logger.Info("Booking created", zap.Int64("booking_id", b.ID), zap.Int64("user_id", b.UserID), zap.String("status", string(b.Status)))
+	h.notifyBooked(b)
+	c.JSON(http.StatusCreated, b)
+}
+
+// GetMyBookings handles GET /api/v1/bookings
+func (h *BookingHandler) GetMyBookings(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	list, total, err := h.bookings.Bookings(c.GetInt64("user_id"), limit, (page-1)*limit)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to fetch bookings")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"bookings": list,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// GetMyBooking handles GET /api/v1/bookings/:id
+func (h *BookingHandler) GetMyBooking(c *gin.Context) {
+	h.getBooking(c, c.GetInt64("user_id"))
+}
+
+// CancelMyBooking handles POST /api/v1/bookings/:id/cancel
+// Confirmed bookings can be cancelled until BOOKING_CANCEL_CUTOFF before they start. A prepaid booking is
+// refunded in full.
+func (h *BookingHandler) CancelMyBooking(c *gin.Context) {
+	h.cancel(c, c.GetInt64("user_id"))
+}
+
+// GetServiceTypesAdmin handles GET /api/v1/admin/service-types
+// It lists inactive service types too.
+func (h *BookingHandler) GetServiceTypesAdmin(c *gin.Context) {
+	list, err := h.bookings.ServiceTypes(false)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to fetch service types")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service_types": list})
+}
+
+// CreateServiceType handles POST /api/v1/admin/service-types
+func (h *BookingHandler) CreateServiceType(c *gin.Context) {
+	t, ok := h.bindServiceType(c)
+	if !ok {
+		return
+	}
+	if err := h.bookings.SaveServiceType(t); err != nil {
+		h.respondBookingError(c, err, "", "Failed to create service type")
+		return
+	}
+	t, err := h.bookings.ServiceType(t.ID)
+	if err != nil {
+		h.respondBookingError(c, err, "Service type not found", "Failed to fetch service type")
+		return
+	}
+
+	h.logger.Info("Service type created", zap.Int64("service_type_id", t.ID), zap.String("code", t.Code))
+	h.audit.Record(auditActor(c), "service_type.create", "service_type", t.ID, nil, t)
+	c.JSON(http.StatusCreated, t)
+}
+
+// UpdateServiceType handles PUT /api/v1/admin/service-types/:id
+// Existing bookings keep the duration and price they were made with.
+func (h *BookingHandler) UpdateServiceType(c *gin.Context) {
+	id, ok := bookingParamID(c, "service type")
+	if !ok {
+		return
+	}
+	before, err := h.bookings.ServiceType(id)
+	if err != nil {
+		h.respondBookingError(c, err, "Service type not found", "Failed to update service type")
+		return
+	}
+	t, ok := h.bindServiceType(c)
+	if !ok {
+		return
+	}
+	t.ID = id
+	if err := h.bookings.SaveServiceType(t); err != nil {
+		h.respondBookingError(c, err, "Service type not found", "Failed to update service type")
+		return
+	}
+	after, err := h.bookings.ServiceType(id)
+	if err != nil {
+		h.respondBookingError(c, err, "Service type not found", "Failed to fetch service type")
+		return
+	}
+
+	h.logger.Info("Service type updated", zap.Int64("service_type_id", id))
+	h.audit.Record(auditActor(c), "service_type.update", "service_type", id, before, after)
+	c.JSON(http.StatusOK, after)
+}
+
+// bindServiceType reads and validates a ServiceTypeRequest, responding with an error when it is invalid
+func (h *BookingHandler) bindServiceType(c *gin.Context) (*bookings.ServiceType, bool) {
+	var req ServiceTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return nil, false
+	}
+	t := &bookings.ServiceType{
+		Code:            strings.TrimSpace(req.Code),
+		Name:            strings.TrimSpace(req.Name),
+		Kind:            bookings.Kind(req.Kind),
+		Description:     optionalString(req.Description),
+		DurationMinutes: req.DurationMinutes,
+		Price:           req.Price,
+		Prepayment:      bookings.Prepayment(req.Prepayment),
+		IsActive:        req.IsActive == nil || *req.IsActive,
+	}
+	if t.Prepayment == "" {
+		t.Prepayment = bookings.PrepaymentNone
+	}
+	switch {
+	case t.Code == "" || t.Name == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code and name cannot be blank"})
+	case !bookings.ValidKind(t.Kind):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kind must be service or test_ride"})
+	case !bookings.ValidPrepayment(t.Prepayment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prepayment must be none, optional or required"})
+	case t.Prepayment != bookings.PrepaymentNone && t.Price <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prepayment needs a price"})
+	default:
+		return t, true
+	}
+	return nil, false
+}
+
+// GetBookingHours handles GET /api/v1/admin/locations/:id/booking-hours
+// It returns the location's weekly hours for each kind of booking.
+func (h *BookingHandler) GetBookingHours(c *gin.Context) {
+	id, ok := bookingParamID(c, "location")
+	if !ok {
+		return
+	}
+	resp := gin.H{}
+	for _, kind := range []bookings.Kind{bookings.KindService, bookings.KindTestRide} {
+		hours, err := h.bookings.Hours(id, kind)
+		if err != nil {
+			h.respondBookingError(c, err, "", "Failed to fetch booking hours")
+			return
+		}
+		resp[string(kind)] = hours
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetBookingHours handles PUT /api/v1/admin/locations/:id/booking-hours
+// It replaces the week for one kind; weekdays left out take no bookings. Existing bookings are kept.
+func (h *BookingHandler) SetBookingHours(c *gin.Context) {
+	id, ok := bookingParamID(c, "location")
+	if !ok {
+		return
+	}
+	var req BookingHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	kind := bookings.Kind(req.Kind)
+	if !bookings.ValidKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kind must be service or test_ride"})
+		return
+	}
+	hours := make([]bookings.Hours, len(req.Hours))
+	seen := map[int]bool{}
+	for i, d := range req.Hours {
+		if seen[d.Weekday] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each weekday can appear only once"})
+			return
+		}
+		seen[d.Weekday] = true
+		opens, err1 := time.Parse("15:04", d.OpensAt)
+		closes, err2 := time.Parse("15:04", d.ClosesAt)
+		if err1 != nil || err2 != nil || !closes.After(opens) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Opening hours must be HH:MM, closing after opening"})
+			return
+		}
+		slot := d.SlotMinutes
+		if slot == 0 {
+			slot = 30
+		}
+		hours[i] = bookings.Hours{Weekday: d.Weekday, OpensAt: d.OpensAt, ClosesAt: d.ClosesAt, SlotMinutes: slot, Capacity: d.Capacity}
+	}
+
+	before, err := h.bookings.Hours(id, kind)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to update booking hours")
+		return
+	}
+	if err := h.bookings.SetHours(id, kind, hours); err != nil {
+		h.respondBookingError(c, err, "Location not found", "Failed to update booking hours")
+		return
+	}
+	after, err := h.bookings.Hours(id, kind)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to fetch booking hours")
+		return
+	}
+
+	h.logger.Info("Booking hours updated", zap.Int64("location_id", id), zap.String("kind", string(kind)))
+	h.audit.Record(auditActor(c), "location.booking_hours", "location", id, gin.H{string(kind): before}, gin.H{string(kind): after})
+	c.JSON(http.StatusOK, gin.H{string(kind): after})
+}
+
+// GetBookingClosures handles GET /api/v1/admin/locations/:id/booking-closures
+// It lists closures from ?from= (YYYY-MM-DD, default today) on.
+func (h *BookingHandler) GetBookingClosures(c *gin.Context) {
+	id, ok := bookingParamID(c, "location")
+	if !ok {
+		return
+	}
+	from := c.DefaultQuery("from", time.Now().In(bookings.Zone).Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", from); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from; use YYYY-MM-DD"})
+		return
+	}
+	list, err := h.bookings.Closures(id, from)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to fetch closures")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"closures": list})
+}
+
+// AddBookingClosure handles POST /api/v1/admin/locations/:id/booking-closures
+// Bookings already made for the day are kept; staff cancel them if need be.
+func (h *BookingHandler) AddBookingClosure(c *gin.Context) {
+	id, ok := bookingParamID(c, "location")
+	if !ok {
+		return
+	}
+	var req BookingClosureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date; use YYYY-MM-DD"})
+		return
+	}
+
+	closure, err := h.bookings.AddClosure(id, req.Date, optionalString(req.Reason))
+	if err != nil {
+		if errors.Is(err, bookings.ErrClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The location is already closed on this day"})
+			return
+		}
+		h.respondBookingError(c, err, "Location not found", "Failed to add closure")
+		return
+	}
+
+	h.logger.Info("Booking closure added", zap.Int64("location_id", id), zap.String("date", closure.Date))
+	h.audit.Record(auditActor(c), "booking_closure.create", "booking_closure", closure.ID, nil, closure)
+	c.JSON(http.StatusCreated, closure)
+}
+
+// DeleteBookingClosure handles DELETE /api/v1/admin/booking-closures/:id
+func (h *BookingHandler) DeleteBookingClosure(c *gin.Context) {
+	id, ok := bookingParamID(c, "closure")
+	if !ok {
+		return
+	}
+	if err := h.bookings.DeleteClosure(id); err != nil {
+		h.respondBookingError(c, err, "Closure not found", "Failed to delete closure")
+		return
+	}
+
+	h.logger.Info("Booking closure deleted", zap.Int64("closure_id", id))
+	h.audit.Record(auditActor(c), "booking_closure.delete", "booking_closure", id, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Closure deleted"})
+}
+
+// GetBookingCalendar handles GET /api/v1/admin/bookings
+// It lists bookings by day from ?from= to ?to= (YYYY-MM-DD, inclusive; default the next 7 days, at most
+// 62 days) and takes ?location_id=, ?kind= and ?status=.
+func (h *BookingHandler) GetBookingCalendar(c *gin.Context) {
+	today := time.Now().In(bookings.Zone).Format("2006-01-02")
+	from, err := time.ParseInLocation("2006-01-02", c.DefaultQuery("from", today), bookings.Zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from; use YYYY-MM-DD"})
+		return
+	}
+	to := from.AddDate(0, 0, 6)
+	if v := c.Query("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, bookings.Zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to; use YYYY-MM-DD"})
+			return
+		}
+	}
+	if to.Before(from) || to.After(from.AddDate(0, 0, maxCalendarDays-1)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to must be on or after from and at most %d days later", maxCalendarDays-1)})
+		return
+	}
+	var locationID int64
+	if v := c.Query("location_id"); v != "" {
+		if locationID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_id"})
+			return
+		}
+	}
+	kind := bookings.Kind(c.Query("kind"))
+	if kind != "" && !bookings.ValidKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown kind"})
+		return
+	}
+	status := bookings.Status(c.Query("status"))
+	if status != "" && !bookings.ValidStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+
+	list, err := h.bookings.Calendar(from, to.AddDate(0, 0, 1), locationID, kind, status)
+	if err != nil {
+		h.respondBookingError(c, err, "", "Failed to fetch bookings")
+		return
+	}
+	days := []CalendarDay{}
+	byDate := map[string]int{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		byDate[date] = len(days)
+		days = append(days, CalendarDay{Date: date, Bookings: []bookings.Booking{}})
+	}
+	for _, b := range list {
+		i := byDate[b.StartsAt.Format("2006-01-02")]
+		days[i].Bookings = append(days[i].Bookings, b)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		"days": days,
+	})
+}
+
+// GetBooking handles GET /api/v1/admin/bookings/:id
+func (h *BookingHandler) GetBooking(c *gin.Context) {
+	h.getBooking(c, 0)
+}
+
+// CompleteBooking handles POST /api/v1/admin/bookings/:id/complete
+func (h *BookingHandler) CompleteBooking(c *gin.Context) {
+	h.finish(c, "booking.complete", h.bookings.Complete)
+}
+
+// MarkBookingNoShow handles POST /api/v1/admin/bookings/:id/no-show
+// Only bookings that have started can be marked; a prepayment is kept.
+func (h *BookingHandler) MarkBookingNoShow(c *gin.Context) {
+	h.finish(c, "booking.no_show", h.bookings.NoShow)
+}
+
+// CancelBooking handles POST /api/v1/admin/bookings/:id/cancel
+// Staff can cancel at any time before the booking is completed. A prepaid booking is refunded in full.
+func (h *BookingHandler) CancelBooking(c *gin.Context) {
+	h.cancel(c, 0)
+}
+
+func (h *BookingHandler) getBooking(c *gin.Context, userID int64) {
+	id, ok := bookingParamID(c, "booking")
+	if !ok {
+		return
+	}
+	b, err := h.bookings.Booking(id, userID)
+	if err != nil {
+		h.respondBookingError(c, err, "Booking not found", "Failed to fetch booking")
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// cancel cancels a booking for the customer, or for staff when userID is zero, and emails the customer
+func (h *BookingHandler) cancel(c *gin.Context, userID int64) {
+	id, ok := bookingParamID(c, "booking")
+	if !ok {
+		return
+	}
+	var req CancelBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	before, err := h.bookings.Booking(id, userID)
+	if err != nil {
+		h.respondBookingError(c, err, "Booking not found", "Failed to cancel booking")
+		return
+	}
+
+	b, err := h.bookings.Cancel(id, userID, h.cfg.BookingCancelCutoff, optionalString(req.Reason),
+		func(paymentID string, amount float64) (string, error) {
+			return h.issueRefund(id, paymentID, amount)
+		})
+	if err != nil {
+		h.respondBookingError(c, err, "Booking not found", "Failed to cancel booking")
+		return
+	}
+
+	h.logger.Info("Booking cancelled", zap.Int64("booking_id", id), zap.Bool("by_staff", userID == 0))
+	if userID == 0 {
+		h.audit.Record(auditActor(c), "booking.cancel", "booking", id, before, b)
+	}
+	h.notifyCancelled(b)
+	c.JSON(http.StatusOK, b)
+}
+
+// finish applies a staff transition that ends a confirmed booking and audits it
+func (h *BookingHandler) finish(c *gin.Context, action string, apply func(id int64) (*bookings.Booking, error)) {
+	id, ok := bookingParamID(c, "booking")
+	if !ok {
+		return
+	}
+	before, err := h.bookings.Booking(id, 0)
+	if err != nil {
+		h.respondBookingError(c, err, "Booking not found", "Failed to update booking")
+		return
+	}
+	b, err := apply(id)
+	if err != nil {
+		h.respondBookingError(c, err, "Booking not found", "Failed to update booking")
+		return
+	}
+
+	h.logger.Info("Booking updated", zap.Int64("booking_id", id), zap.String("status", string(b.Status)))
+	h.audit.Record(auditActor(c), action, "booking", id, before, b)
+	c.JSON(http.StatusOK, b)
+}
+
+// issueRefund refunds amount rupees of a booking's Razorpay payment and returns the refund ID. A refund
+// already made for the booking, by an attempt whose result was not saved, is returned instead of refunding twice.
+func (h *BookingHandler) issueRefund(id int64, paymentID string, amount float64) (string, error) {
+	client := razorpay.NewClient(h.cfg.RazorpayKeyID, h.cfg.RazorpayKeySecret)
+	receipt := fmt.Sprintf("booking_%d", id)
+	ref, _, err := findRefund(client, paymentID, receipt)
+	if err != nil {
+		return "", err
+	}
+	if ref != "" {
+		h.logger.Warn("Refund already issued, recording it", zap.Int64("booking_id", id), zap.String("payment_id", paymentID), zap.String("refund_id", ref))
+		return ref, nil
+	}
+
+	data := map[string]interface{}{
+		"receipt": receipt,
+		"notes":   map[string]interface{}{"booking_id": id},
+	}
+	refund, err := client.Payment.Refund(paymentID, int(math.Round(amount*100)), data, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errRefundFailed, err)
+	}
+	ref, _ = refund["id"].(string)
+	// Logged before it is stored, so a refund is never lost if saving it fails
+	h.logger.Info("Refund issued", zap.Int64("booking_id", id), zap.String("payment_id", paymentID), zap.String("refund_id", ref), zap.Float64("amount", amount))
+	return ref, nil
+}
+
+// notifyBooked emails the customer their new booking, with a reminder to pay when it needs prepayment
+func (h *BookingHandler) notifyBooked(b *bookings.Booking) {
+	subject := fmt.Sprintf("Your Finspeed booking for %s on %s", b.ServiceName, b.When())
+	body := fmt.Sprintf("Your booking #%d for %s at %s on %s is confirmed.\n", b.ID, b.ServiceName, b.LocationName, b.When())
+	if b.Status == bookings.StatusPendingPayment {
+		subject = fmt.Sprintf("Complete payment for your Finspeed booking on %s", b.When())
+		body = fmt.Sprintf("We are holding %s at %s on %s for you as booking #%d.\n\n"+
+			"Please pay ₹%.2f by %s to confirm it; otherwise the booking is cancelled.\n",
+			b.ServiceName, b.LocationName, b.When(), b.ID, b.Price, b.PayBy.Format("15:04"))
+	}
+	h.sendBookingEmail(b, subject, body)
+}
+
+// notifyCancelled emails the customer that their booking was cancelled and whether it was refunded
+func (h *BookingHandler) notifyCancelled(b *bookings.Booking) {
+	subject := fmt.Sprintf("Your Finspeed booking on %s is cancelled", b.When())
+	body := fmt.Sprintf("Your booking #%d for %s at %s on %s has been cancelled.\n", b.ID, b.ServiceName, b.LocationName, b.When())
+	if b.RefundRef != nil {
+		body += fmt.Sprintf("\nWe have refunded ₹%.2f. ", b.Price)
+		body += "The refund goes back to your original payment method and usually shows up within 5-7 business days."
+	}
+	h.sendBookingEmail(b, subject, body)
+}
+
+// sendBookingEmail sends a message to the booking's customer in the background
+func (h *BookingHandler) sendBookingEmail(b *bookings.Booking, subject, body string) {
+	to := b.CustomerEmail
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+			h.logger.Error("Failed to send email", zap.Error(err), zap.String("subject", subject))
+		}
+	}()
+}
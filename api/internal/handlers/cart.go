@@ -72,7 +72,7 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 
 	// Validate product exists and has stock
 	var stockQty int
-	err := h.db.QueryRow("SELECT stock_qty FROM products WHERE id = $1", req.ProductID).Scan(&stockQty)
+	err := h.db.QueryRow("SELECT stock_qty FROM products p WHERE id = $1 AND "+publishedProductCondition, req.ProductID).Scan(&stockQty)
 	if err != nil {
 		h.logger.Error("Product not found", zap.Int("product_id", req.ProductID))
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
@@ -149,7 +149,7 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 			} else {
 				// Validate stock
 				var stockQty int
-				err := h.db.QueryRow("SELECT stock_qty FROM products WHERE id = $1", productID).Scan(&stockQty)
+				err := h.db.QueryRow("SELECT stock_qty FROM products p WHERE id = $1 AND "+publishedProductCondition, productID).Scan(&stockQty)
 				if err != nil {
 					h.logger.Error("Product not found", zap.Int("product_id", productID))
 					c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
@@ -286,17 +286,16 @@ func (h *CartHandler) enrichCart(cart []CartItem) (Cart, error) {
 		var categoryName, categorySlug string
 		
 		query := `
-			SELECT p.id, p.title, p.slug, p.price, p.currency, p.sku, p.hsn, 
+			SELECT p.id, p.title, p.slug, p.price, ` + effectivePriceExpr + `, p.sale_price, p.currency, p.sku, p.hsn, 
 			       p.stock_qty, p.category_id, p.specs_json, p.warranty_months, 
 			       p.created_at, p.updated_at, COALESCE(c.name, '') as category_name, 
 			       COALESCE(c.slug, '') as category_slug
 			FROM products p
-			LEFT JOIN categories c ON p.category_id = c.id
-			WHERE p.id = $1
-		`
+			LEFT JOIN categories c ON p.category_id = c.id AND c.archived_at IS NULL
+			WHERE p.id = $1 AND ` + publishedProductCondition
 
 		err := h.db.QueryRow(query, item.ProductID).Scan(
-			&p.ID, &p.Title, &p.Slug, &p.Price, &p.Currency, &p.SKU, &p.HSN,
+			&p.ID, &p.Title, &p.Slug, &p.Price, &p.EffectivePrice, &p.SalePrice, &p.Currency, &p.SKU, &p.HSN,
 			&p.StockQty, &p.CategoryID, &p.SpecsJSON, &p.WarrantyMonths,
 			&p.CreatedAt, &p.UpdatedAt, &categoryName, &categorySlug,
 		)
@@ -306,6 +305,8 @@ func (h *CartHandler) enrichCart(cart []CartItem) (Cart, error) {
 			continue // Skip invalid products
 		}
 
+		p.setCompareAtPrice()
+
 		// Add category if present
 		if categoryName != "" && p.CategoryID != nil {
 			p.Category = &Category{
@@ -321,7 +322,7 @@ func (h *CartHandler) enrichCart(cart []CartItem) (Cart, error) {
 			p.Images = images
 		}
 
-		itemSubtotal := p.Price * float64(item.Qty)
+		itemSubtotal := p.EffectivePrice * float64(item.Qty)
 		enrichedItem := CartItem{
 			ProductID: item.ProductID,
 			Qty:       item.Qty,
@@ -2,19 +2,23 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
+	"finspeed/api/internal/audit"
 	"finspeed/api/internal/database"
 )
 
 type CategoryHandler struct {
 	db     *database.DB
 	logger *zap.Logger
+	audit  *audit.Recorder
 }
 
 type Category struct {
@@ -22,6 +26,8 @@ type Category struct {
 	Name     string `json:"name"`
 	Slug     string `json:"slug"`
 	ParentID *int64 `json:"parent_id,omitempty"`
+	// Only set in admin listings
+	ArchivedAt *string `json:"archived_at,omitempty"`
 }
 
 type CreateCategoryRequest struct {
@@ -43,15 +49,26 @@ type CategoriesResponse struct {
 	Limit      int        `json:"limit"`
 }
 
-func NewCategoryHandler(db *database.DB, logger *zap.Logger) *CategoryHandler {
+func NewCategoryHandler(db *database.DB, logger *zap.Logger, recorder *audit.Recorder) *CategoryHandler {
 	return &CategoryHandler{
 		db:     db,
 		logger: logger,
+		audit:  recorder,
 	}
 }
 
 // GetCategories handles GET /api/v1/categories
 func (h *CategoryHandler) GetCategories(c *gin.Context) {
+	h.listCategories(c, false)
+}
+
+// GetAdminCategories handles GET /api/v1/admin/categories
+// Takes the same filters as GetCategories plus ?archived=exclude|include|only.
+func (h *CategoryHandler) GetAdminCategories(c *gin.Context) {
+	h.listCategories(c, true)
+}
+
+func (h *CategoryHandler) listCategories(c *gin.Context, admin bool) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	search := c.Query("search")
@@ -65,12 +82,24 @@ func (h *CategoryHandler) GetCategories(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	baseQuery := "SELECT id, name, slug, parent_id FROM categories"
+	baseQuery := "SELECT id, name, slug, parent_id, archived_at FROM categories"
 	countQuery := "SELECT COUNT(*) FROM categories"
 	args := []interface{}{}
-	whereClauses := []string{}
+	whereClauses := []string{"archived_at IS NULL"}
 	argCount := 1
 
+	if admin {
+		clause, err := archivedFilter(c, "archived_at")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		whereClauses = whereClauses[:0]
+		if clause != "" {
+			whereClauses = append(whereClauses, clause)
+		}
+	}
+
 	if search != "" {
 		whereClauses = append(whereClauses, "(name ILIKE $" + strconv.Itoa(argCount) + " OR slug ILIKE $" + strconv.Itoa(argCount) + ")")
 		args = append(args, "%"+search+"%")
@@ -104,7 +133,7 @@ func (h *CategoryHandler) GetCategories(c *gin.Context) {
 	var categories []Category
 	for rows.Next() {
 		var cat Category
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.ParentID)
+		err := rows.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.ParentID, &cat.ArchivedAt)
 		if err != nil {
 			h.logger.Error("Failed to scan category", zap.Error(err))
 			continue
@@ -132,7 +161,7 @@ func (h *CategoryHandler) GetCategory(c *gin.Context) {
 	query := `
 		SELECT id, name, slug, parent_id
 		FROM categories
-		WHERE slug = $1
+		WHERE slug = $1 AND archived_at IS NULL
 	`
 
 	err := h.db.QueryRow(query, slug).Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.ParentID)
@@ -173,6 +202,7 @@ func (h *CategoryHandler) CreateCategory(c *gin.Context) {
 	}
 
 	h.logger.Info("Category created successfully", zap.Int64("category_id", categoryID))
+	h.audit.Record(auditActor(c), "category.create", "category", categoryID, nil, h.audit.Snapshot(categorySnapshotQuery, categoryID))
 
 	// Return the created category
 	category := Category{
@@ -230,6 +260,8 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	query += " WHERE id = $" + strconv.Itoa(argId)
 	args = append(args, id)
 
+	before := h.audit.Snapshot(categorySnapshotQuery, id)
+
 	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		h.logger.Error("Failed to update category", zap.Error(err))
@@ -250,11 +282,22 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	}
 
 	h.logger.Info("Category updated successfully", zap.Int64("category_id", id))
+	h.audit.Record(auditActor(c), "category.update", "category", id, before, h.audit.Snapshot(categorySnapshotQuery, id))
 	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully"})
 }
 
 // DeleteCategory handles DELETE /api/v1/admin/categories/:id
+// The category is archived; its products stay listed without it.
 func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	h.setCategoryArchived(c, true)
+}
+
+// RestoreCategory handles POST /api/v1/admin/categories/:id/restore
+func (h *CategoryHandler) RestoreCategory(c *gin.Context) {
+	h.setCategoryArchived(c, false)
+}
+
+func (h *CategoryHandler) setCategoryArchived(c *gin.Context, archive bool) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
@@ -262,26 +305,96 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	query := "DELETE FROM categories WHERE id = $1"
+	before := h.audit.Snapshot(categorySnapshotQuery, id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	// Keep the visible tree connected: no active child under an archived parent
+	query := "UPDATE categories SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL"
+	check := "SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1 AND archived_at IS NULL)"
+	conflict := "Archive the subcategories first"
+	action, message := "category.archive", "Category archived successfully"
+	if !archive {
+		query = "UPDATE categories SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL"
+		check = "SELECT EXISTS (SELECT 1 FROM categories c JOIN categories p ON p.id = c.parent_id WHERE c.id = $1 AND p.archived_at IS NOT NULL)"
+		conflict = "Restore the parent category first"
+		action, message = "category.restore", "Category restored successfully"
+	}
+
+	var blocked bool
+	if err := h.db.QueryRow(check, id).Scan(&blocked); err != nil {
+		h.logger.Error("Failed to check category tree", zap.Error(err), zap.Int64("category_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusConflict, gin.H{"error": conflict})
+		return
+	}
+
 	result, err := h.db.Exec(query, id)
 	if err != nil {
-		h.logger.Error("Failed to delete category", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		h.logger.Error("Failed to change category archive state", zap.Error(err), zap.Int64("category_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		h.logger.Error("Failed to get rows affected", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
 		return
 	}
 
 	if rowsAffected == 0 {
+		if archive {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category is already archived"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category is not archived"})
+		}
+		return
+	}
+
+	h.logger.Info(message, zap.Int64("category_id", id))
+	h.audit.Record(auditActor(c), action, "category", id, before, h.audit.Snapshot(categorySnapshotQuery, id))
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// PurgeCategory handles DELETE /api/v1/admin/categories/:id/purge
+// Only archived categories without products or subcategories can be deleted permanently.
+func (h *CategoryHandler) PurgeCategory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	before := h.audit.Snapshot(categorySnapshotQuery, id)
+	if before == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 		return
 	}
 
-	h.logger.Info("Category deleted successfully", zap.Int64("category_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+	result, err := h.db.Exec("DELETE FROM categories WHERE id = $1 AND archived_at IS NOT NULL", id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category still has products or subcategories"})
+			return
+		}
+		h.logger.Error("Failed to purge category", zap.Error(err), zap.Int64("category_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge category"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Archive the category before purging it"})
+		return
+	}
+
+	h.logger.Info("Category purged", zap.Int64("category_id", id))
+	h.audit.Record(auditActor(c), "category.purge", "category", id, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted permanently"})
 }
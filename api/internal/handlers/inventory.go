@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/database"
+	"finspeed/api/internal/inventory"
+)
+
+// InventoryHandler serves manual stock movements and the stock ledger
+type InventoryHandler struct {
+	db        *database.DB
+	logger    *zap.Logger
+	inventory *inventory.Store
+	audit     *audit.Recorder
+}
+
+// StockMovementRequest carries a signed quantity: positive adds stock, negative removes it.
+// Sales and cancellations are recorded by orders and cannot be entered by hand.
+// LocationID defaults to the default location.
+type StockMovementRequest struct {
+	Kind       inventory.Kind `json:"kind" binding:"required"`
+	Quantity   int            `json:"quantity" binding:"required"`
+	Reason     string         `json:"reason" binding:"required"`
+	LocationID int64          `json:"location_id"`
+}
+
+func NewInventoryHandler(db *database.DB, logger *zap.Logger, store *inventory.Store, recorder *audit.Recorder) *InventoryHandler {
+	return &InventoryHandler{
+		db:        db,
+		logger:    logger,
+		inventory: store,
+		audit:     recorder,
+	}
+}
+
+// movementActor copies the request's actor onto a movement
+func movementActor(c *gin.Context, m inventory.Movement) inventory.Movement {
+	actor := auditActor(c)
+	m.ActorID = actor.UserID
+	m.APIKeyID = actor.APIKeyID
+	return m
+}
+
+// RecordStockMovement handles POST /api/v1/admin/products/:id/stock/movements
+func (h *InventoryHandler) RecordStockMovement(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req StockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	switch req.Kind {
+	case inventory.KindReceipt, inventory.KindAdjustment, inventory.KindReturn, inventory.KindDamage:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be one of receipt, adjustment, return or damage"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock movement"})
+		return
+	}
+	defer tx.Rollback()
+
+	balance, err := h.inventory.Record(tx, movementActor(c, inventory.Movement{
+		ProductID:  id,
+		LocationID: req.LocationID,
+		Kind:       req.Kind,
+		Quantity:   req.Quantity,
+		Reason:     req.Reason,
+	}))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		case errors.Is(err, inventory.ErrUnknownLocation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown location"})
+		case errors.Is(err, inventory.ErrInvalidMovement):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "receipt and return need a positive quantity, damage a negative one, adjustment any non-zero one"})
+		case errors.Is(err, inventory.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": "Stock cannot go below zero at the location"})
+		default:
+			h.logger.Error("Failed to record stock movement", zap.Error(err), zap.Int64("product_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock movement"})
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit stock movement", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock movement"})
+		return
+	}
+
+	h.logger.Info("Stock movement recorded", zap.Int64("product_id", id), zap.String("kind", string(req.Kind)), zap.Int("quantity", req.Quantity))
+	h.audit.Record(auditActor(c), "product.stock_"+string(req.Kind), "product", id,
+		gin.H{"stock_qty": balance - req.Quantity}, gin.H{"stock_qty": balance, "reason": req.Reason})
+	c.JSON(http.StatusCreated, gin.H{"stock_qty": balance})
+}
+
+// GetStockMovements handles GET /api/v1/admin/products/:id/stock/movements
+// ?kind= and ?location_id= restrict the history to one kind of movement or one location.
+func (h *InventoryHandler) GetStockMovements(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	kind := inventory.Kind(c.Query("kind"))
+	if kind != "" && !inventory.ValidKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown movement kind"})
+		return
+	}
+	var locationID int64
+	if v := c.Query("location_id"); v != "" {
+		if locationID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_id"})
+			return
+		}
+	}
+
+	var stockQty int
+	if err := h.db.QueryRow("SELECT stock_qty FROM products WHERE id = $1", id).Scan(&stockQty); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to load product", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock history"})
+		return
+	}
+
+	movements, total, err := h.inventory.History(id, kind, locationID, limit, (page-1)*limit)
+	if err != nil {
+		h.logger.Error("Failed to fetch stock history", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stock_qty": stockQty,
+		"movements": movements,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// GetStockDiscrepancies handles GET /api/v1/admin/inventory/discrepancies
+// Lists products whose stock_qty was changed outside the ledger.
+func (h *InventoryHandler) GetStockDiscrepancies(c *gin.Context) {
+	list, err := h.inventory.Discrepancies()
+	if err != nil {
+		h.logger.Error("Failed to reconcile stock", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile stock"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"discrepancies": list})
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/address"
+	"finspeed/api/internal/inventory"
+)
+
+// LocationRequest creates or replaces a location. FulfilsOrders and IsActive default to true and
+// Priority to 100; a lower priority is preferred when two locations are equally near a customer.
+type LocationRequest struct {
+	Code          string  `json:"code" binding:"required,max=32"`
+	Name          string  `json:"name" binding:"required,max=120"`
+	Kind          string  `json:"kind" binding:"required,oneof=warehouse store"`
+	Address1      *string `json:"address1"`
+	City          string  `json:"city" binding:"required"`
+	State         string  `json:"state" binding:"required"`
+	Pincode       string  `json:"pincode" binding:"required"`
+	FulfilsOrders *bool   `json:"fulfils_orders"`
+	IsActive      *bool   `json:"is_active"`
+	IsDefault     bool    `json:"is_default"`
+	Priority      *int    `json:"priority" binding:"omitempty,min=0"`
+}
+
+// location validates the request and copies it onto a location
+func (r LocationRequest) location() (*inventory.Location, error) {
+	l := &inventory.Location{
+		Code:          strings.ToLower(strings.TrimSpace(r.Code)),
+		Name:          strings.TrimSpace(r.Name),
+		Kind:          r.Kind,
+		City:          strings.TrimSpace(r.City),
+		Pincode:       strings.TrimSpace(r.Pincode),
+		FulfilsOrders: true,
+		IsActive:      true,
+		IsDefault:     r.IsDefault,
+		Priority:      100,
+	}
+	if r.Address1 != nil {
+		if a := strings.TrimSpace(*r.Address1); a != "" {
+			l.Address1 = &a
+		}
+	}
+	if r.FulfilsOrders != nil {
+		l.FulfilsOrders = *r.FulfilsOrders
+	}
+	if r.IsActive != nil {
+		l.IsActive = *r.IsActive
+	}
+	if r.Priority != nil {
+		l.Priority = *r.Priority
+	}
+	if l.Code == "" || l.Name == "" || l.City == "" {
+		return nil, errors.New("code, name and city are required")
+	}
+	if l.IsDefault && !l.IsActive {
+		return nil, errors.New("the default location must be active")
+	}
+
+	var err error
+	if l.State, err = address.NormalizeState(r.State); err != nil {
+		return nil, err
+	}
+	if err := address.ValidatePincode(l.Pincode, l.State); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetLocations handles GET /api/v1/admin/locations
+// ?include_inactive=true also lists deactivated locations.
+func (h *InventoryHandler) GetLocations(c *gin.Context) {
+	locations, err := h.inventory.Locations(c.Query("include_inactive") == "true")
+	if err != nil {
+		h.logger.Error("Failed to fetch locations", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"locations": locations})
+}
+
+// CreateLocation handles POST /api/v1/admin/locations
+func (h *InventoryHandler) CreateLocation(c *gin.Context) {
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	l, err := req.location()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.inventory.SaveLocation(l); err != nil {
+		h.respondLocationError(c, err)
+		return
+	}
+
+	h.logger.Info("Location created", zap.Int64("location_id", l.ID), zap.String("code", l.Code))
+	h.audit.Record(auditActor(c), "location.create", "location", l.ID, nil, l)
+	c.JSON(http.StatusCreated, l)
+}
+
+// UpdateLocation handles PUT /api/v1/admin/locations/:id
+// Locations are deactivated rather than deleted, since movements and orders refer to them.
+func (h *InventoryHandler) UpdateLocation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	l, err := req.location()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := h.inventory.Location(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+			return
+		}
+		h.logger.Error("Failed to load location", zap.Error(err), zap.Int64("location_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+	// Unassigned stock movements go to the default location, so there must always be one
+	if before.IsDefault && !l.IsDefault {
+		c.JSON(http.StatusConflict, gin.H{"error": "Make another location the default first"})
+		return
+	}
+
+	l.ID = id
+	if err := h.inventory.SaveLocation(l); err != nil {
+		h.respondLocationError(c, err)
+		return
+	}
+
+	h.logger.Info("Location updated", zap.Int64("location_id", id))
+	h.audit.Record(auditActor(c), "location.update", "location", id, before, l)
+	c.JSON(http.StatusOK, l)
+}
+
+func (h *InventoryHandler) respondLocationError(c *gin.Context, err error) {
+	if errors.Is(err, inventory.ErrDuplicateLocationCode) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A location with this code already exists"})
+		return
+	}
+	h.logger.Error("Failed to save location", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save location"})
+}
+
+// GetProductStock handles GET /api/v1/admin/products/:id/stock
+func (h *InventoryHandler) GetProductStock(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var stockQty int
+	var threshold, reorderQty *int
+	err = h.db.QueryRow("SELECT stock_qty, reorder_threshold, reorder_qty FROM products WHERE id = $1", id).Scan(&stockQty, &threshold, &reorderQty)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to load product", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock levels"})
+		return
+	}
+
+	levels, err := h.inventory.StockLevels(id)
+	if err != nil {
+		h.logger.Error("Failed to fetch stock levels", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock levels"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"stock_qty":         stockQty,
+		"reorder_threshold": threshold,
+		"reorder_qty":       reorderQty,
+		"locations":         levels,
+	})
+}
+
+// GetProductAvailability handles GET /api/v1/products/:slug/availability
+// Reports whether the product can be ordered and which showrooms have it, without exposing warehouse stock.
+func (h *InventoryHandler) GetProductAvailability(c *gin.Context) {
+	var id int64
+	var stockQty int
+	err := h.db.QueryRow("SELECT p.id, p.stock_qty FROM products p WHERE p.slug = $1 AND "+publishedProductCondition, c.Param("slug")).
+		Scan(&id, &stockQty)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to load product", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability"})
+		return
+	}
+
+	stores, err := h.inventory.Availability(id)
+	if err != nil {
+		h.logger.Error("Failed to fetch availability", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"in_stock":   stockQty > 0,
+		"stores":     stores,
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ReorderPointRequest replaces a product's reorder settings; an omitted threshold turns low-stock alerts off
+type ReorderPointRequest struct {
+	ReorderThreshold *int `json:"reorder_threshold" binding:"omitempty,gte=0"`
+	ReorderQty       *int `json:"reorder_qty" binding:"omitempty,gt=0"`
+}
+
+// SetReorderPoint handles PUT /api/v1/admin/products/:id/reorder
+func (h *InventoryHandler) SetReorderPoint(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req ReorderPointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	before := h.audit.Snapshot(productSnapshotQuery, id)
+	if err := h.inventory.SetReorderPoint(id, req.ReorderThreshold, req.ReorderQty); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to set reorder point", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reorder settings"})
+		return
+	}
+
+	h.audit.Record(auditActor(c), "product.reorder", "product", id, before, h.audit.Snapshot(productSnapshotQuery, id))
+	c.JSON(http.StatusOK, gin.H{"reorder_threshold": req.ReorderThreshold, "reorder_qty": req.ReorderQty})
+}
+
+// GetLowStock handles GET /api/v1/admin/inventory/low-stock
+func (h *InventoryHandler) GetLowStock(c *gin.Context) {
+	items, err := h.inventory.LowStock()
+	if err != nil {
+		h.logger.Error("Failed to fetch low-stock report", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low-stock report"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"products": items})
+}
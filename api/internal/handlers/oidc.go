@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/auth"
+)
+
+var (
+	errOIDCNoEmail         = errors.New("identity provider did not return an email")
+	errOIDCEmailUnverified = errors.New("identity provider email is not verified")
+)
+
+// OIDCHandler adds "Sign in with ..." login on top of AuthHandler's session handling
+type OIDCHandler struct {
+	*AuthHandler
+	providers  []*auth.OIDCProvider
+	identities *auth.IdentityStore
+}
+
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type OIDCCallbackRequest struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+func NewOIDCHandler(authHandler *AuthHandler, providers []*auth.OIDCProvider, identities *auth.IdentityStore) *OIDCHandler {
+	return &OIDCHandler{
+		AuthHandler: authHandler,
+		providers:   providers,
+		identities:  identities,
+	}
+}
+
+// GetOIDCProviders handles GET /api/v1/auth/oidc/providers
+func (h *OIDCHandler) GetOIDCProviders(c *gin.Context) {
+	providers := make([]OIDCProviderInfo, 0, len(h.providers))
+	for _, p := range h.providers {
+		providers = append(providers, OIDCProviderInfo{Name: p.Name(), DisplayName: p.DisplayName()})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+// StartOIDCLogin handles POST /api/v1/auth/oidc/:provider/start. Signed-in users start a linking flow instead of a login.
+func (h *OIDCHandler) StartOIDCLogin(c *gin.Context) {
+	provider := h.provider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	state, st, err := h.identities.BeginLogin(provider.Name(), c.GetInt64("user_id"), h.config.OIDCStateTTL)
+	if err != nil {
+		h.logger.Error("Failed to store OIDC login state", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	url, err := provider.AuthCodeURL(c.Request.Context(), state, st.Nonce, st.CodeVerifier)
+	if err != nil {
+		h.logger.Error("Failed to build OIDC authorization URL", zap.Error(err), zap.String("provider", provider.Name()))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": url})
+}
+
+// OIDCCallback handles POST /api/v1/auth/oidc/callback with the code and state the provider
+// redirected the browser back with. It returns a session, a two-factor challenge, or confirms a link.
+func (h *OIDCHandler) OIDCCallback(c *gin.Context) {
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	st, err := h.identities.ConsumeLogin(req.State)
+	if err != nil {
+		if !errors.Is(err, auth.ErrLoginStateInvalid) {
+			h.logger.Error("Failed to load OIDC login state", zap.Error(err))
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+	provider := h.provider(st.Provider)
+	if provider == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	ident, err := provider.Exchange(c.Request.Context(), req.Code, st.CodeVerifier, st.Nonce)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCTokenInvalid) {
+			auth.LogSecurityEvent(h.logger, auth.EventLoginFailed,
+				zap.String("reason", "oidc_token_invalid"), zap.String("provider", provider.Name()), zap.Error(err), zap.String("client_ip", c.ClientIP()))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in with the identity provider failed"})
+			return
+		}
+		h.logger.Error("OIDC code exchange failed", zap.Error(err), zap.String("provider", provider.Name()))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Sign-in with the identity provider failed"})
+		return
+	}
+
+	if st.LinkUserID != 0 {
+		h.linkIdentity(c, st.LinkUserID, provider.Name(), ident)
+		return
+	}
+
+	userID, err := h.resolveUser(c, provider.Name(), ident)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCNoEmail):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The identity provider did not share an email address"})
+		case errors.Is(err, errOIDCEmailUnverified):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Sign in with your password and link the provider from your account settings."})
+		case errors.Is(err, auth.ErrIdentityLinked):
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is linked to another account"})
+		default:
+			h.logger.Error("Failed to resolve OIDC user", zap.Error(err), zap.String("provider", provider.Name()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	var user User
+	var archived bool
+	err = h.db.QueryRow("SELECT id, email, role, email_verified_at IS NOT NULL, archived_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified, &archived)
+	if err != nil {
+		h.logger.Error("Failed to load user for OIDC login", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if archived {
+		auth.LogSecurityEvent(h.logger, auth.EventLoginFailed,
+			zap.String("reason", "archived"), zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	if h.startTwoFactor(c, user) {
+		return
+	}
+
+	resp, err := h.completeLogin(c, user)
+	if err != nil {
+		h.logger.Error("Failed to generate token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetIdentities handles GET /api/v1/auth/identities
+func (h *OIDCHandler) GetIdentities(c *gin.Context) {
+	identities, err := h.identities.List(c.GetInt64("user_id"))
+	if err != nil {
+		h.logger.Error("Failed to fetch identities", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch linked accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkIdentity handles DELETE /api/v1/auth/identities/:id
+func (h *OIDCHandler) UnlinkIdentity(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	identities, err := h.identities.List(userID)
+	if err != nil {
+		h.logger.Error("Failed to fetch identities", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		return
+	}
+	var found *auth.Identity
+	for i := range identities {
+		if identities[i].ID == id {
+			found = &identities[i]
+		}
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Linked account not found"})
+		return
+	}
+
+	removed, err := h.identities.Unlink(userID, id)
+	if err != nil {
+		h.logger.Error("Failed to unlink identity", zap.Error(err), zap.Int64("identity_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password or link another provider before removing your only sign-in method"})
+		return
+	}
+
+	auth.LogSecurityEvent(h.logger, auth.EventIdentityUnlinked,
+		zap.Int64("user_id", userID), zap.String("provider", found.Provider), zap.String("client_ip", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlinked"})
+}
+
+// linkIdentity attaches the identity to the signed-in user who started the flow
+func (h *OIDCHandler) linkIdentity(c *gin.Context, userID int64, provider string, ident *auth.OIDCIdentity) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to begin transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := h.identities.Link(tx, userID, provider, ident.Subject, ident.Email); err != nil {
+		if errors.Is(err, auth.ErrIdentityLinked) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is linked to another account"})
+			return
+		}
+		h.logger.Error("Failed to link identity", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit identity link", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	auth.LogSecurityEvent(h.logger, auth.EventIdentityLinked,
+		zap.Int64("user_id", userID), zap.String("provider", provider), zap.String("client_ip", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": "Account linked", "provider": provider})
+}
+
+// resolveUser finds the user for an external identity, linking it to an existing account with the same
+// verified email or creating a password-less account.
+func (h *OIDCHandler) resolveUser(c *gin.Context, provider string, ident *auth.OIDCIdentity) (int64, error) {
+	userID, err := h.identities.FindUser(provider, ident.Subject)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, auth.ErrIdentityNotFound) {
+		return 0, err
+	}
+	if ident.Email == "" {
+		return 0, errOIDCNoEmail
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var localVerified bool
+	err = tx.QueryRow(
+		"SELECT id, email_verified_at IS NOT NULL FROM users WHERE LOWER(email) = $1 FOR UPDATE",
+		ident.Email,
+	).Scan(&userID, &localVerified)
+
+	revokeSessions := false
+	switch {
+	case err == nil:
+		// Only a provider-verified email proves ownership of the existing account
+		if !ident.EmailVerified {
+			return 0, errOIDCEmailUnverified
+		}
+		if !localVerified {
+			// Whoever registered this unverified account never proved they own the email, so their
+			// password and sessions are dropped before the real owner is let in
+			if _, err := tx.Exec(
+				"UPDATE users SET email_verified_at = NOW(), password_hash = NULL WHERE id = $1",
+				userID,
+			); err != nil {
+				return 0, err
+			}
+			revokeSessions = true
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		err = tx.QueryRow(
+			`INSERT INTO users (email, password_hash, role, email_verified_at, name)
+			 VALUES ($1, NULL, $2, CASE WHEN $3 THEN NOW() END, NULLIF($4, ''))
+			 RETURNING id`,
+			ident.Email, auth.RoleCustomer, ident.EmailVerified, ident.Name,
+		).Scan(&userID)
+		if err != nil {
+			return 0, err
+		}
+		h.logger.Info("User registered via identity provider", zap.Int64("user_id", userID), zap.String("provider", provider))
+	default:
+		return 0, err
+	}
+
+	if err := h.identities.Link(tx, userID, provider, ident.Subject, ident.Email); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if revokeSessions {
+		if err := h.sessions.RevokeAllSessions(userID); err != nil {
+			h.logger.Error("Failed to revoke sessions of unverified account", zap.Error(err), zap.Int64("user_id", userID))
+		}
+	}
+	auth.LogSecurityEvent(h.logger, auth.EventIdentityLinked,
+		zap.Int64("user_id", userID), zap.String("provider", provider), zap.String("client_ip", c.ClientIP()))
+	return userID, nil
+}
+
+func (h *OIDCHandler) provider(name string) *auth.OIDCProvider {
+	for _, p := range h.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
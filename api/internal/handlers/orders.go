@@ -3,18 +3,24 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"finspeed/api/internal/database"
+	"finspeed/api/internal/inventory"
+	"finspeed/api/internal/shipping"
 )
 
 type OrderHandler struct {
-	db     *database.DB
-	logger *zap.Logger
+	db        *database.DB
+	logger    *zap.Logger
+	inventory *inventory.Store
+	shipments *shipping.Store
 }
 
 type Order struct {
@@ -30,6 +36,17 @@ type Order struct {
 	CreatedAt           string        `json:"created_at"`
 	Items               []OrderItem   `json:"items,omitempty"`
 	Payment             *Payment      `json:"payment,omitempty"`
+	Fulfilment          []OrderAllocation `json:"fulfilment,omitempty"`
+	Shipments           []shipping.Shipment `json:"shipments,omitempty"`
+}
+
+// OrderAllocation is the part of an order shipped from one location
+type OrderAllocation struct {
+	ProductID    int64  `json:"product_id"`
+	Qty          int    `json:"qty"`
+	LocationID   int64  `json:"location_id"`
+	LocationName string `json:"location_name"`
+	City         string `json:"city"`
 }
 
 type OrderItem struct {
@@ -39,6 +56,8 @@ type OrderItem struct {
 	Qty       int     `json:"qty"`
 	PriceEach float64 `json:"price_each"`
 	Product   *Product `json:"product,omitempty"`
+	// Serials are the serial numbers of the units shipped, for serialised products
+	Serials []string `json:"serials,omitempty"`
 }
 
 type ShippingAddr struct {
@@ -64,9 +83,11 @@ type Payment struct {
 	CreatedAt      string                 `json:"created_at"`
 }
 
+// CreateOrderRequest takes either a saved address ID or a full shipping address
 type CreateOrderRequest struct {
 	Items           []CreateOrderItem `json:"items" binding:"required,min=1"`
-	ShippingAddress ShippingAddr      `json:"shipping_address" binding:"required"`
+	AddressID       *int64            `json:"address_id,omitempty"`
+	ShippingAddress *ShippingAddr     `json:"shipping_address,omitempty"`
 }
 
 type CreateOrderItem struct {
@@ -81,10 +102,12 @@ type OrdersResponse struct {
 	Limit  int     `json:"limit"`
 }
 
-func NewOrderHandler(db *database.DB, logger *zap.Logger) *OrderHandler {
+func NewOrderHandler(db *database.DB, logger *zap.Logger, inv *inventory.Store, shipments *shipping.Store) *OrderHandler {
 	return &OrderHandler{
-		db:     db,
-		logger: logger,
+		db:        db,
+		logger:    logger,
+		inventory: inv,
+		shipments: shipments,
 	}
 }
 
@@ -238,9 +261,53 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		}
 	}
 
+	allocations, err := h.getOrderAllocations(o.ID)
+	if err != nil {
+		h.logger.Warn("Failed to fetch order allocations", zap.Int64("order_id", o.ID), zap.Error(err))
+	} else {
+		o.Fulfilment = allocations
+	}
+
+	// Customers see the parcels on their way; cancelled shipments are an internal detail
+	shipments, err := h.shipments.Shipments(o.ID)
+	if err != nil {
+		h.logger.Warn("Failed to fetch shipments", zap.Int64("order_id", o.ID), zap.Error(err))
+	} else {
+		for _, sh := range shipments {
+			if sh.Status != shipping.StatusCancelled {
+				o.Shipments = append(o.Shipments, sh)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, o)
 }
 
+// getOrderAllocations fetches the locations an order ships from
+func (h *OrderHandler) getOrderAllocations(orderID int64) ([]OrderAllocation, error) {
+	rows, err := h.db.Query(
+		`SELECT a.product_id, a.qty, a.location_id, l.name, l.city
+		 FROM order_allocations a JOIN locations l ON l.id = a.location_id
+		 WHERE a.order_id = $1
+		 ORDER BY a.location_id, a.product_id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []OrderAllocation
+	for rows.Next() {
+		var a OrderAllocation
+		if err := rows.Scan(&a.ProductID, &a.Qty, &a.LocationID, &a.LocationName, &a.City); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, a)
+	}
+	return allocations, rows.Err()
+}
+
 // CreateOrder handles POST /api/v1/orders
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -255,6 +322,20 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
+	if (req.AddressID == nil) == (req.ShippingAddress == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either address_id or shipping_address"})
+		return
+	}
+
+	var shippingAddress ShippingAddr
+	if req.ShippingAddress != nil {
+		addr, err := normalizeShippingAddr(*req.ShippingAddress)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shippingAddress = addr
+	}
 
 	// Start transaction
 	tx, err := h.db.Begin()
@@ -265,15 +346,31 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	// Saved addresses are copied into the order so later edits do not change where it ships
+	if req.AddressID != nil {
+		shippingAddress, err = loadSavedAddress(tx, userID, *req.AddressID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Address not found", "address_id": *req.AddressID})
+				return
+			}
+			h.logger.Error("Failed to load saved address", zap.Int64("address_id", *req.AddressID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+			return
+		}
+	}
+
 	// Calculate totals
 	var subtotal float64
 	var validItems []CreateOrderItem
+	// Effective price of each valid item, reused for its order line
+	var prices []float64
 
 	for _, item := range req.Items {
 		// Get product price and validate stock
 		var price float64
 		var stockQty int
-		err := tx.QueryRow("SELECT price, stock_qty FROM products WHERE id = $1", item.ProductID).Scan(&price, &stockQty)
+		err := tx.QueryRow("SELECT "+effectivePriceExpr+", stock_qty FROM products p WHERE id = $1 AND "+publishedProductCondition, item.ProductID).Scan(&price, &stockQty)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found", "product_id": item.ProductID})
@@ -291,6 +388,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 		subtotal += price * float64(item.Qty)
 		validItems = append(validItems, item)
+		prices = append(prices, price)
 	}
 
 	// Calculate shipping and tax (simplified)
@@ -302,7 +400,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	total := subtotal + shippingFee + taxAmount
 
 	// Marshal shipping address
-	shippingJSON, err := json.Marshal(req.ShippingAddress)
+	shippingJSON, err := json.Marshal(shippingAddress)
 	if err != nil {
 		h.logger.Error("Failed to marshal shipping address", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
@@ -324,31 +422,55 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Create order items and update stock
-	for _, item := range validItems {
-		var price float64
-		err := tx.QueryRow("SELECT price FROM products WHERE id = $1", item.ProductID).Scan(&price)
+	// Create order items
+	lines := make([]inventory.Line, 0, len(validItems))
+	for i, item := range validItems {
+		_, err := tx.Exec(
+			"INSERT INTO order_items (order_id, product_id, qty, price_each) VALUES ($1, $2, $3, $4)",
+			orderID, item.ProductID, item.Qty, prices[i],
+		)
 		if err != nil {
-			h.logger.Error("Failed to get product price", zap.Int("product_id", item.ProductID), zap.Error(err))
+			h.logger.Error("Failed to create order item", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 			return
 		}
+		lines = append(lines, inventory.Line{ProductID: int64(item.ProductID), Qty: item.Qty})
+	}
 
-		// Insert order item
-		_, err = tx.Exec(
-			"INSERT INTO order_items (order_id, product_id, qty, price_each) VALUES ($1, $2, $3, $4)",
-			orderID, item.ProductID, item.Qty, price,
-		)
-		if err != nil {
-			h.logger.Error("Failed to create order item", zap.Error(err))
+	// Pick the shipping locations and take the stock there; the check above only saw the total
+	allocations, err := h.inventory.Route(tx, shippingAddress.Pincode, shippingAddress.State, lines)
+	if errors.Is(err, inventory.ErrInsufficientStock) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock at our fulfilment locations"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to route order", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+	for _, a := range allocations {
+		if _, err := tx.Exec(
+			"INSERT INTO order_allocations (order_id, product_id, location_id, qty) VALUES ($1, $2, $3, $4)",
+			orderID, a.ProductID, a.LocationID, a.Qty,
+		); err != nil {
+			h.logger.Error("Failed to record order allocation", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 			return
 		}
 
-		// Update stock
-		_, err = tx.Exec("UPDATE products SET stock_qty = stock_qty - $1 WHERE id = $2", item.Qty, item.ProductID)
+		_, err = h.inventory.Record(tx, movementActor(c, inventory.Movement{
+			ProductID:  a.ProductID,
+			LocationID: a.LocationID,
+			Kind:       inventory.KindSale,
+			Quantity:   -a.Qty,
+			OrderID:    orderID,
+		}))
+		if errors.Is(err, inventory.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock", "product_id": a.ProductID})
+			return
+		}
 		if err != nil {
-			h.logger.Error("Failed to update stock", zap.Int("product_id", item.ProductID), zap.Error(err))
+			h.logger.Error("Failed to update stock", zap.Int64("product_id", a.ProductID), zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 			return
 		}
@@ -371,7 +493,12 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 func (h *OrderHandler) getOrderItems(orderID int64) ([]OrderItem, error) {
 	query := `
 		SELECT oi.id, oi.order_id, oi.product_id, oi.qty, oi.price_each,
-		       p.title, p.slug, p.price as current_price
+		       p.title, p.slug, p.price as current_price,
+		       ARRAY(SELECT sn.serial FROM serial_numbers sn
+		             JOIN shipment_items si ON si.id = sn.shipment_item_id
+		             JOIN shipments s ON s.id = si.shipment_id
+		             WHERE si.order_item_id = oi.id AND s.status IN ('shipped', 'delivered')
+		             ORDER BY sn.id)
 		FROM order_items oi
 		LEFT JOIN products p ON oi.product_id = p.id
 		WHERE oi.order_id = $1
@@ -392,7 +519,7 @@ func (h *OrderHandler) getOrderItems(orderID int64) ([]OrderItem, error) {
 		
 		err := rows.Scan(
 			&item.ID, &item.OrderID, &item.ProductID, &item.Qty, &item.PriceEach,
-			&title, &slug, &currentPrice,
+			&title, &slug, &currentPrice, pq.Array(&item.Serials),
 		)
 		if err != nil {
 			return nil, err
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"io"
@@ -16,26 +17,31 @@ import (
 	"github.com/razorpay/razorpay-go/utils"
 	"go.uber.org/zap"
 
+	"finspeed/api/internal/bookings"
 	"finspeed/api/internal/config"
 	"finspeed/api/internal/database"
 )
 
 type PaymentHandler struct {
-	db     *database.DB
-	logger *zap.Logger
-	cfg    *config.Config
+	db       *database.DB
+	logger   *zap.Logger
+	cfg      *config.Config
+	bookings *bookings.Store
 }
 
-func NewPaymentHandler(db *database.DB, logger *zap.Logger, cfg *config.Config) *PaymentHandler {
-	return &PaymentHandler{db: db, logger: logger, cfg: cfg}
+func NewPaymentHandler(db *database.DB, logger *zap.Logger, cfg *config.Config, bookingStore *bookings.Store) *PaymentHandler {
+	return &PaymentHandler{db: db, logger: logger, cfg: cfg, bookings: bookingStore}
 }
 
+// createRazorpayOrderRequest pays for an order or a booking; exactly one of the IDs is set
 type createRazorpayOrderRequest struct {
-	OrderID int64 `json:"order_id" binding:"required"`
+	OrderID   int64 `json:"order_id"`
+	BookingID int64 `json:"booking_id"`
 }
 
 type createRazorpayOrderResponse struct {
-	OrderID         int64  `json:"order_id"`
+	OrderID         int64  `json:"order_id,omitempty"`
+	BookingID       int64  `json:"booking_id,omitempty"`
 	RazorpayOrderID string `json:"razorpay_order_id"`
 	Amount          int64  `json:"amount"`    // in paise
 	Currency        string `json:"currency"`  // e.g., INR
@@ -44,6 +50,7 @@ type createRazorpayOrderResponse struct {
 
 // CreateRazorpayOrder handles POST /api/v1/payments/razorpay/order (protected)
 // It verifies the order belongs to the user and is pending, then creates a Razorpay Order.
+// With booking_id instead it pays for a booking that offers prepayment.
 func (h *PaymentHandler) CreateRazorpayOrder(c *gin.Context) {
 	if h.cfg.RazorpayKeyID == "" || h.cfg.RazorpayKeySecret == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Razorpay is not configured"})
@@ -63,6 +70,14 @@ func (h *PaymentHandler) CreateRazorpayOrder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if (req.OrderID == 0) == (req.BookingID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either order_id or booking_id"})
+		return
+	}
+	if req.BookingID != 0 {
+		h.createBookingRazorpayOrder(c, userID, req.BookingID)
+		return
+	}
 
 	// Verify order belongs to user and is pending
 	var (
@@ -123,7 +138,8 @@ func (h *PaymentHandler) CreateRazorpayOrder(c *gin.Context) {
 // VerifyRazorpayPayment handles POST /api/v1/payments/razorpay/verify (protected)
 // It verifies the signature sent by Razorpay after checkout success.
 type verifyRazorpayPaymentRequest struct {
-	OrderID           int64  `json:"order_id" binding:"required"`
+	OrderID           int64  `json:"order_id"`
+	BookingID         int64  `json:"booking_id"`
 	RazorpayOrderID   string `json:"razorpay_order_id" binding:"required"`
 	RazorpayPaymentID string `json:"razorpay_payment_id" binding:"required"`
 	RazorpaySignature string `json:"razorpay_signature" binding:"required"`
@@ -148,6 +164,14 @@ func (h *PaymentHandler) VerifyRazorpayPayment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if (req.OrderID == 0) == (req.BookingID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either order_id or booking_id"})
+		return
+	}
+	if req.BookingID != 0 {
+		h.verifyBookingPayment(c, userID, req)
+		return
+	}
 
 	// Verify order belongs to user and is pending
 	var (
@@ -200,7 +224,8 @@ func (h *PaymentHandler) VerifyRazorpayPayment(c *gin.Context) {
 		return
 	}
 
-	if _, err := h.db.Exec("UPDATE orders SET status = 'paid', payment_id = $1 WHERE id = $2", req.RazorpayPaymentID, req.OrderID); err != nil {
+	// Only orders still awaiting payment become paid; a cancelled order is not revived, and a paid one keeps its payment
+	if _, err := h.db.Exec("UPDATE orders SET status = 'paid', payment_id = $1 WHERE id = $2 AND status IN ('pending', 'payment_failed')", req.RazorpayPaymentID, req.OrderID); err != nil {
 		h.logger.Error("failed to update order status", zap.Error(err))
 		// still return OK to frontend; the core payment is verified
 	}
@@ -261,6 +286,7 @@ func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
 	var amountRupees float64
 	currency := "INR"
 	var localOrderID int64
+	var localBookingID int64
 
 	if paymentEntity != nil {
 		if v, ok := paymentEntity["id"].(string); ok {
@@ -287,6 +313,16 @@ func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
 					}
 				}
 			}
+			if bid, ok := notes["booking_id"]; ok {
+				switch t := bid.(type) {
+				case float64:
+					localBookingID = int64(t)
+				case string:
+					if id64, err := strconv.ParseInt(t, 10, 64); err == nil {
+						localBookingID = id64
+					}
+				}
+			}
 		}
 	}
 
@@ -306,11 +342,18 @@ func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
 		}
 	}
 
-	if localOrderID == 0 && providerPaymentID != "" {
+	if localBookingID == 0 && orderReceipt != "" && strings.HasPrefix(orderReceipt, "booking_") {
+		if id64, err := strconv.ParseInt(strings.TrimPrefix(orderReceipt, "booking_"), 10, 64); err == nil {
+			localBookingID = id64
+		}
+	}
+
+	if localOrderID == 0 && localBookingID == 0 && providerPaymentID != "" {
 		// Fallback: find existing payment record
-		var existingOrderID int64
-		if err := h.db.QueryRow("SELECT order_id FROM payments WHERE provider_ref = $1", providerPaymentID).Scan(&existingOrderID); err == nil {
-			localOrderID = existingOrderID
+		var existingOrderID, existingBookingID sql.NullInt64
+		if err := h.db.QueryRow("SELECT order_id, booking_id FROM payments WHERE provider_ref = $1", providerPaymentID).Scan(&existingOrderID, &existingBookingID); err == nil {
+			localOrderID = existingOrderID.Int64
+			localBookingID = existingBookingID.Int64
 		}
 	}
 
@@ -323,25 +366,33 @@ func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
 		paymentStatus = "failed"
 	}
 
-	// Upsert payments row when we have both payment id and local order id
-	if providerPaymentID != "" && localOrderID != 0 {
+	// Upsert payments row when we have both payment id and local order or booking id
+	if providerPaymentID != "" && (localOrderID != 0 || localBookingID != 0) {
 		raw := json.RawMessage(payload)
 		statusForUpsert := paymentStatus
 		if statusForUpsert == "" {
 			// For intermediate or unknown events, keep processing state
 			statusForUpsert = "processing"
 		}
-		if _, err := h.db.Exec(
-			`INSERT INTO payments (order_id, provider, provider_ref, status, amount, currency, raw_webhook_json)
-             VALUES ($1,$2,$3,$4,$5,$6,$7)
-             ON CONFLICT (provider_ref) DO UPDATE SET status = EXCLUDED.status, amount = EXCLUDED.amount, currency = EXCLUDED.currency, raw_webhook_json = EXCLUDED.raw_webhook_json`,
-			localOrderID, "razorpay", providerPaymentID, statusForUpsert, amountRupees, currency, raw,
-		); err != nil {
+		// A payment stays with the order or booking it was first recorded for
+		result, err := h.db.Exec(
+			`INSERT INTO payments (order_id, booking_id, provider, provider_ref, status, amount, currency, raw_webhook_json)
+             VALUES (NULLIF($1::bigint, 0),NULLIF($2::bigint, 0),$3,$4,$5,$6,$7,$8)
+             ON CONFLICT (provider_ref) DO UPDATE SET status = EXCLUDED.status, amount = EXCLUDED.amount, currency = EXCLUDED.currency, raw_webhook_json = EXCLUDED.raw_webhook_json
+             WHERE payments.order_id IS NOT DISTINCT FROM EXCLUDED.order_id AND payments.booking_id IS NOT DISTINCT FROM EXCLUDED.booking_id`,
+			localOrderID, localBookingID, "razorpay", providerPaymentID, statusForUpsert, amountRupees, currency, raw,
+		)
+		if err != nil {
 			h.logger.Error("failed to upsert payment from webhook", zap.Error(err))
 			// Still ack to prevent retries; reconciliation can happen later
 			c.Status(http.StatusOK)
 			return
 		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			h.logger.Warn("razorpay webhook payment is recorded for another order or booking", zap.String("payment_id", providerPaymentID), zap.Int64("order_id", localOrderID), zap.Int64("booking_id", localBookingID))
+			c.Status(http.StatusOK)
+			return
+		}
 	}
 
 	// Update order status if resolvable
@@ -349,11 +400,11 @@ func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
 		switch paymentStatus {
 		case "succeeded":
 			if providerPaymentID != "" {
-				if _, err := h.db.Exec("UPDATE orders SET status = 'paid', payment_id = $1 WHERE id = $2", providerPaymentID, localOrderID); err != nil {
+				if _, err := h.db.Exec("UPDATE orders SET status = 'paid', payment_id = $1 WHERE id = $2 AND status IN ('pending', 'payment_failed')", providerPaymentID, localOrderID); err != nil {
 					h.logger.Error("failed to update order to paid", zap.Error(err))
 				}
 			} else {
-				if _, err := h.db.Exec("UPDATE orders SET status = 'paid' WHERE id = $1", localOrderID); err != nil {
+				if _, err := h.db.Exec("UPDATE orders SET status = 'paid' WHERE id = $1 AND status IN ('pending', 'payment_failed')", localOrderID); err != nil {
 					h.logger.Error("failed to update order to paid (no payment id)", zap.Error(err))
 				}
 			}
@@ -363,9 +414,159 @@ func (h *PaymentHandler) RazorpayWebhook(c *gin.Context) {
 				h.logger.Warn("failed to update order to payment_failed (non-blocking)", zap.Error(err))
 			}
 		}
+	} else if localBookingID != 0 {
+		// A failed attempt leaves the booking holding its slot until the payment window runs out
+		if paymentStatus == "succeeded" && providerPaymentID != "" {
+			if err := h.markBookingPaid(localBookingID, providerPaymentID, rzpOrderID); err != nil {
+				h.logger.Error("failed to mark booking paid", zap.Int64("booking_id", localBookingID), zap.Error(err))
+			}
+		}
 	} else if localOrderID == 0 {
-		h.logger.Warn("razorpay webhook could not resolve local order_id", zap.String("event", eventType), zap.String("rzp_order_id", rzpOrderID), zap.String("payment_id", providerPaymentID))
+		h.logger.Warn("razorpay webhook could not resolve local order_id or booking_id", zap.String("event", eventType), zap.String("rzp_order_id", rzpOrderID), zap.String("payment_id", providerPaymentID))
 	}
 
 	c.Status(http.StatusOK)
 }
+
+// createBookingRazorpayOrder creates a Razorpay Order for the price of a customer's booking
+func (h *PaymentHandler) createBookingRazorpayOrder(c *gin.Context, userID, bookingID int64) {
+	b, err := h.bookings.Payable(bookingID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		case errors.Is(err, bookings.ErrNotPayable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Booking cannot be paid for"})
+		default:
+			h.logger.Error("failed to fetch booking", zap.Int64("booking_id", bookingID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Razorpay order"})
+		}
+		return
+	}
+
+	amountPaise := int64(math.Round(b.Price * 100))
+
+	// The price of a booking never changes, so a checkout that was abandoned is retried on the same order
+	if b.RazorpayOrder != nil {
+		c.JSON(http.StatusOK, createRazorpayOrderResponse{
+			BookingID:       b.ID,
+			RazorpayOrderID: *b.RazorpayOrder,
+			Amount:          amountPaise,
+			Currency:        "INR",
+			KeyID:           h.cfg.RazorpayKeyID,
+		})
+		return
+	}
+
+	client := razorpay.NewClient(h.cfg.RazorpayKeyID, h.cfg.RazorpayKeySecret)
+	data := map[string]interface{}{
+		"amount":          amountPaise,
+		"currency":        "INR",
+		"receipt":         fmt.Sprintf("booking_%d", b.ID),
+		"payment_capture": 1,
+		"notes": map[string]interface{}{
+			"booking_id": b.ID,
+			"user_id":    userID,
+		},
+	}
+
+	rzpOrder, err := client.Order.Create(data, nil)
+	if err != nil {
+		h.logger.Error("razorpay order create failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create Razorpay order"})
+		return
+	}
+
+	rzpOrderID, _ := rzpOrder["id"].(string)
+	if err := h.bookings.SetRazorpayOrder(b.ID, rzpOrderID); err != nil {
+		h.logger.Error("failed to store razorpay order", zap.Int64("booking_id", b.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Razorpay order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, createRazorpayOrderResponse{
+		BookingID:       b.ID,
+		RazorpayOrderID: rzpOrderID,
+		Amount:          amountPaise,
+		Currency:        "INR",
+		KeyID:           h.cfg.RazorpayKeyID,
+	})
+}
+
+// verifyBookingPayment checks the checkout signature for a booking payment, records the payment and
+// confirms the booking. The signature only vouches for the Razorpay order and payment IDs, so the order must
+// be the one created for this booking and the payment must not be recorded for anything else.
+func (h *PaymentHandler) verifyBookingPayment(c *gin.Context, userID int64, req verifyRazorpayPaymentRequest) {
+	b, err := h.bookings.Booking(req.BookingID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+			return
+		}
+		h.logger.Error("failed to fetch booking", zap.Int64("booking_id", req.BookingID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify payment"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"razorpay_order_id":   req.RazorpayOrderID,
+		"razorpay_payment_id": req.RazorpayPaymentID,
+	}
+	if !utils.VerifyPaymentSignature(params, req.RazorpaySignature, h.cfg.RazorpayKeySecret) {
+		h.logger.Warn("razorpay signature verification failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Signature verification failed"})
+		return
+	}
+	if b.RazorpayOrder == nil || *b.RazorpayOrder != req.RazorpayOrderID {
+		h.logger.Warn("razorpay order does not belong to booking", zap.Int64("booking_id", b.ID), zap.String("rzp_order_id", req.RazorpayOrderID))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The payment is not for this booking"})
+		return
+	}
+
+	rawPayload, _ := json.Marshal(params)
+	var paymentRowID int64
+	err = h.db.QueryRow(
+		`INSERT INTO payments (booking_id, provider, provider_ref, status, amount, currency, raw_webhook_json)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)
+		 ON CONFLICT (provider_ref) DO UPDATE SET status = EXCLUDED.status, raw_webhook_json = EXCLUDED.raw_webhook_json
+		 WHERE payments.booking_id = EXCLUDED.booking_id
+		 RETURNING id`,
+		b.ID, "razorpay", req.RazorpayPaymentID, "succeeded", b.Price, "INR", json.RawMessage(rawPayload),
+	).Scan(&paymentRowID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The payment is already recorded for another order or booking
+		h.logger.Warn("razorpay payment replayed for another booking", zap.Int64("booking_id", b.ID), zap.String("payment_id", req.RazorpayPaymentID))
+		c.JSON(http.StatusConflict, gin.H{"error": "The payment is already recorded"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to upsert payment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	if err := h.markBookingPaid(b.ID, req.RazorpayPaymentID, req.RazorpayOrderID); err != nil {
+		h.logger.Error("failed to mark booking paid", zap.Int64("booking_id", b.ID), zap.Error(err))
+		// still return OK to frontend; the core payment is verified
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "verified"})
+}
+
+// markBookingPaid confirms the booking a captured payment was for. Money received for a booking that was
+// cancelled meanwhile, e.g. because its payment window ran out, is logged for staff to refund.
+func (h *PaymentHandler) markBookingPaid(bookingID int64, paymentID, rzpOrderID string) error {
+	ok, err := h.bookings.MarkPaid(bookingID, paymentID, rzpOrderID)
+	if err != nil || ok {
+		return err
+	}
+	b, err := h.bookings.Booking(bookingID, 0)
+	if err != nil {
+		return err
+	}
+	if b.PaymentID == nil || *b.PaymentID != paymentID {
+		h.logger.Warn("payment received for a booking that can no longer take it; refund it manually",
+			zap.Int64("booking_id", bookingID), zap.String("payment_id", paymentID), zap.String("status", string(b.Status)))
+	}
+	return nil
+}
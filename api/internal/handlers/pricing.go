@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// saleActiveCondition holds while the sale price of products alias p applies
+const saleActiveCondition = `p.sale_price IS NOT NULL
+	AND (p.sale_starts_at IS NULL OR p.sale_starts_at <= NOW()) AND (p.sale_ends_at IS NULL OR p.sale_ends_at > NOW())`
+
+// effectivePriceExpr is what a customer pays for products alias p right now.
+// LEAST guards against a sale price left above a regular price that was lowered later.
+const effectivePriceExpr = "CASE WHEN " + saleActiveCondition + " THEN LEAST(p.sale_price, p.price) ELSE p.price END"
+
+type ProductSaleRequest struct {
+	SalePrice float64    `json:"sale_price" binding:"required,gt=0"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+}
+
+type PriceHistoryEntry struct {
+	ID           int64    `json:"id"`
+	Price        float64  `json:"price"`
+	SalePrice    *float64 `json:"sale_price,omitempty"`
+	SaleStartsAt *string  `json:"sale_starts_at,omitempty"`
+	SaleEndsAt   *string  `json:"sale_ends_at,omitempty"`
+	ChangedBy    *int64   `json:"changed_by,omitempty"`
+	APIKeyID     *int64   `json:"api_key_id,omitempty"`
+	ChangedAt    string   `json:"changed_at"`
+}
+
+// recordPriceHistory stores the product's current pricing; call it in the transaction that changed it
+func recordPriceHistory(tx *sql.Tx, c *gin.Context, productID int64) error {
+	actor := auditActor(c)
+	_, err := tx.Exec(
+		`INSERT INTO price_history (product_id, price, sale_price, sale_starts_at, sale_ends_at, changed_by, api_key_id)
+		 SELECT id, price, sale_price, sale_starts_at, sale_ends_at, NULLIF($2::bigint, 0), NULLIF($3::bigint, 0) FROM products WHERE id = $1`,
+		productID, actor.UserID, actor.APIKeyID,
+	)
+	return err
+}
+
+// SetProductSale handles PUT /api/v1/admin/products/:id/sale
+// The sale price applies from starts_at (or now) until ends_at (or until the sale is ended).
+func (h *ProductHandler) SetProductSale(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req ProductSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be in the future"})
+		return
+	}
+
+	h.updateSale(c, id, &req)
+}
+
+// EndProductSale handles DELETE /api/v1/admin/products/:id/sale
+func (h *ProductHandler) EndProductSale(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	h.updateSale(c, id, nil)
+}
+
+// updateSale replaces the product's sale, or clears it when req is nil
+func (h *ProductHandler) updateSale(c *gin.Context, id int64, req *ProductSaleRequest) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+		return
+	}
+	defer tx.Rollback()
+
+	var price float64
+	var salePrice sql.NullFloat64
+	err = tx.QueryRow("SELECT price, sale_price FROM products WHERE id = $1 FOR UPDATE", id).Scan(&price, &salePrice)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to load product", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+		return
+	}
+
+	before := h.audit.Snapshot(productSnapshotQuery, id)
+
+	action := "product.sale_end"
+	if req != nil {
+		if req.SalePrice >= price {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sale_price must be below the regular price", "price": price})
+			return
+		}
+		_, err = tx.Exec(
+			"UPDATE products SET sale_price = $1, sale_starts_at = $2, sale_ends_at = $3, updated_at = NOW() WHERE id = $4",
+			req.SalePrice, req.StartsAt, req.EndsAt, id,
+		)
+		action = "product.sale_set"
+	} else {
+		if !salePrice.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product has no sale"})
+			return
+		}
+		_, err = tx.Exec("UPDATE products SET sale_price = NULL, sale_starts_at = NULL, sale_ends_at = NULL, updated_at = NOW() WHERE id = $1", id)
+	}
+	if err != nil {
+		h.logger.Error("Failed to update sale", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+		return
+	}
+
+	if err := recordPriceHistory(tx, c, id); err != nil {
+		h.logger.Error("Failed to record price history", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit sale", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+		return
+	}
+
+	h.logger.Info("Product sale updated", zap.Int64("product_id", id), zap.String("action", action))
+	h.audit.Record(auditActor(c), action, "product", id, before, h.audit.Snapshot(productSnapshotQuery, id))
+	c.JSON(http.StatusOK, gin.H{"message": "Sale updated"})
+}
+
+// GetPriceHistory handles GET /api/v1/admin/products/:id/price-history
+func (h *ProductHandler) GetPriceHistory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)", id).Scan(&exists); err != nil {
+		h.logger.Error("Failed to check product", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT id, price, sale_price, sale_starts_at, sale_ends_at, changed_by, api_key_id, changed_at
+		 FROM price_history WHERE product_id = $1
+		 ORDER BY changed_at DESC, id DESC LIMIT $2`,
+		id, limit,
+	)
+	if err != nil {
+		h.logger.Error("Failed to fetch price history", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+	defer rows.Close()
+
+	history := []PriceHistoryEntry{}
+	for rows.Next() {
+		var e PriceHistoryEntry
+		if err := rows.Scan(&e.ID, &e.Price, &e.SalePrice, &e.SaleStartsAt, &e.SaleEndsAt, &e.ChangedBy, &e.APIKeyID, &e.ChangedAt); err != nil {
+			h.logger.Error("Failed to scan price history", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+			return
+		}
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		h.logger.Error("Error iterating price history", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"price_history": history})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/mailer"
+	"finspeed/api/internal/privacy"
+	"finspeed/api/internal/storage"
+)
+
+// PrivacyHandler serves data access and erasure requests on top of AuthHandler's tokens and mail
+type PrivacyHandler struct {
+	*AuthHandler
+	privacy *privacy.Store
+	files   storage.Storage
+}
+
+// DeleteAccountRequest needs the password unless the account signs in only through an identity provider
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func NewPrivacyHandler(authHandler *AuthHandler, store *privacy.Store, files storage.Storage) *PrivacyHandler {
+	return &PrivacyHandler{
+		AuthHandler: authHandler,
+		privacy:     store,
+		files:       files,
+	}
+}
+
+// ExportData handles GET /api/v1/me/export
+// ?format=zip returns a ZIP archive with one JSON file per section instead of a single JSON document.
+func (h *PrivacyHandler) ExportData(c *gin.Context) {
+	userID := c.GetInt64("user_id")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	export, err := h.privacy.Export(userID)
+	if err != nil {
+		h.logger.Error("Failed to export user data", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+	h.logger.Info("User data exported", zap.Int64("user_id", userID), zap.String("format", format))
+
+	filename := fmt.Sprintf("finspeed-data-%d-%s.%s", userID, export.ExportedAt.Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	if format == "json" {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := export.WriteZip(c.Writer); err != nil {
+		// Headers are already sent, so the client sees a truncated archive
+		h.logger.Error("Failed to write data export archive", zap.Error(err), zap.Int64("user_id", userID))
+	}
+}
+
+// RequestAccountDeletion handles POST /api/v1/me/delete
+// A confirmation link is emailed; nothing is erased until it is used.
+func (h *PrivacyHandler) RequestAccountDeletion(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	var email, role string
+	var hash sql.NullString
+	var openOrders bool
+	err := h.db.QueryRow(
+		`SELECT email, role, password_hash, EXISTS (SELECT 1 FROM orders WHERE user_id = $1 AND status IN ('paid', 'partially_shipped', 'shipped'))
+		     OR EXISTS (SELECT 1 FROM returns WHERE user_id = $1 AND status IN ('approved', 'shipped', 'received'))
+		 FROM users WHERE id = $1`,
+		userID,
+	).Scan(&email, &role, &hash, &openOrders)
+	if err != nil {
+		h.logger.Error("Failed to load user", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if hash.Valid && bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if role != auth.RoleCustomer {
+		c.JSON(http.StatusConflict, gin.H{"error": "Staff accounts must be demoted by an administrator before they can be deleted"})
+		return
+	}
+	if openOrders {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your account can be deleted once your paid orders and returns have been completed"})
+		return
+	}
+
+	token, err := h.tokens.Issue(userID, auth.PurposeAccountDeletion, h.config.PasswordResetTTL)
+	if err != nil {
+		h.logger.Error("Failed to issue account deletion token", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+	h.sendEmail(mailer.Message{
+		To:      email,
+		Subject: "Confirm deletion of your Finspeed account",
+		Body: fmt.Sprintf(
+			"We received a request to delete your Finspeed account.\n\nConfirm here: %s\n\n"+
+				"Your personal details will be erased. Order and payment amounts are kept as required for tax records.\n"+
+				"This link expires in %s. If you did not request this, change your password.\n",
+			h.frontendLink("/account/delete/confirm", token), h.config.PasswordResetTTL,
+		),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Check your email to confirm account deletion"})
+}
+
+// ConfirmAccountDeletion handles POST /api/v1/auth/account/delete/confirm
+func (h *PrivacyHandler) ConfirmAccountDeletion(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	// Erasure deletes every action token of the user, so the token cannot be reused afterwards
+	userID, err := h.tokens.Lookup(req.Token, auth.PurposeAccountDeletion)
+	if err != nil {
+		if errors.Is(err, auth.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		h.logger.Error("Failed to look up account deletion token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var email, role string
+	if err := h.db.QueryRow("SELECT email, role FROM users WHERE id = $1", userID).Scan(&email, &role); err != nil {
+		h.logger.Error("Failed to load user", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	// The user may have been promoted since the link was sent
+	if role != auth.RoleCustomer {
+		c.JSON(http.StatusConflict, gin.H{"error": "Staff accounts must be demoted by an administrator before they can be deleted"})
+		return
+	}
+
+	if !h.erase(c, userID, true) {
+		return
+	}
+
+	h.sendEmail(mailer.Message{
+		To:      email,
+		Subject: "Your Finspeed account has been deleted",
+		Body:    "Your account and personal details have been deleted. Order records are kept only as required for tax purposes.\n",
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// PurgeUser handles DELETE /api/v1/admin/users/:id/purge
+// Only archived users can be purged. Users with orders are anonymised instead, since orders must be kept for tax records.
+func (h *PrivacyHandler) PurgeUser(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var archived bool
+	if err := h.db.QueryRow("SELECT archived_at IS NOT NULL FROM users WHERE id = $1", id).Scan(&archived); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to load user", zap.Error(err), zap.Int64("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !archived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Archive the user before purging them"})
+		return
+	}
+
+	if !h.erase(c, id, false) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted permanently"})
+}
+
+// erase deletes the user, or anonymises them when orders must be kept, and writes the error response on failure
+func (h *PrivacyHandler) erase(c *gin.Context, userID int64, selfService bool) bool {
+	anonymised, files, err := h.privacy.Erase(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, privacy.ErrOrdersInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": "The account has paid orders awaiting fulfilment, returns awaiting a refund or paid bookings still to come"})
+		default:
+			h.logger.Error("Failed to erase user", zap.Error(err), zap.Int64("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		}
+		return false
+	}
+
+	if anonymised {
+		if err := h.sessions.RevokeAllSessions(userID); err != nil {
+			h.logger.Error("Failed to revoke sessions after erasure", zap.Error(err), zap.Int64("user_id", userID))
+		}
+	}
+	for _, url := range files {
+		if err := h.files.DeleteByURL(c.Request.Context(), url); err != nil {
+			h.logger.Error("Failed to delete uploaded file after erasure", zap.Error(err), zap.Int64("user_id", userID), zap.String("url", url))
+		}
+	}
+
+	fields := []zap.Field{zap.Int64("user_id", userID), zap.Bool("anonymised", anonymised), zap.String("client_ip", c.ClientIP())}
+	actor := auditActor(c)
+	if selfService && anonymised {
+		// A deleted user can no longer be referenced as the actor
+		actor.UserID = userID
+	}
+	if !selfService {
+		fields = append(fields, zap.Int64("admin_id", c.GetInt64("user_id")))
+	}
+	auth.LogSecurityEvent(h.logger, auth.EventAccountErased, fields...)
+	// The entry deliberately carries no personal data
+	h.audit.Record(actor, "user.delete", "user", userID, nil, gin.H{"anonymised": anonymised, "self_service": selfService})
+	return true
+}
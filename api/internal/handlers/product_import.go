@@ -0,0 +1,632 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/inventory"
+	"finspeed/api/internal/spreadsheet"
+)
+
+const (
+	maxImportSize = 10 * 1024 * 1024
+	maxImportRows = 5000
+	// specColumnPrefix marks a spec column; dots in the rest of the name nest, e.g. spec.display.size
+	specColumnPrefix = "spec."
+)
+
+// importColumns are the fixed columns of an import file, in export order
+var importColumns = []string{"sku", "title", "slug", "price", "hsn", "stock", "category", "warranty_months", "status"}
+
+var requiredImportColumns = []string{"sku", "title", "slug", "price"}
+
+// ImportIssue is a problem with one cell or row of an import file. Row is the line in the file.
+type ImportIssue struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// importRow is a parsed row. Nil optional fields were left blank and keep their current value on update.
+type importRow struct {
+	line           int
+	sku            string
+	title          string
+	slug           string
+	price          float64
+	hsn            *string
+	stock          *int
+	category       string
+	warrantyMonths *int
+	status         string
+	specs          map[string]interface{}
+}
+
+// ImportProducts handles POST /api/v1/admin/products/import
+// The file (multipart field "file", .csv or .xlsx) has a header row and one product per row, matched on SKU:
+// existing products are updated and new ones created as drafts. All rows are applied in one transaction,
+// nothing is saved if any row is invalid, and ?dry_run=true only validates.
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required (field name: file)"})
+		return
+	}
+	if fileHeader.Size <= 0 || fileHeader.Size > maxImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file size (max 10MB)"})
+		return
+	}
+	format, err := spreadsheet.FormatOf(fileHeader.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .csv and .xlsx files can be imported"})
+		return
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(src, maxImportSize))
+	_ = src.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+
+	// One more row than the products for the header
+	table, err := spreadsheet.Read(format, data, maxImportRows+1)
+	if errors.Is(err, spreadsheet.ErrTooManyRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d products can be imported at once", maxImportRows)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse file: " + err.Error()})
+		return
+	}
+	if len(table) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file needs a header row and at least one product"})
+		return
+	}
+
+	header, msg := importHeader(table[0].Cells)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var issues []ImportIssue
+	var rows []importRow
+	seenSKU := map[string]int{}
+	seenSlug := map[string]int{}
+	for _, r := range table[1:] {
+		row, rowIssues := parseImportRow(header, r)
+		if len(rowIssues) > 0 {
+			issues = append(issues, rowIssues...)
+			continue
+		}
+		if first, ok := seenSKU[row.sku]; ok {
+			issues = append(issues, ImportIssue{Row: row.line, Column: "sku", Message: fmt.Sprintf("Duplicate of row %d", first)})
+			continue
+		}
+		if first, ok := seenSlug[row.slug]; ok {
+			issues = append(issues, ImportIssue{Row: row.line, Column: "slug", Message: fmt.Sprintf("Duplicate of row %d", first)})
+			continue
+		}
+		seenSKU[row.sku] = row.line
+		seenSlug[row.slug] = row.line
+		rows = append(rows, row)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+		return
+	}
+	defer tx.Rollback()
+
+	categories, err := importCategories(tx)
+	if err != nil {
+		h.logger.Error("Failed to load categories", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+		return
+	}
+
+	var created, updated []importedProduct
+	for _, row := range rows {
+		var categoryID *int64
+		if row.category != "" {
+			id, ok := categories[row.category]
+			if !ok {
+				issues = append(issues, ImportIssue{Row: row.line, Column: "category", Message: "Unknown category slug"})
+				continue
+			}
+			categoryID = &id
+		}
+
+		p, issue, err := h.importProduct(tx, c, row, categoryID)
+		if err != nil {
+			h.logger.Error("Failed to import product", zap.Error(err), zap.String("sku", row.sku))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+			return
+		}
+		if issue != nil {
+			issues = append(issues, *issue)
+			continue
+		}
+		if p.existing {
+			updated = append(updated, p)
+		} else {
+			created = append(created, p)
+		}
+	}
+
+	if issues == nil {
+		issues = []ImportIssue{}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Row < issues[j].Row })
+	resp := gin.H{
+		"dry_run": dryRun,
+		"rows":    len(table) - 1,
+		"created": len(created),
+		"updated": len(updated),
+		"errors":  issues,
+	}
+	if len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit product import", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import products"})
+		return
+	}
+
+	h.logger.Info("Products imported", zap.Int("created", len(created)), zap.Int("updated", len(updated)))
+	actor := auditActor(c)
+	for _, p := range append(created, updated...) {
+		h.audit.Record(actor, "product.import", "product", p.id, p.before, h.audit.Snapshot(productSnapshotQuery, p.id))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// importedProduct identifies the product a row was applied to
+type importedProduct struct {
+	id       int64
+	existing bool
+	before   map[string]interface{}
+}
+
+// importProduct creates or updates the product with the row's SKU within tx. Problems the admin can fix
+// in the file are returned as an issue; err is only set for failures that abort the import.
+func (h *ProductHandler) importProduct(tx *sql.Tx, c *gin.Context, row importRow, categoryID *int64) (importedProduct, *ImportIssue, error) {
+	var p importedProduct
+	var oldPrice float64
+	var oldStock int
+	var archivedAt *string
+	err := tx.QueryRow(
+		"SELECT id, price, stock_qty, archived_at FROM products WHERE sku = $1 FOR UPDATE",
+		row.sku,
+	).Scan(&p.id, &oldPrice, &oldStock, &archivedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return p, nil, err
+	}
+	p.existing = err == nil
+	if archivedAt != nil {
+		return p, &ImportIssue{Row: row.line, Column: "sku", Message: "The product with this SKU is archived; restore it first"}, nil
+	}
+
+	var taken bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE slug = $1 AND id <> $2)", row.slug, p.id).Scan(&taken)
+	if err != nil {
+		return p, nil, err
+	}
+	if taken {
+		return p, &ImportIssue{Row: row.line, Column: "slug", Message: "Slug is used by another product"}, nil
+	}
+
+	var specs interface{}
+	if len(row.specs) > 0 {
+		data, err := json.Marshal(row.specs)
+		if err != nil {
+			return p, nil, err
+		}
+		specs = data
+	}
+
+	if !p.existing {
+		status := row.status
+		if status == "" {
+			status = ProductStatusDraft
+		}
+		err := tx.QueryRow(
+			`INSERT INTO products (title, slug, price, currency, sku, hsn, stock_qty, category_id, specs_json, warranty_months, status)
+			 VALUES ($1, $2, $3, 'INR', $4, $5, 0, $6, $7, $8, $9) RETURNING id`,
+			row.title, row.slug, row.price, row.sku, row.hsn, categoryID, specs, row.warrantyMonths, status,
+		).Scan(&p.id)
+		if err != nil {
+			return p, nil, err
+		}
+		if err := recordPriceHistory(tx, c, p.id); err != nil {
+			return p, nil, err
+		}
+		if row.stock != nil && *row.stock > 0 {
+			_, err := h.inventory.Record(tx, movementActor(c, inventory.Movement{
+				ProductID: p.id,
+				Kind:      inventory.KindReceipt,
+				Quantity:  *row.stock,
+				Reason:    "Initial stock",
+			}))
+			if err != nil {
+				return p, nil, err
+			}
+		}
+		return p, nil, nil
+	}
+
+	p.before = h.audit.Snapshot(productSnapshotQuery, p.id)
+	// Blank optional cells keep the current value
+	_, err = tx.Exec(
+		`UPDATE products SET title = $2, slug = $3, price = $4, hsn = COALESCE($5, hsn), category_id = COALESCE($6, category_id),
+		        specs_json = COALESCE($7, specs_json), warranty_months = COALESCE($8, warranty_months),
+		        status = COALESCE(NULLIF($9, ''), status), updated_at = NOW()
+		 WHERE id = $1`,
+		p.id, row.title, row.slug, row.price, row.hsn, categoryID, specs, row.warrantyMonths, row.status,
+	)
+	if err != nil {
+		return p, nil, err
+	}
+	if row.price != oldPrice {
+		if err := recordPriceHistory(tx, c, p.id); err != nil {
+			return p, nil, err
+		}
+	}
+	// Like the product editor, the stock column is a count at the default location
+	if row.stock != nil && *row.stock != oldStock {
+		_, err := h.inventory.Record(tx, movementActor(c, inventory.Movement{
+			ProductID: p.id,
+			Kind:      inventory.KindAdjustment,
+			Quantity:  *row.stock - oldStock,
+			Reason:    "Stock count set by import",
+		}))
+		if errors.Is(err, inventory.ErrInsufficientStock) {
+			return p, &ImportIssue{Row: row.line, Column: "stock", Message: "The default location does not hold enough stock; record the adjustment per location"}, nil
+		}
+		if err != nil {
+			return p, nil, err
+		}
+	}
+	return p, nil, nil
+}
+
+// importHeader maps the columns of an import file's header row to their index, or describes what is wrong with it
+func importHeader(cells []string) (map[string]int, string) {
+	known := map[string]bool{}
+	for _, col := range importColumns {
+		known[col] = true
+	}
+	header := map[string]int{}
+	for i, cell := range cells {
+		name := strings.TrimSpace(cell)
+		col := strings.ToLower(name)
+		if col == "" {
+			continue
+		}
+		// Spec keys keep their case, the rest of the header does not matter
+		if strings.HasPrefix(col, specColumnPrefix) {
+			col = specColumnPrefix + name[len(specColumnPrefix):]
+			if !validSpecPath(col[len(specColumnPrefix):]) {
+				return nil, fmt.Sprintf("Invalid spec column %q", cell)
+			}
+		} else if !known[col] {
+			return nil, fmt.Sprintf("Unknown column %q", cell)
+		}
+		if _, dup := header[col]; dup {
+			return nil, fmt.Sprintf("Column %q appears more than once", cell)
+		}
+		header[col] = i
+	}
+	for _, col := range requiredImportColumns {
+		if _, ok := header[col]; !ok {
+			return nil, fmt.Sprintf("Missing required column %q", col)
+		}
+	}
+	return header, ""
+}
+
+func validSpecPath(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseImportRow(header map[string]int, r spreadsheet.Row) (importRow, []ImportIssue) {
+	row := importRow{line: r.Line}
+	var issues []ImportIssue
+	cell := func(col string) string {
+		if i, ok := header[col]; ok && i < len(r.Cells) {
+			return strings.TrimSpace(r.Cells[i])
+		}
+		return ""
+	}
+	fail := func(col, msg string) {
+		issues = append(issues, ImportIssue{Row: r.Line, Column: col, Message: msg})
+	}
+
+	for _, col := range requiredImportColumns {
+		if cell(col) == "" {
+			fail(col, "Required")
+		}
+	}
+	row.sku = cell("sku")
+	row.title = cell("title")
+	row.slug = cell("slug")
+	row.category = strings.ToLower(cell("category"))
+
+	if v := cell("price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price <= 0 {
+			fail("price", "Must be a number greater than 0")
+		}
+		row.price = price
+	}
+	if v := cell("hsn"); v != "" {
+		row.hsn = &v
+	}
+	if v := cell("stock"); v != "" {
+		stock, err := strconv.Atoi(v)
+		if err != nil || stock < 0 {
+			fail("stock", "Must be a whole number of 0 or more")
+		}
+		row.stock = &stock
+	}
+	if v := cell("warranty_months"); v != "" {
+		months, err := strconv.Atoi(v)
+		if err != nil || months < 0 {
+			fail("warranty_months", "Must be a whole number of 0 or more")
+		}
+		row.warrantyMonths = &months
+	}
+	if v := strings.ToLower(cell("status")); v != "" {
+		if !validProductStatus(v) {
+			fail("status", "Must be draft, published or hidden")
+		}
+		row.status = v
+	}
+
+	for col := range header {
+		if !strings.HasPrefix(col, specColumnPrefix) {
+			continue
+		}
+		v := cell(col)
+		if v == "" {
+			continue
+		}
+		if row.specs == nil {
+			row.specs = map[string]interface{}{}
+		}
+		if !setSpec(row.specs, strings.Split(col[len(specColumnPrefix):], "."), specValue(v)) {
+			fail(col, "Conflicts with another spec column")
+		}
+	}
+	return row, issues
+}
+
+// setSpec stores value at the nested path, or reports false if the path runs into a value set by another column
+func setSpec(specs map[string]interface{}, path []string, value interface{}) bool {
+	for _, key := range path[:len(path)-1] {
+		next, ok := specs[key]
+		if !ok {
+			child := map[string]interface{}{}
+			specs[key] = child
+			specs = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		specs = child
+	}
+	last := path[len(path)-1]
+	if _, exists := specs[last]; exists {
+		return false
+	}
+	specs[last] = value
+	return true
+}
+
+// specValue reads a spec cell as a boolean, number or JSON array where it looks like one, and as text otherwise.
+// Codes with leading zeros such as "007" stay text.
+func specValue(v string) interface{} {
+	switch v {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	leadingZero := len(v) > 1 && v[0] == '0' && v[1] != '.'
+	if f, err := strconv.ParseFloat(v, 64); err == nil && !leadingZero {
+		return f
+	}
+	if strings.HasPrefix(v, "[") {
+		var list []interface{}
+		if err := json.Unmarshal([]byte(v), &list); err == nil {
+			return list
+		}
+	}
+	return v
+}
+
+// importCategories maps the slugs of active categories to their IDs
+func importCategories(tx *sql.Tx) (map[string]int64, error) {
+	rows, err := tx.Query("SELECT id, slug FROM categories WHERE archived_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var slug string
+		if err := rows.Scan(&id, &slug); err != nil {
+			return nil, err
+		}
+		categories[strings.ToLower(slug)] = id
+	}
+	return categories, rows.Err()
+}
+
+// ExportProducts handles GET /api/v1/admin/products/export
+// It returns the catalogue as ?format=csv (default) or xlsx in the layout accepted by ImportProducts.
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	format := spreadsheet.Format(strings.ToLower(c.DefaultQuery("format", string(spreadsheet.CSV))))
+	if format != spreadsheet.CSV && format != spreadsheet.XLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+	archived, err := archivedFilter(c, "p.archived_at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	where := ""
+	if archived != "" {
+		where = " WHERE " + archived
+	}
+
+	rows, err := h.db.Query(
+		`SELECT p.sku, p.title, p.slug, p.price, p.hsn, p.stock_qty, cat.slug, p.warranty_months, p.status, p.specs_json
+		 FROM products p LEFT JOIN categories cat ON cat.id = p.category_id` + where + `
+		 ORDER BY p.id`,
+	)
+	if err != nil {
+		h.logger.Error("Failed to export products", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export products"})
+		return
+	}
+	defer rows.Close()
+
+	var products []map[string]string
+	specColumns := map[string]bool{}
+	for rows.Next() {
+		var sku, hsn, category *string
+		var title, slug, status string
+		var price float64
+		var stock int
+		var warranty *int
+		var specsRaw []byte
+		if err := rows.Scan(&sku, &title, &slug, &price, &hsn, &stock, &category, &warranty, &status, &specsRaw); err != nil {
+			h.logger.Error("Failed to scan product", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export products"})
+			return
+		}
+		p := map[string]string{
+			"title":  title,
+			"slug":   slug,
+			"price":  strconv.FormatFloat(price, 'f', -1, 64),
+			"stock":  strconv.Itoa(stock),
+			"status": status,
+		}
+		if sku != nil {
+			p["sku"] = *sku
+		}
+		if hsn != nil {
+			p["hsn"] = *hsn
+		}
+		if category != nil {
+			p["category"] = *category
+		}
+		if warranty != nil {
+			p["warranty_months"] = strconv.Itoa(*warranty)
+		}
+		if len(specsRaw) > 0 {
+			var specs map[string]interface{}
+			if err := json.Unmarshal(specsRaw, &specs); err == nil {
+				flattenSpecs(p, specColumnPrefix, specs)
+			}
+		}
+		for col := range p {
+			if strings.HasPrefix(col, specColumnPrefix) {
+				specColumns[col] = true
+			}
+		}
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		h.logger.Error("Failed to read products", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export products"})
+		return
+	}
+
+	columns := append([]string{}, importColumns...)
+	specs := make([]string, 0, len(specColumns))
+	for col := range specColumns {
+		specs = append(specs, col)
+	}
+	sort.Strings(specs)
+	columns = append(columns, specs...)
+
+	table := [][]string{columns}
+	for _, p := range products {
+		line := make([]string, len(columns))
+		for i, col := range columns {
+			line[i] = p[col]
+		}
+		table = append(table, line)
+	}
+
+	// Build the file before writing headers so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	if err := spreadsheet.Write(&buf, format, "Products", table); err != nil {
+		h.logger.Error("Failed to write export", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export products"})
+		return
+	}
+	filename := fmt.Sprintf("products-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, format.ContentType(), buf.Bytes())
+}
+
+// flattenSpecs writes nested specs as dotted columns; arrays are kept as JSON
+func flattenSpecs(out map[string]string, prefix string, specs map[string]interface{}) {
+	for key, v := range specs {
+		col := prefix + key
+		switch val := v.(type) {
+		case map[string]interface{}:
+			flattenSpecs(out, col+".", val)
+		case string:
+			out[col] = val
+		case float64:
+			out[col] = strconv.FormatFloat(val, 'f', -1, 64)
+		case bool:
+			out[col] = strconv.FormatBool(val)
+		case nil:
+		default:
+			data, _ := json.Marshal(val)
+			out[col] = string(data)
+		}
+	}
+}
@@ -11,16 +11,21 @@ import (
     "time"
 
     "github.com/gin-gonic/gin"
+    "github.com/lib/pq"
     "go.uber.org/zap"
 
+    "finspeed/api/internal/audit"
     "finspeed/api/internal/database"
+    "finspeed/api/internal/inventory"
     "finspeed/api/internal/storage"
 )
 
 type ProductHandler struct {
-	db     *database.DB
-	logger *zap.Logger
-	store  storage.Storage
+	db        *database.DB
+	logger    *zap.Logger
+	store     storage.Storage
+	audit     *audit.Recorder
+	inventory *inventory.Store
 }
 
 // UploadProductImage handles POST /api/v1/admin/products/:id/images
@@ -120,6 +125,7 @@ func (h *ProductHandler) UploadProductImage(c *gin.Context) {
     if alt != "" {
         img.Alt = &alt
     }
+    h.audit.Record(auditActor(c), "product.image_upload", "product_image", imageID, nil, h.audit.Snapshot(productImageSnapshotQuery, imageID))
     c.JSON(http.StatusCreated, gin.H{"image": img})
 }
 
@@ -152,6 +158,8 @@ func (h *ProductHandler) DeleteProductImage(c *gin.Context) {
         return
     }
 
+    before := h.audit.Snapshot(productImageSnapshotQuery, imageID)
+
     // Delete DB record first
     if _, err := h.db.Exec("DELETE FROM product_images WHERE id = $1 AND product_id = $2", imageID, productID); err != nil {
         h.logger.Error("Failed to delete image record", zap.Error(err))
@@ -171,6 +179,7 @@ func (h *ProductHandler) DeleteProductImage(c *gin.Context) {
         )`, productID)
     }
 
+    h.audit.Record(auditActor(c), "product.image_delete", "product_image", imageID, before, nil)
     c.JSON(http.StatusOK, gin.H{"message": "Image deleted"})
 }
 
@@ -199,6 +208,8 @@ func (h *ProductHandler) SetPrimaryProductImage(c *gin.Context) {
         return
     }
 
+    before := h.audit.Snapshot(productImageSnapshotQuery, imageID)
+
     // Reset all to false, then set chosen to true
     if _, err := h.db.Exec("UPDATE product_images SET is_primary = FALSE WHERE product_id = $1", productID); err != nil {
         h.logger.Error("Failed to reset primary images", zap.Error(err))
@@ -211,6 +222,7 @@ func (h *ProductHandler) SetPrimaryProductImage(c *gin.Context) {
         return
     }
 
+    h.audit.Record(auditActor(c), "product.image_set_primary", "product_image", imageID, before, h.audit.Snapshot(productImageSnapshotQuery, imageID))
     c.JSON(http.StatusOK, gin.H{"message": "Primary image updated"})
 }
 
@@ -222,11 +234,39 @@ func nullableString(s string) *string {
     return &s
 }
 
+const (
+	ProductStatusDraft     = "draft"
+	ProductStatusPublished = "published"
+	ProductStatusHidden    = "hidden"
+)
+
+// publishedProductCondition selects products the storefront may show and sell; p is the products alias
+const publishedProductCondition = `p.archived_at IS NULL AND p.status = 'published'
+	AND (p.publish_at IS NULL OR p.publish_at <= NOW()) AND (p.unpublish_at IS NULL OR p.unpublish_at > NOW())`
+
+// setCompareAtPrice shows the regular price struck through while a sale is active
+func (p *Product) setCompareAtPrice() {
+	if p.EffectivePrice < p.Price {
+		regular := p.Price
+		p.CompareAtPrice = &regular
+	}
+}
+
+func validProductStatus(status string) bool {
+	return status == ProductStatusDraft || status == ProductStatusPublished || status == ProductStatusHidden
+}
+
 type Product struct {
 	ID              int64                  `json:"id"`
 	Title           string                 `json:"title"`
 	Slug            string                 `json:"slug"`
 	Price           float64                `json:"price"`
+	// EffectivePrice is what the customer pays now; while on sale CompareAtPrice is the regular price
+	EffectivePrice  float64                `json:"effective_price"`
+	CompareAtPrice  *float64               `json:"compare_at_price,omitempty"`
+	SalePrice       *float64               `json:"sale_price,omitempty"`
+	SaleStartsAt    *string                `json:"sale_starts_at,omitempty"`
+	SaleEndsAt      *string                `json:"sale_ends_at,omitempty"`
 	Currency        string                 `json:"currency"`
 	SKU             *string                `json:"sku,omitempty"`
 	HSN             *string                `json:"hsn,omitempty"`
@@ -234,8 +274,14 @@ type Product struct {
 	CategoryID      *int64                 `json:"category_id,omitempty"`
 	SpecsJSON       map[string]interface{} `json:"specs,omitempty"`
 	WarrantyMonths  *int                   `json:"warranty_months,omitempty"`
+	// IsSerialised products are tracked unit by unit and need a serial number for each unit shipped
+	IsSerialised    bool                   `json:"is_serialised,omitempty"`
+	Status          string                 `json:"status"`
+	PublishAt       *string                `json:"publish_at,omitempty"`
+	UnpublishAt     *string                `json:"unpublish_at,omitempty"`
 	CreatedAt       string                 `json:"created_at"`
 	UpdatedAt       *string                `json:"updated_at,omitempty"`
+	ArchivedAt      *string                `json:"archived_at,omitempty"`
 	Images          []ProductImage         `json:"images,omitempty"`
 	Category        *Category              `json:"category,omitempty"`
 }
@@ -259,6 +305,18 @@ type CreateProductRequest struct {
 	CategoryID     *int64                 `json:"category_id,omitempty"`
 	SpecsJSON      map[string]interface{} `json:"specs,omitempty"`
 	WarrantyMonths *int                   `json:"warranty_months,omitempty"`
+	IsSerialised   bool                   `json:"is_serialised"`
+	// Status defaults to draft
+	Status      string     `json:"status,omitempty"`
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	UnpublishAt *time.Time `json:"unpublish_at,omitempty"`
+}
+
+// ProductPublicationRequest replaces the status and schedule of a product; omitted times clear the schedule
+type ProductPublicationRequest struct {
+	Status      string     `json:"status" binding:"required"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
 }
 
 type ProductsResponse struct {
@@ -268,16 +326,29 @@ type ProductsResponse struct {
 	Limit    int       `json:"limit"`
 }
 
-func NewProductHandler(db *database.DB, logger *zap.Logger, store storage.Storage) *ProductHandler {
+func NewProductHandler(db *database.DB, logger *zap.Logger, store storage.Storage, recorder *audit.Recorder, inv *inventory.Store) *ProductHandler {
 	return &ProductHandler{
-		db:     db,
-		logger: logger,
-		store:  store,
+		db:        db,
+		logger:    logger,
+		store:     store,
+		audit:     recorder,
+		inventory: inv,
 	}
 }
 
 // GetProducts handles GET /api/v1/products
 func (h *ProductHandler) GetProducts(c *gin.Context) {
+	h.listProducts(c, false)
+}
+
+// GetAdminProducts handles GET /api/v1/admin/products
+// Takes the same filters as GetProducts plus ?archived=exclude|include|only and ?status=draft|published|hidden.
+func (h *ProductHandler) GetAdminProducts(c *gin.Context) {
+	h.listProducts(c, true)
+}
+
+// listProducts serves both listings; the storefront only sees published products
+func (h *ProductHandler) listProducts(c *gin.Context, admin bool) {
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -296,18 +367,42 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 	// Build query
 	baseQuery := `
 		SELECT p.id, p.title, p.slug, p.price, p.currency, p.sku, p.hsn, 
-		       p.stock_qty, p.category_id, p.specs_json, p.warranty_months, 
-		       p.created_at, p.updated_at,
+		       p.stock_qty, p.category_id, p.specs_json, p.warranty_months, p.is_serialised,
+		       p.status, p.publish_at, p.unpublish_at,
+		       ` + effectivePriceExpr + `, p.sale_price, p.sale_starts_at, p.sale_ends_at,
+		       p.created_at, p.updated_at, p.archived_at,
 		       c.name as category_name, c.slug as category_slug
 		FROM products p
-		LEFT JOIN categories c ON p.category_id = c.id
+		LEFT JOIN categories c ON p.category_id = c.id AND c.archived_at IS NULL
 	`
 	
 	countQuery := "SELECT COUNT(*) FROM products p"
 	args := []interface{}{}
-	whereClauses := []string{}
+	whereClauses := []string{publishedProductCondition}
 	argCount := 1
 
+	if admin {
+		clause, err := archivedFilter(c, "p.archived_at")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		whereClauses = whereClauses[:0]
+		if clause != "" {
+			whereClauses = append(whereClauses, clause)
+		}
+
+		if status := c.Query("status"); status != "" {
+			if !validProductStatus(status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of draft, published or hidden"})
+				return
+			}
+			whereClauses = append(whereClauses, "p.status = $"+strconv.Itoa(argCount))
+			args = append(args, status)
+			argCount++
+		}
+	}
+
 	if categoryID != "" {
 		whereClauses = append(whereClauses, "p.category_id = $"+strconv.Itoa(argCount))
 		args = append(args, categoryID)
@@ -356,13 +451,16 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		
 		err := rows.Scan(
 			&p.ID, &p.Title, &p.Slug, &p.Price, &p.Currency, &p.SKU, &p.HSN,
-			&p.StockQty, &p.CategoryID, &specsRaw, &p.WarrantyMonths,
-			&p.CreatedAt, &p.UpdatedAt, &categoryName, &categorySlug,
+			&p.StockQty, &p.CategoryID, &specsRaw, &p.WarrantyMonths, &p.IsSerialised,
+			&p.Status, &p.PublishAt, &p.UnpublishAt,
+			&p.EffectivePrice, &p.SalePrice, &p.SaleStartsAt, &p.SaleEndsAt,
+			&p.CreatedAt, &p.UpdatedAt, &p.ArchivedAt, &categoryName, &categorySlug,
 		)
 		if err != nil {
 			h.logger.Error("Failed to scan product", zap.Error(err))
 			continue
 		}
+		p.setCompareAtPrice()
 
 		// Unmarshal specs_json if present
 		if len(specsRaw) > 0 {
@@ -404,41 +502,68 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 
 // GetProduct handles GET /api/v1/products/:slug
 func (h *ProductHandler) GetProduct(c *gin.Context) {
-	slug := c.Param("slug")
+	h.respondProduct(c, c.Param("slug"), true)
+}
+
+// PreviewProduct handles GET /api/v1/admin/products/preview/:slug
+// Returns the product whatever its status, so staff can review drafts before publishing.
+func (h *ProductHandler) PreviewProduct(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	h.respondProduct(c, c.Param("slug"), false)
+}
+
+func (h *ProductHandler) respondProduct(c *gin.Context, slug string, publishedOnly bool) {
 	if slug == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Product slug is required"})
 		return
 	}
 
+	p, err := h.loadProduct(slug, publishedOnly)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to fetch product", zap.String("slug", slug), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// loadProduct fetches a product with its category and images by slug
+func (h *ProductHandler) loadProduct(slug string, publishedOnly bool) (*Product, error) {
 	var p Product
 	var categoryName, categorySlug sql.NullString
 	var specsRaw []byte
 	
 	query := `
 		SELECT p.id, p.title, p.slug, p.price, p.currency, p.sku, p.hsn, 
-		       p.stock_qty, p.category_id, p.specs_json, p.warranty_months, 
-		       p.created_at, p.updated_at,
+		       p.stock_qty, p.category_id, p.specs_json, p.warranty_months, p.is_serialised,
+		       p.status, p.publish_at, p.unpublish_at,
+		       ` + effectivePriceExpr + `, p.sale_price, p.sale_starts_at, p.sale_ends_at,
+		       p.created_at, p.updated_at, p.archived_at,
 		       c.name as category_name, c.slug as category_slug
 		FROM products p
-		LEFT JOIN categories c ON p.category_id = c.id
+		LEFT JOIN categories c ON p.category_id = c.id AND c.archived_at IS NULL
 		WHERE p.slug = $1
 	`
+	if publishedOnly {
+		query += " AND " + publishedProductCondition
+	}
 
 	err := h.db.QueryRow(query, slug).Scan(
 		&p.ID, &p.Title, &p.Slug, &p.Price, &p.Currency, &p.SKU, &p.HSN,
-		&p.StockQty, &p.CategoryID, &specsRaw, &p.WarrantyMonths,
-		&p.CreatedAt, &p.UpdatedAt, &categoryName, &categorySlug,
+		&p.StockQty, &p.CategoryID, &specsRaw, &p.WarrantyMonths, &p.IsSerialised,
+		&p.Status, &p.PublishAt, &p.UnpublishAt,
+		&p.EffectivePrice, &p.SalePrice, &p.SaleStartsAt, &p.SaleEndsAt,
+		&p.CreatedAt, &p.UpdatedAt, &p.ArchivedAt, &categoryName, &categorySlug,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-			return
-		}
-		h.logger.Error("Failed to fetch product", zap.String("slug", slug), zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
-		return
+		return nil, err
 	}
+	p.setCompareAtPrice()
 
 	// Unmarshal specs_json if present
 	if len(specsRaw) > 0 {
@@ -465,7 +590,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		p.Images = images
 	}
 
-	c.JSON(http.StatusOK, p)
+	return &p, nil
 }
 
 type UpdateProductRequest struct {
@@ -479,6 +604,7 @@ type UpdateProductRequest struct {
 	CategoryID     *int64                 `json:"category_id,omitempty"`
 	SpecsJSON      map[string]interface{} `json:"specs,omitempty"`
 	WarrantyMonths *int                   `json:"warranty_months,omitempty"`
+	IsSerialised   *bool                  `json:"is_serialised,omitempty"`
 }
 
 // CreateProduct handles POST /api/v1/admin/products
@@ -494,11 +620,19 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	if req.Currency == "" {
 		req.Currency = "INR"
 	}
+	if req.Status == "" {
+		req.Status = ProductStatusDraft
+	}
+	if msg := validatePublication(req.Status, req.PublishAt, req.UnpublishAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	var productID int64
 	query := `
-		INSERT INTO products (title, slug, price, currency, sku, hsn, stock_qty, category_id, specs_json, warranty_months)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO products (title, slug, price, currency, sku, hsn, stock_qty, category_id, specs_json, warranty_months,
+		                      status, publish_at, unpublish_at, is_serialised)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id
 	`
 
@@ -512,10 +646,19 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		}
 	}
 
-	err := h.db.QueryRow(
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
 		query,
 		req.Title, req.Slug, req.Price, req.Currency, req.SKU, req.HSN,
-		req.StockQty, req.CategoryID, specsJSONParam, req.WarrantyMonths,
+		0, req.CategoryID, specsJSONParam, req.WarrantyMonths,
+		req.Status, req.PublishAt, req.UnpublishAt, req.IsSerialised,
 	).Scan(&productID)
 
 	if err != nil {
@@ -524,10 +667,91 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	// The initial price opens the product's price history
+	if err := recordPriceHistory(tx, c, productID); err != nil {
+		h.logger.Error("Failed to record price history", zap.Error(err), zap.Int64("product_id", productID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+
+	// Initial stock enters through the ledger like any other receipt
+	if req.StockQty > 0 {
+		_, err := h.inventory.Record(tx, movementActor(c, inventory.Movement{
+			ProductID: productID,
+			Kind:      inventory.KindReceipt,
+			Quantity:  req.StockQty,
+			Reason:    "Initial stock",
+		}))
+		if err != nil {
+			h.logger.Error("Failed to record initial stock", zap.Error(err), zap.Int64("product_id", productID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit product", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+		return
+	}
+
 	h.logger.Info("Product created successfully", zap.Int64("product_id", productID))
+	h.audit.Record(auditActor(c), "product.create", "product", productID, nil, h.audit.Snapshot(productSnapshotQuery, productID))
+
+	// Return the created product, which is usually still a draft
+	h.respondProduct(c, req.Slug, false)
+}
 
-	// Return the created product
-	h.GetProduct(c)
+// validatePublication returns a client error message for an invalid status or schedule
+func validatePublication(status string, publishAt, unpublishAt *time.Time) string {
+	if !validProductStatus(status) {
+		return "status must be one of draft, published or hidden"
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return "unpublish_at must be after publish_at"
+	}
+	return ""
+}
+
+// SetProductPublication handles PUT /api/v1/admin/products/:id/publication
+// A published product is visible from publish_at (or immediately) until unpublish_at (or indefinitely).
+func (h *ProductHandler) SetProductPublication(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req ProductPublicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if msg := validatePublication(req.Status, req.PublishAt, req.UnpublishAt); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	before := h.audit.Snapshot(productSnapshotQuery, id)
+
+	result, err := h.db.Exec(
+		"UPDATE products SET status = $1, publish_at = $2, unpublish_at = $3, updated_at = NOW() WHERE id = $4",
+		req.Status, req.PublishAt, req.UnpublishAt, id,
+	)
+	if err != nil {
+		h.logger.Error("Failed to update product publication", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	h.logger.Info("Product publication updated", zap.Int64("product_id", id), zap.String("status", req.Status))
+	h.audit.Record(auditActor(c), "product.publication", "product", id, before, h.audit.Snapshot(productSnapshotQuery, id))
+	c.JSON(http.StatusOK, gin.H{"message": "Product publication updated"})
 }
 
 // UpdateProduct handles PUT /api/v1/admin/products/:id
@@ -581,10 +805,10 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		args = append(args, *req.HSN)
 		argId++
 	}
-	if req.StockQty != nil {
-		query += "stock_qty = $" + strconv.Itoa(argId) + ", "
-		args = append(args, *req.StockQty)
-		argId++
+	// stock_qty is changed through the inventory ledger below
+	if req.StockQty != nil && *req.StockQty < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stock_qty cannot be negative"})
+		return
 	}
 	if req.CategoryID != nil {
 		query += "category_id = $" + strconv.Itoa(argId) + ", "
@@ -608,8 +832,13 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		args = append(args, *req.WarrantyMonths)
 		argId++
 	}
+	if req.IsSerialised != nil {
+		query += "is_serialised = $" + strconv.Itoa(argId) + ", "
+		args = append(args, *req.IsSerialised)
+		argId++
+	}
 
-	if len(args) == 0 {
+	if len(args) == 0 && req.StockQty == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
 		return
 	}
@@ -617,32 +846,86 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	query += "updated_at = NOW() WHERE id = $" + strconv.Itoa(argId)
 	args = append(args, id)
 
-	// Execute query
-	result, err := h.db.Exec(query, args...)
+	before := h.audit.Snapshot(productSnapshotQuery, id)
+
+	tx, err := h.db.Begin()
 	if err != nil {
-		h.logger.Error("Failed to update product", zap.Error(err))
+		h.logger.Error("Failed to start transaction", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		h.logger.Error("Failed to get rows affected", zap.Error(err))
+	// Lock the row so the comparisons below see the price and stock this update replaces
+	var oldPrice float64
+	var oldStock int
+	if err := tx.QueryRow("SELECT price, stock_qty FROM products WHERE id = $1 FOR UPDATE", id).Scan(&oldPrice, &oldStock); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to load product", zap.Error(err), zap.Int64("product_id", id))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
 
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	// Execute query
+	if _, err := tx.Exec(query, args...); err != nil {
+		h.logger.Error("Failed to update product", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		return
+	}
+
+	if req.Price != nil && *req.Price != oldPrice {
+		if err := recordPriceHistory(tx, c, id); err != nil {
+			h.logger.Error("Failed to record price history", zap.Error(err), zap.Int64("product_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+			return
+		}
+	}
+
+	// Setting stock_qty directly is a stock count at the default location; the difference is booked as an adjustment
+	if req.StockQty != nil && *req.StockQty != oldStock {
+		_, err := h.inventory.Record(tx, movementActor(c, inventory.Movement{
+			ProductID: id,
+			Kind:      inventory.KindAdjustment,
+			Quantity:  *req.StockQty - oldStock,
+			Reason:    "Stock count set in product editor",
+		}))
+		if errors.Is(err, inventory.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The default location does not hold enough stock; record the adjustment per location"})
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to record stock adjustment", zap.Error(err), zap.Int64("product_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit product update", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
 
 	h.logger.Info("Product updated successfully", zap.Int64("product_id", id))
+	h.audit.Record(auditActor(c), "product.update", "product", id, before, h.audit.Snapshot(productSnapshotQuery, id))
 	c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully"})
 }
 
 // DeleteProduct handles DELETE /api/v1/admin/products/:id
+// Products are archived rather than deleted so historical orders keep resolving them.
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	h.setProductArchived(c, true)
+}
+
+// RestoreProduct handles POST /api/v1/admin/products/:id/restore
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	h.setProductArchived(c, false)
+}
+
+func (h *ProductHandler) setProductArchived(c *gin.Context, archive bool) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
@@ -650,28 +933,94 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	query := "DELETE FROM products WHERE id = $1"
+	query := "UPDATE products SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL"
+	action, message := "product.archive", "Product archived successfully"
+	if !archive {
+		query = "UPDATE products SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL"
+		action, message = "product.restore", "Product restored successfully"
+	}
+
+	before := h.audit.Snapshot(productSnapshotQuery, id)
+
 	result, err := h.db.Exec(query, id)
 	if err != nil {
-		h.logger.Error("Failed to delete product", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		h.logger.Error("Failed to change product archive state", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		h.logger.Error("Failed to get rows affected", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 		return
 	}
 
 	if rowsAffected == 0 {
+		if before == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else if archive {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product is already archived"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product is not archived"})
+		}
+		return
+	}
+
+	h.logger.Info(message, zap.Int64("product_id", id))
+	h.audit.Record(auditActor(c), action, "product", id, before, h.audit.Snapshot(productSnapshotQuery, id))
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// PurgeProduct handles DELETE /api/v1/admin/products/:id/purge
+// Only archived products that were never ordered can be deleted permanently.
+func (h *ProductHandler) PurgeProduct(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	before := h.audit.Snapshot(productSnapshotQuery, id)
+	if before == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
-	h.logger.Info("Product deleted successfully", zap.Int64("product_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+	images, err := h.getProductImages(id)
+	if err != nil {
+		h.logger.Error("Failed to fetch product images", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge product"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM products WHERE id = $1 AND archived_at IS NOT NULL", id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Product appears in customer or purchase orders and can only stay archived"})
+			return
+		}
+		h.logger.Error("Failed to purge product", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge product"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Archive the product before purging it"})
+		return
+	}
+
+	// Image rows were removed by the cascade; the files are cleaned up on a best-effort basis
+	for _, img := range images {
+		if err := h.store.DeleteByURL(c.Request.Context(), img.URL); err != nil {
+			h.logger.Warn("Failed to delete purged product image", zap.Error(err), zap.String("url", img.URL))
+		}
+	}
+
+	h.logger.Info("Product purged", zap.Int64("product_id", id))
+	h.audit.Record(auditActor(c), "product.purge", "product", id, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Product deleted permanently"})
 }
 
 // getProductImages fetches images for a product
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"finspeed/api/internal/address"
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/mailer"
+)
+
+// Profile is the signed-in user's own view of their account
+type Profile struct {
+	ID            int64     `json:"id"`
+	Email         string    `json:"email"`
+	PendingEmail  *string   `json:"pending_email,omitempty"`
+	Name          *string   `json:"name"`
+	Phone         *string   `json:"phone"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	HasPassword   bool      `json:"has_password"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// UpdateProfileRequest changes only the fields present; an empty string clears the field
+type UpdateProfileRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,max=100"`
+	Phone *string `json:"phone,omitempty"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// GetProfile handles GET /api/v1/me
+func (h *AuthHandler) GetProfile(c *gin.Context) {
+	profile, err := h.loadProfile(c.GetInt64("user_id"))
+	if err != nil {
+		h.logger.Error("Failed to load profile", zap.Error(err), zap.Int64("user_id", c.GetInt64("user_id")))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateProfile handles PUT /api/v1/me
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var updates []string
+	var params []interface{}
+
+	if req.Name != nil {
+		params = append(params, strings.TrimSpace(*req.Name))
+		updates = append(updates, "name = NULLIF($"+strconv.Itoa(len(params))+", '')")
+	}
+	if req.Phone != nil {
+		phone := strings.TrimSpace(*req.Phone)
+		if phone != "" {
+			normalized, err := address.NormalizePhone(phone)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			phone = normalized
+		}
+		params = append(params, phone)
+		updates = append(updates, "phone = NULLIF($"+strconv.Itoa(len(params))+", '')")
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	params = append(params, userID)
+	query := "UPDATE users SET " + strings.Join(updates, ", ") + " WHERE id = $" + strconv.Itoa(len(params))
+	if _, err := h.db.Exec(query, params...); err != nil {
+		h.logger.Error("Failed to update profile", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	profile, err := h.loadProfile(userID)
+	if err != nil {
+		h.logger.Error("Failed to load profile", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// ChangeEmail handles POST /api/v1/me/email
+// The new address only replaces the current one once the link sent to it is confirmed.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	newEmail := normalizeEmail(req.Email)
+
+	userID := c.GetInt64("user_id")
+	currentEmail, ok := h.checkCurrentPassword(c, userID, req.Password)
+	if !ok {
+		return
+	}
+	if strings.EqualFold(newEmail, currentEmail) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+
+	var taken bool
+	if err := h.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = $1)", newEmail).Scan(&taken); err != nil {
+		h.logger.Error("Failed to check email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	if _, err := h.db.Exec("UPDATE users SET pending_email = $1 WHERE id = $2", newEmail, userID); err != nil {
+		h.logger.Error("Failed to store pending email", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	token, err := h.tokens.Issue(userID, auth.PurposeEmailChange, h.config.EmailVerificationTTL)
+	if err != nil {
+		h.logger.Error("Failed to issue email change token", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+	h.sendEmail(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Finspeed email address",
+		Body: fmt.Sprintf(
+			"Please confirm that you want to use this address for your Finspeed account: %s\n\nThis link expires in %s.\n",
+			h.frontendLink("/auth/confirm-email", token), h.config.EmailVerificationTTL,
+		),
+	})
+	h.sendEmail(mailer.Message{
+		To:      currentEmail,
+		Subject: "Your Finspeed email address is being changed",
+		Body: fmt.Sprintf(
+			"A request was made to change your account email to %s. If this was not you, reset your password immediately.\n",
+			newEmail,
+		),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Confirmation email sent to the new address", "pending_email": newEmail})
+}
+
+// ConfirmEmailChange handles POST /api/v1/auth/email/change/confirm
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to start transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := h.tokens.Consume(tx, req.Token, auth.PurposeEmailChange)
+	if err != nil {
+		if errors.Is(err, auth.ErrActionTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		h.logger.Error("Failed to consume email change token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var oldEmail, newEmail string
+	err = tx.QueryRow(
+		`UPDATE users u SET email = u.pending_email, pending_email = NULL, email_verified_at = NOW()
+		 FROM (SELECT email FROM users WHERE id = $1) old
+		 WHERE u.id = $1 AND u.pending_email IS NOT NULL
+		 RETURNING old.email, u.email`,
+		userID,
+	).Scan(&oldEmail, &newEmail)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		case errors.As(err, &pqErr) && pqErr.Code == "23505":
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		default:
+			h.logger.Error("Failed to change email", zap.Error(err), zap.Int64("user_id", userID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit email change", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Access tokens carry the email, so every session signs in again with the new address
+	if err := h.sessions.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to revoke sessions after email change", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	auth.LogSecurityEvent(h.logger, auth.EventEmailChanged, zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+	h.sendEmail(mailer.Message{
+		To:      oldEmail,
+		Subject: "Your Finspeed email address was changed",
+		Body:    fmt.Sprintf("Your account email is now %s. If this was not you, contact support immediately.\n", newEmail),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed", "email": newEmail})
+}
+
+// ChangePassword handles POST /api/v1/me/password
+// Other sessions are signed out and the caller receives a fresh session.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	email, ok := h.checkCurrentPassword(c, userID, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		h.logger.Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var user User
+	err = h.db.QueryRow(
+		`UPDATE users SET password_hash = $1, failed_login_count = 0, locked_until = NULL WHERE id = $2
+		 RETURNING id, email, role, email_verified_at IS NOT NULL`,
+		string(hashedPassword), userID,
+	).Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified)
+	if err != nil {
+		h.logger.Error("Failed to update password", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := h.sessions.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to revoke sessions after password change", zap.Error(err), zap.Int64("user_id", userID))
+	}
+	if err := h.revokeCurrentAccessToken(c); err != nil {
+		h.logger.Warn("Failed to revoke current access token", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	auth.LogSecurityEvent(h.logger, auth.EventPasswordChanged, zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+	h.sendEmail(mailer.Message{
+		To:      email,
+		Subject: "Your Finspeed password was changed",
+		Body:    "Your password was just changed and your other sessions were signed out. If this was not you, reset your password immediately.\n",
+	})
+
+	resp, err := h.issueSession(c, user)
+	if err != nil {
+		h.logger.Error("Failed to generate token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkCurrentPassword re-authenticates the signed-in user before a sensitive change and returns their email.
+// Password-less accounts (created through an identity provider) must set a password via reset first,
+// so a stolen access token alone cannot take over the account.
+func (h *AuthHandler) checkCurrentPassword(c *gin.Context, userID int64, password string) (string, bool) {
+	var email string
+	var hash sql.NullString
+	if err := h.db.QueryRow("SELECT email, password_hash FROM users WHERE id = $1", userID).Scan(&email, &hash); err != nil {
+		h.logger.Error("Failed to load user", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return "", false
+	}
+	if !hash.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your account has no password; set one through password reset first"})
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return "", false
+	}
+	return email, true
+}
+
+func (h *AuthHandler) loadProfile(userID int64) (Profile, error) {
+	var p Profile
+	err := h.db.QueryRow(
+		`SELECT id, email, pending_email, name, phone, role, email_verified_at IS NOT NULL, password_hash IS NOT NULL, created_at
+		 FROM users WHERE id = $1`,
+		userID,
+	).Scan(&p.ID, &p.Email, &p.PendingEmail, &p.Name, &p.Phone, &p.Role, &p.EmailVerified, &p.HasPassword, &p.CreatedAt)
+	return p, err
+}
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/purchasing"
+)
+
+// PurchasingHandler serves suppliers and purchase orders
+type PurchasingHandler struct {
+	logger     *zap.Logger
+	purchasing *purchasing.Store
+	audit      *audit.Recorder
+}
+
+// SupplierRequest creates or replaces a supplier; IsActive defaults to true
+type SupplierRequest struct {
+	Name         string  `json:"name" binding:"required,max=200"`
+	ContactName  *string `json:"contact_name"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	Phone        *string `json:"phone" binding:"omitempty,max=20"`
+	GSTIN        *string `json:"gstin" binding:"omitempty,len=15"`
+	Address      *string `json:"address"`
+	LeadTimeDays *int    `json:"lead_time_days" binding:"omitempty,min=0"`
+	Notes        *string `json:"notes"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+// PurchaseOrderRequest creates or replaces a draft purchase order. LocationID defaults to the default
+// location and ExpectedAt is a date in YYYY-MM-DD form.
+type PurchaseOrderRequest struct {
+	SupplierID int64                      `json:"supplier_id" binding:"required"`
+	LocationID int64                      `json:"location_id"`
+	ExpectedAt *string                    `json:"expected_at"`
+	Notes      *string                    `json:"notes"`
+	Lines      []PurchaseOrderLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type PurchaseOrderLineRequest struct {
+	ProductID int64   `json:"product_id" binding:"required"`
+	Qty       int     `json:"qty" binding:"required,gt=0"`
+	UnitCost  float64 `json:"unit_cost" binding:"gte=0"`
+}
+
+// ReceiveRequest books a delivery. A line's unit_cost defaults to the cost on the purchase order.
+type ReceiveRequest struct {
+	Notes *string              `json:"notes"`
+	Lines []ReceiveLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+type ReceiveLineRequest struct {
+	LineID   int64    `json:"line_id" binding:"required"`
+	Qty      int      `json:"qty" binding:"required,gt=0"`
+	UnitCost *float64 `json:"unit_cost" binding:"omitempty,gte=0"`
+}
+
+func NewPurchasingHandler(logger *zap.Logger, store *purchasing.Store, recorder *audit.Recorder) *PurchasingHandler {
+	return &PurchasingHandler{
+		logger:     logger,
+		purchasing: store,
+		audit:      recorder,
+	}
+}
+
+// optionalString trims s and turns an empty value into nil
+func optionalString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := strings.TrimSpace(*s)
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// respondPurchasingError maps store errors to responses; failed is the message for unexpected errors
+func (h *PurchasingHandler) respondPurchasingError(c *gin.Context, err error, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+	case errors.Is(err, purchasing.ErrWrongStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "The purchase order's status does not allow this"})
+	case errors.Is(err, purchasing.ErrOverReceipt):
+		c.JSON(http.StatusConflict, gin.H{"error": "Received quantity exceeds the quantity still outstanding"})
+	case errors.Is(err, purchasing.ErrInvalidReference):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or inactive supplier, location or product"})
+	case errors.Is(err, purchasing.ErrDuplicateProduct):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Each product can only appear on one line"})
+	case errors.Is(err, purchasing.ErrUnknownLine):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Line does not belong to this purchase order"})
+	default:
+		h.logger.Error(failed, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// GetSuppliers handles GET /api/v1/admin/suppliers
+// ?include_inactive=true also lists deactivated suppliers.
+func (h *PurchasingHandler) GetSuppliers(c *gin.Context) {
+	suppliers, err := h.purchasing.Suppliers(c.Query("include_inactive") == "true")
+	if err != nil {
+		h.logger.Error("Failed to fetch suppliers", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suppliers": suppliers})
+}
+
+// CreateSupplier handles POST /api/v1/admin/suppliers
+func (h *PurchasingHandler) CreateSupplier(c *gin.Context) {
+	h.saveSupplier(c, 0)
+}
+
+// UpdateSupplier handles PUT /api/v1/admin/suppliers/:id
+// Suppliers are deactivated rather than deleted, since purchase orders refer to them.
+func (h *PurchasingHandler) UpdateSupplier(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+	h.saveSupplier(c, id)
+}
+
+// saveSupplier creates a supplier when id is zero and replaces it otherwise
+func (h *PurchasingHandler) saveSupplier(c *gin.Context, id int64) {
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	sup := &purchasing.Supplier{
+		ID:           id,
+		Name:         strings.TrimSpace(req.Name),
+		ContactName:  optionalString(req.ContactName),
+		Email:        optionalString(req.Email),
+		Phone:        optionalString(req.Phone),
+		GSTIN:        optionalString(req.GSTIN),
+		Address:      optionalString(req.Address),
+		LeadTimeDays: req.LeadTimeDays,
+		Notes:        optionalString(req.Notes),
+		IsActive:     req.IsActive == nil || *req.IsActive,
+	}
+	if sup.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if sup.GSTIN != nil {
+		gstin := strings.ToUpper(*sup.GSTIN)
+		sup.GSTIN = &gstin
+	}
+
+	var before *purchasing.Supplier
+	if id != 0 {
+		var err error
+		if before, err = h.purchasing.Supplier(id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+				return
+			}
+			h.logger.Error("Failed to load supplier", zap.Error(err), zap.Int64("supplier_id", id))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save supplier"})
+			return
+		}
+	}
+
+	if err := h.purchasing.SaveSupplier(sup); err != nil {
+		if errors.Is(err, purchasing.ErrDuplicateSupplier) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A supplier with this name already exists"})
+			return
+		}
+		h.logger.Error("Failed to save supplier", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save supplier"})
+		return
+	}
+
+	if id == 0 {
+		h.logger.Info("Supplier created", zap.Int64("supplier_id", sup.ID))
+		h.audit.Record(auditActor(c), "supplier.create", "supplier", sup.ID, nil, sup)
+		c.JSON(http.StatusCreated, sup)
+		return
+	}
+	h.logger.Info("Supplier updated", zap.Int64("supplier_id", id))
+	h.audit.Record(auditActor(c), "supplier.update", "supplier", id, before, sup)
+	c.JSON(http.StatusOK, sup)
+}
+
+// GetPurchaseOrders handles GET /api/v1/admin/purchase-orders
+// ?status= and ?supplier_id= filter the list.
+func (h *PurchasingHandler) GetPurchaseOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := purchasing.Status(c.Query("status"))
+	if status != "" && !purchasing.ValidStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+	var supplierID int64
+	if v := c.Query("supplier_id"); v != "" {
+		var err error
+		if supplierID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier_id"})
+			return
+		}
+	}
+
+	orders, total, err := h.purchasing.Orders(status, supplierID, limit, (page-1)*limit)
+	if err != nil {
+		h.logger.Error("Failed to fetch purchase orders", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"purchase_orders": orders,
+		"total":           total,
+		"page":            page,
+		"limit":           limit,
+	})
+}
+
+// GetPurchaseOrder handles GET /api/v1/admin/purchase-orders/:id
+func (h *PurchasingHandler) GetPurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+	po, err := h.purchasing.Order(id)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to fetch purchase order")
+		return
+	}
+	c.JSON(http.StatusOK, po)
+}
+
+// draft validates the request and converts it for the store
+func (req PurchaseOrderRequest) draft(c *gin.Context) (purchasing.Draft, error) {
+	d := purchasing.Draft{
+		SupplierID: req.SupplierID,
+		LocationID: req.LocationID,
+		ExpectedAt: optionalString(req.ExpectedAt),
+		Notes:      optionalString(req.Notes),
+		CreatedBy:  auditActor(c).UserID,
+	}
+	if d.ExpectedAt != nil {
+		if _, err := time.Parse("2006-01-02", *d.ExpectedAt); err != nil {
+			return d, errors.New("expected_at must be a date in YYYY-MM-DD form")
+		}
+	}
+	for _, l := range req.Lines {
+		d.Lines = append(d.Lines, purchasing.DraftLine{ProductID: l.ProductID, Qty: l.Qty, UnitCost: l.UnitCost})
+	}
+	return d, nil
+}
+
+// CreatePurchaseOrder handles POST /api/v1/admin/purchase-orders
+func (h *PurchasingHandler) CreatePurchaseOrder(c *gin.Context) {
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	d, err := req.draft(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := h.purchasing.CreateOrder(d)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to create purchase order")
+		return
+	}
+	po, err := h.purchasing.Order(id)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to fetch purchase order")
+		return
+	}
+
+	h.logger.Info("Purchase order created", zap.Int64("purchase_order_id", id))
+	h.audit.Record(auditActor(c), "purchase_order.create", "purchase_order", id, nil, po)
+	c.JSON(http.StatusCreated, po)
+}
+
+// UpdatePurchaseOrder handles PUT /api/v1/admin/purchase-orders/:id
+// Only drafts can be edited.
+func (h *PurchasingHandler) UpdatePurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	d, err := req.draft(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := h.purchasing.Order(id)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to update purchase order")
+		return
+	}
+	if err := h.purchasing.UpdateOrder(id, d); err != nil {
+		h.respondPurchasingError(c, err, "Failed to update purchase order")
+		return
+	}
+	po, err := h.purchasing.Order(id)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to fetch purchase order")
+		return
+	}
+
+	h.logger.Info("Purchase order updated", zap.Int64("purchase_order_id", id))
+	h.audit.Record(auditActor(c), "purchase_order.update", "purchase_order", id, before, po)
+	c.JSON(http.StatusOK, po)
+}
+
+// ApprovePurchaseOrder handles POST /api/v1/admin/purchase-orders/:id/approve
+func (h *PurchasingHandler) ApprovePurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+	if err := h.purchasing.Approve(id, auditActor(c).UserID); err != nil {
+		h.respondPurchasingError(c, err, "Failed to approve purchase order")
+		return
+	}
+
+	h.logger.Info("Purchase order approved", zap.Int64("purchase_order_id", id))
+	h.audit.Record(auditActor(c), "purchase_order.approve", "purchase_order", id,
+		gin.H{"status": purchasing.StatusDraft}, gin.H{"status": purchasing.StatusApproved})
+	c.JSON(http.StatusOK, gin.H{"status": purchasing.StatusApproved})
+}
+
+// CancelPurchaseOrder handles POST /api/v1/admin/purchase-orders/:id/cancel
+// A partially received order is closed instead; what was received stays in stock.
+func (h *PurchasingHandler) CancelPurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+	status, err := h.purchasing.Cancel(id)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to cancel purchase order")
+		return
+	}
+
+	h.logger.Info("Purchase order cancelled", zap.Int64("purchase_order_id", id), zap.String("status", string(status)))
+	h.audit.Record(auditActor(c), "purchase_order.cancel", "purchase_order", id, nil, gin.H{"status": status})
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// ReceivePurchaseOrder handles POST /api/v1/admin/purchase-orders/:id/receipts
+// Goods can arrive in several deliveries; each one adds stock at the order's location.
+func (h *PurchasingHandler) ReceivePurchaseOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+	var req ReceiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	actor := auditActor(c)
+	d := purchasing.Delivery{Notes: optionalString(req.Notes), ReceivedBy: actor.UserID, APIKeyID: actor.APIKeyID}
+	for _, l := range req.Lines {
+		d.Lines = append(d.Lines, purchasing.DeliveryLine{LineID: l.LineID, Qty: l.Qty, UnitCost: l.UnitCost})
+	}
+
+	receiptID, status, err := h.purchasing.Receive(id, d)
+	if err != nil {
+		h.respondPurchasingError(c, err, "Failed to receive purchase order")
+		return
+	}
+
+	h.logger.Info("Purchase order received", zap.Int64("purchase_order_id", id), zap.Int64("receipt_id", receiptID))
+	h.audit.Record(actor, "purchase_order.receive", "purchase_order", id, nil, gin.H{"receipt_id": receiptID, "lines": d.Lines, "status": status})
+	c.JSON(http.StatusCreated, gin.H{"receipt_id": receiptID, "status": status})
+}
+
+// GetCostHistory handles GET /api/v1/admin/products/:id/cost-history
+// cost_price is the unit cost of the most recent receipt.
+func (h *PurchasingHandler) GetCostHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	costPrice, err := h.purchasing.CostPrice(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.logger.Error("Failed to load product", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cost history"})
+		return
+	}
+	history, err := h.purchasing.CostHistory(id, limit)
+	if err != nil {
+		h.logger.Error("Failed to fetch cost history", zap.Error(err), zap.Int64("product_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cost history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cost_price": costPrice, "cost_history": history})
+}
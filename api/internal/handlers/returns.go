@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/razorpay/razorpay-go"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/config"
+	"finspeed/api/internal/inventory"
+	"finspeed/api/internal/mailer"
+	"finspeed/api/internal/returns"
+	"finspeed/api/internal/storage"
+)
+
+// errRefundFailed wraps errors from the payment provider when issuing a refund
+var errRefundFailed = errors.New("payment provider refused the refund")
+
+// ReturnHandler serves return requests: customers open and track them, staff decide, receive and refund
+type ReturnHandler struct {
+	logger  *zap.Logger
+	returns *returns.Store
+	files   storage.Storage
+	mailer  mailer.Mailer
+	cfg     *config.Config
+	audit   *audit.Recorder
+}
+
+// ReturnRequest opens a return for part of a delivered order item
+type ReturnRequest struct {
+	OrderItemID int64   `json:"order_item_id" binding:"required"`
+	Qty         int     `json:"qty" binding:"required,gt=0"`
+	Reason      string  `json:"reason" binding:"required"`
+	Comment     *string `json:"comment" binding:"omitempty,max=2000"`
+}
+
+// ReturnShipRequest is the parcel a return was sent back in
+type ReturnShipRequest struct {
+	Courier     string  `json:"courier" binding:"required,max=100"`
+	AWBNumber   string  `json:"awb_number" binding:"required,max=64"`
+	TrackingURL *string `json:"tracking_url" binding:"omitempty,url"`
+}
+
+// ReturnDecisionRequest approves or rejects a return; the note is shown to the customer
+type ReturnDecisionRequest struct {
+	Note *string `json:"note" binding:"omitempty,max=2000"`
+}
+
+// ReturnReceiveRequest books the returned goods in. LocationID defaults to the default location. Serials
+// lists the serial number of every returned unit of a serialised product.
+type ReturnReceiveRequest struct {
+	Disposition string   `json:"disposition" binding:"required"`
+	LocationID  int64    `json:"location_id"`
+	Serials     []string `json:"serials"`
+}
+
+// ReturnRefundRequest refunds a received return. Amount defaults to the price paid for the returned items.
+type ReturnRefundRequest struct {
+	Amount *float64 `json:"amount" binding:"omitempty,gt=0"`
+}
+
+func NewReturnHandler(logger *zap.Logger, store *returns.Store, files storage.Storage, mail mailer.Mailer, cfg *config.Config, recorder *audit.Recorder) *ReturnHandler {
+	return &ReturnHandler{
+		logger:  logger,
+		returns: store,
+		files:   files,
+		mailer:  mail,
+		cfg:     cfg,
+		audit:   recorder,
+	}
+}
+
+// respondReturnError maps store errors to responses; failed is the message for unexpected errors
+func (h *ReturnHandler) respondReturnError(c *gin.Context, err error, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+	case errors.Is(err, returns.ErrWrongStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "The return's status does not allow this"})
+	case errors.Is(err, returns.ErrUnknownItem):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Item does not belong to this order"})
+	case errors.Is(err, returns.ErrNotReturnable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Quantity exceeds what was delivered and not already returned"})
+	case errors.Is(err, returns.ErrWindowClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Returns must be requested within %d days of delivery", int(h.cfg.ReturnWindow.Hours()/24))})
+	case errors.Is(err, returns.ErrTooManyPhotos):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A return can have at most %d photos", returns.MaxPhotos)})
+	case errors.Is(err, returns.ErrTrackingMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "courier and awb_number are required"})
+	case errors.Is(err, returns.ErrRefundTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund cannot exceed the price paid for the returned items"})
+	case errors.Is(err, returns.ErrNoPayment):
+		c.JSON(http.StatusConflict, gin.H{"error": "The order has no online payment to refund"})
+	case errors.Is(err, inventory.ErrUnknownLocation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown location"})
+	case errors.Is(err, returns.ErrSerialCount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give the serial number of every returned unit"})
+	case errors.Is(err, inventory.ErrNotSerialised):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The returned product is not serialised"})
+	case errors.Is(err, inventory.ErrSerialNotSold):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A serial number was not delivered for the returned item"})
+	case errors.Is(err, errRefundFailed):
+		h.logger.Warn(failed, zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment provider refused the refund"})
+	default:
+		h.logger.Error(failed, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// returnID parses the :id parameter, responding with an error when it is invalid
+func returnID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// CreateReturn handles POST /api/v1/orders/:id/returns
+// Customers can return delivered items within the return window, one order item per return.
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	var req ReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !returns.ValidReason(returns.Reason(req.Reason)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reason"})
+		return
+	}
+
+	id, err := h.returns.Create(returns.NewReturn{
+		OrderID:     orderID,
+		OrderItemID: req.OrderItemID,
+		UserID:      c.GetInt64("user_id"),
+		Qty:         req.Qty,
+		Reason:      returns.Reason(req.Reason),
+		Comment:     optionalString(req.Comment),
+	}, h.cfg.ReturnWindow)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		h.respondReturnError(c, err, "Failed to create return")
+		return
+	}
+	r, err := h.returns.Return(id, 0)
+	if err != nil {
+		h.respondReturnError(c, err, "Failed to fetch return")
+		return
+	}
+
+	h.logger.Info("Return requested", zap.Int64("return_id", id), zap.Int64("order_id", orderID))
+	c.JSON(http.StatusCreated, r)
+}
+
+// GetMyReturns handles GET /api/v1/returns
+// ?order_id= limits the list to one order.
+func (h *ReturnHandler) GetMyReturns(c *gin.Context) {
+	h.listReturns(c, c.GetInt64("user_id"))
+}
+
+// GetMyReturn handles GET /api/v1/returns/:id
+func (h *ReturnHandler) GetMyReturn(c *gin.Context) {
+	h.getReturn(c, c.GetInt64("user_id"))
+}
+
+// UploadReturnPhoto handles POST /api/v1/returns/:id/photos
+// Photos are multipart uploads in the "file" field and can be added until the return is decided.
+func (h *ReturnHandler) UploadReturnPhoto(c *gin.Context) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+	r, err := h.returns.Return(id, userID)
+	if err != nil {
+		h.respondReturnError(c, err, "Failed to upload photo")
+		return
+	}
+	if r.Status != returns.StatusRequested {
+		h.respondReturnError(c, returns.ErrWrongStatus, "Failed to upload photo")
+		return
+	}
+	if len(r.Photos) >= returns.MaxPhotos {
+		h.respondReturnError(c, returns.ErrTooManyPhotos, "Failed to upload photo")
+		return
+	}
+
+	file, ok := readUpload(c, photoTypes, "Photos must be JPEG, PNG or WebP images")
+	if !ok {
+		return
+	}
+	defer file.Close()
+	url, err := h.files.SaveReturnPhoto(c.Request.Context(), id, file.Filename, file.ContentType, file)
+	if err != nil {
+		h.logger.Error("Failed to save return photo", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save photo"})
+		return
+	}
+	photo, err := h.returns.AddPhoto(id, userID, url)
+	if err != nil {
+		// The return changed since it was checked; drop the orphaned file
+		_ = h.files.DeleteByURL(c.Request.Context(), url)
+		h.respondReturnError(c, err, "Failed to save photo")
+		return
+	}
+	c.JSON(http.StatusCreated, photo)
+}
+
+// ShipReturn handles POST /api/v1/returns/:id/ship
+// The customer enters the courier and AWB number once the approved return is on its way back.
+func (h *ReturnHandler) ShipReturn(c *gin.Context) {
+	h.shipReturn(c, c.GetInt64("user_id"))
+}
+
+// CancelReturn handles POST /api/v1/returns/:id/cancel
+// Customers can withdraw a return until they send the item back.
+func (h *ReturnHandler) CancelReturn(c *gin.Context) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	if err := h.returns.Cancel(id, c.GetInt64("user_id")); err != nil {
+		h.respondReturnError(c, err, "Failed to cancel return")
+		return
+	}
+	h.logger.Info("Return cancelled", zap.Int64("return_id", id))
+	h.getReturn(c, c.GetInt64("user_id"))
+}
+
+// GetReturns handles GET /api/v1/admin/returns
+// It takes ?status=, ?order_id= and ?user_id=.
+func (h *ReturnHandler) GetReturns(c *gin.Context) {
+	var userID int64
+	if v := c.Query("user_id"); v != "" {
+		var err error
+		if userID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+	}
+	h.listReturns(c, userID)
+}
+
+// GetReturn handles GET /api/v1/admin/returns/:id
+func (h *ReturnHandler) GetReturn(c *gin.Context) {
+	h.getReturn(c, 0)
+}
+
+// ApproveReturn handles POST /api/v1/admin/returns/:id/approve
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+	h.decide(c, "return.approve", false, h.returns.Approve)
+}
+
+// RejectReturn handles POST /api/v1/admin/returns/:id/reject
+// The note, which tells the customer why, is required.
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+	h.decide(c, "return.reject", true, h.returns.Reject)
+}
+
+func (h *ReturnHandler) decide(c *gin.Context, action string, noteRequired bool, apply func(id int64, note *string, actorID int64) error) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	var req ReturnDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	note := optionalString(req.Note)
+	if noteRequired && note == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A note explaining the rejection is required"})
+		return
+	}
+
+	actor := auditActor(c)
+	h.applyAdmin(c, id, action, "Failed to update return", func() error {
+		return apply(id, note, actor.UserID)
+	})
+}
+
+// AdminShipReturn handles POST /api/v1/admin/returns/:id/ship
+// Staff record the tracking when they arrange the pickup themselves.
+func (h *ReturnHandler) AdminShipReturn(c *gin.Context) {
+	h.shipReturn(c, 0)
+}
+
+// ReceiveReturn handles POST /api/v1/admin/returns/:id/receive
+// The disposition decides whether the goods go back into stock at the location or are written off.
+func (h *ReturnHandler) ReceiveReturn(c *gin.Context) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	var req ReturnReceiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	disposition := returns.Disposition(req.Disposition)
+	if disposition != returns.DispositionRestock && disposition != returns.DispositionWriteOff {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "disposition must be restock or write_off"})
+		return
+	}
+
+	actor := auditActor(c)
+	h.applyAdmin(c, id, "return.receive", "Failed to receive return", func() error {
+		return h.returns.Receive(id, returns.Receipt{
+			Disposition: disposition,
+			LocationID:  req.LocationID,
+			Serials:     req.Serials,
+			ReceivedBy:  actor.UserID,
+			APIKeyID:    actor.APIKeyID,
+		})
+	})
+}
+
+// RefundReturn handles POST /api/v1/admin/returns/:id/refund
+// It refunds a received return to the order's Razorpay payment.
+func (h *ReturnHandler) RefundReturn(c *gin.Context) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	var req ReturnRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if h.cfg.RazorpayKeyID == "" || h.cfg.RazorpayKeySecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Razorpay is not configured"})
+		return
+	}
+
+	actor := auditActor(c)
+	h.applyAdmin(c, id, "return.refund", "Failed to refund return", func() error {
+		_, err := h.returns.Refund(id, req.Amount, actor.UserID, func(paymentID string, amount float64) (string, float64, error) {
+			return h.issueRefund(id, paymentID, amount)
+		})
+		return err
+	})
+}
+
+// issueRefund refunds amount rupees of a Razorpay payment under the return's number and returns the refund
+// ID and the amount refunded. A refund already made for the return, by an attempt whose result was not
+// saved, is returned instead of refunding twice.
+func (h *ReturnHandler) issueRefund(id int64, paymentID string, amount float64) (string, float64, error) {
+	client := razorpay.NewClient(h.cfg.RazorpayKeyID, h.cfg.RazorpayKeySecret)
+	receipt := returns.Number(id)
+	ref, refunded, err := findRefund(client, paymentID, receipt)
+	if err != nil {
+		return "", 0, err
+	}
+	if ref != "" {
+		h.logger.Warn("Refund already issued, recording it", zap.Int64("return_id", id), zap.String("payment_id", paymentID), zap.String("refund_id", ref), zap.Float64("amount", refunded))
+		return ref, refunded, nil
+	}
+
+	data := map[string]interface{}{
+		"receipt": receipt,
+		"notes":   map[string]interface{}{"return": receipt},
+	}
+	refund, err := client.Payment.Refund(paymentID, int(math.Round(amount*100)), data, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", errRefundFailed, err)
+	}
+	ref, _ = refund["id"].(string)
+	// Logged before it is stored, so a refund is never lost if saving it fails
+	h.logger.Info("Refund issued", zap.Int64("return_id", id), zap.String("payment_id", paymentID), zap.String("refund_id", ref), zap.Float64("amount", amount))
+	return ref, amount, nil
+}
+
+// findRefund returns the ID and rupee amount of the payment's refund made under receipt that has not
+// failed, or "" if there is none
+func findRefund(client *razorpay.Client, paymentID, receipt string) (string, float64, error) {
+	list, err := client.Payment.FetchMultipleRefund(paymentID, map[string]interface{}{"count": 100}, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", errRefundFailed, err)
+	}
+	items, _ := list["items"].([]interface{})
+	for _, item := range items {
+		refund, _ := item.(map[string]interface{})
+		if refund["receipt"] != receipt || refund["status"] == "failed" {
+			continue
+		}
+		id, _ := refund["id"].(string)
+		paise, _ := refund["amount"].(float64)
+		return id, paise / 100, nil
+	}
+	return "", 0, nil
+}
+
+// applyAdmin runs a staff transition, audits it and notifies the customer of the new status
+func (h *ReturnHandler) applyAdmin(c *gin.Context, id int64, action, failed string, apply func() error) {
+	before, err := h.returns.Return(id, 0)
+	if err != nil {
+		h.respondReturnError(c, err, failed)
+		return
+	}
+	if err := apply(); err != nil {
+		h.respondReturnError(c, err, failed)
+		return
+	}
+	r, err := h.returns.Return(id, 0)
+	if err != nil {
+		h.respondReturnError(c, err, "Failed to fetch return")
+		return
+	}
+
+	h.logger.Info("Return updated", zap.Int64("return_id", id), zap.String("status", string(r.Status)))
+	h.audit.Record(auditActor(c), action, "return", id, before, r)
+	if r.Status != before.Status {
+		h.notifyCustomer(r)
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func (h *ReturnHandler) shipReturn(c *gin.Context, userID int64) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	var req ReturnShipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	t := returns.Tracking{
+		Courier:     strings.TrimSpace(req.Courier),
+		AWBNumber:   strings.TrimSpace(req.AWBNumber),
+		TrackingURL: optionalString(req.TrackingURL),
+	}
+	if userID == 0 {
+		h.applyAdmin(c, id, "return.ship", "Failed to update return", func() error {
+			return h.returns.Ship(id, 0, t)
+		})
+		return
+	}
+	if err := h.returns.Ship(id, userID, t); err != nil {
+		h.respondReturnError(c, err, "Failed to update return")
+		return
+	}
+	h.logger.Info("Return shipped", zap.Int64("return_id", id))
+	h.getReturn(c, userID)
+}
+
+func (h *ReturnHandler) listReturns(c *gin.Context, userID int64) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := returns.Status(c.Query("status"))
+	if status != "" && !returns.ValidStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+	var orderID int64
+	if v := c.Query("order_id"); v != "" {
+		var err error
+		if orderID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order_id"})
+			return
+		}
+	}
+
+	list, total, err := h.returns.Returns(status, orderID, userID, limit, (page-1)*limit)
+	if err != nil {
+		h.logger.Error("Failed to fetch returns", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"returns": list,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+func (h *ReturnHandler) getReturn(c *gin.Context, userID int64) {
+	id, ok := returnID(c)
+	if !ok {
+		return
+	}
+	r, err := h.returns.Return(id, userID)
+	if err != nil {
+		h.respondReturnError(c, err, "Failed to fetch return")
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// notifyCustomer emails the customer when staff approve, reject or refund their return
+func (h *ReturnHandler) notifyCustomer(r *returns.Return) {
+	number := returns.Number(r.ID)
+	var subject, body string
+	switch r.Status {
+	case returns.StatusApproved:
+		subject = "Your Finspeed return " + number + " is approved"
+		body = fmt.Sprintf("Your return of %d x %s from order #%d is approved.\n\n", r.Qty, r.Title, r.OrderID)
+		if r.DecisionNote != nil {
+			body += *r.DecisionNote + "\n\n"
+		}
+		body += "Please pack the item securely, mark the parcel with " + number + " and add the courier and tracking number to the return in your account once it is on its way."
+	case returns.StatusRejected:
+		subject = "Your Finspeed return " + number + " was not approved"
+		body = fmt.Sprintf("We could not approve your return of %d x %s from order #%d.\n\n", r.Qty, r.Title, r.OrderID)
+		if r.DecisionNote != nil {
+			body += *r.DecisionNote + "\n\n"
+		}
+		body += "Reply to this email if you have any questions."
+	case returns.StatusRefunded:
+		if r.RefundAmount == nil {
+			return
+		}
+		subject = "Your Finspeed return " + number + " has been refunded"
+		body = fmt.Sprintf("We have refunded ₹%.2f for your return of %d x %s from order #%d.\n\n", *r.RefundAmount, r.Qty, r.Title, r.OrderID)
+		body += "The refund goes back to your original payment method and usually shows up within 5-7 business days."
+	default:
+		return
+	}
+
+	go func() {
+		email, _, err := h.returns.Recipient(r.ID)
+		if err != nil {
+			h.logger.Error("Failed to load customer for notification", zap.Error(err), zap.Int64("return_id", r.ID))
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, mailer.Message{To: email, Subject: subject, Body: body}); err != nil {
+			h.logger.Error("Failed to send email", zap.Error(err), zap.String("subject", subject))
+		}
+	}()
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/database"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+type RoleHandler struct {
+	db     *database.DB
+	logger *zap.Logger
+	roles  *auth.RoleStore
+	audit  *audit.Recorder
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateRoleRequest struct {
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+func NewRoleHandler(db *database.DB, logger *zap.Logger, roles *auth.RoleStore, recorder *audit.Recorder) *RoleHandler {
+	return &RoleHandler{
+		db:     db,
+		logger: logger,
+		roles:  roles,
+		audit:  recorder,
+	}
+}
+
+// GetRoles handles GET /api/v1/admin/roles
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	roles, err := h.roles.List()
+	if err != nil {
+		h.logger.Error("Failed to fetch roles", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GetPermissions handles GET /api/v1/admin/permissions
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": auth.AllPermissions})
+}
+
+// CreateRole handles POST /api/v1/admin/roles
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name must be lowercase letters, digits or underscores"})
+		return
+	}
+	if bad := unknownPermission(req.Permissions); bad != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission", "permission": bad})
+		return
+	}
+	if !h.checkGrantable(c, req.Permissions, "Failed to create role") {
+		return
+	}
+
+	exists, err := h.roles.Exists(req.Name)
+	if err != nil {
+		h.logger.Error("Failed to check role", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	if err := h.roles.Save(req.Name, req.Description, req.Permissions); err != nil {
+		h.logger.Error("Failed to create role", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	h.logger.Info("Role created", zap.String("role", req.Name), zap.Strings("permissions", req.Permissions))
+	h.audit.Record(auditActor(c), "role.create", "role", req.Name, nil, h.snapshot(req.Name))
+	h.respondWithRole(c, http.StatusCreated, req.Name)
+}
+
+// UpdateRole handles PUT /api/v1/admin/roles/:name
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	name := c.Param("name")
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if bad := unknownPermission(req.Permissions); bad != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission", "permission": bad})
+		return
+	}
+
+	before, err := h.roles.Get(name)
+	if err != nil {
+		if errors.Is(err, auth.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		h.logger.Error("Failed to fetch role", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	// System roles are read-only: admin must keep full access so the system cannot be locked out, and
+	// customer must grant nothing or every shopper would become staff
+	if before.IsSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "System roles cannot be modified"})
+		return
+	}
+	if !h.checkGrantable(c, req.Permissions, "Failed to update role") {
+		return
+	}
+
+	if err := h.roles.Save(name, req.Description, req.Permissions); err != nil {
+		h.logger.Error("Failed to update role", zap.Error(err), zap.String("role", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	h.logger.Info("Role updated", zap.String("role", name), zap.Strings("permissions", req.Permissions))
+	h.audit.Record(auditActor(c), "role.update", "role", name, before, h.snapshot(name))
+	h.respondWithRole(c, http.StatusOK, name)
+}
+
+// DeleteRole handles DELETE /api/v1/admin/roles/:name
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+
+	role, err := h.roles.Get(name)
+	if err != nil {
+		if errors.Is(err, auth.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		h.logger.Error("Failed to fetch role", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if role.IsSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "System roles cannot be deleted"})
+		return
+	}
+
+	var assigned int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM users WHERE role = $1", name).Scan(&assigned); err != nil {
+		h.logger.Error("Failed to count role assignments", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if assigned > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is assigned to users", "users": assigned})
+		return
+	}
+
+	if err := h.roles.Delete(name); err != nil {
+		h.logger.Error("Failed to delete role", zap.Error(err), zap.String("role", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	h.logger.Info("Role deleted", zap.String("role", name))
+	h.audit.Record(auditActor(c), "role.delete", "role", name, role, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+func (h *RoleHandler) respondWithRole(c *gin.Context, status int, name string) {
+	role, err := h.roles.Get(name)
+	if err != nil {
+		h.logger.Error("Failed to fetch role", zap.Error(err), zap.String("role", name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+	c.JSON(status, role)
+}
+
+// snapshot returns the role for the audit log, or nil if it cannot be loaded
+func (h *RoleHandler) snapshot(name string) interface{} {
+	role, err := h.roles.Get(name)
+	if err != nil {
+		return nil
+	}
+	return role
+}
+
+// checkGrantable responds with 403 and returns false if the caller lacks any of perms. failure is the
+// error message for a lookup failure.
+func (h *RoleHandler) checkGrantable(c *gin.Context, perms []string, failure string) bool {
+	missing, err := ungrantedPermission(c, h.roles, perms)
+	if err != nil {
+		h.logger.Error("Failed to resolve role permissions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+	if missing != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant a permission you do not have", "permission": missing})
+		return false
+	}
+	return true
+}
+
+// ungrantedPermission returns the first of perms the caller does not hold, or "". Staff can only hand out
+// permissions their role grants, and only the wildcard grants the wildcard; API keys are limited to their scopes.
+func ungrantedPermission(c *gin.Context, roles *auth.RoleStore, perms []string) (string, error) {
+	v, _ := c.Get("api_key")
+	key, isKey := v.(*auth.APIKey)
+	for _, p := range perms {
+		held := isKey && key.HasScope(p)
+		if !isKey {
+			var err error
+			if held, err = roles.HasPermission(c.GetString("user_role"), p); err != nil {
+				return "", err
+			}
+		}
+		if !held {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// unknownPermission returns the first permission not in auth.AllPermissions, or ""
+func unknownPermission(perms []string) string {
+	for _, p := range perms {
+		if !auth.IsKnownPermission(p) {
+			return p
+		}
+	}
+	return ""
+}
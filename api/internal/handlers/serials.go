@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/inventory"
+)
+
+// SerialsRequest registers the serial numbers of units held at a location; LocationID defaults to the
+// default location
+type SerialsRequest struct {
+	LocationID int64    `json:"location_id"`
+	Serials    []string `json:"serials" binding:"required,min=1,max=500,dive,required,max=64"`
+}
+
+// respondSerialError maps serial number errors to responses; failed is the message for unexpected errors.
+// Callers handle sql.ErrNoRows, which means different things per route.
+func (h *InventoryHandler) respondSerialError(c *gin.Context, err error, failed string) {
+	switch {
+	case errors.Is(err, inventory.ErrNotSerialised):
+		c.JSON(http.StatusConflict, gin.H{"error": "The product is not serialised"})
+	case errors.Is(err, inventory.ErrDuplicateSerial):
+		c.JSON(http.StatusConflict, gin.H{"error": "A serial number is already registered"})
+	case errors.Is(err, inventory.ErrSerialAssigned):
+		c.JSON(http.StatusConflict, gin.H{"error": "The unit is packed in a shipment"})
+	case errors.Is(err, inventory.ErrUnknownLocation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown location"})
+	default:
+		h.logger.Error(failed, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// GetProductSerials handles GET /api/v1/admin/products/:id/serials
+// It takes ?status= (in_stock, allocated or sold) and ?location_id=.
+func (h *InventoryHandler) GetProductSerials(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := inventory.SerialStatus(c.Query("status"))
+	if status != "" && !inventory.ValidSerialStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+	var locationID int64
+	if v := c.Query("location_id"); v != "" {
+		if locationID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_id"})
+			return
+		}
+	}
+
+	list, total, err := h.inventory.Serials(id, status, locationID, limit, (page-1)*limit)
+	if err != nil {
+		h.respondSerialError(c, err, "Failed to fetch serial numbers")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"serials": list,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// RegisterSerials handles POST /api/v1/admin/products/:id/serials
+// Serial numbers are recorded for units already counted in stock, e.g. as a delivery from the supplier is
+// unpacked; they do not change the stock level.
+func (h *InventoryHandler) RegisterSerials(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	var req SerialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	for _, serial := range req.Serials {
+		if strings.TrimSpace(serial) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Serial numbers cannot be blank"})
+			return
+		}
+	}
+
+	actor := auditActor(c)
+	list, err := h.inventory.RegisterSerials(id, req.LocationID, req.Serials, actor.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		h.respondSerialError(c, err, "Failed to register serial numbers")
+		return
+	}
+
+	h.logger.Info("Serial numbers registered", zap.Int64("product_id", id), zap.Int("count", len(list)))
+	h.audit.Record(actor, "product.serials", "product", id, nil, list)
+	c.JSON(http.StatusCreated, gin.H{"serials": list})
+}
+
+// LookupSerial handles GET /api/v1/admin/serials/:serial
+// It finds a unit by serial number, ignoring case, with the order and customer it was sold to, e.g. for a
+// theft report or an insurance claim.
+func (h *InventoryHandler) LookupSerial(c *gin.Context) {
+	sn, err := h.inventory.LookupSerial(c.Param("serial"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Serial number not found"})
+			return
+		}
+		h.respondSerialError(c, err, "Failed to look up serial number")
+		return
+	}
+	c.JSON(http.StatusOK, sn)
+}
+
+// DeleteSerial handles DELETE /api/v1/admin/serials/:id
+// Only units in stock can be removed, e.g. a mistyped serial number or a frame written off.
+func (h *InventoryHandler) DeleteSerial(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid serial ID"})
+		return
+	}
+	before, err := h.inventory.Serial(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Serial number not found"})
+			return
+		}
+		h.respondSerialError(c, err, "Failed to delete serial number")
+		return
+	}
+	if err := h.inventory.DeleteSerial(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Serial number not found"})
+			return
+		}
+		h.respondSerialError(c, err, "Failed to delete serial number")
+		return
+	}
+
+	h.logger.Info("Serial number deleted", zap.Int64("serial_id", id))
+	h.audit.Record(auditActor(c), "serial.delete", "serial_number", id, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Serial number deleted"})
+}
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/courier"
+	"finspeed/api/internal/mailer"
+	"finspeed/api/internal/shipping"
+)
+
+// maxWebhookSize bounds courier webhook payloads
+const maxWebhookSize = 1 << 20
+
+// ShipmentHandler serves the shipments of customer orders. courier is nil when no courier
+// aggregator is configured and shipments are booked by hand.
+type ShipmentHandler struct {
+	logger    *zap.Logger
+	shipments *shipping.Store
+	courier   courier.Provider
+	mailer    mailer.Mailer
+	audit     *audit.Recorder
+}
+
+// ShipmentRequest creates a shipment. Without items it packs everything on the order not yet in a shipment.
+type ShipmentRequest struct {
+	LocationID  int64                 `json:"location_id"`
+	Courier     *string               `json:"courier" binding:"omitempty,max=100"`
+	AWBNumber   *string               `json:"awb_number" binding:"omitempty,max=64"`
+	TrackingURL *string               `json:"tracking_url" binding:"omitempty,url"`
+	Items       []ShipmentItemRequest `json:"items" binding:"dive"`
+}
+
+type ShipmentItemRequest struct {
+	OrderItemID int64 `json:"order_item_id" binding:"required"`
+	Qty         int   `json:"qty" binding:"required,gt=0"`
+}
+
+// ShipRequest sets the courier's tracking details when a shipment leaves; omitted fields keep earlier values
+type ShipRequest struct {
+	Courier     *string `json:"courier" binding:"omitempty,max=100"`
+	AWBNumber   *string `json:"awb_number" binding:"omitempty,max=64"`
+	TrackingURL *string `json:"tracking_url" binding:"omitempty,url"`
+}
+
+// ShipmentSerialsRequest lists the serial numbers of the units packed for each serialised item
+type ShipmentSerialsRequest struct {
+	Items []ShipmentSerialsItem `json:"items" binding:"required,min=1,dive"`
+}
+
+type ShipmentSerialsItem struct {
+	OrderItemID int64    `json:"order_item_id" binding:"required"`
+	Serials     []string `json:"serials" binding:"dive,required,max=64"`
+}
+
+// BookShipmentRequest is the packed parcel; couriers price on weight and size
+type BookShipmentRequest struct {
+	WeightKG  float64 `json:"weight_kg" binding:"required,gt=0"`
+	LengthCM  float64 `json:"length_cm" binding:"gte=0"`
+	BreadthCM float64 `json:"breadth_cm" binding:"gte=0"`
+	HeightCM  float64 `json:"height_cm" binding:"gte=0"`
+}
+
+func NewShipmentHandler(logger *zap.Logger, store *shipping.Store, provider courier.Provider, mail mailer.Mailer, recorder *audit.Recorder) *ShipmentHandler {
+	return &ShipmentHandler{
+		logger:    logger,
+		shipments: store,
+		courier:   provider,
+		mailer:    mail,
+		audit:     recorder,
+	}
+}
+
+// respondShipmentError maps store errors to responses; failed is the message for unexpected errors
+func (h *ShipmentHandler) respondShipmentError(c *gin.Context, err error, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+	case errors.Is(err, shipping.ErrWrongStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "The shipment's status does not allow this"})
+	case errors.Is(err, shipping.ErrOrderNotShippable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paid orders that are not fully shipped can get new shipments"})
+	case errors.Is(err, shipping.ErrOverShipment):
+		c.JSON(http.StatusConflict, gin.H{"error": "Quantity exceeds what is left to ship for the item"})
+	case errors.Is(err, shipping.ErrNothingToShip):
+		c.JSON(http.StatusConflict, gin.H{"error": "Every item on the order is already in a shipment"})
+	case errors.Is(err, shipping.ErrDuplicateAWB):
+		c.JSON(http.StatusConflict, gin.H{"error": "This AWB number is already used for the courier"})
+	case errors.Is(err, shipping.ErrUnknownItem):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Item does not belong to this order"})
+	case errors.Is(err, shipping.ErrDuplicateItem):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Each order item can only appear once"})
+	case errors.Is(err, shipping.ErrUnknownLocation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or inactive location"})
+	case errors.Is(err, shipping.ErrTrackingRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "courier and awb_number are required to ship"})
+	case errors.Is(err, shipping.ErrAlreadyBooked):
+		c.JSON(http.StatusConflict, gin.H{"error": "The shipment is already booked with a courier"})
+	case errors.Is(err, shipping.ErrSerialsMissing):
+		c.JSON(http.StatusConflict, gin.H{"error": "Assign a serial number to every unit of the serialised items first"})
+	case errors.Is(err, shipping.ErrNotSerialised):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The item's product is not serialised"})
+	case errors.Is(err, shipping.ErrTooManySerials):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "More serial numbers than units of the item in the shipment"})
+	case errors.Is(err, shipping.ErrSerialUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "A serial number is not in stock at the shipment's location"})
+	case errors.Is(err, courier.ErrRejected):
+		h.logger.Warn(failed, zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The courier rejected the request: " + err.Error()})
+	default:
+		h.logger.Error(failed, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// GetOrderShipments handles GET /api/v1/admin/orders/:id/shipments
+// Cancelled shipments are included.
+func (h *ShipmentHandler) GetOrderShipments(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	shipments, err := h.shipments.Shipments(orderID)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch shipments")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shipments": shipments})
+}
+
+// CreateShipment handles POST /api/v1/admin/orders/:id/shipments
+// The shipment starts as pending; courier details can be given now or when it ships.
+func (h *ShipmentHandler) CreateShipment(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	var req ShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	n := shipping.NewShipment{
+		LocationID:  req.LocationID,
+		Courier:     optionalString(req.Courier),
+		AWBNumber:   optionalString(req.AWBNumber),
+		TrackingURL: optionalString(req.TrackingURL),
+		CreatedBy:   auditActor(c).UserID,
+	}
+	for _, it := range req.Items {
+		n.Items = append(n.Items, shipping.ItemQty{OrderItemID: it.OrderItemID, Qty: it.Qty})
+	}
+
+	id, err := h.shipments.Create(orderID, n)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		h.respondShipmentError(c, err, "Failed to create shipment")
+		return
+	}
+	sh, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch shipment")
+		return
+	}
+
+	h.logger.Info("Shipment created", zap.Int64("shipment_id", id), zap.Int64("order_id", orderID))
+	h.audit.Record(auditActor(c), "shipment.create", "shipment", id, nil, sh)
+	c.JSON(http.StatusCreated, sh)
+}
+
+// MarkShipmentShipped handles POST /api/v1/admin/shipments/:id/ship
+func (h *ShipmentHandler) MarkShipmentShipped(c *gin.Context) {
+	// The body may be empty when the tracking details were given with the shipment
+	var req ShipRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	t := shipping.Tracking{
+		Courier:     optionalString(req.Courier),
+		AWBNumber:   optionalString(req.AWBNumber),
+		TrackingURL: optionalString(req.TrackingURL),
+	}
+	h.transition(c, "shipment.ship", "Failed to ship shipment", func(id int64) (string, error) {
+		return h.shipments.Ship(id, t)
+	})
+}
+
+// MarkShipmentDelivered handles POST /api/v1/admin/shipments/:id/deliver
+func (h *ShipmentHandler) MarkShipmentDelivered(c *gin.Context) {
+	h.transition(c, "shipment.deliver", "Failed to mark shipment delivered", h.shipments.Deliver)
+}
+
+// CancelShipment handles POST /api/v1/admin/shipments/:id/cancel
+// Only pending shipments can be cancelled; their items can then be shipped again.
+// A booking with the courier is cancelled first.
+func (h *ShipmentHandler) CancelShipment(c *gin.Context) {
+	h.transition(c, "shipment.cancel", "Failed to cancel shipment", func(id int64) (string, error) {
+		sh, err := h.shipments.Shipment(id)
+		if err != nil {
+			return "", err
+		}
+		if sh.Status != shipping.StatusPending {
+			return "", shipping.ErrWrongStatus
+		}
+		if b, ok := h.booking(sh); ok {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+			defer cancel()
+			if err := h.courier.Cancel(ctx, b); err != nil {
+				return "", err
+			}
+		}
+		return h.shipments.Cancel(id)
+	})
+}
+
+// AssignShipmentSerials handles PUT /api/v1/admin/shipments/:id/serials
+// Staff record which units of serialised products they packed while the shipment is pending. Each item's
+// list replaces the serial numbers given for it before; an empty list clears them.
+func (h *ShipmentHandler) AssignShipmentSerials(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+	var req ShipmentSerialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	before, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to assign serial numbers")
+		return
+	}
+	items := make([]shipping.SerialAssignment, 0, len(req.Items))
+	for _, it := range req.Items {
+		items = append(items, shipping.SerialAssignment{OrderItemID: it.OrderItemID, Serials: it.Serials})
+	}
+	if err := h.shipments.AssignSerials(id, items); err != nil {
+		h.respondShipmentError(c, err, "Failed to assign serial numbers")
+		return
+	}
+	sh, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch shipment")
+		return
+	}
+
+	h.logger.Info("Shipment serial numbers assigned", zap.Int64("shipment_id", id))
+	h.audit.Record(auditActor(c), "shipment.serials", "shipment", id, before, sh)
+	c.JSON(http.StatusOK, sh)
+}
+
+// booking returns the courier booking of a shipment booked with the configured provider
+func (h *ShipmentHandler) booking(sh *shipping.Shipment) (courier.Booking, bool) {
+	if h.courier == nil || sh.Provider == nil || *sh.Provider != h.courier.Name() || sh.ProviderRef == nil {
+		return courier.Booking{}, false
+	}
+	b := courier.Booking{Ref: *sh.ProviderRef}
+	if sh.Courier != nil {
+		b.Courier = *sh.Courier
+	}
+	if sh.AWBNumber != nil {
+		b.AWBNumber = *sh.AWBNumber
+	}
+	if sh.TrackingURL != nil {
+		b.TrackingURL = *sh.TrackingURL
+	}
+	return b, true
+}
+
+// BookShipment handles POST /api/v1/admin/shipments/:id/book
+// It books a pending shipment with the courier aggregator, which assigns the courier and AWB number.
+// The shipment stays pending until the courier reports the pickup.
+func (h *ShipmentHandler) BookShipment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+	if h.courier == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "No courier provider is configured; enter the courier details by hand"})
+		return
+	}
+	var req BookShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	booking, err := h.shipments.BookingRequest(id, courier.Parcel{
+		WeightKG: req.WeightKG, LengthCM: req.LengthCM, BreadthCM: req.BreadthCM, HeightCM: req.HeightCM,
+	})
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to book shipment")
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+	b, err := h.courier.Book(ctx, *booking)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to book shipment")
+		return
+	}
+	if err := h.shipments.SetBooking(id, h.courier.Name(), *b); err != nil {
+		// The courier holds a booking we could not save; release it so it is not billed
+		if cErr := h.courier.Cancel(context.Background(), *b); cErr != nil {
+			h.logger.Error("Failed to cancel unsaved courier booking", zap.Error(cErr), zap.String("awb_number", b.AWBNumber))
+		}
+		h.respondShipmentError(c, err, "Failed to book shipment")
+		return
+	}
+	sh, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch shipment")
+		return
+	}
+
+	h.logger.Info("Shipment booked", zap.Int64("shipment_id", id), zap.String("provider", h.courier.Name()), zap.String("awb_number", b.AWBNumber))
+	h.audit.Record(auditActor(c), "shipment.book", "shipment", id, nil, sh)
+	c.JSON(http.StatusOK, sh)
+}
+
+// GetShipmentLabel handles GET /api/v1/admin/shipments/:id/label
+// It returns the courier's shipping label as a PDF.
+func (h *ShipmentHandler) GetShipmentLabel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+	sh, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch label")
+		return
+	}
+	b, ok := h.booking(sh)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The shipment was not booked through the courier provider"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+	pdf, err := h.courier.Label(ctx, b)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch label")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="label-%s.pdf"`, b.AWBNumber))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// CourierWebhook handles POST /api/v1/shipping/webhook (public)
+// The provider authenticates the request. Tracking updates move shipments along, update the order's
+// status and tell the customer when the parcel ships, is out for delivery and arrives.
+func (h *ShipmentHandler) CourierWebhook(c *gin.Context) {
+	if h.courier == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No courier provider is configured"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+	events, err := h.courier.ParseWebhook(c.Request.Header, body)
+	if errors.Is(err, courier.ErrUnauthorized) {
+		h.logger.Warn("Courier webhook authentication failed", zap.String("provider", h.courier.Name()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook credentials"})
+		return
+	}
+	if err != nil {
+		h.logger.Warn("Invalid courier webhook", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	for _, ev := range events {
+		u, err := h.shipments.ApplyEvent(h.courier.Name(), ev)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Not ours, or booked in the courier portal; acknowledge so it is not retried
+			h.logger.Warn("Courier webhook for unknown AWB number", zap.String("awb_number", ev.AWBNumber))
+			continue
+		}
+		if err != nil {
+			h.logger.Error("Failed to apply tracking event", zap.Error(err), zap.String("awb_number", ev.AWBNumber))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply tracking update"})
+			return
+		}
+		if u.Duplicate {
+			continue
+		}
+		if u.SerialsMissing {
+			h.logger.Warn("Shipment left pending until its serial numbers are recorded", zap.Int64("shipment_id", u.ShipmentID),
+				zap.String("event", string(ev.Status)))
+		}
+		h.logger.Info("Tracking update applied", zap.Int64("shipment_id", u.ShipmentID), zap.String("event", string(ev.Status)),
+			zap.String("shipment_status", string(u.Status)), zap.String("order_status", u.OrderStatus))
+		if u.Changed {
+			h.notifyCustomer(u.ShipmentID, u.Status)
+		} else if ev.Status == courier.StatusOutForDelivery {
+			h.notifyOutForDelivery(u.ShipmentID)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// transition applies a status change to the shipment in the path, audits it and responds with the
+// shipment and its order's resulting status
+func (h *ShipmentHandler) transition(c *gin.Context, action, failed string, apply func(id int64) (string, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+	before, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, failed)
+		return
+	}
+	orderStatus, err := apply(id)
+	if err != nil {
+		h.respondShipmentError(c, err, failed)
+		return
+	}
+	sh, err := h.shipments.Shipment(id)
+	if err != nil {
+		h.respondShipmentError(c, err, "Failed to fetch shipment")
+		return
+	}
+
+	h.logger.Info("Shipment updated", zap.Int64("shipment_id", id), zap.String("status", string(sh.Status)))
+	h.audit.Record(auditActor(c), action, "shipment", id, before, sh)
+	if sh.Status != before.Status {
+		h.notifyCustomer(id, sh.Status)
+	}
+	c.JSON(http.StatusOK, gin.H{"shipment": sh, "order_status": orderStatus})
+}
+
+// notifyCustomer emails the customer when their parcel ships or arrives
+func (h *ShipmentHandler) notifyCustomer(shipmentID int64, status shipping.Status) {
+	switch status {
+	case shipping.StatusShipped:
+		h.sendShipmentEmail(shipmentID, func(sh *shipping.Shipment) (string, string) {
+			body := fmt.Sprintf("Part or all of your order #%d is on its way", sh.OrderID)
+			if sh.Courier != nil {
+				body += " with " + *sh.Courier
+			}
+			body += ".\n"
+			if sh.AWBNumber != nil {
+				body += "\nTracking number: " + *sh.AWBNumber + "\n"
+			}
+			if sh.TrackingURL != nil {
+				body += "Track it here: " + *sh.TrackingURL + "\n"
+			}
+			return fmt.Sprintf("Your Finspeed order #%d has shipped", sh.OrderID), body + "\n" + shipmentContents(sh)
+		})
+	case shipping.StatusDelivered:
+		h.sendShipmentEmail(shipmentID, func(sh *shipping.Shipment) (string, string) {
+			return fmt.Sprintf("Your Finspeed order #%d has been delivered", sh.OrderID),
+				fmt.Sprintf("Your parcel for order #%d has been delivered.\n\n%s", sh.OrderID, shipmentContents(sh))
+		})
+	}
+}
+
+func (h *ShipmentHandler) notifyOutForDelivery(shipmentID int64) {
+	h.sendShipmentEmail(shipmentID, func(sh *shipping.Shipment) (string, string) {
+		return fmt.Sprintf("Your Finspeed order #%d is out for delivery", sh.OrderID),
+			fmt.Sprintf("Your parcel for order #%d will be delivered today.\n\n%s", sh.OrderID, shipmentContents(sh))
+	})
+}
+
+// sendShipmentEmail sends the message built for the shipment to the customer in the background
+func (h *ShipmentHandler) sendShipmentEmail(shipmentID int64, build func(sh *shipping.Shipment) (string, string)) {
+	go func() {
+		sh, err := h.shipments.Shipment(shipmentID)
+		if err != nil {
+			h.logger.Error("Failed to load shipment for notification", zap.Error(err), zap.Int64("shipment_id", shipmentID))
+			return
+		}
+		email, _, err := h.shipments.Recipient(sh.OrderID)
+		if err != nil {
+			h.logger.Error("Failed to load customer for notification", zap.Error(err), zap.Int64("order_id", sh.OrderID))
+			return
+		}
+		subject, body := build(sh)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, mailer.Message{To: email, Subject: subject, Body: body}); err != nil {
+			h.logger.Error("Failed to send email", zap.Error(err), zap.String("subject", subject))
+		}
+	}()
+}
+
+// shipmentContents lists the items in a parcel for customer emails
+func shipmentContents(sh *shipping.Shipment) string {
+	var b strings.Builder
+	b.WriteString("In this parcel:\n")
+	for _, it := range sh.Items {
+		fmt.Fprintf(&b, "- %d x %s\n", it.Qty, it.Title)
+	}
+	return b.String()
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"finspeed/api/internal/auth"
+)
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired  bool   `json:"two_factor_required,omitempty"`
+	EnrollmentRequired bool   `json:"two_factor_enrollment_required,omitempty"`
+	ChallengeToken     string `json:"challenge_token"`
+	ChallengeExpiresAt int64  `json:"challenge_expires_at"`
+}
+
+type TwoFactorSetupRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorConfirmRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorEnabledResponse struct {
+	AuthResponse
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// startTwoFactor replaces the session with a challenge when the user has TOTP enabled, or when staff
+// must enrol first. It reports whether a response was written.
+func (h *AuthHandler) startTwoFactor(c *gin.Context, user User) bool {
+	enabled, err := h.twoFactor.IsEnabled(user.ID)
+	if err != nil {
+		h.logger.Error("Failed to check two-factor status", zap.Error(err), zap.Int64("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return true
+	}
+
+	purpose := ""
+	if enabled {
+		purpose = auth.PurposeTwoFactorChallenge
+	} else if h.config.TwoFactorRequiredForStaff {
+		staff, err := h.roles.IsStaff(user.Role)
+		if err != nil {
+			h.logger.Error("Failed to resolve role", zap.Error(err), zap.String("role", user.Role))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return true
+		}
+		if staff {
+			purpose = auth.PurposeTwoFactorEnrollment
+		}
+	}
+	if purpose == "" {
+		return false
+	}
+
+	token, err := h.tokens.Issue(user.ID, purpose, h.config.TwoFactorChallengeTTL)
+	if err != nil {
+		h.logger.Error("Failed to issue two-factor challenge", zap.Error(err), zap.Int64("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return true
+	}
+
+	c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+		TwoFactorRequired:  enabled,
+		EnrollmentRequired: !enabled,
+		ChallengeToken:     token,
+		ChallengeExpiresAt: time.Now().Add(h.config.TwoFactorChallengeTTL).Unix(),
+	})
+	return true
+}
+
+// VerifyTwoFactor handles POST /api/v1/auth/2fa/verify, the second login step
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A challenge token and either code or recovery_code are required"})
+		return
+	}
+
+	userID, err := h.tokens.Lookup(req.ChallengeToken, auth.PurposeTwoFactorChallenge)
+	if err != nil {
+		if !errors.Is(err, auth.ErrActionTokenInvalid) {
+			h.logger.Error("Failed to look up two-factor challenge", zap.Error(err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	var user User
+	var lockedUntil sql.NullTime
+	err = h.db.QueryRow(
+		"SELECT id, email, role, email_verified_at IS NOT NULL, locked_until FROM users WHERE id = $1",
+		userID,
+	).Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified, &lockedUntil)
+	if err != nil {
+		h.logger.Error("Failed to load user for two-factor verification", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		auth.LogSecurityEvent(h.logger, auth.EventLoginWhileLocked,
+			zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()), zap.Time("locked_until", lockedUntil.Time))
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(lockedUntil.Time).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Account temporarily locked due to failed login attempts"})
+		return
+	}
+
+	usedRecoveryCode := req.RecoveryCode != ""
+	if usedRecoveryCode {
+		err = h.twoFactor.UseRecoveryCode(userID, req.RecoveryCode)
+	} else {
+		err = h.twoFactor.VerifyCode(userID, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrTwoFactorCodeInvalid) || errors.Is(err, auth.ErrTwoFactorNotEnabled) {
+			auth.LogSecurityEvent(h.logger, auth.EventTwoFactorFailed,
+				zap.Int64("user_id", userID), zap.Bool("recovery_code", usedRecoveryCode), zap.String("client_ip", c.ClientIP()))
+			h.registerFailedLogin(c, userID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+			return
+		}
+		h.logger.Error("Failed to verify two-factor code", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if !h.consumeChallenge(c, req.ChallengeToken, auth.PurposeTwoFactorChallenge) {
+		return
+	}
+	if usedRecoveryCode {
+		auth.LogSecurityEvent(h.logger, auth.EventRecoveryCodeUsed, zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+	}
+
+	resp, err := h.completeLogin(c, user)
+	if err != nil {
+		h.logger.Error("Failed to generate token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetTwoFactorStatus handles GET /api/v1/auth/2fa
+func (h *AuthHandler) GetTwoFactorStatus(c *gin.Context) {
+	status, err := h.twoFactor.Status(c.GetInt64("user_id"))
+	if err != nil {
+		h.logger.Error("Failed to load two-factor status", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupTwoFactor handles POST /api/v1/auth/2fa/setup. Signed-in users call it with their access token;
+// staff who must enrol during login pass the enrolment challenge token instead.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	var req TwoFactorSetupRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+			return
+		}
+	}
+
+	user, ok := h.twoFactorSubject(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+
+	secret, err := h.twoFactor.BeginEnrollment(user.ID)
+	if err != nil {
+		if errors.Is(err, auth.ErrTwoFactorAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		h.logger.Error("Failed to start two-factor enrolment", zap.Error(err), zap.Int64("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(h.config.TwoFactorIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor handles POST /api/v1/auth/2fa/confirm. It enables TOTP, returns recovery codes
+// and a new session; all other sessions are revoked as they were established with a password only.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var req TwoFactorConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	user, ok := h.twoFactorSubject(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+
+	codes, err := h.twoFactor.ConfirmEnrollment(user.ID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrTwoFactorCodeInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		case errors.Is(err, auth.ErrTwoFactorNotEnrolling):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		case errors.Is(err, auth.ErrTwoFactorAlreadyEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		default:
+			h.logger.Error("Failed to confirm two-factor enrolment", zap.Error(err), zap.Int64("user_id", user.ID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	auth.LogSecurityEvent(h.logger, auth.EventTwoFactorEnabled, zap.Int64("user_id", user.ID), zap.String("client_ip", c.ClientIP()))
+
+	if err := h.sessions.RevokeAllSessions(user.ID); err != nil {
+		h.logger.Error("Failed to revoke sessions after enabling two-factor", zap.Error(err), zap.Int64("user_id", user.ID))
+	}
+
+	var resp AuthResponse
+	if req.ChallengeToken != "" {
+		if !h.consumeChallenge(c, req.ChallengeToken, auth.PurposeTwoFactorEnrollment) {
+			return
+		}
+		resp, err = h.completeLogin(c, user)
+	} else {
+		if err := h.revokeCurrentAccessToken(c); err != nil {
+			h.logger.Warn("Failed to revoke current access token", zap.Error(err), zap.Int64("user_id", user.ID))
+		}
+		resp, err = h.issueSession(c, user)
+	}
+	if err != nil {
+		h.logger.Error("Failed to generate token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorEnabledResponse{AuthResponse: resp, RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes handles POST /api/v1/auth/2fa/recovery-codes
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	if !h.checkSecondFactor(c, userID, req.Code, "") {
+		return
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		h.logger.Error("Failed to regenerate recovery codes", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	auth.LogSecurityEvent(h.logger, auth.EventRecoveryCodesReissued, zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor handles POST /api/v1/auth/2fa/disable
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password and either code or recovery_code are required"})
+		return
+	}
+
+	userID := c.GetInt64("user_id")
+	var role string
+	var passwordHash sql.NullString
+	if err := h.db.QueryRow("SELECT password_hash, role FROM users WHERE id = $1", userID).Scan(&passwordHash, &role); err != nil {
+		h.logger.Error("Failed to load user", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !passwordHash.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set a password before disabling two-factor authentication"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if h.config.TwoFactorRequiredForStaff {
+		staff, err := h.roles.IsStaff(role)
+		if err != nil {
+			h.logger.Error("Failed to resolve role", zap.Error(err), zap.String("role", role))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if staff {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for staff accounts"})
+			return
+		}
+	}
+
+	if !h.checkSecondFactor(c, userID, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	if err := h.twoFactor.Disable(userID); err != nil {
+		h.logger.Error("Failed to disable two-factor", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	auth.LogSecurityEvent(h.logger, auth.EventTwoFactorDisabled, zap.Int64("user_id", userID), zap.String("client_ip", c.ClientIP()))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// ResetUserTwoFactor handles DELETE /api/v1/admin/users/:id/2fa for users who lost their authenticator
+func (h *AuthHandler) ResetUserTwoFactor(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if id == c.GetInt64("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot reset your own two-factor authentication"})
+		return
+	}
+
+	before, err := h.twoFactor.Status(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to load two-factor status", zap.Error(err), zap.Int64("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	if err := h.twoFactor.Disable(id); err != nil {
+		h.logger.Error("Failed to reset two-factor", zap.Error(err), zap.Int64("user_id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+	if err := h.sessions.RevokeAllSessions(id); err != nil {
+		h.logger.Error("Failed to revoke sessions after two-factor reset", zap.Error(err), zap.Int64("user_id", id))
+	}
+
+	auth.LogSecurityEvent(h.logger, auth.EventTwoFactorDisabled,
+		zap.Int64("user_id", id), zap.Int64("admin_id", c.GetInt64("user_id")), zap.String("client_ip", c.ClientIP()))
+	h.audit.Record(auditActor(c), "user.two_factor_reset", "user", id, before, auth.TwoFactorStatus{})
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// twoFactorSubject resolves the user enrolling either from an enrolment challenge token or the access token
+func (h *AuthHandler) twoFactorSubject(c *gin.Context, challengeToken string) (User, bool) {
+	userID := c.GetInt64("user_id")
+	if challengeToken != "" {
+		id, err := h.tokens.Lookup(challengeToken, auth.PurposeTwoFactorEnrollment)
+		if err != nil {
+			if !errors.Is(err, auth.ErrActionTokenInvalid) {
+				h.logger.Error("Failed to look up enrolment challenge", zap.Error(err))
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return User{}, false
+		}
+		userID = id
+	}
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return User{}, false
+	}
+
+	var user User
+	err := h.db.QueryRow("SELECT id, email, role, email_verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Email, &user.Role, &user.EmailVerified)
+	if err != nil {
+		h.logger.Error("Failed to load user", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return User{}, false
+	}
+	return user, true
+}
+
+// checkSecondFactor verifies a TOTP or recovery code for a signed-in user and writes the error response on failure
+func (h *AuthHandler) checkSecondFactor(c *gin.Context, userID int64, code, recoveryCode string) bool {
+	var err error
+	if recoveryCode != "" {
+		err = h.twoFactor.UseRecoveryCode(userID, recoveryCode)
+	} else {
+		err = h.twoFactor.VerifyCode(userID, code)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+	case errors.Is(err, auth.ErrTwoFactorCodeInvalid):
+		auth.LogSecurityEvent(h.logger, auth.EventTwoFactorFailed,
+			zap.Int64("user_id", userID), zap.Bool("recovery_code", recoveryCode != ""), zap.String("client_ip", c.ClientIP()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+	default:
+		h.logger.Error("Failed to verify two-factor code", zap.Error(err), zap.Int64("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+	return false
+}
+
+// consumeChallenge marks a challenge token as used so it cannot start a second session
+func (h *AuthHandler) consumeChallenge(c *gin.Context, value, purpose string) bool {
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.logger.Error("Failed to begin transaction", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	defer tx.Rollback()
+
+	if _, err := h.tokens.Consume(tx, value, purpose); err != nil {
+		if errors.Is(err, auth.ErrActionTokenInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return false
+		}
+		h.logger.Error("Failed to consume challenge", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		h.logger.Error("Failed to commit challenge", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadSize bounds customer uploads such as return photos and warranty claim attachments
+const maxUploadSize = 10 * 1024 * 1024
+
+// photoTypes are the image types customers can upload, with the extension they are stored under
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// upload is a customer file read from the "file" form field
+type upload struct {
+	multipart.File
+	ContentType string
+	Filename    string // generated name with the extension of the detected type
+}
+
+// readUpload opens the "file" form field and sniffs its type, which must be in allowed. It responds with
+// an error and returns false when the file is missing, too large or of the wrong type; unsupported
+// describes the allowed types. The caller closes the file.
+func readUpload(c *gin.Context, allowed map[string]string, unsupported string) (*upload, bool) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required (field name: file)"})
+		return nil, false
+	}
+	if fileHeader.Size <= 0 || fileHeader.Size > maxUploadSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file size (max 10MB)"})
+		return nil, false
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return nil, false
+	}
+	buf := make([]byte, 512)
+	n, _ := src.Read(buf)
+	contentType := http.DetectContentType(buf[:n])
+	ext, ok := allowed[contentType]
+	if !ok {
+		src.Close()
+		c.JSON(http.StatusBadRequest, gin.H{"error": unsupported})
+		return nil, false
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		src.Close()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return nil, false
+	}
+	return &upload{File: src, ContentType: contentType, Filename: fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)}, true
+}
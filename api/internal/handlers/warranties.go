@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/mailer"
+	"finspeed/api/internal/storage"
+	"finspeed/api/internal/warranty"
+)
+
+// claimFileTypes are photos plus PDFs, e.g. a repair shop's report
+var claimFileTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// WarrantyHandler serves warranties and warranty claims
+type WarrantyHandler struct {
+	logger     *zap.Logger
+	warranties *warranty.Store
+	files      storage.Storage
+	mailer     mailer.Mailer
+	audit      *audit.Recorder
+}
+
+// FrameSerialRequest records the frame serial number of a warranty
+type FrameSerialRequest struct {
+	FrameSerial string `json:"frame_serial" binding:"required,max=64"`
+}
+
+// ClaimRequest files a warranty claim
+type ClaimRequest struct {
+	Description string `json:"description" binding:"required,max=5000"`
+}
+
+// ClaimStatusRequest moves a claim to a new status; the note is shown to the customer
+type ClaimStatusRequest struct {
+	Status string  `json:"status" binding:"required"`
+	Note   *string `json:"note" binding:"omitempty,max=2000"`
+}
+
+func NewWarrantyHandler(logger *zap.Logger, store *warranty.Store, files storage.Storage, mail mailer.Mailer, recorder *audit.Recorder) *WarrantyHandler {
+	return &WarrantyHandler{
+		logger:     logger,
+		warranties: store,
+		files:      files,
+		mailer:     mail,
+		audit:      recorder,
+	}
+}
+
+// respondWarrantyError maps store errors to responses; notFound names the missing entity and failed is
+// the message for unexpected errors
+func (h *WarrantyHandler) respondWarrantyError(c *gin.Context, err error, notFound, failed string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, warranty.ErrSerialTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "This frame serial number is already registered"})
+	case errors.Is(err, warranty.ErrSerialSet):
+		c.JSON(http.StatusConflict, gin.H{"error": "The frame serial number is already recorded; contact support to correct it"})
+	case errors.Is(err, warranty.ErrExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": "The warranty has expired"})
+	case errors.Is(err, warranty.ErrClaimOpen):
+		c.JSON(http.StatusConflict, gin.H{"error": "There is already an open claim for this warranty"})
+	case errors.Is(err, warranty.ErrWrongStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": "The claim's status does not allow this"})
+	case errors.Is(err, warranty.ErrTooManyFiles):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A claim can have at most %d attachments", warranty.MaxAttachments)})
+	default:
+		h.logger.Error(failed, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failed})
+	}
+}
+
+// GetMyWarranties handles GET /api/v1/warranties
+// It lists running warranties; ?include_expired=true lists expired ones too.
+func (h *WarrantyHandler) GetMyWarranties(c *gin.Context) {
+	h.listWarranties(c, c.GetInt64("user_id"), c.Query("include_expired") != "true")
+}
+
+// GetMyWarranty handles GET /api/v1/warranties/:id
+func (h *WarrantyHandler) GetMyWarranty(c *gin.Context) {
+	h.getWarranty(c, c.GetInt64("user_id"))
+}
+
+// RegisterFrameSerial handles PUT /api/v1/warranties/:id/serial
+// Customers register the frame serial number once; corrections go through support.
+func (h *WarrantyHandler) RegisterFrameSerial(c *gin.Context) {
+	h.setSerial(c, c.GetInt64("user_id"))
+}
+
+// CreateClaim handles POST /api/v1/warranties/:id/claims
+func (h *WarrantyHandler) CreateClaim(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warranty ID"})
+		return
+	}
+	var req ClaimRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	description := strings.TrimSpace(req.Description)
+	if description == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Describe the problem"})
+		return
+	}
+
+	claimID, err := h.warranties.CreateClaim(id, c.GetInt64("user_id"), description)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Warranty not found", "Failed to file claim")
+		return
+	}
+	claim, err := h.warranties.Claim(claimID, 0)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to fetch claim")
+		return
+	}
+
+	h.logger.Info("Warranty claim filed", zap.Int64("claim_id", claimID), zap.Int64("warranty_id", id))
+	c.JSON(http.StatusCreated, claim)
+}
+
+// GetMyClaims handles GET /api/v1/warranty-claims
+func (h *WarrantyHandler) GetMyClaims(c *gin.Context) {
+	h.listClaims(c, c.GetInt64("user_id"))
+}
+
+// GetMyClaim handles GET /api/v1/warranty-claims/:id
+func (h *WarrantyHandler) GetMyClaim(c *gin.Context) {
+	h.getClaim(c, c.GetInt64("user_id"))
+}
+
+// UploadClaimAttachment handles POST /api/v1/warranty-claims/:id/attachments
+// Attachments are multipart uploads in the "file" field: JPEG, PNG or WebP photos, or PDFs.
+// They can be added while the claim is being assessed.
+func (h *WarrantyHandler) UploadClaimAttachment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid claim ID"})
+		return
+	}
+	userID := c.GetInt64("user_id")
+	claim, err := h.warranties.Claim(id, userID)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to upload attachment")
+		return
+	}
+	if claim.Status != warranty.ClaimSubmitted && claim.Status != warranty.ClaimInReview {
+		h.respondWarrantyError(c, warranty.ErrWrongStatus, "", "")
+		return
+	}
+	if len(claim.Attachments) >= warranty.MaxAttachments {
+		h.respondWarrantyError(c, warranty.ErrTooManyFiles, "", "")
+		return
+	}
+
+	file, ok := readUpload(c, claimFileTypes, "Attachments must be JPEG, PNG or WebP images or PDF documents")
+	if !ok {
+		return
+	}
+	defer file.Close()
+	url, err := h.files.SaveClaimAttachment(c.Request.Context(), id, file.Filename, file.ContentType, file)
+	if err != nil {
+		h.logger.Error("Failed to save claim attachment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+		return
+	}
+	attachment, err := h.warranties.AddAttachment(id, userID, url, file.ContentType)
+	if err != nil {
+		// The claim changed since it was checked; drop the orphaned file
+		_ = h.files.DeleteByURL(c.Request.Context(), url)
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to save attachment")
+		return
+	}
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// GetWarranties handles GET /api/v1/admin/warranties
+// It takes ?user_id=, ?order_id=, ?serial= (exact frame serial number) and ?active=true.
+func (h *WarrantyHandler) GetWarranties(c *gin.Context) {
+	var userID int64
+	if v := c.Query("user_id"); v != "" {
+		var err error
+		if userID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+	}
+	h.listWarranties(c, userID, c.Query("active") == "true")
+}
+
+// GetWarranty handles GET /api/v1/admin/warranties/:id
+func (h *WarrantyHandler) GetWarranty(c *gin.Context) {
+	h.getWarranty(c, 0)
+}
+
+// UpdateFrameSerial handles PUT /api/v1/admin/warranties/:id/serial
+// Staff can record or correct the frame serial number.
+func (h *WarrantyHandler) UpdateFrameSerial(c *gin.Context) {
+	h.setSerial(c, 0)
+}
+
+// GetClaims handles GET /api/v1/admin/warranty-claims
+// It takes ?status= and ?user_id=.
+func (h *WarrantyHandler) GetClaims(c *gin.Context) {
+	var userID int64
+	if v := c.Query("user_id"); v != "" {
+		var err error
+		if userID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+	}
+	h.listClaims(c, userID)
+}
+
+// GetClaim handles GET /api/v1/admin/warranty-claims/:id
+func (h *WarrantyHandler) GetClaim(c *gin.Context) {
+	h.getClaim(c, 0)
+}
+
+// UpdateClaimStatus handles POST /api/v1/admin/warranty-claims/:id/status
+// Submitted claims move to in_review, approved or rejected; approved claims to resolved. Rejections need
+// a note. The customer is emailed on every change.
+func (h *WarrantyHandler) UpdateClaimStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid claim ID"})
+		return
+	}
+	var req ClaimStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	status := warranty.ClaimStatus(req.Status)
+	if !warranty.ValidClaimStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+	note := optionalString(req.Note)
+	if status == warranty.ClaimRejected && note == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A note explaining the rejection is required"})
+		return
+	}
+
+	before, err := h.warranties.Claim(id, 0)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to update claim")
+		return
+	}
+	actor := auditActor(c)
+	if err := h.warranties.SetStatus(id, status, note, actor.UserID); err != nil {
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to update claim")
+		return
+	}
+	claim, err := h.warranties.Claim(id, 0)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to fetch claim")
+		return
+	}
+
+	h.logger.Info("Warranty claim updated", zap.Int64("claim_id", id), zap.String("status", string(status)))
+	h.audit.Record(actor, "warranty_claim.status", "warranty_claim", id, before, claim)
+	h.notifyCustomer(claim, note)
+	c.JSON(http.StatusOK, claim)
+}
+
+func (h *WarrantyHandler) listWarranties(c *gin.Context, userID int64, activeOnly bool) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	var orderID int64
+	if v := c.Query("order_id"); v != "" {
+		var err error
+		if orderID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order_id"})
+			return
+		}
+	}
+
+	list, total, err := h.warranties.Warranties(userID, orderID, c.Query("serial"), activeOnly, limit, (page-1)*limit)
+	if err != nil {
+		h.logger.Error("Failed to fetch warranties", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warranties"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"warranties": list,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+func (h *WarrantyHandler) getWarranty(c *gin.Context, userID int64) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warranty ID"})
+		return
+	}
+	w, err := h.warranties.Warranty(id, userID)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Warranty not found", "Failed to fetch warranty")
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// setSerial records the frame serial number; a zero userID is staff
+func (h *WarrantyHandler) setSerial(c *gin.Context, userID int64) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warranty ID"})
+		return
+	}
+	var req FrameSerialRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.FrameSerial) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	before, err := h.warranties.Warranty(id, userID)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Warranty not found", "Failed to register serial number")
+		return
+	}
+	if err := h.warranties.SetSerial(id, userID, req.FrameSerial); err != nil {
+		h.respondWarrantyError(c, err, "Warranty not found", "Failed to register serial number")
+		return
+	}
+	w, err := h.warranties.Warranty(id, userID)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Warranty not found", "Failed to fetch warranty")
+		return
+	}
+
+	h.logger.Info("Frame serial number registered", zap.Int64("warranty_id", id))
+	if userID == 0 {
+		h.audit.Record(auditActor(c), "warranty.serial", "warranty", id, before, w)
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+func (h *WarrantyHandler) listClaims(c *gin.Context, userID int64) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := warranty.ClaimStatus(c.Query("status"))
+	if status != "" && !warranty.ValidClaimStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown status"})
+		return
+	}
+
+	list, total, err := h.warranties.Claims(status, userID, 0, limit, (page-1)*limit)
+	if err != nil {
+		h.logger.Error("Failed to fetch warranty claims", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warranty claims"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"claims": list,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+func (h *WarrantyHandler) getClaim(c *gin.Context, userID int64) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid claim ID"})
+		return
+	}
+	claim, err := h.warranties.Claim(id, userID)
+	if err != nil {
+		h.respondWarrantyError(c, err, "Claim not found", "Failed to fetch claim")
+		return
+	}
+	c.JSON(http.StatusOK, claim)
+}
+
+// claimStatusText describes each status a claim moves to in customer emails
+var claimStatusText = map[warranty.ClaimStatus]string{
+	warranty.ClaimInReview: "is being reviewed by our service team",
+	warranty.ClaimApproved: "is approved and covered by your warranty",
+	warranty.ClaimRejected: "is not covered by your warranty",
+	warranty.ClaimResolved: "is resolved",
+}
+
+// notifyCustomer emails the customer the claim's new status and the note that came with it
+func (h *WarrantyHandler) notifyCustomer(claim *warranty.Claim, note *string) {
+	text, ok := claimStatusText[claim.Status]
+	if !ok {
+		return
+	}
+	subject := fmt.Sprintf("Your Finspeed warranty claim #%d %s", claim.ID, text)
+	body := fmt.Sprintf("Your warranty claim #%d for %s %s.\n", claim.ID, claim.Title, text)
+	if note != nil {
+		body += "\n" + *note + "\n"
+	}
+
+	go func() {
+		email, _, err := h.warranties.Recipient(claim.ID)
+		if err != nil {
+			h.logger.Error("Failed to load customer for notification", zap.Error(err), zap.Int64("claim_id", claim.ID))
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, mailer.Message{To: email, Subject: subject, Body: body}); err != nil {
+			h.logger.Error("Failed to send email", zap.Error(err), zap.String("subject", subject))
+		}
+	}()
+}
@@ -0,0 +1,235 @@
+// Package inventory keeps the stock ledger and per-location stock. products.stock_qty and
+// location_stock are only changed through Record, so both always equal the sum of the movements.
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+
+	"finspeed/api/internal/database"
+)
+
+// Kind is the reason class of a stock movement.
+type Kind string
+
+const (
+	KindReceipt      Kind = "receipt"      // goods received from a supplier
+	KindSale         Kind = "sale"         // stock reserved by an order
+	KindCancellation Kind = "cancellation" // stock released by a cancelled order
+	KindAdjustment   Kind = "adjustment"   // stock count correction, either direction
+	KindReturn       Kind = "return"       // sellable goods returned by a customer
+	KindDamage       Kind = "damage"       // goods written off
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrInvalidMovement   = errors.New("quantity has the wrong sign for this kind of movement")
+	ErrUnknownLocation   = errors.New("unknown location")
+)
+
+// Movement is a single stock change. Quantity is signed: positive adds stock, negative removes it.
+// A zero LocationID means the default location. OrderID, PurchaseOrderID, ActorID and APIKeyID are optional
+// and left out when zero.
+type Movement struct {
+	ProductID       int64
+	LocationID      int64
+	Kind            Kind
+	Quantity        int
+	Reason          string
+	OrderID         int64
+	PurchaseOrderID int64
+	ActorID         int64
+	APIKeyID        int64
+}
+
+// Entry is a recorded movement.
+type Entry struct {
+	ID              int64   `json:"id"`
+	ProductID       int64   `json:"product_id"`
+	LocationID      int64   `json:"location_id"`
+	Kind            Kind    `json:"kind"`
+	Quantity        int     `json:"quantity"`
+	BalanceAfter    int     `json:"balance_after"`
+	Reason          *string `json:"reason,omitempty"`
+	OrderID         *int64  `json:"order_id,omitempty"`
+	PurchaseOrderID *int64  `json:"purchase_order_id,omitempty"`
+	ActorID         *int64  `json:"actor_id,omitempty"`
+	APIKeyID        *int64  `json:"api_key_id,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+// Discrepancy is a product whose stock_qty no longer matches its ledger or its location stock,
+// e.g. after a manual database edit.
+type Discrepancy struct {
+	ProductID    int64  `json:"product_id"`
+	Title        string `json:"title"`
+	StockQty     int    `json:"stock_qty"`
+	LedgerQty    int    `json:"ledger_qty"`
+	LocationQty  int    `json:"location_qty"`
+	Difference   int    `json:"difference"`
+	LastMovement *int64 `json:"last_movement_id,omitempty"`
+}
+
+// ValidKind reports whether k is a known movement kind.
+func ValidKind(k Kind) bool {
+	switch k {
+	case KindReceipt, KindSale, KindCancellation, KindAdjustment, KindReturn, KindDamage:
+		return true
+	}
+	return false
+}
+
+// validSign reports whether the quantity direction fits the kind
+func validSign(k Kind, qty int) bool {
+	switch k {
+	case KindReceipt, KindCancellation, KindReturn:
+		return qty > 0
+	case KindSale, KindDamage:
+		return qty < 0
+	}
+	return qty != 0
+}
+
+// Store records and reads stock movements.
+type Store struct {
+	db *database.DB
+}
+
+func NewStore(db *database.DB) *Store {
+	return &Store{db: db}
+}
+
+// Record applies the movement to products.stock_qty and the location's stock and appends it to the
+// ledger within tx. It returns the product's new total, ErrInsufficientStock if stock would go negative
+// overall or at the location, ErrUnknownLocation and sql.ErrNoRows for an unknown product.
+func (s *Store) Record(tx *sql.Tx, m Movement) (int, error) {
+	if !ValidKind(m.Kind) || !validSign(m.Kind, m.Quantity) {
+		return 0, ErrInvalidMovement
+	}
+
+	var err error
+	if m.LocationID == 0 {
+		err = tx.QueryRow("SELECT id FROM locations WHERE is_default").Scan(&m.LocationID)
+	} else {
+		err = tx.QueryRow("SELECT id FROM locations WHERE id = $1", m.LocationID).Scan(&m.LocationID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUnknownLocation
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var balance int
+	err = tx.QueryRow(
+		"UPDATE products SET stock_qty = stock_qty + $2 WHERE id = $1 AND stock_qty + $2 >= 0 RETURNING stock_qty",
+		m.ProductID, m.Quantity,
+	).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)", m.ProductID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, ErrInsufficientStock
+		}
+		return 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The CHECK on location_stock.quantity would reject a negative insert even on conflict, so removals only update
+	var located int
+	if m.Quantity > 0 {
+		err = tx.QueryRow(
+			`INSERT INTO location_stock (location_id, product_id, quantity) VALUES ($1, $2, $3)
+			 ON CONFLICT (location_id, product_id) DO UPDATE SET quantity = location_stock.quantity + EXCLUDED.quantity
+			 RETURNING quantity`,
+			m.LocationID, m.ProductID, m.Quantity,
+		).Scan(&located)
+	} else {
+		err = tx.QueryRow(
+			`UPDATE location_stock SET quantity = quantity + $3
+			 WHERE location_id = $1 AND product_id = $2 AND quantity + $3 >= 0 RETURNING quantity`,
+			m.LocationID, m.ProductID, m.Quantity,
+		).Scan(&located)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInsufficientStock
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO inventory_movements (product_id, location_id, kind, quantity, balance_after, reason, order_id, purchase_order_id,
+		     actor_id, api_key_id)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7::bigint, 0), NULLIF($8::bigint, 0), NULLIF($9::bigint, 0), NULLIF($10::bigint, 0))`,
+		m.ProductID, m.LocationID, m.Kind, m.Quantity, balance, m.Reason, m.OrderID, m.PurchaseOrderID, m.ActorID, m.APIKeyID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// History returns a page of the product's movements, newest first, and the total count.
+// An empty kind or a zero locationID does not filter.
+func (s *Store) History(productID int64, kind Kind, locationID int64, limit, offset int) ([]Entry, int, error) {
+	const filter = "product_id = $1 AND ($2 = '' OR kind = $2) AND ($3::bigint = 0 OR location_id = $3)"
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM inventory_movements WHERE "+filter, productID, kind, locationID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, product_id, location_id, kind, quantity, balance_after, reason, order_id, purchase_order_id, actor_id, api_key_id,
+		     created_at
+		 FROM inventory_movements WHERE `+filter+`
+		 ORDER BY id DESC LIMIT $4 OFFSET $5`,
+		productID, kind, locationID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.ProductID, &e.LocationID, &e.Kind, &e.Quantity, &e.BalanceAfter, &e.Reason,
+			&e.OrderID, &e.PurchaseOrderID, &e.ActorID, &e.APIKeyID, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// Discrepancies lists products whose stock_qty differs from the sum of their movements
+// or from the sum of their location stock. Difference is stock_qty minus the ledger total.
+func (s *Store) Discrepancies() ([]Discrepancy, error) {
+	rows, err := s.db.Query(`
+		SELECT p.id, p.title, p.stock_qty, COALESCE(m.qty, 0), COALESCE(ls.qty, 0), p.stock_qty - COALESCE(m.qty, 0), m.last_id
+		FROM products p
+		LEFT JOIN (SELECT product_id, SUM(quantity) AS qty, MAX(id) AS last_id
+		           FROM inventory_movements GROUP BY product_id) m ON m.product_id = p.id
+		LEFT JOIN (SELECT product_id, SUM(quantity) AS qty FROM location_stock GROUP BY product_id) ls ON ls.product_id = p.id
+		WHERE p.stock_qty <> COALESCE(m.qty, 0) OR p.stock_qty <> COALESCE(ls.qty, 0)
+		ORDER BY p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Discrepancy{}
+	for rows.Next() {
+		var d Discrepancy
+		if err := rows.Scan(&d.ProductID, &d.Title, &d.StockQty, &d.LedgerQty, &d.LocationQty, &d.Difference, &d.LastMovement); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,186 @@
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateLocationCode is returned when another location already uses the code.
+var ErrDuplicateLocationCode = errors.New("location code already exists")
+
+const (
+	LocationWarehouse = "warehouse"
+	LocationStore     = "store"
+)
+
+// Location is a warehouse or showroom that holds stock.
+type Location struct {
+	ID            int64   `json:"id"`
+	Code          string  `json:"code"`
+	Name          string  `json:"name"`
+	Kind          string  `json:"kind"`
+	Address1      *string `json:"address1,omitempty"`
+	City          string  `json:"city"`
+	State         string  `json:"state"`
+	Pincode       string  `json:"pincode"`
+	FulfilsOrders bool    `json:"fulfils_orders"`
+	IsActive      bool    `json:"is_active"`
+	IsDefault     bool    `json:"is_default"`
+	Priority      int     `json:"priority"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     *string `json:"updated_at,omitempty"`
+}
+
+// StockLevel is a product's stock at one location.
+type StockLevel struct {
+	LocationID   int64  `json:"location_id"`
+	LocationCode string `json:"location_code"`
+	LocationName string `json:"location_name"`
+	City         string `json:"city"`
+	Quantity     int    `json:"quantity"`
+}
+
+// Availability is what the storefront may show about a product's stock at a showroom.
+type Availability struct {
+	LocationID int64  `json:"location_id"`
+	Name       string `json:"name"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	Quantity   int    `json:"quantity"`
+}
+
+const locationColumns = `id, code, name, kind, address1, city, state, pincode, fulfils_orders, is_active, is_default, priority,
+	created_at, updated_at`
+
+func scanLocation(row interface{ Scan(...interface{}) error }) (*Location, error) {
+	var l Location
+	err := row.Scan(&l.ID, &l.Code, &l.Name, &l.Kind, &l.Address1, &l.City, &l.State, &l.Pincode,
+		&l.FulfilsOrders, &l.IsActive, &l.IsDefault, &l.Priority, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Locations lists locations, active ones first.
+func (s *Store) Locations(includeInactive bool) ([]Location, error) {
+	rows, err := s.db.Query(
+		"SELECT "+locationColumns+" FROM locations WHERE is_active OR $1 ORDER BY is_active DESC, priority, name",
+		includeInactive,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Location{}
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *l)
+	}
+	return list, rows.Err()
+}
+
+// Location returns a location by ID or sql.ErrNoRows.
+func (s *Store) Location(id int64) (*Location, error) {
+	return scanLocation(s.db.QueryRow("SELECT "+locationColumns+" FROM locations WHERE id = $1", id))
+}
+
+// SaveLocation inserts the location when its ID is zero and updates it otherwise.
+// Making a location the default clears the flag on the previous default.
+func (s *Store) SaveLocation(l *Location) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if l.IsDefault {
+		if _, err := tx.Exec("UPDATE locations SET is_default = false WHERE is_default AND id <> $1", l.ID); err != nil {
+			return err
+		}
+	}
+
+	var row *sql.Row
+	if l.ID == 0 {
+		row = tx.QueryRow(
+			`INSERT INTO locations (code, name, kind, address1, city, state, pincode, fulfils_orders, is_active, is_default, priority)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			 RETURNING `+locationColumns,
+			l.Code, l.Name, l.Kind, l.Address1, l.City, l.State, l.Pincode, l.FulfilsOrders, l.IsActive, l.IsDefault, l.Priority,
+		)
+	} else {
+		row = tx.QueryRow(
+			`UPDATE locations SET code = $2, name = $3, kind = $4, address1 = $5, city = $6, state = $7, pincode = $8,
+			     fulfils_orders = $9, is_active = $10, is_default = $11, priority = $12, updated_at = NOW()
+			 WHERE id = $1
+			 RETURNING `+locationColumns,
+			l.ID, l.Code, l.Name, l.Kind, l.Address1, l.City, l.State, l.Pincode, l.FulfilsOrders, l.IsActive, l.IsDefault, l.Priority,
+		)
+	}
+	saved, err := scanLocation(row)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "locations_code_key" {
+			return ErrDuplicateLocationCode
+		}
+		return err
+	}
+	*l = *saved
+	return tx.Commit()
+}
+
+// StockLevels returns the product's stock at every location that holds or held it.
+func (s *Store) StockLevels(productID int64) ([]StockLevel, error) {
+	rows, err := s.db.Query(
+		`SELECT l.id, l.code, l.name, l.city, ls.quantity
+		 FROM location_stock ls JOIN locations l ON l.id = ls.location_id
+		 WHERE ls.product_id = $1
+		 ORDER BY l.priority, l.name`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []StockLevel{}
+	for rows.Next() {
+		var sl StockLevel
+		if err := rows.Scan(&sl.LocationID, &sl.LocationCode, &sl.LocationName, &sl.City, &sl.Quantity); err != nil {
+			return nil, err
+		}
+		levels = append(levels, sl)
+	}
+	return levels, rows.Err()
+}
+
+// Availability lists the active showrooms that have the product in stock.
+func (s *Store) Availability(productID int64) ([]Availability, error) {
+	rows, err := s.db.Query(
+		`SELECT l.id, l.name, l.city, l.state, ls.quantity
+		 FROM location_stock ls JOIN locations l ON l.id = ls.location_id
+		 WHERE ls.product_id = $1 AND ls.quantity > 0 AND l.is_active AND l.kind = $2
+		 ORDER BY l.city, l.name`,
+		productID, LocationStore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Availability{}
+	for rows.Next() {
+		var a Availability
+		if err := rows.Scan(&a.LocationID, &a.Name, &a.City, &a.State, &a.Quantity); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,227 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/notify"
+)
+
+// LowStockItem is a product at or below its reorder threshold.
+type LowStockItem struct {
+	ProductID        int64   `json:"product_id"`
+	Title            string  `json:"title"`
+	SKU              *string `json:"sku,omitempty"`
+	StockQty         int     `json:"stock_qty"`
+	ReorderThreshold int     `json:"reorder_threshold"`
+	ReorderQty       *int    `json:"reorder_qty,omitempty"`
+	// LowSince is when the scheduled check first saw the product low; empty until it has run
+	LowSince *string `json:"low_since,omitempty"`
+	alertID  int64
+}
+
+// SetReorderPoint sets the product's reorder threshold and quantity; nil clears them.
+// It returns sql.ErrNoRows for an unknown product.
+func (s *Store) SetReorderPoint(productID int64, threshold, qty *int) error {
+	res, err := s.db.Exec(
+		"UPDATE products SET reorder_threshold = $2, reorder_qty = $3, updated_at = NOW() WHERE id = $1",
+		productID, threshold, qty,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// LowStock lists the products that are at or below their reorder threshold, emptiest first.
+func (s *Store) LowStock() ([]LowStockItem, error) {
+	rows, err := s.db.Query(
+		`SELECT p.id, p.title, p.sku, p.stock_qty, p.reorder_threshold, p.reorder_qty, a.opened_at
+		 FROM products p
+		 LEFT JOIN low_stock_alerts a ON a.product_id = p.id AND a.resolved_at IS NULL
+		 WHERE p.reorder_threshold IS NOT NULL AND p.stock_qty <= p.reorder_threshold AND p.archived_at IS NULL
+		 ORDER BY p.stock_qty, p.title`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []LowStockItem{}
+	for rows.Next() {
+		var it LowStockItem
+		if err := rows.Scan(&it.ProductID, &it.Title, &it.SKU, &it.StockQty, &it.ReorderThreshold, &it.ReorderQty, &it.LowSince); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// refreshAlerts closes the alerts of products that recovered, opens alerts for products that
+// ran low, and returns the open alerts staff have not been notified about yet.
+func (s *Store) refreshAlerts() ([]LowStockItem, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE low_stock_alerts a SET resolved_at = NOW()
+		 FROM products p
+		 WHERE a.product_id = p.id AND a.resolved_at IS NULL
+		   AND (p.reorder_threshold IS NULL OR p.stock_qty > p.reorder_threshold OR p.archived_at IS NOT NULL)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO low_stock_alerts (product_id, stock_qty, reorder_threshold)
+		 SELECT p.id, p.stock_qty, p.reorder_threshold FROM products p
+		 WHERE p.reorder_threshold IS NOT NULL AND p.stock_qty <= p.reorder_threshold AND p.archived_at IS NULL
+		 ON CONFLICT (product_id) WHERE resolved_at IS NULL DO NOTHING`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(
+		`SELECT a.id, p.id, p.title, p.sku, p.stock_qty, a.reorder_threshold, p.reorder_qty, a.opened_at
+		 FROM low_stock_alerts a JOIN products p ON p.id = a.product_id
+		 WHERE a.resolved_at IS NULL AND a.notified_at IS NULL
+		 ORDER BY p.stock_qty, p.title`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var pending []LowStockItem
+	for rows.Next() {
+		var it LowStockItem
+		if err := rows.Scan(&it.alertID, &it.ProductID, &it.Title, &it.SKU, &it.StockQty, &it.ReorderThreshold, &it.ReorderQty, &it.LowSince); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pending = append(pending, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pending, tx.Commit()
+}
+
+// lowStockLockKey is the advisory lock that lets one instance at a time run the low-stock check
+const lowStockLockKey = 4201
+
+// lockLowStock waits for the low-stock check lock and returns the transaction holding it. Ending the
+// transaction releases the lock.
+func (s *Store) lockLowStock() (*sql.Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", lowStockLockKey); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *Store) markNotified(items []LowStockItem) error {
+	ids := make([]int64, len(items))
+	for i, it := range items {
+		ids[i] = it.alertID
+	}
+	_, err := s.db.Exec("UPDATE low_stock_alerts SET notified_at = NOW() WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
+
+// LowStockMonitor periodically checks stock against the reorder thresholds and notifies staff
+// once about each product that runs low. A failed notification is retried on the next check; one that
+// reached any channel counts as sent. Instances take turns, so a product is never reported twice.
+type LowStockMonitor struct {
+	store    *Store
+	notifier notify.Notifier
+	logger   *zap.Logger
+}
+
+func NewLowStockMonitor(store *Store, notifier notify.Notifier, logger *zap.Logger) *LowStockMonitor {
+	return &LowStockMonitor{store: store, notifier: notifier, logger: logger}
+}
+
+// Run checks immediately and then every interval until ctx is cancelled.
+func (m *LowStockMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Check(ctx); err != nil {
+			m.logger.Error("Low-stock check failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a single low-stock check.
+func (m *LowStockMonitor) Check(ctx context.Context) error {
+	// Held until the alerts are marked notified, so another instance cannot pick them up meanwhile
+	lock, err := m.store.lockLowStock()
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	pending, err := m.store.refreshAlerts()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err = m.notifier.Notify(ctx, lowStockNotification(pending))
+	var partial *notify.PartialError
+	if errors.As(err, &partial) {
+		m.logger.Warn("Low-stock notification only partly delivered", zap.Error(err))
+	} else if err != nil {
+		return fmt.Errorf("notify low stock: %w", err)
+	}
+	m.logger.Info("Low-stock notification sent", zap.Int("products", len(pending)))
+	return m.store.markNotified(pending)
+}
+
+func lowStockNotification(items []LowStockItem) notify.Notification {
+	var b strings.Builder
+	b.WriteString("These products are at or below their reorder threshold:\n\n")
+	for _, it := range items {
+		b.WriteString("- " + it.Title)
+		if it.SKU != nil {
+			fmt.Fprintf(&b, " (SKU %s)", *it.SKU)
+		}
+		fmt.Fprintf(&b, ": %d in stock, threshold %d", it.StockQty, it.ReorderThreshold)
+		if it.ReorderQty != nil {
+			fmt.Fprintf(&b, ", reorder %d", *it.ReorderQty)
+		}
+		b.WriteString("\n")
+	}
+	return notify.Notification{
+		Subject: fmt.Sprintf("Low stock: %d product(s) need reordering", len(items)),
+		Body:    b.String(),
+	}
+}
@@ -0,0 +1,141 @@
+package inventory
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/address"
+)
+
+// Line is a product and quantity to fulfil.
+type Line struct {
+	ProductID int64
+	Qty       int
+}
+
+// Allocation assigns part of an order to the location that ships it.
+type Allocation struct {
+	ProductID  int64
+	LocationID int64
+	Qty        int
+}
+
+type candidate struct {
+	id        int64
+	proximity int
+	sameState bool
+	priority  int
+	stock     map[int64]int
+}
+
+// nearer orders candidates by PIN code proximity, then state, then the configured priority
+func (a *candidate) nearer(b *candidate) bool {
+	if a.proximity != b.proximity {
+		return a.proximity > b.proximity
+	}
+	if a.sameState != b.sameState {
+		return a.sameState
+	}
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	return a.id < b.id
+}
+
+// Route picks the locations that ship an order to pincode in state. The nearest location that
+// can ship every line is preferred; otherwise lines are split, taking as much as possible from the
+// nearest locations first. The stock rows read are locked until tx ends, and ErrInsufficientStock is
+// returned when the fulfilling locations together cannot cover the order.
+func (s *Store) Route(tx *sql.Tx, pincode, state string, lines []Line) ([]Allocation, error) {
+	need := map[int64]int{}
+	var productIDs []int64
+	for _, l := range lines {
+		if _, ok := need[l.ProductID]; !ok {
+			productIDs = append(productIDs, l.ProductID)
+		}
+		need[l.ProductID] += l.Qty
+	}
+
+	rows, err := tx.Query(
+		`SELECT l.id, l.pincode, l.state, l.priority, ls.product_id, ls.quantity
+		 FROM location_stock ls JOIN locations l ON l.id = ls.location_id
+		 WHERE ls.product_id = ANY($1) AND ls.quantity > 0 AND l.is_active AND l.fulfils_orders
+		 ORDER BY l.id, ls.product_id
+		 FOR UPDATE OF ls`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int64]*candidate{}
+	var candidates []*candidate
+	for rows.Next() {
+		var id, productID int64
+		var locPincode, locState string
+		var priority, qty int
+		if err := rows.Scan(&id, &locPincode, &locState, &priority, &productID, &qty); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c, ok := byID[id]
+		if !ok {
+			c = &candidate{
+				id:        id,
+				proximity: address.PincodeProximity(pincode, locPincode),
+				sameState: locState == state,
+				priority:  priority,
+				stock:     map[int64]int{},
+			}
+			byID[id] = c
+			candidates = append(candidates, c)
+		}
+		c.stock[productID] = qty
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].nearer(candidates[j]) })
+
+	// A single shipment is cheaper and arrives together, so it wins over a nearer split
+	for _, c := range candidates {
+		whole := true
+		for _, id := range productIDs {
+			if c.stock[id] < need[id] {
+				whole = false
+				break
+			}
+		}
+		if whole {
+			allocations := make([]Allocation, 0, len(productIDs))
+			for _, id := range productIDs {
+				allocations = append(allocations, Allocation{ProductID: id, LocationID: c.id, Qty: need[id]})
+			}
+			return allocations, nil
+		}
+	}
+
+	var allocations []Allocation
+	for _, id := range productIDs {
+		remaining := need[id]
+		for _, c := range candidates {
+			if remaining == 0 {
+				break
+			}
+			take := c.stock[id]
+			if take > remaining {
+				take = remaining
+			}
+			if take > 0 {
+				allocations = append(allocations, Allocation{ProductID: id, LocationID: c.id, Qty: take})
+				remaining -= take
+			}
+		}
+		if remaining > 0 {
+			return nil, ErrInsufficientStock
+		}
+	}
+	return allocations, nil
+}
@@ -0,0 +1,268 @@
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNotSerialised   = errors.New("product is not serialised")
+	ErrDuplicateSerial = errors.New("serial number is already registered")
+	ErrSerialAssigned  = errors.New("serial number is packed in a shipment")
+	ErrSerialNotSold   = errors.New("serial number was not delivered for the returned item")
+)
+
+// SerialStatus is where a serialised unit is: in stock, packed in a pending shipment or sent to a customer.
+type SerialStatus string
+
+const (
+	SerialInStock   SerialStatus = "in_stock"
+	SerialAllocated SerialStatus = "allocated"
+	SerialSold      SerialStatus = "sold"
+)
+
+// ValidSerialStatus reports whether s is a known status.
+func ValidSerialStatus(s SerialStatus) bool {
+	switch s {
+	case SerialInStock, SerialAllocated, SerialSold:
+		return true
+	}
+	return false
+}
+
+// Serial is one unit of a serialised product. The shipment, order and customer are set once the unit
+// is packed; WarrantyID once a warranty carries its serial number.
+type Serial struct {
+	ID            int64        `json:"id"`
+	ProductID     int64        `json:"product_id"`
+	Title         string       `json:"title"`
+	Serial        string       `json:"serial"`
+	LocationID    int64        `json:"location_id"`
+	LocationName  string       `json:"location_name"`
+	Status        SerialStatus `json:"status"`
+	ShipmentID    *int64       `json:"shipment_id,omitempty"`
+	OrderID       *int64       `json:"order_id,omitempty"`
+	OrderItemID   *int64       `json:"order_item_id,omitempty"`
+	ShippedAt     *string      `json:"shipped_at,omitempty"`
+	DeliveredAt   *string      `json:"delivered_at,omitempty"`
+	UserID        *int64       `json:"user_id,omitempty"`
+	CustomerEmail *string      `json:"customer_email,omitempty"`
+	CustomerName  *string      `json:"customer_name,omitempty"`
+	WarrantyID    *int64       `json:"warranty_id,omitempty"`
+	CreatedAt     string       `json:"created_at"`
+}
+
+// serialStatusExpr derives a unit's status from the shipment it is packed in
+const serialStatusExpr = `CASE WHEN sh.id IS NULL THEN 'in_stock' WHEN sh.status = 'pending' THEN 'allocated' ELSE 'sold' END`
+
+const serialQuery = `
+	SELECT sn.id, sn.product_id, COALESCE(p.title, ''), sn.serial, sn.location_id, l.name, ` + serialStatusExpr + `,
+	       sh.id, sh.order_id, si.order_item_id, sh.shipped_at, sh.delivered_at, o.user_id, u.email, u.name, w.id,
+	       sn.created_at
+	FROM serial_numbers sn
+	JOIN locations l ON l.id = sn.location_id
+	LEFT JOIN products p ON p.id = sn.product_id
+	LEFT JOIN shipment_items si ON si.id = sn.shipment_item_id
+	LEFT JOIN shipments sh ON sh.id = si.shipment_id
+	LEFT JOIN orders o ON o.id = sh.order_id
+	LEFT JOIN users u ON u.id = o.user_id
+	LEFT JOIN warranties w ON upper(w.frame_serial) = upper(sn.serial)`
+
+func scanSerial(row interface{ Scan(...interface{}) error }) (*Serial, error) {
+	var s Serial
+	err := row.Scan(&s.ID, &s.ProductID, &s.Title, &s.Serial, &s.LocationID, &s.LocationName, &s.Status,
+		&s.ShipmentID, &s.OrderID, &s.OrderItemID, &s.ShippedAt, &s.DeliveredAt, &s.UserID, &s.CustomerEmail,
+		&s.CustomerName, &s.WarrantyID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// RegisterSerials records the serial numbers of units of a serialised product held at a location, or the
+// default location when locationID is zero. Either all are registered or none. It returns sql.ErrNoRows
+// for an unknown product.
+func (s *Store) RegisterSerials(productID, locationID int64, serials []string, actorID int64) ([]Serial, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var serialised bool
+	if err := tx.QueryRow("SELECT is_serialised FROM products WHERE id = $1", productID).Scan(&serialised); err != nil {
+		return nil, err
+	}
+	if !serialised {
+		return nil, ErrNotSerialised
+	}
+	if locationID == 0 {
+		err = tx.QueryRow("SELECT id FROM locations WHERE is_default").Scan(&locationID)
+	} else {
+		err = tx.QueryRow("SELECT id FROM locations WHERE id = $1", locationID).Scan(&locationID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownLocation
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(serials))
+	for _, serial := range serials {
+		var id int64
+		err := tx.QueryRow(
+			`INSERT INTO serial_numbers (product_id, serial, location_id, created_by)
+			 VALUES ($1, $2, $3, NULLIF($4::bigint, 0)) RETURNING id`,
+			productID, strings.TrimSpace(serial), locationID, actorID,
+		).Scan(&id)
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicateSerial
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(serialQuery+" WHERE sn.id = ANY($1) ORDER BY sn.id", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Serial{}
+	for rows.Next() {
+		sn, err := scanSerial(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sn)
+	}
+	return list, rows.Err()
+}
+
+// Serials returns a page of a product's units, oldest first, and the total count. An empty status or a
+// zero locationID does not filter.
+func (s *Store) Serials(productID int64, status SerialStatus, locationID int64, limit, offset int) ([]Serial, int, error) {
+	const filter = ` WHERE sn.product_id = $1 AND ($2 = '' OR ` + serialStatusExpr + ` = $2)
+		AND ($3::bigint = 0 OR sn.location_id = $3)`
+	var total int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM serial_numbers sn
+		 LEFT JOIN shipment_items si ON si.id = sn.shipment_item_id
+		 LEFT JOIN shipments sh ON sh.id = si.shipment_id`+filter,
+		productID, status, locationID,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(serialQuery+filter+" ORDER BY sn.id LIMIT $4 OFFSET $5", productID, status, locationID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Serial{}
+	for rows.Next() {
+		sn, err := scanSerial(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *sn)
+	}
+	return list, total, rows.Err()
+}
+
+// LookupSerial finds a unit by its serial number, ignoring case, with the order and customer it went to.
+// It returns sql.ErrNoRows if the serial number is not registered.
+func (s *Store) LookupSerial(serial string) (*Serial, error) {
+	return scanSerial(s.db.QueryRow(serialQuery+" WHERE upper(sn.serial) = upper($1)", strings.TrimSpace(serial)))
+}
+
+// Serial returns a unit by ID, or sql.ErrNoRows.
+func (s *Store) Serial(id int64) (*Serial, error) {
+	return scanSerial(s.db.QueryRow(serialQuery+" WHERE sn.id = $1", id))
+}
+
+// DeleteSerial removes a serial number entered by mistake or for a unit written off. Units packed in a
+// shipment cannot be removed. It returns sql.ErrNoRows for an unknown unit.
+func (s *Store) DeleteSerial(id int64) error {
+	res, err := s.db.Exec("DELETE FROM serial_numbers WHERE id = $1 AND shipment_item_id IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM serial_numbers WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return ErrSerialAssigned
+}
+
+// ReturnSerials records, as part of tx, which units of a serialised order item came back on a return. Each
+// unit must have been delivered for the item and not already returned on it. With restock the units are
+// released from their shipment into stock at locationID and from the returned item's warranty; otherwise
+// they stay recorded as sold.
+func (s *Store) ReturnSerials(tx *sql.Tx, returnID, orderItemID, locationID int64, serials []string, restock bool) error {
+	for _, serial := range serials {
+		var id int64
+		err := tx.QueryRow(
+			`SELECT sn.id FROM serial_numbers sn
+			 JOIN shipment_items si ON si.id = sn.shipment_item_id JOIN shipments sh ON sh.id = si.shipment_id
+			 WHERE upper(sn.serial) = upper($1) AND si.order_item_id = $2 AND sh.status = 'delivered'
+			   AND NOT EXISTS (SELECT 1 FROM return_serials rs JOIN returns r ON r.id = rs.return_id
+			                   WHERE rs.serial_number_id = sn.id AND r.order_item_id = $2)
+			 FOR UPDATE OF sn`,
+			strings.TrimSpace(serial), orderItemID,
+		).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSerialNotSold
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO return_serials (return_id, serial_number_id) VALUES ($1, $2)", returnID, id); err != nil {
+			if isUniqueViolation(err) {
+				return ErrSerialNotSold
+			}
+			return err
+		}
+		if restock {
+			_, err := tx.Exec(
+				"UPDATE serial_numbers SET shipment_item_id = NULL, location_id = $2, updated_at = NOW() WHERE id = $1",
+				id, locationID,
+			)
+			if err != nil {
+				return err
+			}
+			// The serial number passes to the warranty of whoever buys the unit next
+			_, err = tx.Exec(
+				`UPDATE warranties SET frame_serial = NULL, updated_at = NOW()
+				 WHERE order_item_id = $1 AND upper(frame_serial) = upper($2)`,
+				orderItemID, strings.TrimSpace(serial),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,17 @@
+package mailer
+
+import (
+	"context"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	// Send delivers the message or returns an error. Implementations must be safe for concurrent use.
+	Send(ctx context.Context, msg Message) error
+}
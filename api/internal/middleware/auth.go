@@ -1,25 +1,22 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 
-	"finspeed/api/internal/config"
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/database"
+	"finspeed/api/internal/ratelimit"
 )
 
-type Claims struct {
-	UserID int64  `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(config *config.Config, logger *zap.Logger) gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens and rejects tokens on the deny list
+func AuthMiddleware(tokens *auth.TokenManager, sessions *auth.SessionStore, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Prefer app JWT from X-App-Authorization to avoid conflicts with IAP using Authorization
 		authHeader := c.GetHeader("X-App-Authorization")
@@ -42,11 +39,8 @@ func AuthMiddleware(config *config.Config, logger *zap.Logger) gin.HandlerFunc {
 
 		tokenString := tokenParts[1]
 
-		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		})
-
+		// Parse and validate token (signature, expiry, issuer and audience)
+		claims, err := tokens.Parse(tokenString)
 		if err != nil {
 			logger.Warn("Invalid token", zap.Error(err))
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -54,23 +48,94 @@ func AuthMiddleware(config *config.Config, logger *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			// Set user information in context
-			c.Set("user_id", claims.UserID)
-			c.Set("user_email", claims.Email)
-			c.Set("user_role", claims.Role)
-			c.Next()
+		revoked, err := isRevoked(sessions, claims)
+		if err != nil {
+			logger.Error("Failed to check token revocation", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// AuthOrAPIKeyMiddleware authenticates integrations by the X-API-Key header, applying the key's rate limit,
+// and otherwise falls back to AuthMiddleware. Routes behind it must check RequirePermission, which honours key scopes.
+func AuthOrAPIKeyMiddleware(tokens *auth.TokenManager, sessions *auth.SessionStore, apiKeys *auth.APIKeyStore, limiter *ratelimit.Limiter, logger *zap.Logger) gin.HandlerFunc {
+	jwtAuth := AuthMiddleware(tokens, sessions, logger)
+	return func(c *gin.Context) {
+		value := c.GetHeader("X-API-Key")
+		if value == "" {
+			jwtAuth(c)
+			return
+		}
+
+		key, err := apiKeys.Authenticate(value)
+		if err != nil {
+			if errors.Is(err, auth.ErrAPIKeyInvalid) {
+				auth.LogSecurityEvent(logger, auth.EventAPIKeyRejected, zap.String("client_ip", c.ClientIP()), zap.String("path", c.FullPath()))
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			} else {
+				logger.Error("Failed to authenticate API key", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			}
+			c.Abort()
+			return
+		}
+
+		var res ratelimit.Result
+		if key.RateLimitPerMinute != nil {
+			res, err = limiter.AllowWithLimit(c.Request.Context(), strconv.FormatInt(key.ID, 10), *key.RateLimitPerMinute)
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			res, err = limiter.Allow(c.Request.Context(), strconv.FormatInt(key.ID, 10))
+		}
+		if err != nil {
+			logger.Error("Rate limit check failed", zap.Error(err))
+		} else if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "API key rate limit exceeded"})
 			c.Abort()
 			return
+		} else {
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
 		}
+
+		if err := apiKeys.TouchLastUsed(key.ID, c.ClientIP()); err != nil {
+			logger.Warn("Failed to record API key usage", zap.Error(err), zap.Int64("api_key_id", key.ID))
+		}
+
+		c.Set("api_key", key)
+		c.Set("api_key_id", key.ID)
+		c.Next()
+	}
+}
+
+// apiKeyFromContext returns the API key the request authenticated with, if any
+func apiKeyFromContext(c *gin.Context) (*auth.APIKey, bool) {
+	v, ok := c.Get("api_key")
+	if !ok {
+		return nil, false
 	}
+	key, ok := v.(*auth.APIKey)
+	return key, ok
 }
 
-// AdminMiddleware ensures the user has admin role
-func AdminMiddleware() gin.HandlerFunc {
+// AdminMiddleware ensures the user has a staff role, i.e. one that grants at least one permission.
+// API keys are created by staff and always pass. Individual routes further restrict access with RequirePermission.
+func AdminMiddleware(roles *auth.RoleStore, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if _, ok := apiKeyFromContext(c); ok {
+			c.Next()
+			return
+		}
+
 		role, exists := c.Get("user_role")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
@@ -78,7 +143,14 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if role != "admin" {
+		staff, err := roles.IsStaff(role.(string))
+		if err != nil {
+			logger.Error("Failed to resolve role permissions", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if !staff {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
@@ -88,8 +160,38 @@ func AdminMiddleware() gin.HandlerFunc {
 	}
 }
 
+// RequirePermission ensures the user's role, or the API key's scopes, grant the given permission
+func RequirePermission(roles *auth.RoleStore, permission string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := apiKeyFromContext(c); ok {
+			if !key.HasScope(permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the required scope", "permission": permission})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		allowed, err := roles.HasPermission(c.GetString("user_role"), permission)
+		if err != nil {
+			logger.Error("Failed to resolve role permissions", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied", "permission": permission})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // OptionalAuthMiddleware validates JWT tokens if present but doesn't require them
-func OptionalAuthMiddleware(config *config.Config, logger *zap.Logger) gin.HandlerFunc {
+func OptionalAuthMiddleware(tokens *auth.TokenManager, sessions *auth.SessionStore, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Prefer app JWT from X-App-Authorization to avoid conflicts with IAP using Authorization
 		authHeader := c.GetHeader("X-App-Authorization")
@@ -111,19 +213,83 @@ func OptionalAuthMiddleware(config *config.Config, logger *zap.Logger) gin.Handl
 		tokenString := tokenParts[1]
 
 		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		})
-
-		if err == nil {
-			if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-				// Set user information in context
-				c.Set("user_id", claims.UserID)
-				c.Set("user_email", claims.Email)
-				c.Set("user_role", claims.Role)
+		if claims, err := tokens.Parse(tokenString); err == nil {
+			if revoked, err := isRevoked(sessions, claims); err != nil {
+				logger.Warn("Failed to check token revocation", zap.Error(err))
+			} else if !revoked {
+				setClaims(c, claims)
 			}
 		}
 
 		c.Next()
 	}
 }
+
+// isRevoked checks the token against the jti deny list and the user's "log out all sessions" marker
+func isRevoked(sessions *auth.SessionStore, claims *auth.Claims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return sessions.IsAccessTokenRevoked(claims.ID, claims.UserID, issuedAt)
+}
+
+// setClaims stores user and token information in the request context
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_role", claims.Role)
+	c.Set("token_id", claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+	}
+}
+
+// RequireVerifiedEmail blocks users who have not confirmed their email address yet
+func RequireVerifiedEmail(db *database.DB, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var verified bool
+		err := db.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1", c.GetInt64("user_id")).Scan(&verified)
+		if err != nil {
+			logger.Error("Failed to check email verification", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email verification required", "code": "email_unverified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireTwoFactor blocks users who have not enrolled TOTP; used on staff routes when 2FA is mandatory.
+// API keys are not tied to a user and are exempt.
+func RequireTwoFactor(twoFactor *auth.TwoFactorStore, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := apiKeyFromContext(c); ok {
+			c.Next()
+			return
+		}
+
+		enabled, err := twoFactor.IsEnabled(c.GetInt64("user_id"))
+		if err != nil {
+			logger.Error("Failed to check two-factor status", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+
+		if !enabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication must be enabled for staff accounts", "code": "two_factor_enrollment_required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"os"
 	"strings"
 
@@ -18,6 +20,7 @@ func Logger(logger *zap.Logger) gin.HandlerFunc {
 			zap.Duration("latency", param.Latency),
 			zap.String("client_ip", param.ClientIP),
 			zap.String("user_agent", param.Request.UserAgent()),
+			zap.Any("request_id", param.Keys["request_id"]),
 		)
 		return ""
 	})
@@ -61,7 +64,8 @@ func CORS() gin.HandlerFunc {
 
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Request-ID")
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -72,13 +76,21 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
-// RequestID middleware adds a unique request ID to each request
+// RequestID middleware adds a unique request ID to each request. An incoming
+// X-Request-ID (e.g. from the load balancer) is reused when present.
 func RequestID() gin.HandlerFunc {
-	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
-		c.JSON(500, gin.H{
-			"error": "Internal server error",
-		})
-	})
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err == nil {
+				id = hex.EncodeToString(b)
+			}
+		}
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
 }
 
 // Recovery middleware with structured logging
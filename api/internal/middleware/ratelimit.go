@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/ratelimit"
+)
+
+// RateLimitByIP rejects requests from a client IP that exceeds the limiter's budget.
+// Store failures are logged and the request is let through.
+func RateLimitByIP(limiter *ratelimit.Limiter, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := limiter.Allow(c.Request.Context(), c.ClientIP())
+		if err != nil {
+			logger.Error("Rate limit check failed", zap.Error(err))
+			c.Next()
+			return
+		}
+
+		if !res.Allowed {
+			auth.LogSecurityEvent(logger, auth.EventLoginRateLimited,
+				zap.String("scope", "ip"),
+				zap.String("client_ip", c.ClientIP()),
+				zap.String("path", c.FullPath()),
+			)
+			c.Header("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+
+	"finspeed/api/internal/mailer"
+)
+
+// EmailNotifier mails notifications to a fixed list of staff addresses.
+type EmailNotifier struct {
+	mailer     mailer.Mailer
+	recipients []string
+}
+
+func NewEmail(m mailer.Mailer, recipients []string) *EmailNotifier {
+	return &EmailNotifier{mailer: m, recipients: recipients}
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, to := range e.recipients {
+		if err := e.mailer.Send(ctx, mailer.Message{To: to, Subject: n.Subject, Body: n.Body}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return deliveryError(errs, len(e.recipients))
+}
@@ -0,0 +1,83 @@
+// Package notify delivers operational notifications, such as low-stock reports, to the shop's staff.
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// Notification is a short plain-text message for staff.
+type Notification struct {
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	// Notify delivers the notification or returns an error. Implementations must be safe for concurrent use.
+	Notify(ctx context.Context, n Notification) error
+}
+
+// PartialError is returned when a notification reached some channels or recipients but not others.
+// Callers should treat it as delivered, as retrying would repeat it everywhere it arrived.
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return "notification partly delivered: " + e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// deliveryError returns nil if nothing failed, a PartialError if some of the attempts delivered, and the
+// joined errors if none did
+func deliveryError(errs []error, attempts int) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) < attempts {
+		return &PartialError{Err: errors.Join(errs...)}
+	}
+	return errors.Join(errs...)
+}
+
+// Multi delivers to every channel and reports the errors of those that failed. A channel that partly
+// delivered counts as delivered.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	delivered := 0
+	for _, notifier := range m {
+		err := notifier.Notify(ctx, n)
+		var partial *PartialError
+		if err == nil || errors.As(err, &partial) {
+			delivered++
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && delivered > 0 {
+		return &PartialError{Err: errors.Join(errs...)}
+	}
+	return errors.Join(errs...)
+}
+
+// LogNotifier writes notifications to the application log. Used when no channel is configured.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLog(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (l *LogNotifier) Notify(ctx context.Context, n Notification) error {
+	l.logger.Info("Staff notification (log notifier)", zap.String("subject", n.Subject), zap.String("body", n.Body))
+	return nil
+}
@@ -0,0 +1,370 @@
+// Package privacy implements data access and erasure requests under India's DPDP Act.
+package privacy
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"finspeed/api/internal/database"
+	"finspeed/api/internal/inventory"
+)
+
+// ErrOrdersInProgress is returned when the user has paid orders that still have to be fulfilled,
+// returns that are on their way back or awaiting a refund, or paid bookings still to come.
+var ErrOrdersInProgress = errors.New("orders are still in progress")
+
+// Export is everything we hold about a user. Secrets such as password and TOTP hashes are left out.
+type Export struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	Profile    json.RawMessage `json:"profile"`
+	Addresses  json.RawMessage `json:"addresses"`
+	Identities json.RawMessage `json:"identities"`
+	Sessions   json.RawMessage `json:"sessions"`
+	Orders     json.RawMessage `json:"orders"`
+	Payments   json.RawMessage `json:"payments"`
+	Bookings   json.RawMessage `json:"bookings"`
+	Returns    json.RawMessage `json:"returns"`
+	Warranties json.RawMessage `json:"warranties"`
+	Claims     json.RawMessage `json:"warranty_claims"`
+}
+
+// Each query returns one JSON value for the user given as $1
+const (
+	profileQuery = `
+		SELECT json_build_object('id', id, 'email', email, 'pending_email', pending_email, 'name', name, 'phone', phone,
+		       'role', role, 'email_verified_at', email_verified_at, 'two_factor_enabled', totp_enabled_at IS NOT NULL,
+		       'created_at', created_at)
+		FROM users WHERE id = $1`
+	addressesQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', id, 'label', label, 'name', name, 'phone', phone,
+		       'address1', address1, 'address2', address2, 'city', city, 'state', state, 'pincode', pincode,
+		       'country', country, 'is_default', is_default, 'created_at', created_at, 'updated_at', updated_at) ORDER BY id), '[]')
+		FROM user_addresses WHERE user_id = $1`
+	identitiesQuery = `
+		SELECT COALESCE(json_agg(json_build_object('provider', provider, 'email', email,
+		       'last_login_at', last_login_at, 'created_at', created_at) ORDER BY id), '[]')
+		FROM user_identities WHERE user_id = $1`
+	sessionsQuery = `
+		SELECT COALESCE(json_agg(json_build_object('ip', ip, 'user_agent', user_agent, 'created_at', created_at,
+		       'expires_at', expires_at, 'revoked_at', revoked_at) ORDER BY id), '[]')
+		FROM refresh_tokens WHERE user_id = $1`
+	ordersQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', o.id, 'status', o.status, 'subtotal', o.subtotal,
+		       'shipping_fee', o.shipping_fee, 'tax_amount', o.tax_amount, 'total', o.total,
+		       'shipping_address', o.shipping_address_json, 'created_at', o.created_at,
+		       'items', (SELECT COALESCE(json_agg(json_build_object('product_id', oi.product_id, 'title', p.title,
+		                        'qty', oi.qty, 'price_each', oi.price_each) ORDER BY oi.id), '[]')
+		                 FROM order_items oi LEFT JOIN products p ON p.id = oi.product_id
+		                 WHERE oi.order_id = o.id)) ORDER BY o.id), '[]')
+		FROM orders o WHERE o.user_id = $1`
+	paymentsQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', p.id, 'order_id', p.order_id, 'booking_id', p.booking_id,
+		       'provider', p.provider, 'provider_ref', p.provider_ref, 'status', p.status, 'amount', p.amount,
+		       'currency', p.currency, 'created_at', p.created_at) ORDER BY p.id), '[]')
+		FROM payments p LEFT JOIN orders o ON o.id = p.order_id LEFT JOIN bookings b ON b.id = p.booking_id
+		WHERE o.user_id = $1 OR b.user_id = $1`
+	bookingsQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', b.id, 'service', t.name, 'location', l.name,
+		       'product_id', b.product_id, 'starts_at', b.starts_at, 'ends_at', b.ends_at, 'status', b.status,
+		       'price', b.price, 'notes', b.notes, 'paid_at', b.paid_at, 'refunded_at', b.refunded_at,
+		       'cancelled_at', b.cancelled_at, 'created_at', b.created_at) ORDER BY b.id), '[]')
+		FROM bookings b JOIN service_types t ON t.id = b.service_type_id JOIN locations l ON l.id = b.location_id
+		WHERE b.user_id = $1`
+	returnsQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', r.id, 'order_id', r.order_id, 'product_id', oi.product_id,
+		       'title', p.title, 'qty', r.qty, 'reason', r.reason, 'comment', r.comment, 'status', r.status,
+		       'decision_note', r.decision_note, 'courier', r.courier, 'awb_number', r.awb_number,
+		       'shipped_at', r.shipped_at, 'received_at', r.received_at, 'refund_amount', r.refund_amount,
+		       'refunded_at', r.refunded_at, 'created_at', r.created_at,
+		       'photos', (SELECT COALESCE(json_agg(ph.url ORDER BY ph.id), '[]') FROM return_photos ph
+		                  WHERE ph.return_id = r.id)) ORDER BY r.id), '[]')
+		FROM returns r JOIN order_items oi ON oi.id = r.order_item_id LEFT JOIN products p ON p.id = oi.product_id
+		WHERE r.user_id = $1`
+	warrantiesQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', w.id, 'order_id', w.order_id, 'product_id', w.product_id,
+		       'title', p.title, 'frame_serial', w.frame_serial, 'starts_on', w.starts_on, 'ends_on', w.ends_on,
+		       'created_at', w.created_at) ORDER BY w.id), '[]')
+		FROM warranties w LEFT JOIN products p ON p.id = w.product_id
+		WHERE w.user_id = $1`
+	claimsQuery = `
+		SELECT COALESCE(json_agg(json_build_object('id', c.id, 'warranty_id', c.warranty_id,
+		       'description', c.description, 'status', c.status, 'resolution', c.resolution,
+		       'created_at', c.created_at, 'updated_at', c.updated_at,
+		       'attachments', (SELECT COALESCE(json_agg(a.url ORDER BY a.id), '[]') FROM warranty_claim_attachments a
+		                       WHERE a.claim_id = c.id),
+		       'events', (SELECT COALESCE(json_agg(json_build_object('status', ev.status, 'note', ev.note,
+		                         'created_at', ev.created_at) ORDER BY ev.id), '[]')
+		                  FROM warranty_claim_events ev WHERE ev.claim_id = c.id)) ORDER BY c.id), '[]')
+		FROM warranty_claims c
+		WHERE c.user_id = $1`
+)
+
+// uploadsQuery lists the URLs of the files the user uploaded
+const uploadsQuery = `
+	SELECT ph.url FROM return_photos ph JOIN returns r ON r.id = ph.return_id WHERE r.user_id = $1
+	UNION ALL
+	SELECT a.url FROM warranty_claim_attachments a JOIN warranty_claims c ON c.id = a.claim_id WHERE c.user_id = $1`
+
+// Store reads and erases personal data across the tables that hold it.
+type Store struct {
+	db        *database.DB
+	inventory *inventory.Store
+}
+
+func NewStore(db *database.DB, inv *inventory.Store) *Store {
+	return &Store{db: db, inventory: inv}
+}
+
+// Export collects the user's data. It returns sql.ErrNoRows for an unknown user.
+func (s *Store) Export(userID int64) (*Export, error) {
+	e := &Export{ExportedAt: time.Now().UTC()}
+	sections := []struct {
+		query string
+		dest  *json.RawMessage
+	}{
+		{profileQuery, &e.Profile},
+		{addressesQuery, &e.Addresses},
+		{identitiesQuery, &e.Identities},
+		{sessionsQuery, &e.Sessions},
+		{ordersQuery, &e.Orders},
+		{paymentsQuery, &e.Payments},
+		{bookingsQuery, &e.Bookings},
+		{returnsQuery, &e.Returns},
+		{warrantiesQuery, &e.Warranties},
+		{claimsQuery, &e.Claims},
+	}
+	for _, sec := range sections {
+		var raw []byte
+		if err := s.db.QueryRow(sec.query, userID).Scan(&raw); err != nil {
+			return nil, err
+		}
+		*sec.dest = raw
+	}
+	return e, nil
+}
+
+// WriteZip writes the export as a ZIP archive with one JSON file per section.
+func (e *Export) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data json.RawMessage
+	}{
+		{"profile.json", e.Profile},
+		{"addresses.json", e.Addresses},
+		{"linked_accounts.json", e.Identities},
+		{"sessions.json", e.Sessions},
+		{"orders.json", e.Orders},
+		{"payments.json", e.Payments},
+		{"bookings.json", e.Bookings},
+		{"returns.json", e.Returns},
+		{"warranties.json", e.Warranties},
+		{"warranty_claims.json", e.Claims},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "README.txt", Method: zip.Deflate, Modified: e.ExportedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(fw, "Finspeed account data export created %s.\nEach JSON file holds one category of the personal data we store about you.\n",
+		e.ExportedAt.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Anonymise erases the user's personal data while keeping orders and payments for tax records.
+// It returns the URLs of the uploaded files it removed, or sql.ErrNoRows for an unknown user.
+//
+// The account keeps its ID but can no longer sign in. Orders keep the amounts and the place of
+// supply (city, state, pincode) needed for GST; the name, phone and street address are removed.
+// Unpaid pending orders are cancelled and their stock released, as are unpaid upcoming bookings; booking
+// notes, return comments and notes, and return photos are removed, as are frame serial numbers and warranty
+// claim descriptions, notes and attachments. Sessions must be revoked and the files deleted from storage
+// by the caller.
+func (s *Store) Anonymise(userID int64) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so a concurrent order cannot slip in between the check and the erasure
+	var id int64
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	var inProgress bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM orders WHERE user_id = $1 AND status IN ('paid', 'partially_shipped', 'shipped'))
+		     OR EXISTS (SELECT 1 FROM returns WHERE user_id = $1 AND status IN ('approved', 'shipped', 'received'))
+		     OR EXISTS (SELECT 1 FROM bookings WHERE user_id = $1 AND status = 'confirmed' AND starts_at > NOW()
+		                AND payment_id IS NOT NULL AND refund_ref IS NULL)`,
+		userID,
+	).Scan(&inProgress)
+	if err != nil {
+		return nil, err
+	}
+	if inProgress {
+		return nil, ErrOrdersInProgress
+	}
+
+	if err := s.releasePendingStock(tx, userID); err != nil {
+		return nil, err
+	}
+	files, err := uploads(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		"UPDATE orders SET status = 'cancelled' WHERE user_id = $1 AND status = 'pending'",
+		"UPDATE returns SET status = 'cancelled', updated_at = NOW() WHERE user_id = $1 AND status = 'requested'",
+		"UPDATE returns SET comment = NULL, decision_note = NULL WHERE user_id = $1",
+		"DELETE FROM return_photos WHERE return_id IN (SELECT id FROM returns WHERE user_id = $1)",
+		"UPDATE warranties SET frame_serial = NULL, updated_at = NOW() WHERE user_id = $1 AND frame_serial IS NOT NULL",
+		"UPDATE warranty_claims SET description = '', resolution = NULL, updated_at = NOW() WHERE user_id = $1",
+		"UPDATE warranty_claim_events SET note = NULL WHERE claim_id IN (SELECT id FROM warranty_claims WHERE user_id = $1)",
+		"DELETE FROM warranty_claim_attachments WHERE claim_id IN (SELECT id FROM warranty_claims WHERE user_id = $1)",
+		`UPDATE bookings SET status = 'cancelled', cancel_reason = 'Account deleted', cancelled_at = NOW(), updated_at = NOW()
+		 WHERE user_id = $1 AND status IN ('pending_payment', 'confirmed') AND starts_at > NOW()`,
+		"UPDATE bookings SET notes = NULL WHERE user_id = $1",
+		`UPDATE orders SET shipping_address_json = jsonb_build_object(
+		     'city', shipping_address_json->'city', 'state', shipping_address_json->'state',
+		     'pincode', shipping_address_json->'pincode', 'country', shipping_address_json->'country')
+		 WHERE user_id = $1 AND shipping_address_json IS NOT NULL`,
+		// Provider payloads carry the payer's email and phone; provider_ref is enough for reconciliation
+		"UPDATE payments SET raw_webhook_json = NULL WHERE order_id IN (SELECT id FROM orders WHERE user_id = $1)",
+		"UPDATE payments SET raw_webhook_json = NULL WHERE booking_id IN (SELECT id FROM bookings WHERE user_id = $1)",
+		"DELETE FROM user_addresses WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM user_recovery_codes WHERE user_id = $1",
+		"DELETE FROM user_action_tokens WHERE user_id = $1",
+		"DELETE FROM oidc_login_states WHERE link_user_id = $1",
+		"DELETE FROM refresh_tokens WHERE user_id = $1",
+		`UPDATE users SET email = 'deleted-' || id || '@deleted.invalid', pending_email = NULL, name = NULL, phone = NULL,
+		     password_hash = NULL, email_verified_at = NULL, totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL,
+		     role = 'customer', failed_login_count = 0, locked_until = NULL, deleted_at = NOW(),
+		     archived_at = COALESCE(archived_at, NOW())
+		 WHERE id = $1`,
+	}
+	for _, stmt := range append(auditScrub, statements...) {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// auditScrub removes the user's email from the audit log, both as the actor and from the snapshots of
+// their account
+var auditScrub = []string{
+	"UPDATE audit_log SET actor_email = NULL WHERE actor_id = $1",
+	`UPDATE audit_log SET before_json = before_json - 'email', after_json = after_json - 'email', diff_json = diff_json - 'email'
+	 WHERE entity_type = 'user' AND entity_id = $1::text`,
+}
+
+// uploads returns the URLs of the files the user uploaded
+func uploads(tx *sql.Tx, userID int64) ([]string, error) {
+	rows, err := tx.Query(uploadsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+// releasePendingStock returns the stock held by the user's pending orders to the locations it was allocated from
+func (s *Store) releasePendingStock(tx *sql.Tx, userID int64) error {
+	rows, err := tx.Query(
+		`SELECT a.order_id, a.product_id, a.location_id, SUM(a.qty) FROM order_allocations a JOIN orders o ON o.id = a.order_id
+		 WHERE o.user_id = $1 AND o.status = 'pending'
+		 GROUP BY a.order_id, a.product_id, a.location_id ORDER BY a.order_id, a.product_id, a.location_id`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	var movements []inventory.Movement
+	for rows.Next() {
+		m := inventory.Movement{Kind: inventory.KindCancellation, Reason: "Order cancelled on account erasure"}
+		if err := rows.Scan(&m.OrderID, &m.ProductID, &m.LocationID, &m.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		movements = append(movements, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range movements {
+		if _, err := s.inventory.Record(tx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Erase deletes the user outright when nothing has to be retained, and anonymises them otherwise.
+// It reports whether the row was anonymised rather than deleted, and returns the URLs of the uploaded
+// files to delete from storage.
+func (s *Store) Erase(userID int64) (bool, []string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so a concurrent order or booking cannot slip in between the check and the delete
+	var id int64
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id); err != nil {
+		return false, nil, err
+	}
+	var hasOrders bool
+	err = tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM orders WHERE user_id = $1) OR EXISTS (SELECT 1 FROM bookings WHERE user_id = $1)`,
+		userID,
+	).Scan(&hasOrders)
+	if err != nil {
+		return false, nil, err
+	}
+	if hasOrders {
+		tx.Rollback()
+		files, err := s.Anonymise(userID)
+		return true, files, err
+	}
+
+	for _, stmt := range append(auditScrub, "DELETE FROM users WHERE id = $1") {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return false, nil, err
+		}
+	}
+	return false, nil, tx.Commit()
+}
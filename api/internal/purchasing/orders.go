@@ -0,0 +1,300 @@
+package purchasing
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Line is a product ordered on a purchase order.
+type Line struct {
+	ID          int64   `json:"id"`
+	ProductID   int64   `json:"product_id"`
+	Title       string  `json:"title"`
+	SKU         *string `json:"sku,omitempty"`
+	QtyOrdered  int     `json:"qty_ordered"`
+	QtyReceived int     `json:"qty_received"`
+	UnitCost    float64 `json:"unit_cost"`
+}
+
+// PurchaseOrder is an order placed with a supplier. Total is the ordered value at the agreed unit costs.
+type PurchaseOrder struct {
+	ID           int64     `json:"id"`
+	Number       string    `json:"number"`
+	SupplierID   int64     `json:"supplier_id"`
+	SupplierName string    `json:"supplier_name"`
+	LocationID   int64     `json:"location_id"`
+	LocationName string    `json:"location_name"`
+	Status       Status    `json:"status"`
+	ExpectedAt   *string   `json:"expected_at,omitempty"`
+	Notes        *string   `json:"notes,omitempty"`
+	Total        float64   `json:"total"`
+	CreatedBy    *int64    `json:"created_by,omitempty"`
+	ApprovedBy   *int64    `json:"approved_by,omitempty"`
+	ApprovedAt   *string   `json:"approved_at,omitempty"`
+	CreatedAt    string    `json:"created_at"`
+	UpdatedAt    *string   `json:"updated_at,omitempty"`
+	Lines        []Line    `json:"lines,omitempty"`
+	Receipts     []Receipt `json:"receipts,omitempty"`
+}
+
+// Draft is the editable content of a purchase order. A zero LocationID means the default location
+// and ExpectedAt is a date in YYYY-MM-DD form.
+type Draft struct {
+	SupplierID int64
+	LocationID int64
+	ExpectedAt *string
+	Notes      *string
+	Lines      []DraftLine
+	CreatedBy  int64
+}
+
+type DraftLine struct {
+	ProductID int64
+	Qty       int
+	UnitCost  float64
+}
+
+const orderQuery = `
+	SELECT po.id, po.supplier_id, s.name, po.location_id, l.name, po.status, po.expected_at::text, po.notes,
+	       COALESCE((SELECT SUM(pl.qty_ordered * pl.unit_cost) FROM purchase_order_lines pl WHERE pl.purchase_order_id = po.id), 0),
+	       po.created_by, po.approved_by, po.approved_at, po.created_at, po.updated_at
+	FROM purchase_orders po
+	JOIN suppliers s ON s.id = po.supplier_id
+	JOIN locations l ON l.id = po.location_id`
+
+func scanOrder(row interface{ Scan(...interface{}) error }) (*PurchaseOrder, error) {
+	var po PurchaseOrder
+	err := row.Scan(&po.ID, &po.SupplierID, &po.SupplierName, &po.LocationID, &po.LocationName, &po.Status, &po.ExpectedAt,
+		&po.Notes, &po.Total, &po.CreatedBy, &po.ApprovedBy, &po.ApprovedAt, &po.CreatedAt, &po.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	po.Number = Number(po.ID)
+	return &po, nil
+}
+
+// Orders returns a page of purchase orders, newest first, and the total count.
+// An empty status or a zero supplierID does not filter.
+func (s *Store) Orders(status Status, supplierID int64, limit, offset int) ([]PurchaseOrder, int, error) {
+	const filter = " WHERE ($1 = '' OR po.status = $1) AND ($2::bigint = 0 OR po.supplier_id = $2)"
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM purchase_orders po"+filter, status, supplierID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(orderQuery+filter+" ORDER BY po.id DESC LIMIT $3 OFFSET $4", status, supplierID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []PurchaseOrder{}
+	for rows.Next() {
+		po, err := scanOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *po)
+	}
+	return list, total, rows.Err()
+}
+
+// Order returns a purchase order with its lines and receipts, or sql.ErrNoRows.
+func (s *Store) Order(id int64) (*PurchaseOrder, error) {
+	po, err := scanOrder(s.db.QueryRow(orderQuery+" WHERE po.id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT pl.id, pl.product_id, p.title, p.sku, pl.qty_ordered, pl.qty_received, pl.unit_cost
+		 FROM purchase_order_lines pl JOIN products p ON p.id = pl.product_id
+		 WHERE pl.purchase_order_id = $1 ORDER BY pl.id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l Line
+		if err := rows.Scan(&l.ID, &l.ProductID, &l.Title, &l.SKU, &l.QtyOrdered, &l.QtyReceived, &l.UnitCost); err != nil {
+			return nil, err
+		}
+		po.Lines = append(po.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if po.Receipts, err = s.receipts(id); err != nil {
+		return nil, err
+	}
+	return po, nil
+}
+
+// CreateOrder saves a new draft purchase order and returns its ID.
+func (s *Store) CreateOrder(d Draft) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	locationID, err := checkDraft(tx, d)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = tx.QueryRow(
+		`INSERT INTO purchase_orders (supplier_id, location_id, expected_at, notes, created_by)
+		 VALUES ($1, $2, $3, $4, NULLIF($5::bigint, 0)) RETURNING id`,
+		d.SupplierID, locationID, d.ExpectedAt, d.Notes, d.CreatedBy,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := insertLines(tx, id, d.Lines); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateOrder replaces the content of a draft purchase order. Approved orders can no longer be edited.
+func (s *Store) UpdateOrder(id int64, d Draft) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOrder(tx, id, StatusDraft); err != nil {
+		return err
+	}
+	locationID, err := checkDraft(tx, d)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE purchase_orders SET supplier_id = $2, location_id = $3, expected_at = $4, notes = $5, updated_at = NOW() WHERE id = $1",
+		id, d.SupplierID, locationID, d.ExpectedAt, d.Notes,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM purchase_order_lines WHERE purchase_order_id = $1", id); err != nil {
+		return err
+	}
+	if err := insertLines(tx, id, d.Lines); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Approve marks a draft purchase order as approved for sending to the supplier.
+func (s *Store) Approve(id, approverID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOrder(tx, id, StatusDraft); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"UPDATE purchase_orders SET status = $2, approved_by = NULLIF($3::bigint, 0), approved_at = NOW(), updated_at = NOW() WHERE id = $1",
+		id, StatusApproved, approverID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Cancel cancels a purchase order that has not been received, or closes a partially received one.
+// It returns the resulting status.
+func (s *Store) Cancel(id int64) (Status, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	current, err := lockOrder(tx, id, StatusDraft, StatusApproved, StatusPartiallyReceived)
+	if err != nil {
+		return "", err
+	}
+	next := StatusCancelled
+	if current == StatusPartiallyReceived {
+		next = StatusClosed
+	}
+	if _, err := tx.Exec("UPDATE purchase_orders SET status = $2, updated_at = NOW() WHERE id = $1", id, next); err != nil {
+		return "", err
+	}
+	return next, tx.Commit()
+}
+
+// lockOrder locks the purchase order row and checks that it is in one of the allowed statuses.
+// It returns sql.ErrNoRows for an unknown order and ErrWrongStatus otherwise.
+func lockOrder(tx *sql.Tx, id int64, allowed ...Status) (Status, error) {
+	var status Status
+	if err := tx.QueryRow("SELECT status FROM purchase_orders WHERE id = $1 FOR UPDATE", id).Scan(&status); err != nil {
+		return "", err
+	}
+	for _, a := range allowed {
+		if status == a {
+			return status, nil
+		}
+	}
+	return status, ErrWrongStatus
+}
+
+// checkDraft validates the supplier, location and lines of a draft and resolves the location
+func checkDraft(tx *sql.Tx, d Draft) (int64, error) {
+	seen := map[int64]bool{}
+	for _, l := range d.Lines {
+		if seen[l.ProductID] {
+			return 0, ErrDuplicateProduct
+		}
+		seen[l.ProductID] = true
+	}
+
+	var active bool
+	err := tx.QueryRow("SELECT is_active FROM suppliers WHERE id = $1", d.SupplierID).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !active) {
+		return 0, ErrInvalidReference
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var locationID int64
+	if d.LocationID == 0 {
+		err = tx.QueryRow("SELECT id FROM locations WHERE is_default").Scan(&locationID)
+	} else {
+		err = tx.QueryRow("SELECT id FROM locations WHERE id = $1 AND is_active", d.LocationID).Scan(&locationID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidReference
+	}
+	return locationID, err
+}
+
+func insertLines(tx *sql.Tx, orderID int64, lines []DraftLine) error {
+	for _, l := range lines {
+		_, err := tx.Exec(
+			"INSERT INTO purchase_order_lines (purchase_order_id, product_id, qty_ordered, unit_cost) VALUES ($1, $2, $3, $4)",
+			orderID, l.ProductID, l.Qty, l.UnitCost,
+		)
+		if isForeignKeyViolation(err) {
+			return ErrInvalidReference
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package purchasing manages suppliers and purchase orders. Received goods are booked into stock
+// through the inventory ledger, so every receipt shows up as a receipt movement.
+package purchasing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/database"
+	"finspeed/api/internal/inventory"
+)
+
+// Status is the lifecycle state of a purchase order.
+type Status string
+
+const (
+	StatusDraft             Status = "draft"
+	StatusApproved          Status = "approved"
+	StatusPartiallyReceived Status = "partially_received"
+	StatusReceived          Status = "received"
+	StatusClosed            Status = "closed" // cancelled after part of it was received
+	StatusCancelled         Status = "cancelled"
+)
+
+var (
+	ErrWrongStatus       = errors.New("purchase order status does not allow this")
+	ErrInvalidReference  = errors.New("unknown or inactive supplier, location or product")
+	ErrDuplicateProduct  = errors.New("a product appears on more than one line")
+	ErrDuplicateSupplier = errors.New("supplier name already exists")
+	ErrUnknownLine       = errors.New("line does not belong to the purchase order")
+	ErrOverReceipt       = errors.New("received quantity exceeds the outstanding quantity")
+)
+
+// ValidStatus reports whether s is a known status.
+func ValidStatus(s Status) bool {
+	switch s {
+	case StatusDraft, StatusApproved, StatusPartiallyReceived, StatusReceived, StatusClosed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Number formats a purchase order ID the way it is quoted to suppliers.
+func Number(id int64) string {
+	return fmt.Sprintf("PO-%06d", id)
+}
+
+// Store reads and writes suppliers and purchase orders.
+type Store struct {
+	db        *database.DB
+	inventory *inventory.Store
+}
+
+func NewStore(db *database.DB, inv *inventory.Store) *Store {
+	return &Store{db: db, inventory: inv}
+}
+
+// isForeignKeyViolation reports whether err is a foreign key violation
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
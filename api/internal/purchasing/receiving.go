@@ -0,0 +1,220 @@
+package purchasing
+
+import (
+	"finspeed/api/internal/inventory"
+)
+
+// Receipt is one delivery against a purchase order.
+type Receipt struct {
+	ID         int64         `json:"id"`
+	ReceivedBy *int64        `json:"received_by,omitempty"`
+	APIKeyID   *int64        `json:"api_key_id,omitempty"`
+	Notes      *string       `json:"notes,omitempty"`
+	ReceivedAt string        `json:"received_at"`
+	Lines      []ReceiptLine `json:"lines"`
+}
+
+// ReceiptLine is the quantity of one purchase order line in a delivery and what it cost.
+type ReceiptLine struct {
+	LineID    int64   `json:"line_id"`
+	ProductID int64   `json:"product_id"`
+	Qty       int     `json:"qty"`
+	UnitCost  float64 `json:"unit_cost"`
+}
+
+// Delivery is what arrived from the supplier. A nil UnitCost on a line means the cost agreed on the order.
+type Delivery struct {
+	Lines      []DeliveryLine
+	Notes      *string
+	ReceivedBy int64
+	APIKeyID   int64
+}
+
+type DeliveryLine struct {
+	LineID   int64    `json:"line_id"`
+	Qty      int      `json:"qty"`
+	UnitCost *float64 `json:"unit_cost,omitempty"`
+}
+
+// CostEntry is a past purchase of a product.
+type CostEntry struct {
+	ReceiptID       int64   `json:"receipt_id"`
+	PurchaseOrderID int64   `json:"purchase_order_id"`
+	Number          string  `json:"number"`
+	SupplierID      int64   `json:"supplier_id"`
+	SupplierName    string  `json:"supplier_name"`
+	Qty             int     `json:"qty"`
+	UnitCost        float64 `json:"unit_cost"`
+	ReceivedAt      string  `json:"received_at"`
+}
+
+// Receive books a delivery against an approved or partially received purchase order. Each line is recorded
+// as a receipt movement at the order's location and sets the product's cost price to what was paid.
+// It returns the receipt ID and the order's new status.
+func (s *Store) Receive(id int64, d Delivery) (int64, Status, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockOrder(tx, id, StatusApproved, StatusPartiallyReceived); err != nil {
+		return 0, "", err
+	}
+	var locationID int64
+	if err := tx.QueryRow("SELECT location_id FROM purchase_orders WHERE id = $1", id).Scan(&locationID); err != nil {
+		return 0, "", err
+	}
+
+	rows, err := tx.Query(
+		"SELECT id, product_id, qty_ordered, qty_received, unit_cost FROM purchase_order_lines WHERE purchase_order_id = $1",
+		id,
+	)
+	if err != nil {
+		return 0, "", err
+	}
+	lines := map[int64]*Line{}
+	for rows.Next() {
+		var l Line
+		if err := rows.Scan(&l.ID, &l.ProductID, &l.QtyOrdered, &l.QtyReceived, &l.UnitCost); err != nil {
+			rows.Close()
+			return 0, "", err
+		}
+		lines[l.ID] = &l
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	var receiptID int64
+	err = tx.QueryRow(
+		`INSERT INTO purchase_receipts (purchase_order_id, received_by, api_key_id, notes)
+		 VALUES ($1, NULLIF($2::bigint, 0), NULLIF($3::bigint, 0), $4) RETURNING id`,
+		id, d.ReceivedBy, d.APIKeyID, d.Notes,
+	).Scan(&receiptID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for _, dl := range d.Lines {
+		l, ok := lines[dl.LineID]
+		if !ok {
+			return 0, "", ErrUnknownLine
+		}
+		if dl.Qty <= 0 || l.QtyReceived+dl.Qty > l.QtyOrdered {
+			return 0, "", ErrOverReceipt
+		}
+		l.QtyReceived += dl.Qty
+		cost := l.UnitCost
+		if dl.UnitCost != nil {
+			cost = *dl.UnitCost
+		}
+
+		_, err := tx.Exec(
+			"INSERT INTO purchase_receipt_lines (receipt_id, line_id, product_id, qty, unit_cost) VALUES ($1, $2, $3, $4, $5)",
+			receiptID, l.ID, l.ProductID, dl.Qty, cost,
+		)
+		if err != nil {
+			return 0, "", err
+		}
+		if _, err := tx.Exec("UPDATE purchase_order_lines SET qty_received = $2 WHERE id = $1", l.ID, l.QtyReceived); err != nil {
+			return 0, "", err
+		}
+		if _, err := tx.Exec("UPDATE products SET cost_price = $2 WHERE id = $1", l.ProductID, cost); err != nil {
+			return 0, "", err
+		}
+		_, err = s.inventory.Record(tx, inventory.Movement{
+			ProductID:       l.ProductID,
+			LocationID:      locationID,
+			Kind:            inventory.KindReceipt,
+			Quantity:        dl.Qty,
+			Reason:          "Received on " + Number(id),
+			PurchaseOrderID: id,
+			ActorID:         d.ReceivedBy,
+			APIKeyID:        d.APIKeyID,
+		})
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	status := StatusReceived
+	for _, l := range lines {
+		if l.QtyReceived < l.QtyOrdered {
+			status = StatusPartiallyReceived
+			break
+		}
+	}
+	if _, err := tx.Exec("UPDATE purchase_orders SET status = $2, updated_at = NOW() WHERE id = $1", id, status); err != nil {
+		return 0, "", err
+	}
+	return receiptID, status, tx.Commit()
+}
+
+// receipts returns the deliveries booked against a purchase order, oldest first
+func (s *Store) receipts(orderID int64) ([]Receipt, error) {
+	rows, err := s.db.Query(
+		`SELECT r.id, r.received_by, r.api_key_id, r.notes, r.received_at, rl.line_id, rl.product_id, rl.qty, rl.unit_cost
+		 FROM purchase_receipts r JOIN purchase_receipt_lines rl ON rl.receipt_id = r.id
+		 WHERE r.purchase_order_id = $1
+		 ORDER BY r.id, rl.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Receipt
+	for rows.Next() {
+		var r Receipt
+		var rl ReceiptLine
+		if err := rows.Scan(&r.ID, &r.ReceivedBy, &r.APIKeyID, &r.Notes, &r.ReceivedAt, &rl.LineID, &rl.ProductID, &rl.Qty, &rl.UnitCost); err != nil {
+			return nil, err
+		}
+		if n := len(list); n == 0 || list[n-1].ID != r.ID {
+			list = append(list, r)
+		}
+		last := &list[len(list)-1]
+		last.Lines = append(last.Lines, rl)
+	}
+	return list, rows.Err()
+}
+
+// CostPrice returns what the product cost on its most recent receipt, nil if it was never received,
+// or sql.ErrNoRows for an unknown product.
+func (s *Store) CostPrice(productID int64) (*float64, error) {
+	var cost *float64
+	err := s.db.QueryRow("SELECT cost_price FROM products WHERE id = $1", productID).Scan(&cost)
+	return cost, err
+}
+
+// CostHistory returns the most recent purchases of a product, newest first.
+func (s *Store) CostHistory(productID int64, limit int) ([]CostEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT r.id, po.id, s.id, s.name, rl.qty, rl.unit_cost, r.received_at
+		 FROM purchase_receipt_lines rl
+		 JOIN purchase_receipts r ON r.id = rl.receipt_id
+		 JOIN purchase_orders po ON po.id = r.purchase_order_id
+		 JOIN suppliers s ON s.id = po.supplier_id
+		 WHERE rl.product_id = $1
+		 ORDER BY r.received_at DESC, rl.id DESC LIMIT $2`,
+		productID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []CostEntry{}
+	for rows.Next() {
+		var e CostEntry
+		if err := rows.Scan(&e.ReceiptID, &e.PurchaseOrderID, &e.SupplierID, &e.SupplierName, &e.Qty, &e.UnitCost, &e.ReceivedAt); err != nil {
+			return nil, err
+		}
+		e.Number = Number(e.PurchaseOrderID)
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,92 @@
+package purchasing
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Supplier is a distributor or brand we buy stock from.
+type Supplier struct {
+	ID           int64   `json:"id"`
+	Name         string  `json:"name"`
+	ContactName  *string `json:"contact_name,omitempty"`
+	Email        *string `json:"email,omitempty"`
+	Phone        *string `json:"phone,omitempty"`
+	GSTIN        *string `json:"gstin,omitempty"`
+	Address      *string `json:"address,omitempty"`
+	LeadTimeDays *int    `json:"lead_time_days,omitempty"`
+	Notes        *string `json:"notes,omitempty"`
+	IsActive     bool    `json:"is_active"`
+	CreatedAt    string  `json:"created_at"`
+	UpdatedAt    *string `json:"updated_at,omitempty"`
+}
+
+const supplierColumns = "id, name, contact_name, email, phone, gstin, address, lead_time_days, notes, is_active, created_at, updated_at"
+
+func scanSupplier(row interface{ Scan(...interface{}) error }) (*Supplier, error) {
+	var s Supplier
+	err := row.Scan(&s.ID, &s.Name, &s.ContactName, &s.Email, &s.Phone, &s.GSTIN, &s.Address, &s.LeadTimeDays, &s.Notes,
+		&s.IsActive, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Suppliers lists suppliers by name, leaving out inactive ones unless includeInactive is set.
+func (s *Store) Suppliers(includeInactive bool) ([]Supplier, error) {
+	rows, err := s.db.Query("SELECT "+supplierColumns+" FROM suppliers WHERE is_active OR $1 ORDER BY lower(name)", includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Supplier{}
+	for rows.Next() {
+		sup, err := scanSupplier(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sup)
+	}
+	return list, rows.Err()
+}
+
+// Supplier returns a supplier by ID or sql.ErrNoRows.
+func (s *Store) Supplier(id int64) (*Supplier, error) {
+	return scanSupplier(s.db.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE id = $1", id))
+}
+
+// SaveSupplier inserts the supplier when its ID is zero and updates it otherwise.
+// It returns sql.ErrNoRows when updating an unknown supplier.
+func (s *Store) SaveSupplier(sup *Supplier) error {
+	var row *sql.Row
+	if sup.ID == 0 {
+		row = s.db.QueryRow(
+			`INSERT INTO suppliers (name, contact_name, email, phone, gstin, address, lead_time_days, notes, is_active)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			 RETURNING `+supplierColumns,
+			sup.Name, sup.ContactName, sup.Email, sup.Phone, sup.GSTIN, sup.Address, sup.LeadTimeDays, sup.Notes, sup.IsActive,
+		)
+	} else {
+		row = s.db.QueryRow(
+			`UPDATE suppliers SET name = $2, contact_name = $3, email = $4, phone = $5, gstin = $6, address = $7,
+			     lead_time_days = $8, notes = $9, is_active = $10, updated_at = NOW()
+			 WHERE id = $1
+			 RETURNING `+supplierColumns,
+			sup.ID, sup.Name, sup.ContactName, sup.Email, sup.Phone, sup.GSTIN, sup.Address, sup.LeadTimeDays, sup.Notes, sup.IsActive,
+		)
+	}
+	saved, err := scanSupplier(row)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDuplicateSupplier
+		}
+		return err
+	}
+	*sup = *saved
+	return nil
+}
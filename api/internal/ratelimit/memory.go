@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type counter struct {
+	count     int
+	windowEnd time.Time
+}
+
+// MemoryStore keeps counters in process memory. Suitable for single-instance deployments and local development.
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*counter), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Hit(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.windowEnd) {
+		c = &counter{windowEnd: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+	return c.count, c.windowEnd, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+// sweep drops expired counters at most once a minute so the map does not grow without bound
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	for k, c := range s.counters {
+		if !now.Before(c.windowEnd) {
+			delete(s.counters, k)
+		}
+	}
+	s.lastSweep = now
+}
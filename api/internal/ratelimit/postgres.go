@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"finspeed/api/internal/database"
+)
+
+// PostgresStore keeps counters in the rate_limit_counters table so limits hold across API instances.
+type PostgresStore struct {
+	db     *database.DB
+	logger *zap.Logger
+	hits   atomic.Uint64
+}
+
+func NewPostgresStore(db *database.DB, logger *zap.Logger) *PostgresStore {
+	return &PostgresStore{db: db, logger: logger}
+}
+
+func (s *PostgresStore) Hit(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	var (
+		count     int
+		windowEnd time.Time
+	)
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO rate_limit_counters (key, count, window_ends_at)
+		 VALUES ($1, 1, NOW() + make_interval(secs => $2))
+		 ON CONFLICT (key) DO UPDATE SET
+		     count = CASE WHEN rate_limit_counters.window_ends_at <= NOW() THEN 1 ELSE rate_limit_counters.count + 1 END,
+		     window_ends_at = CASE WHEN rate_limit_counters.window_ends_at <= NOW() THEN EXCLUDED.window_ends_at ELSE rate_limit_counters.window_ends_at END
+		 RETURNING count, window_ends_at`,
+		key, window.Seconds(),
+	).Scan(&count, &windowEnd)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	// Prune expired rows every few hundred hits
+	if s.hits.Add(1)%500 == 0 {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit_counters WHERE window_ends_at < NOW()"); err != nil {
+			s.logger.Warn("Failed to prune rate limit counters", zap.Error(err))
+		}
+	}
+	return count, windowEnd, nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit_counters WHERE key = $1", key)
+	return err
+}
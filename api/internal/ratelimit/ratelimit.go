@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps fixed-window hit counters.
+type Store interface {
+	// Hit increments the counter for key and returns the new count and when the current window ends.
+	Hit(ctx context.Context, key string, window time.Duration) (int, time.Time, error)
+	// Reset clears the counter for key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter allows at most Limit hits per key within Window.
+type Limiter struct {
+	store  Store
+	limit  int
+	window time.Duration
+	prefix string
+}
+
+// Result describes the outcome of a rate limit check.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+func NewLimiter(store Store, prefix string, limit int, window time.Duration) *Limiter {
+	return &Limiter{store: store, limit: limit, window: window, prefix: prefix}
+}
+
+// Allow records a hit for key and reports whether it is within the limit.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowWithLimit(ctx, key, l.limit)
+}
+
+// AllowWithLimit is Allow with a per-key limit overriding the limiter's default, e.g. for API keys.
+func (l *Limiter) AllowWithLimit(ctx context.Context, key string, limit int) (Result, error) {
+	count, resetAt, err := l.store.Hit(ctx, l.prefix+":"+key, l.window)
+	if err != nil {
+		return Result{}, err
+	}
+	if count > limit {
+		retry := time.Until(resetAt)
+		if retry < time.Second {
+			retry = time.Second
+		}
+		return Result{Allowed: false, RetryAfter: retry}, nil
+	}
+	return Result{Allowed: true, Remaining: limit - count}, nil
+}
+
+// Reset clears the counter for key, e.g. after a successful login.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, l.prefix+":"+key)
+}
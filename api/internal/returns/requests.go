@@ -0,0 +1,237 @@
+package returns
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Return is a request to send back part of an order item. Refund fields are set once it is refunded.
+type Return struct {
+	ID           int64        `json:"id"`
+	Number       string       `json:"number"`
+	OrderID      int64        `json:"order_id"`
+	OrderItemID  int64        `json:"order_item_id"`
+	ProductID    int64        `json:"product_id"`
+	Title        string       `json:"title"`
+	UserID       int64        `json:"user_id"`
+	Qty          int          `json:"qty"`
+	PriceEach    float64      `json:"price_each"`
+	Reason       Reason       `json:"reason"`
+	Comment      *string      `json:"comment,omitempty"`
+	Status       Status       `json:"status"`
+	DecisionNote *string      `json:"decision_note,omitempty"`
+	DecidedAt    *string      `json:"decided_at,omitempty"`
+	Courier      *string      `json:"courier,omitempty"`
+	AWBNumber    *string      `json:"awb_number,omitempty"`
+	TrackingURL  *string      `json:"tracking_url,omitempty"`
+	ShippedAt    *string      `json:"shipped_at,omitempty"`
+	Disposition  *Disposition `json:"disposition,omitempty"`
+	LocationID   *int64       `json:"location_id,omitempty"`
+	ReceivedAt   *string      `json:"received_at,omitempty"`
+	RefundAmount *float64     `json:"refund_amount,omitempty"`
+	RefundRef    *string      `json:"refund_ref,omitempty"`
+	RefundedAt   *string      `json:"refunded_at,omitempty"`
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    *string      `json:"updated_at,omitempty"`
+	Photos       []Photo      `json:"photos"`
+	Serials      []string     `json:"serials,omitempty"`
+}
+
+// Photo is a picture the customer attached, usually of the damage.
+type Photo struct {
+	ID        int64  `json:"id"`
+	URL       string `json:"url"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NewReturn is a customer's return request.
+type NewReturn struct {
+	OrderID     int64
+	OrderItemID int64
+	UserID      int64
+	Qty         int
+	Reason      Reason
+	Comment     *string
+}
+
+const returnQuery = `
+	SELECT r.id, r.order_id, r.order_item_id, oi.product_id, COALESCE(p.title, ''), r.user_id, r.qty, oi.price_each,
+	       r.reason, r.comment, r.status, r.decision_note, r.decided_at, r.courier, r.awb_number, r.tracking_url,
+	       r.shipped_at, r.disposition, r.location_id, r.received_at, r.refund_amount, r.refund_ref, r.refunded_at,
+	       r.created_at, r.updated_at
+	FROM returns r
+	JOIN order_items oi ON oi.id = r.order_item_id
+	LEFT JOIN products p ON p.id = oi.product_id`
+
+func scanReturn(row interface{ Scan(...interface{}) error }) (*Return, error) {
+	var r Return
+	err := row.Scan(&r.ID, &r.OrderID, &r.OrderItemID, &r.ProductID, &r.Title, &r.UserID, &r.Qty, &r.PriceEach,
+		&r.Reason, &r.Comment, &r.Status, &r.DecisionNote, &r.DecidedAt, &r.Courier, &r.AWBNumber, &r.TrackingURL,
+		&r.ShippedAt, &r.Disposition, &r.LocationID, &r.ReceivedAt, &r.RefundAmount, &r.RefundRef, &r.RefundedAt,
+		&r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Number = Number(r.ID)
+	r.Photos = []Photo{}
+	return &r, nil
+}
+
+// Create opens a return for a delivered order item of the customer's order and returns its ID. The quantity
+// must still be returnable: delivered, and not in another return that is open or done. A positive window
+// limits returns to that long after the item's last delivery. It returns sql.ErrNoRows if the order is
+// not the customer's.
+func (s *Store) Create(n NewReturn, window time.Duration) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the order serialises return requests for its items
+	var orderID int64
+	if err := tx.QueryRow("SELECT id FROM orders WHERE id = $1 AND user_id = $2 FOR UPDATE", n.OrderID, n.UserID).Scan(&orderID); err != nil {
+		return 0, err
+	}
+
+	var delivered, returned int
+	var lastDelivery *time.Time
+	err = tx.QueryRow(
+		`SELECT COALESCE((SELECT SUM(si.qty) FROM shipment_items si JOIN shipments s ON s.id = si.shipment_id
+		                  WHERE si.order_item_id = oi.id AND s.status = 'delivered'), 0),
+		        (SELECT MAX(s.delivered_at) FROM shipment_items si JOIN shipments s ON s.id = si.shipment_id
+		         WHERE si.order_item_id = oi.id AND s.status = 'delivered'),
+		        COALESCE((SELECT SUM(r.qty) FROM returns r
+		                  WHERE r.order_item_id = oi.id AND r.status NOT IN ('rejected', 'cancelled')), 0)
+		 FROM order_items oi WHERE oi.id = $1 AND oi.order_id = $2`,
+		n.OrderItemID, n.OrderID,
+	).Scan(&delivered, &lastDelivery, &returned)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUnknownItem
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n.Qty <= 0 || n.Qty > delivered-returned {
+		return 0, ErrNotReturnable
+	}
+	if window > 0 && lastDelivery != nil && time.Since(*lastDelivery) > window {
+		return 0, ErrWindowClosed
+	}
+
+	var id int64
+	err = tx.QueryRow(
+		`INSERT INTO returns (order_id, order_item_id, user_id, qty, reason, comment)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		n.OrderID, n.OrderItemID, n.UserID, n.Qty, n.Reason, n.Comment,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Returns returns a page of returns, newest first, and the total count. An empty status or a zero
+// orderID or userID does not filter.
+func (s *Store) Returns(status Status, orderID, userID int64, limit, offset int) ([]Return, int, error) {
+	const filter = " WHERE ($1 = '' OR r.status = $1) AND ($2::bigint = 0 OR r.order_id = $2) AND ($3::bigint = 0 OR r.user_id = $3)"
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM returns r"+filter, status, orderID, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(returnQuery+filter+" ORDER BY r.id DESC LIMIT $4 OFFSET $5", status, orderID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Return{}
+	for rows.Next() {
+		r, err := scanReturn(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *r)
+	}
+	return list, total, rows.Err()
+}
+
+// Return returns a return with its photos and returned serial numbers, or sql.ErrNoRows. A non-zero userID
+// must own it.
+func (s *Store) Return(id, userID int64) (*Return, error) {
+	r, err := scanReturn(s.db.QueryRow(returnQuery+" WHERE r.id = $1 AND ($2::bigint = 0 OR r.user_id = $2)", id, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT id, url, created_at FROM return_photos WHERE return_id = $1 ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Photo
+		if err := rows.Scan(&p.ID, &p.URL, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Photos = append(r.Photos, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRow(
+		`SELECT ARRAY(SELECT sn.serial FROM return_serials rs JOIN serial_numbers sn ON sn.id = rs.serial_number_id
+		              WHERE rs.return_id = $1 ORDER BY sn.id)`,
+		id,
+	).Scan(pq.Array(&r.Serials))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// AddPhoto attaches an uploaded photo to the customer's return while it awaits a decision.
+func (s *Store) AddPhoto(id, userID int64, url string) (*Photo, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lock(tx, id, userID, StatusRequested); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM return_photos WHERE return_id = $1", id).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= MaxPhotos {
+		return nil, ErrTooManyPhotos
+	}
+
+	var p Photo
+	err = tx.QueryRow(
+		"INSERT INTO return_photos (return_id, url) VALUES ($1, $2) RETURNING id, url, created_at",
+		id, url,
+	).Scan(&p.ID, &p.URL, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, tx.Commit()
+}
+
+// Recipient returns the email address of the customer who opened the return and their name.
+func (s *Store) Recipient(id int64) (string, string, error) {
+	var email, name string
+	err := s.db.QueryRow(
+		`SELECT u.email, COALESCE(u.name, '')
+		 FROM returns r JOIN users u ON u.id = r.user_id WHERE r.id = $1`,
+		id,
+	).Scan(&email, &name)
+	return email, name, err
+}
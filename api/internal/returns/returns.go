@@ -0,0 +1,113 @@
+// Package returns handles return requests (RMAs) for delivered order items. Returned goods go back
+// into stock, or are written off, through the inventory ledger.
+package returns
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"finspeed/api/internal/database"
+	"finspeed/api/internal/inventory"
+)
+
+// Status is the lifecycle state of a return.
+type Status string
+
+const (
+	StatusRequested Status = "requested"
+	StatusApproved  Status = "approved"
+	StatusRejected  Status = "rejected"
+	StatusShipped   Status = "shipped" // the customer sent the item back
+	StatusReceived  Status = "received"
+	StatusRefunded  Status = "refunded"
+	StatusCancelled Status = "cancelled" // withdrawn by the customer
+)
+
+// Reason is why the customer is returning the item.
+type Reason string
+
+const (
+	ReasonDamaged        Reason = "damaged"
+	ReasonDefective      Reason = "defective"
+	ReasonWrongSize      Reason = "wrong_size"
+	ReasonWrongItem      Reason = "wrong_item"
+	ReasonNotAsDescribed Reason = "not_as_described"
+	ReasonChangedMind    Reason = "changed_mind"
+	ReasonOther          Reason = "other"
+)
+
+// Disposition is what happens to returned goods once they arrive.
+type Disposition string
+
+const (
+	DispositionRestock  Disposition = "restock"   // back into sellable stock
+	DispositionWriteOff Disposition = "write_off" // recorded as returned, then as damaged
+)
+
+// MaxPhotos is the number of photos a customer can attach to a return.
+const MaxPhotos = 5
+
+var (
+	ErrWrongStatus     = errors.New("return status does not allow this")
+	ErrUnknownItem     = errors.New("item does not belong to the order")
+	ErrNotReturnable   = errors.New("quantity exceeds what was delivered and not yet returned")
+	ErrWindowClosed    = errors.New("the return window has closed")
+	ErrTooManyPhotos   = errors.New("the return already has the maximum number of photos")
+	ErrTrackingMissing = errors.New("courier and awb_number are required")
+	ErrRefundTooLarge  = errors.New("refund exceeds the price paid for the returned items")
+	ErrNoPayment       = errors.New("the order has no payment to refund")
+	ErrSerialCount     = errors.New("serialised items need the serial number of every returned unit")
+)
+
+// ValidStatus reports whether s is a known status.
+func ValidStatus(s Status) bool {
+	switch s {
+	case StatusRequested, StatusApproved, StatusRejected, StatusShipped, StatusReceived, StatusRefunded, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// ValidReason reports whether r is a known reason.
+func ValidReason(r Reason) bool {
+	switch r {
+	case ReasonDamaged, ReasonDefective, ReasonWrongSize, ReasonWrongItem, ReasonNotAsDescribed, ReasonChangedMind, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// Number formats a return ID the way it is quoted to customers.
+func Number(id int64) string {
+	return fmt.Sprintf("RMA-%06d", id)
+}
+
+// Store reads and writes returns.
+type Store struct {
+	db        *database.DB
+	inventory *inventory.Store
+}
+
+func NewStore(db *database.DB, inv *inventory.Store) *Store {
+	return &Store{db: db, inventory: inv}
+}
+
+// lock locks the return and checks that it is in one of the allowed statuses. A non-zero userID must
+// own the return. It returns sql.ErrNoRows for an unknown return.
+func lock(tx *sql.Tx, id, userID int64, allowed ...Status) (Status, error) {
+	var status Status
+	var owner int64
+	if err := tx.QueryRow("SELECT status, user_id FROM returns WHERE id = $1 FOR UPDATE", id).Scan(&status, &owner); err != nil {
+		return "", err
+	}
+	if userID != 0 && owner != userID {
+		return "", sql.ErrNoRows
+	}
+	for _, a := range allowed {
+		if status == a {
+			return status, nil
+		}
+	}
+	return status, ErrWrongStatus
+}
@@ -0,0 +1,233 @@
+package returns
+
+import (
+	"math"
+
+	"finspeed/api/internal/inventory"
+)
+
+// Tracking is the courier's reference for the parcel coming back.
+type Tracking struct {
+	Courier     string
+	AWBNumber   string
+	TrackingURL *string
+}
+
+// Receipt records the arrival of the returned goods. A zero LocationID means the default location.
+// Serials lists the serial number of every returned unit of a serialised product.
+type Receipt struct {
+	Disposition Disposition
+	LocationID  int64
+	Serials     []string
+	ReceivedBy  int64
+	APIKeyID    int64
+}
+
+// Approve accepts a requested return; the customer can then send the item back.
+func (s *Store) Approve(id int64, note *string, actorID int64) error {
+	return s.decide(id, StatusApproved, note, actorID)
+}
+
+// Reject turns down a requested return; note tells the customer why.
+func (s *Store) Reject(id int64, note *string, actorID int64) error {
+	return s.decide(id, StatusRejected, note, actorID)
+}
+
+func (s *Store) decide(id int64, status Status, note *string, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lock(tx, id, 0, StatusRequested); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE returns SET status = $2, decision_note = $3, decided_by = NULLIF($4::bigint, 0), decided_at = NOW(), updated_at = NOW()
+		 WHERE id = $1`,
+		id, status, note, actorID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Cancel withdraws the customer's return before the item is sent back.
+func (s *Store) Cancel(id, userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lock(tx, id, userID, StatusRequested, StatusApproved); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE returns SET status = $2, updated_at = NOW() WHERE id = $1", id, StatusCancelled); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ship records the parcel an approved return was sent back in. The tracking of a shipped return can be
+// corrected until it is received. A non-zero userID must own the return.
+func (s *Store) Ship(id, userID int64, t Tracking) error {
+	if t.Courier == "" || t.AWBNumber == "" {
+		return ErrTrackingMissing
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lock(tx, id, userID, StatusApproved, StatusShipped); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE returns SET status = $2, courier = $3, awb_number = $4, tracking_url = $5,
+		        shipped_at = COALESCE(shipped_at, NOW()), updated_at = NOW()
+		 WHERE id = $1`,
+		id, StatusShipped, t.Courier, t.AWBNumber, t.TrackingURL,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Receive books the returned goods in at a location. Restocked goods are recorded as a return movement;
+// written-off goods as a return followed by damage, so the ledger shows both the arrival and the loss.
+// Goods can arrive without tracking, e.g. when handed in at a store, so approved returns are accepted too.
+// Serialised units are recorded by serial number, and restocked ones go back in stock at the location.
+func (s *Store) Receive(id int64, r Receipt) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lock(tx, id, 0, StatusApproved, StatusShipped); err != nil {
+		return err
+	}
+	var orderID, orderItemID, productID int64
+	var qty int
+	var serialised bool
+	err = tx.QueryRow(
+		`SELECT r.order_id, r.order_item_id, oi.product_id, r.qty, COALESCE(p.is_serialised, false)
+		 FROM returns r JOIN order_items oi ON oi.id = r.order_item_id LEFT JOIN products p ON p.id = oi.product_id
+		 WHERE r.id = $1`,
+		id,
+	).Scan(&orderID, &orderItemID, &productID, &qty, &serialised)
+	if err != nil {
+		return err
+	}
+	if !serialised && len(r.Serials) > 0 {
+		return inventory.ErrNotSerialised
+	}
+	if serialised && len(r.Serials) != qty {
+		return ErrSerialCount
+	}
+
+	m := inventory.Movement{
+		ProductID:  productID,
+		LocationID: r.LocationID,
+		Kind:       inventory.KindReturn,
+		Quantity:   qty,
+		Reason:     "Returned on " + Number(id),
+		OrderID:    orderID,
+		ActorID:    r.ReceivedBy,
+		APIKeyID:   r.APIKeyID,
+	}
+	if _, err := s.inventory.Record(tx, m); err != nil {
+		return err
+	}
+	if r.Disposition == DispositionWriteOff {
+		m.Kind = inventory.KindDamage
+		m.Quantity = -qty
+		m.Reason = "Written off on " + Number(id)
+		if _, err := s.inventory.Record(tx, m); err != nil {
+			return err
+		}
+	}
+	if serialised {
+		locationID := r.LocationID
+		if locationID == 0 {
+			if err := tx.QueryRow("SELECT id FROM locations WHERE is_default").Scan(&locationID); err != nil {
+				return err
+			}
+		}
+		restock := r.Disposition == DispositionRestock
+		if err := s.inventory.ReturnSerials(tx, id, orderItemID, locationID, r.Serials, restock); err != nil {
+			return err
+		}
+	}
+
+	// Record resolved a zero location to the default one; store that
+	_, err = tx.Exec(
+		`UPDATE returns SET status = $2, disposition = $3,
+		        location_id = COALESCE(NULLIF($4::bigint, 0), (SELECT id FROM locations WHERE is_default)),
+		        received_by = NULLIF($5::bigint, 0), received_at = NOW(), updated_at = NOW()
+		 WHERE id = $1`,
+		id, StatusReceived, r.Disposition, r.LocationID, r.ReceivedBy,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Refund refunds a received return through issue, which is given the order's payment ID and the amount and
+// returns the provider's refund ID and the amount refunded. A nil amount refunds the full price paid for
+// the returned items. The return stays locked while issue runs, so it is refunded once at a time; if saving
+// the result fails the return can be refunded again, so issue must return the earlier refund rather than
+// make a second one.
+func (s *Store) Refund(id int64, amount *float64, actorID int64, issue func(paymentID string, amount float64) (string, float64, error)) (float64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lock(tx, id, 0, StatusReceived); err != nil {
+		return 0, err
+	}
+	var paid float64
+	var paymentID *string
+	err = tx.QueryRow(
+		`SELECT r.qty * oi.price_each, o.payment_id
+		 FROM returns r JOIN order_items oi ON oi.id = r.order_item_id JOIN orders o ON o.id = r.order_id
+		 WHERE r.id = $1`,
+		id,
+	).Scan(&paid, &paymentID)
+	if err != nil {
+		return 0, err
+	}
+	refund := paid
+	if amount != nil {
+		refund = math.Round(*amount*100) / 100
+	}
+	if refund <= 0 || refund > paid {
+		return 0, ErrRefundTooLarge
+	}
+	if paymentID == nil || *paymentID == "" {
+		return 0, ErrNoPayment
+	}
+
+	ref, refund, err := issue(*paymentID, refund)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(
+		`UPDATE returns SET status = $2, refund_amount = $3, refund_ref = $4, refunded_by = NULLIF($5::bigint, 0),
+		        refunded_at = NOW(), updated_at = NOW()
+		 WHERE id = $1`,
+		id, StatusRefunded, refund, ref, actorID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return refund, tx.Commit()
+}
@@ -11,18 +11,36 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"finspeed/api/internal/audit"
+	"finspeed/api/internal/auth"
+	"finspeed/api/internal/bookings"
 	"finspeed/api/internal/config"
+	"finspeed/api/internal/courier"
 	"finspeed/api/internal/database"
 	"finspeed/api/internal/handlers"
+	"finspeed/api/internal/inventory"
+	"finspeed/api/internal/mailer"
 	"finspeed/api/internal/middleware"
+	"finspeed/api/internal/notify"
+	"finspeed/api/internal/privacy"
+	"finspeed/api/internal/purchasing"
+	"finspeed/api/internal/ratelimit"
+	"finspeed/api/internal/returns"
+	"finspeed/api/internal/shipping"
 	"finspeed/api/internal/storage"
+	"finspeed/api/internal/warranty"
 )
 
 type Server struct {
-	config *config.Config
-	db     *database.DB
-	logger *zap.Logger
-	router *gin.Engine
+	config   *config.Config
+	db       *database.DB
+	logger   *zap.Logger
+	router   *gin.Engine
+	tokens   *auth.TokenManager
+	roles    *auth.RoleStore
+	sessions *auth.SessionStore
+	// jobs run in the background from Start until shutdown
+	jobs []func(ctx context.Context)
 }
 
 func New(cfg *config.Config, db *database.DB, logger *zap.Logger) *Server {
@@ -41,16 +59,26 @@ func New(cfg *config.Config, db *database.DB, logger *zap.Logger) *Server {
 	logger.Info("[SERVER] Gin router initialized.")
 
 	// Add middleware
+	router.Use(middleware.RequestID())
 	router.Use(middleware.Logger(logger))
 	router.Use(middleware.Recovery(logger))
 	router.Use(middleware.CORS())
-	logger.Info("[SERVER] Core middleware (Logger, Recovery, CORS) added.")
+	logger.Info("[SERVER] Core middleware (RequestID, Logger, Recovery, CORS) added.")
+
+	tokens, err := newTokenManager(cfg, logger)
+	if err != nil {
+		logger.Fatal("[AUTH] Failed to initialize JWT signing keys", zap.Error(err))
+	}
+	logger.Info("[AUTH] JWT signing keys loaded.", zap.String("active_kid", tokens.ActiveKeyID()))
 
 	s := &Server{
-		config: cfg,
-		db:     db,
-		logger: logger,
-		router: router,
+		config:   cfg,
+		db:       db,
+		logger:   logger,
+		router:   router,
+		tokens:   tokens,
+		roles:    auth.NewRoleStore(db),
+		sessions: auth.NewSessionStore(db, logger),
 	}
 	logger.Info("[SERVER] Server struct created.")
 
@@ -60,12 +88,77 @@ func New(cfg *config.Config, db *database.DB, logger *zap.Logger) *Server {
 	return s
 }
 
+// newTokenManager loads the JWT key set. Without JWT_KEYS_DIR (development only) an
+// ephemeral key is generated, so tokens do not survive a restart.
+func newTokenManager(cfg *config.Config, logger *zap.Logger) (*auth.TokenManager, error) {
+	var keys []*auth.SigningKey
+	if cfg.JWTKeysDir != "" {
+		loaded, err := auth.LoadKeysFromDir(cfg.JWTKeysDir)
+		if err != nil {
+			return nil, err
+		}
+		keys = loaded
+	} else {
+		logger.Warn("[AUTH] JWT_KEYS_DIR not set; generating an ephemeral development signing key")
+		key, err := auth.GenerateEphemeralKey("dev-ephemeral")
+		if err != nil {
+			return nil, err
+		}
+		keys = []*auth.SigningKey{key}
+	}
+	return auth.NewTokenManager(keys, cfg.JWTActiveKID, cfg.JWTIssuer, cfg.JWTAudience, cfg.AccessTokenTTL, cfg.JWTSecret)
+}
+
 func (s *Server) SetupRoutes() {
 	s.logger.Info("[ROUTES] Starting route configuration...")
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(s.db, s.logger)
-	authHandler := handlers.NewAuthHandler(s.db, s.logger, s.config)
+
+	// Initialize mail backend
+	var mail mailer.Mailer
+	if s.config.MailBackend == "smtp" {
+		mail = mailer.NewSMTP(s.config.SMTPHost, s.config.SMTPPort, s.config.SMTPUsername, s.config.SMTPPassword, s.config.MailFrom)
+		s.logger.Info("[MAILER] Using SMTP mail backend", zap.String("host", s.config.SMTPHost))
+	} else {
+		mail = mailer.NewLog(s.logger)
+		s.logger.Info("[MAILER] Using log mail backend")
+	}
+
+	// Initialize rate limit store
+	var limitStore ratelimit.Store
+	if s.config.RateLimitStore == "postgres" {
+		limitStore = ratelimit.NewPostgresStore(s.db, s.logger)
+	} else {
+		limitStore = ratelimit.NewMemoryStore()
+	}
+	s.logger.Info("[RATELIMIT] Rate limit store configured", zap.String("store", s.config.RateLimitStore))
+	authIPLimiter := ratelimit.NewLimiter(limitStore, "auth:ip", s.config.AuthRateLimitPerIP, s.config.RateLimitWindow)
+	loginEmailLimiter := ratelimit.NewLimiter(limitStore, "login:email", s.config.LoginRateLimitPerEmail, s.config.RateLimitWindow)
+	apiKeyLimiter := ratelimit.NewLimiter(limitStore, "apikey", s.config.APIKeyRateLimit, time.Minute)
+
+	auditRecorder := audit.NewRecorder(s.db, s.logger)
+
+	twoFactor := auth.NewTwoFactorStore(s.db)
+	apiKeys := auth.NewAPIKeyStore(s.db)
+
+	authHandler := handlers.NewAuthHandler(s.db, s.logger, s.config, s.tokens, s.roles, s.sessions, auth.NewActionTokenStore(s.db), twoFactor, mail, loginEmailLimiter, auditRecorder)
+
+	var oidcProviders []*auth.OIDCProvider
+	for _, p := range s.config.OIDCProviders {
+		oidcProviders = append(oidcProviders, auth.NewOIDCProvider(auth.OIDCProviderConfig{
+			Name:         p.Name,
+			DisplayName:  p.DisplayName,
+			DiscoveryURL: p.DiscoveryURL,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  s.config.OIDCRedirectURL,
+			Scopes:       p.Scopes,
+		}))
+		s.logger.Info("[OIDC] Identity provider configured", zap.String("provider", p.Name), zap.String("discovery_url", p.DiscoveryURL))
+	}
+	oidcHandler := handlers.NewOIDCHandler(authHandler, oidcProviders, auth.NewIdentityStore(s.db))
+	inventoryStore := inventory.NewStore(s.db)
 
 	// Initialize storage backend
 	var store storage.Storage
@@ -81,11 +174,58 @@ func (s *Server) SetupRoutes() {
 		s.logger.Info("[STORAGE] Using local storage backend", zap.String("root", "./uploads"))
 	}
 
-	productHandler := handlers.NewProductHandler(s.db, s.logger, store)
-	categoryHandler := handlers.NewCategoryHandler(s.db, s.logger)
+	privacyHandler := handlers.NewPrivacyHandler(authHandler, privacy.NewStore(s.db, inventoryStore), store)
+	productHandler := handlers.NewProductHandler(s.db, s.logger, store, auditRecorder, inventoryStore)
+	categoryHandler := handlers.NewCategoryHandler(s.db, s.logger, auditRecorder)
 	cartHandler := handlers.NewCartHandler(s.db, s.logger)
-	orderHandler := handlers.NewOrderHandler(s.db, s.logger)
-	paymentHandler := handlers.NewPaymentHandler(s.db, s.logger, s.config)
+	warrantyStore := warranty.NewStore(s.db)
+	shippingStore := shipping.NewStore(s.db, warrantyStore)
+	orderHandler := handlers.NewOrderHandler(s.db, s.logger, inventoryStore, shippingStore)
+	inventoryHandler := handlers.NewInventoryHandler(s.db, s.logger, inventoryStore, auditRecorder)
+	purchasingHandler := handlers.NewPurchasingHandler(s.logger, purchasing.NewStore(s.db, inventoryStore), auditRecorder)
+
+	// Initialize courier provider; without one, staff enter courier details by hand
+	var courierProvider courier.Provider
+	switch s.config.CourierProvider {
+	case "shiprocket":
+		courierProvider = courier.NewShiprocket(s.config.ShiprocketBaseURL, s.config.ShiprocketEmail, s.config.ShiprocketPassword, s.config.CourierWebhookSecret)
+		s.logger.Info("[COURIER] Using Shiprocket courier provider", zap.String("base_url", s.config.ShiprocketBaseURL))
+	case "fake":
+		courierProvider = courier.NewFake()
+		s.logger.Info("[COURIER] Using fake courier provider")
+	}
+	shipmentHandler := handlers.NewShipmentHandler(s.logger, shippingStore, courierProvider, mail, auditRecorder)
+
+	// Staff notifications go to every configured channel, or to the log when none is
+	var notifiers notify.Multi
+	if len(s.config.AdminNotifyEmails) > 0 {
+		notifiers = append(notifiers, notify.NewEmail(mail, s.config.AdminNotifyEmails))
+	}
+	if s.config.AdminNotifyWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhook(s.config.AdminNotifyWebhookURL))
+	}
+	if len(notifiers) == 0 {
+		notifiers = append(notifiers, notify.NewLog(s.logger))
+	}
+	if interval := s.config.LowStockCheckInterval; interval > 0 {
+		monitor := inventory.NewLowStockMonitor(inventoryStore, notifiers, s.logger)
+		s.jobs = append(s.jobs, func(ctx context.Context) { monitor.Run(ctx, interval) })
+		s.logger.Info("[JOBS] Low-stock check scheduled", zap.Duration("interval", interval))
+	}
+	returnHandler := handlers.NewReturnHandler(s.logger, returns.NewStore(s.db, inventoryStore), store, mail, s.config, auditRecorder)
+	warrantyHandler := handlers.NewWarrantyHandler(s.logger, warrantyStore, store, mail, auditRecorder)
+	bookingStore := bookings.NewStore(s.db, s.config.BookingPaymentWindow)
+	bookingHandler := handlers.NewBookingHandler(s.logger, bookingStore, mail, s.config, auditRecorder)
+	if interval := s.config.BookingReminderInterval; interval > 0 {
+		reminder := bookings.NewReminder(bookingStore, mail, s.logger, s.config.BookingReminderLead)
+		s.jobs = append(s.jobs, func(ctx context.Context) { reminder.Run(ctx, interval) })
+		s.logger.Info("[JOBS] Booking reminders scheduled", zap.Duration("interval", interval), zap.Duration("lead", s.config.BookingReminderLead))
+	}
+	addressHandler := handlers.NewAddressHandler(s.db, s.logger)
+	paymentHandler := handlers.NewPaymentHandler(s.db, s.logger, s.config, bookingStore)
+	roleHandler := handlers.NewRoleHandler(s.db, s.logger, s.roles, auditRecorder)
+	auditHandler := handlers.NewAuditHandler(s.db, s.logger)
+	apiKeyHandler := handlers.NewAPIKeyHandler(s.logger, apiKeys, s.roles, auditRecorder)
 	s.logger.Info("[ROUTES] All handlers initialized.")
 
 	// Health check routes
@@ -93,6 +233,10 @@ func (s *Server) SetupRoutes() {
 	s.router.GET("/readyz", healthHandler.ReadinessCheck)
 	s.logger.Info("[ROUTES] Health check routes (/healthz, /readyz) configured.")
 
+	// Public signing keys for verifying access tokens (e.g. in the api-gateway)
+	s.router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	s.logger.Info("[ROUTES] JWKS route configured.")
+
 	// API v1 routes
 	v1 := s.router.Group("/api/v1")
 	s.logger.Info("[ROUTES] Configured API v1 group.")
@@ -100,6 +244,7 @@ func (s *Server) SetupRoutes() {
 		// Health check routes under API v1 (for LB/Gateway path-based routing)
 		v1.GET("/healthz", healthHandler.HealthCheck)
 		v1.GET("/readyz", healthHandler.ReadinessCheck)
+		v1.GET("/.well-known/jwks.json", authHandler.JWKS)
 		s.logger.Info("[ROUTES] API v1 health routes configured.")
 
 		// Static files for uploaded content (local dev only)
@@ -108,17 +253,47 @@ func (s *Server) SetupRoutes() {
 			v1.Static("/uploads", "./uploads")
 		}
 
+		requireAuth := middleware.AuthMiddleware(s.tokens, s.sessions, s.logger)
+		optionalAuth := middleware.OptionalAuthMiddleware(s.tokens, s.sessions, s.logger)
+		requireVerified := middleware.RequireVerifiedEmail(s.db, s.logger)
+		authRateLimit := middleware.RateLimitByIP(authIPLimiter, s.logger)
+
 		// Auth routes (public)
-		auth := v1.Group("/auth")
+		authRoutes := v1.Group("/auth")
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			authRoutes.POST("/register", authRateLimit, authHandler.Register)
+			authRoutes.POST("/login", authRateLimit, authHandler.Login)
+			authRoutes.POST("/refresh", authHandler.Refresh)
+			authRoutes.POST("/logout", requireAuth, authHandler.Logout)
+			authRoutes.POST("/logout-all", requireAuth, authHandler.LogoutAll)
+			authRoutes.POST("/password/forgot", authRateLimit, authHandler.ForgotPassword)
+			authRoutes.POST("/password/reset", authRateLimit, authHandler.ResetPassword)
+			authRoutes.POST("/email/verify", authHandler.VerifyEmail)
+			authRoutes.POST("/email/resend", requireAuth, authHandler.ResendVerification)
+			authRoutes.POST("/email/change/confirm", authRateLimit, authHandler.ConfirmEmailChange)
+			authRoutes.POST("/account/delete/confirm", authRateLimit, privacyHandler.ConfirmAccountDeletion)
+
+			// Two-factor authentication; setup and confirm also accept an enrolment challenge token
+			authRoutes.POST("/2fa/verify", authRateLimit, authHandler.VerifyTwoFactor)
+			authRoutes.GET("/2fa", requireAuth, authHandler.GetTwoFactorStatus)
+			authRoutes.POST("/2fa/setup", authRateLimit, optionalAuth, authHandler.SetupTwoFactor)
+			authRoutes.POST("/2fa/confirm", authRateLimit, optionalAuth, authHandler.ConfirmTwoFactor)
+			authRoutes.POST("/2fa/recovery-codes", authRateLimit, requireAuth, authHandler.RegenerateRecoveryCodes)
+			authRoutes.POST("/2fa/disable", authRateLimit, requireAuth, authHandler.DisableTwoFactor)
+
+			// OpenID Connect login; starting while signed in links the identity to the current account
+			authRoutes.GET("/oidc/providers", oidcHandler.GetOIDCProviders)
+			authRoutes.POST("/oidc/:provider/start", authRateLimit, optionalAuth, oidcHandler.StartOIDCLogin)
+			authRoutes.POST("/oidc/callback", authRateLimit, oidcHandler.OIDCCallback)
+			authRoutes.GET("/identities", requireAuth, oidcHandler.GetIdentities)
+			authRoutes.DELETE("/identities/:id", requireAuth, oidcHandler.UnlinkIdentity)
 		}
 		s.logger.Info("[ROUTES] Public auth routes configured.")
 
 		// Public product routes
 		v1.GET("/products", productHandler.GetProducts)
 		v1.GET("/products/:slug", productHandler.GetProduct)
+		v1.GET("/products/:slug/availability", inventoryHandler.GetProductAvailability)
 		s.logger.Info("[ROUTES] Public product routes configured.")
 
 		// Public category routes
@@ -126,6 +301,13 @@ func (s *Server) SetupRoutes() {
 		v1.GET("/categories/:slug", categoryHandler.GetCategory)
 		s.logger.Info("[ROUTES] Public category routes configured.")
 
+		// Bookable services and test rides with their free slots
+		v1.GET("/service-types", bookingHandler.GetServiceTypes)
+		v1.GET("/service-types/:id/slots", bookingHandler.GetSlots)
+
+		// States and union territories accepted in shipping addresses
+		v1.GET("/states", addressHandler.GetStates)
+
 		// Cart routes (public for session-based cart)
 		cart := v1.Group("/cart")
 		{
@@ -139,46 +321,183 @@ func (s *Server) SetupRoutes() {
 
 		        // Public payments webhook (Razorpay)
         v1.POST("/payments/razorpay/webhook", paymentHandler.RazorpayWebhook)
+		// Public courier tracking webhook; the provider authenticates it
+		v1.POST("/shipping/webhook", shipmentHandler.CourierWebhook)
 
 		// Protected routes (require authentication)
 		protected := v1.Group("/")
-		protected.Use(middleware.AuthMiddleware(s.config, s.logger))
+		protected.Use(requireAuth)
 		{
+			// Profile and address book
+			protected.GET("/me", authHandler.GetProfile)
+			protected.PUT("/me", authHandler.UpdateProfile)
+			protected.POST("/me/email", authRateLimit, authHandler.ChangeEmail)
+			protected.POST("/me/password", authRateLimit, authHandler.ChangePassword)
+			protected.GET("/me/addresses", addressHandler.GetAddresses)
+			protected.POST("/me/addresses", addressHandler.CreateAddress)
+			protected.PUT("/me/addresses/:id", addressHandler.UpdateAddress)
+			protected.PUT("/me/addresses/:id/default", addressHandler.SetDefaultAddress)
+			protected.DELETE("/me/addresses/:id", addressHandler.DeleteAddress)
+
+			// Data access and erasure (DPDP)
+			protected.GET("/me/export", authRateLimit, privacyHandler.ExportData)
+			protected.POST("/me/delete", authRateLimit, privacyHandler.RequestAccountDeletion)
+
 			// Order routes
 			protected.GET("/orders", orderHandler.GetOrders)
 			protected.GET("/orders/:id", orderHandler.GetOrder)
-			protected.POST("/orders", orderHandler.CreateOrder)
+			protected.POST("/orders", requireVerified, orderHandler.CreateOrder)
+			protected.POST("/orders/:id/returns", returnHandler.CreateReturn)
+			protected.GET("/returns", returnHandler.GetMyReturns)
+			protected.GET("/returns/:id", returnHandler.GetMyReturn)
+			protected.POST("/returns/:id/photos", returnHandler.UploadReturnPhoto)
+			protected.POST("/returns/:id/ship", returnHandler.ShipReturn)
+			protected.POST("/returns/:id/cancel", returnHandler.CancelReturn)
+			protected.GET("/warranties", warrantyHandler.GetMyWarranties)
+			protected.GET("/warranties/:id", warrantyHandler.GetMyWarranty)
+			protected.PUT("/warranties/:id/serial", warrantyHandler.RegisterFrameSerial)
+			protected.POST("/warranties/:id/claims", warrantyHandler.CreateClaim)
+			protected.GET("/warranty-claims", warrantyHandler.GetMyClaims)
+			protected.GET("/warranty-claims/:id", warrantyHandler.GetMyClaim)
+			protected.POST("/warranty-claims/:id/attachments", warrantyHandler.UploadClaimAttachment)
+			protected.POST("/bookings", requireVerified, bookingHandler.CreateBooking)
+			protected.GET("/bookings", bookingHandler.GetMyBookings)
+			protected.GET("/bookings/:id", bookingHandler.GetMyBooking)
+			protected.POST("/bookings/:id/cancel", bookingHandler.CancelMyBooking)
 
 			            // Payments routes (Razorpay)
-            protected.POST("/payments/razorpay/order", paymentHandler.CreateRazorpayOrder)
+            protected.POST("/payments/razorpay/order", requireVerified, paymentHandler.CreateRazorpayOrder)
             protected.POST("/payments/razorpay/verify", paymentHandler.VerifyRazorpayPayment)
 		}
-		s.logger.Info("[ROUTES] Protected (order) routes configured.")
+		s.logger.Info("[ROUTES] Protected (profile, order) routes configured.")
 
-		// Admin routes (require admin role)
+		// Admin routes (require a staff role; each route checks its own permission)
+		perm := func(p string) gin.HandlerFunc { return middleware.RequirePermission(s.roles, p, s.logger) }
 		admin := v1.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(s.config, s.logger))
-		admin.Use(middleware.AdminMiddleware())
+		// Integrations authenticate with X-API-Key; their scopes are checked by perm()
+		admin.Use(middleware.AuthOrAPIKeyMiddleware(s.tokens, s.sessions, apiKeys, apiKeyLimiter, s.logger))
+		admin.Use(middleware.AdminMiddleware(s.roles, s.logger))
+		if s.config.TwoFactorRequiredForStaff {
+			admin.Use(middleware.RequireTwoFactor(twoFactor, s.logger))
+		}
 		{
 			// Admin product management
-			admin.POST("/products", productHandler.CreateProduct)
-			admin.PUT("/products/:id", productHandler.UpdateProduct)
-			admin.DELETE("/products/:id", productHandler.DeleteProduct)
+			admin.GET("/products", perm(auth.PermProductsWrite), productHandler.GetAdminProducts)
+			admin.POST("/products", perm(auth.PermProductsWrite), productHandler.CreateProduct)
+			admin.POST("/products/import", perm(auth.PermProductsWrite), productHandler.ImportProducts)
+			admin.GET("/products/export", perm(auth.PermProductsWrite), productHandler.ExportProducts)
+			admin.PUT("/products/:id", perm(auth.PermProductsWrite), productHandler.UpdateProduct)
+			admin.DELETE("/products/:id", perm(auth.PermProductsWrite), productHandler.DeleteProduct)
+			admin.POST("/products/:id/restore", perm(auth.PermProductsWrite), productHandler.RestoreProduct)
+			admin.DELETE("/products/:id/purge", perm(auth.PermProductsWrite), productHandler.PurgeProduct)
+			admin.PUT("/products/:id/publication", perm(auth.PermProductsWrite), productHandler.SetProductPublication)
+			admin.GET("/products/preview/:slug", perm(auth.PermProductsWrite), productHandler.PreviewProduct)
+			admin.PUT("/products/:id/sale", perm(auth.PermProductsWrite), productHandler.SetProductSale)
+			admin.DELETE("/products/:id/sale", perm(auth.PermProductsWrite), productHandler.EndProductSale)
+			admin.GET("/products/:id/price-history", perm(auth.PermProductsWrite), productHandler.GetPriceHistory)
+			// Stock ledger
+			admin.GET("/products/:id/stock", perm(auth.PermInventoryManage), inventoryHandler.GetProductStock)
+			admin.GET("/products/:id/stock/movements", perm(auth.PermInventoryManage), inventoryHandler.GetStockMovements)
+			admin.POST("/products/:id/stock/movements", perm(auth.PermInventoryManage), inventoryHandler.RecordStockMovement)
+			admin.GET("/inventory/discrepancies", perm(auth.PermInventoryManage), inventoryHandler.GetStockDiscrepancies)
+			admin.GET("/inventory/low-stock", perm(auth.PermInventoryManage), inventoryHandler.GetLowStock)
+			admin.PUT("/products/:id/reorder", perm(auth.PermInventoryManage), inventoryHandler.SetReorderPoint)
+			// Serialised units; looking one up shows who bought it
+			admin.GET("/products/:id/serials", perm(auth.PermInventoryManage), inventoryHandler.GetProductSerials)
+			admin.POST("/products/:id/serials", perm(auth.PermInventoryManage), inventoryHandler.RegisterSerials)
+			admin.DELETE("/serials/:id", perm(auth.PermInventoryManage), inventoryHandler.DeleteSerial)
+			admin.GET("/serials/:serial", perm(auth.PermOrdersRead), inventoryHandler.LookupSerial)
+			// Stock locations
+			admin.GET("/locations", perm(auth.PermInventoryManage), inventoryHandler.GetLocations)
+			admin.POST("/locations", perm(auth.PermInventoryManage), inventoryHandler.CreateLocation)
+			admin.PUT("/locations/:id", perm(auth.PermInventoryManage), inventoryHandler.UpdateLocation)
+			// Suppliers and purchase orders; receiving is warehouse work and books stock
+			admin.GET("/suppliers", perm(auth.PermPurchasingManage), purchasingHandler.GetSuppliers)
+			admin.POST("/suppliers", perm(auth.PermPurchasingManage), purchasingHandler.CreateSupplier)
+			admin.PUT("/suppliers/:id", perm(auth.PermPurchasingManage), purchasingHandler.UpdateSupplier)
+			admin.GET("/purchase-orders", perm(auth.PermPurchasingManage), purchasingHandler.GetPurchaseOrders)
+			admin.POST("/purchase-orders", perm(auth.PermPurchasingManage), purchasingHandler.CreatePurchaseOrder)
+			admin.GET("/purchase-orders/:id", perm(auth.PermPurchasingManage), purchasingHandler.GetPurchaseOrder)
+			admin.PUT("/purchase-orders/:id", perm(auth.PermPurchasingManage), purchasingHandler.UpdatePurchaseOrder)
+			admin.POST("/purchase-orders/:id/approve", perm(auth.PermPurchasingApprove), purchasingHandler.ApprovePurchaseOrder)
+			admin.POST("/purchase-orders/:id/cancel", perm(auth.PermPurchasingManage), purchasingHandler.CancelPurchaseOrder)
+			admin.POST("/purchase-orders/:id/receipts", perm(auth.PermInventoryManage), purchasingHandler.ReceivePurchaseOrder)
+			admin.GET("/products/:id/cost-history", perm(auth.PermPurchasingManage), purchasingHandler.GetCostHistory)
+			// Order shipments
+			admin.GET("/orders/:id/shipments", perm(auth.PermOrdersRead), shipmentHandler.GetOrderShipments)
+			admin.POST("/orders/:id/shipments", perm(auth.PermOrdersWrite), shipmentHandler.CreateShipment)
+			admin.POST("/shipments/:id/ship", perm(auth.PermOrdersWrite), shipmentHandler.MarkShipmentShipped)
+			admin.POST("/shipments/:id/deliver", perm(auth.PermOrdersWrite), shipmentHandler.MarkShipmentDelivered)
+			admin.POST("/shipments/:id/cancel", perm(auth.PermOrdersWrite), shipmentHandler.CancelShipment)
+			admin.PUT("/shipments/:id/serials", perm(auth.PermOrdersWrite), shipmentHandler.AssignShipmentSerials)
+			admin.POST("/shipments/:id/book", perm(auth.PermOrdersWrite), shipmentHandler.BookShipment)
+			admin.GET("/shipments/:id/label", perm(auth.PermOrdersWrite), shipmentHandler.GetShipmentLabel)
+			// Returns; receiving books stock, refunds move money
+			admin.GET("/returns", perm(auth.PermOrdersRead), returnHandler.GetReturns)
+			admin.GET("/returns/:id", perm(auth.PermOrdersRead), returnHandler.GetReturn)
+			admin.POST("/returns/:id/approve", perm(auth.PermOrdersWrite), returnHandler.ApproveReturn)
+			admin.POST("/returns/:id/reject", perm(auth.PermOrdersWrite), returnHandler.RejectReturn)
+			admin.POST("/returns/:id/ship", perm(auth.PermOrdersWrite), returnHandler.AdminShipReturn)
+			admin.POST("/returns/:id/receive", perm(auth.PermInventoryManage), returnHandler.ReceiveReturn)
+			admin.POST("/returns/:id/refund", perm(auth.PermOrdersRefund), returnHandler.RefundReturn)
+			// Warranties are registered on delivery; staff correct serials and decide claims
+			admin.GET("/warranties", perm(auth.PermOrdersRead), warrantyHandler.GetWarranties)
+			admin.GET("/warranties/:id", perm(auth.PermOrdersRead), warrantyHandler.GetWarranty)
+			admin.PUT("/warranties/:id/serial", perm(auth.PermOrdersWrite), warrantyHandler.UpdateFrameSerial)
+			admin.GET("/warranty-claims", perm(auth.PermOrdersRead), warrantyHandler.GetClaims)
+			admin.GET("/warranty-claims/:id", perm(auth.PermOrdersRead), warrantyHandler.GetClaim)
+			admin.POST("/warranty-claims/:id/status", perm(auth.PermOrdersWrite), warrantyHandler.UpdateClaimStatus)
+			// Service and test-ride bookings
+			admin.GET("/service-types", perm(auth.PermBookingsManage), bookingHandler.GetServiceTypesAdmin)
+			admin.POST("/service-types", perm(auth.PermBookingsManage), bookingHandler.CreateServiceType)
+			admin.PUT("/service-types/:id", perm(auth.PermBookingsManage), bookingHandler.UpdateServiceType)
+			admin.GET("/locations/:id/booking-hours", perm(auth.PermBookingsManage), bookingHandler.GetBookingHours)
+			admin.PUT("/locations/:id/booking-hours", perm(auth.PermBookingsManage), bookingHandler.SetBookingHours)
+			admin.GET("/locations/:id/booking-closures", perm(auth.PermBookingsManage), bookingHandler.GetBookingClosures)
+			admin.POST("/locations/:id/booking-closures", perm(auth.PermBookingsManage), bookingHandler.AddBookingClosure)
+			admin.DELETE("/booking-closures/:id", perm(auth.PermBookingsManage), bookingHandler.DeleteBookingClosure)
+			admin.GET("/bookings", perm(auth.PermBookingsManage), bookingHandler.GetBookingCalendar)
+			admin.GET("/bookings/:id", perm(auth.PermBookingsManage), bookingHandler.GetBooking)
+			admin.POST("/bookings/:id/complete", perm(auth.PermBookingsManage), bookingHandler.CompleteBooking)
+			admin.POST("/bookings/:id/no-show", perm(auth.PermBookingsManage), bookingHandler.MarkBookingNoShow)
+			admin.POST("/bookings/:id/cancel", perm(auth.PermBookingsManage), bookingHandler.CancelBooking)
 			// Product image management
-			admin.POST("/products/:id/images", productHandler.UploadProductImage)
-			admin.DELETE("/products/:id/images/:image_id", productHandler.DeleteProductImage)
-			admin.PUT("/products/:id/images/:image_id/primary", productHandler.SetPrimaryProductImage)
-			
+			admin.POST("/products/:id/images", perm(auth.PermProductsWrite), productHandler.UploadProductImage)
+			admin.DELETE("/products/:id/images/:image_id", perm(auth.PermProductsWrite), productHandler.DeleteProductImage)
+			admin.PUT("/products/:id/images/:image_id/primary", perm(auth.PermProductsWrite), productHandler.SetPrimaryProductImage)
+
 			// Admin category management
-			admin.POST("/categories", categoryHandler.CreateCategory)
-			admin.PUT("/categories/:id", categoryHandler.UpdateCategory)
-			admin.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+			admin.GET("/categories", perm(auth.PermCategoriesWrite), categoryHandler.GetAdminCategories)
+			admin.POST("/categories", perm(auth.PermCategoriesWrite), categoryHandler.CreateCategory)
+			admin.PUT("/categories/:id", perm(auth.PermCategoriesWrite), categoryHandler.UpdateCategory)
+			admin.DELETE("/categories/:id", perm(auth.PermCategoriesWrite), categoryHandler.DeleteCategory)
+			admin.POST("/categories/:id/restore", perm(auth.PermCategoriesWrite), categoryHandler.RestoreCategory)
+			admin.DELETE("/categories/:id/purge", perm(auth.PermCategoriesWrite), categoryHandler.PurgeCategory)
 
 			// Admin user management
-			admin.GET("/users", authHandler.GetUsers)
-			admin.GET("/users/:id", authHandler.GetUser)
-			admin.PUT("/users/:id", authHandler.UpdateUser)
-			admin.DELETE("/users/:id", authHandler.DeleteUser)
+			admin.GET("/users", perm(auth.PermUsersRead), authHandler.GetUsers)
+			admin.GET("/users/:id", perm(auth.PermUsersRead), authHandler.GetUser)
+			admin.PUT("/users/:id", perm(auth.PermUsersWrite), authHandler.UpdateUser)
+			admin.DELETE("/users/:id", perm(auth.PermUsersDelete), authHandler.ArchiveUser)
+			admin.POST("/users/:id/restore", perm(auth.PermUsersDelete), authHandler.RestoreUser)
+			admin.DELETE("/users/:id/purge", perm(auth.PermUsersDelete), privacyHandler.PurgeUser)
+			admin.DELETE("/users/:id/sessions", perm(auth.PermUsersWrite), authHandler.RevokeUserSessions)
+			admin.DELETE("/users/:id/2fa", perm(auth.PermUsersWrite), authHandler.ResetUserTwoFactor)
+
+			// Role and permission management
+			admin.GET("/permissions", perm(auth.PermUsersRead), roleHandler.GetPermissions)
+			admin.GET("/roles", perm(auth.PermUsersRead), roleHandler.GetRoles)
+			admin.POST("/roles", perm(auth.PermRolesManage), roleHandler.CreateRole)
+			admin.PUT("/roles/:name", perm(auth.PermRolesManage), roleHandler.UpdateRole)
+			admin.DELETE("/roles/:name", perm(auth.PermRolesManage), roleHandler.DeleteRole)
+
+			// Audit log
+			admin.GET("/audit", perm(auth.PermAuditRead), auditHandler.GetAuditLog)
+
+			// API keys for server-to-server integrations
+			admin.GET("/api-keys", perm(auth.PermAPIKeysManage), apiKeyHandler.GetAPIKeys)
+			admin.POST("/api-keys", perm(auth.PermAPIKeysManage), apiKeyHandler.CreateAPIKey)
+			admin.DELETE("/api-keys/:id", perm(auth.PermAPIKeysManage), apiKeyHandler.RevokeAPIKey)
 		}
 		s.logger.Info("[ROUTES] Admin routes configured.")
 	}
@@ -207,6 +526,13 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	// Start background jobs; they stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	for _, job := range s.jobs {
+		go job(jobsCtx)
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -214,6 +540,7 @@ func (s *Server) Start() error {
 	<-quit
 
 	s.logger.Info("[SERVER_SHUTDOWN] Received shutdown signal. Shutting down server...")
+	stopJobs()
 
 	// Give outstanding requests 30 seconds to complete
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -0,0 +1,127 @@
+package shipping
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNotSerialised     = errors.New("product is not serialised")
+	ErrTooManySerials    = errors.New("more serial numbers than units of the item in the shipment")
+	ErrSerialUnavailable = errors.New("serial number is not in stock at the shipment's location")
+	ErrSerialsMissing    = errors.New("serialised items need a serial number for every unit")
+)
+
+// SerialAssignment lists the serial numbers of the units of one order item packed in a shipment.
+type SerialAssignment struct {
+	OrderItemID int64    `json:"order_item_id"`
+	Serials     []string `json:"serials"`
+}
+
+// AssignSerials records which units of serialised products are packed in a pending shipment. Each
+// assignment replaces the serial numbers of its item; the units must be in stock at the shipment's location,
+// or the default location when it has none.
+func (s *Store) AssignSerials(id int64, items []SerialAssignment) error {
+	tx, _, err := s.begin(id, StatusPending)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locationID int64
+	err = tx.QueryRow(
+		"SELECT COALESCE(location_id, (SELECT id FROM locations WHERE is_default)) FROM shipments WHERE id = $1",
+		id,
+	).Scan(&locationID)
+	if err != nil {
+		return err
+	}
+
+	seen := map[int64]bool{}
+	for _, it := range items {
+		if seen[it.OrderItemID] {
+			return ErrDuplicateItem
+		}
+		seen[it.OrderItemID] = true
+
+		var itemID, productID int64
+		var qty int
+		var serialised bool
+		err := tx.QueryRow(
+			`SELECT si.id, si.qty, oi.product_id, COALESCE(p.is_serialised, false)
+			 FROM shipment_items si
+			 JOIN order_items oi ON oi.id = si.order_item_id
+			 LEFT JOIN products p ON p.id = oi.product_id
+			 WHERE si.shipment_id = $1 AND si.order_item_id = $2`,
+			id, it.OrderItemID,
+		).Scan(&itemID, &qty, &productID, &serialised)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUnknownItem
+		}
+		if err != nil {
+			return err
+		}
+		if !serialised {
+			return ErrNotSerialised
+		}
+		if len(it.Serials) > qty {
+			return ErrTooManySerials
+		}
+
+		if _, err := tx.Exec("UPDATE serial_numbers SET shipment_item_id = NULL, updated_at = NOW() WHERE shipment_item_id = $1", itemID); err != nil {
+			return err
+		}
+		for _, serial := range it.Serials {
+			result, err := tx.Exec(
+				`UPDATE serial_numbers SET shipment_item_id = $1, updated_at = NOW()
+				 WHERE upper(serial) = upper($2) AND product_id = $3 AND location_id = $4 AND shipment_item_id IS NULL`,
+				itemID, strings.TrimSpace(serial), productID, locationID,
+			)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				return ErrSerialUnavailable
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// rowQuerier is the database or a transaction
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// checkSerials returns ErrSerialsMissing unless every unit of a serialised product in the shipment has a
+// serial number
+func checkSerials(q rowQuerier, id int64) error {
+	var missing bool
+	err := q.QueryRow(
+		`SELECT EXISTS (
+		     SELECT 1 FROM shipment_items si
+		     JOIN order_items oi ON oi.id = si.order_item_id
+		     JOIN products p ON p.id = oi.product_id
+		     WHERE si.shipment_id = $1 AND p.is_serialised
+		       AND si.qty > (SELECT COUNT(*) FROM serial_numbers sn WHERE sn.shipment_item_id = si.id))`,
+		id,
+	).Scan(&missing)
+	if err != nil {
+		return err
+	}
+	if missing {
+		return ErrSerialsMissing
+	}
+	return nil
+}
+
+// releaseSerials puts the units packed in a cancelled shipment back in stock
+func releaseSerials(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec(
+		`UPDATE serial_numbers SET shipment_item_id = NULL, updated_at = NOW()
+		 WHERE shipment_item_id IN (SELECT id FROM shipment_items WHERE shipment_id = $1)`,
+		id,
+	)
+	return err
+}
@@ -0,0 +1,381 @@
+package shipping
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Shipment is a parcel sent for an order.
+type Shipment struct {
+	ID           int64   `json:"id"`
+	OrderID      int64   `json:"order_id"`
+	LocationID   *int64  `json:"location_id,omitempty"`
+	LocationName *string `json:"location_name,omitempty"`
+	Status       Status  `json:"status"`
+	Courier      *string `json:"courier,omitempty"`
+	AWBNumber    *string `json:"awb_number,omitempty"`
+	TrackingURL  *string `json:"tracking_url,omitempty"`
+	ShippedAt    *string `json:"shipped_at,omitempty"`
+	DeliveredAt  *string `json:"delivered_at,omitempty"`
+	CreatedAt    string  `json:"created_at"`
+	UpdatedAt    *string `json:"updated_at,omitempty"`
+	// Provider and ProviderRef are set when the shipment was booked through a courier aggregator
+	Provider    *string `json:"provider,omitempty"`
+	ProviderRef *string `json:"provider_ref,omitempty"`
+	Items       []Item  `json:"items"`
+	Events      []Event `json:"events,omitempty"`
+}
+
+// Item is the quantity of one order item packed in a shipment.
+type Item struct {
+	OrderItemID int64  `json:"order_item_id"`
+	ProductID   int64  `json:"product_id"`
+	Title       string `json:"title"`
+	Qty         int    `json:"qty"`
+	// Serials are the serial numbers of the units packed, for serialised products
+	Serials []string `json:"serials,omitempty"`
+}
+
+// NewShipment describes a shipment to create. A zero LocationID leaves the origin unset, and no items
+// means everything on the order that is not in a shipment yet.
+type NewShipment struct {
+	LocationID  int64
+	Courier     *string
+	AWBNumber   *string
+	TrackingURL *string
+	Items       []ItemQty
+	CreatedBy   int64
+}
+
+type ItemQty struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Qty         int   `json:"qty"`
+}
+
+// Tracking is the courier's reference for a shipment. Nil fields keep the value already on the shipment.
+type Tracking struct {
+	Courier     *string
+	AWBNumber   *string
+	TrackingURL *string
+}
+
+const shipmentQuery = `
+	SELECT s.id, s.order_id, s.location_id, l.name, s.status, s.courier, s.awb_number, s.tracking_url,
+	       s.shipped_at, s.delivered_at, s.created_at, s.updated_at, s.provider, s.provider_ref
+	FROM shipments s
+	LEFT JOIN locations l ON l.id = s.location_id`
+
+func scanShipment(row interface{ Scan(...interface{}) error }) (*Shipment, error) {
+	var s Shipment
+	err := row.Scan(&s.ID, &s.OrderID, &s.LocationID, &s.LocationName, &s.Status, &s.Courier, &s.AWBNumber,
+		&s.TrackingURL, &s.ShippedAt, &s.DeliveredAt, &s.CreatedAt, &s.UpdatedAt, &s.Provider, &s.ProviderRef)
+	if err != nil {
+		return nil, err
+	}
+	s.Items = []Item{}
+	return &s, nil
+}
+
+// Shipments returns the shipments of an order with their items and tracking events, oldest first.
+func (s *Store) Shipments(orderID int64) ([]Shipment, error) {
+	rows, err := s.db.Query(shipmentQuery+" WHERE s.order_id = $1 ORDER BY s.id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	list := []Shipment{}
+	index := map[int64]int{}
+	for rows.Next() {
+		sh, err := scanShipment(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[sh.ID] = len(list)
+		list = append(list, *sh)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	if err := s.loadEvents(orderID, list, index); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(
+		`SELECT si.shipment_id, si.order_item_id, oi.product_id, COALESCE(p.title, ''), si.qty,
+		        ARRAY(SELECT sn.serial FROM serial_numbers sn WHERE sn.shipment_item_id = si.id ORDER BY sn.id)
+		 FROM shipment_items si
+		 JOIN shipments s ON s.id = si.shipment_id
+		 JOIN order_items oi ON oi.id = si.order_item_id
+		 LEFT JOIN products p ON p.id = oi.product_id
+		 WHERE s.order_id = $1
+		 ORDER BY si.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var shipmentID int64
+		var it Item
+		if err := rows.Scan(&shipmentID, &it.OrderItemID, &it.ProductID, &it.Title, &it.Qty, pq.Array(&it.Serials)); err != nil {
+			return nil, err
+		}
+		if i, ok := index[shipmentID]; ok {
+			list[i].Items = append(list[i].Items, it)
+		}
+	}
+	return list, rows.Err()
+}
+
+// Shipment returns a shipment with its items, or sql.ErrNoRows.
+func (s *Store) Shipment(id int64) (*Shipment, error) {
+	var orderID int64
+	if err := s.db.QueryRow("SELECT order_id FROM shipments WHERE id = $1", id).Scan(&orderID); err != nil {
+		return nil, err
+	}
+	list, err := s.Shipments(orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Create adds a pending shipment to a paid order and returns its ID. The items must still be unshipped:
+// quantities in pending, shipped and delivered shipments count, cancelled ones do not.
+// It returns sql.ErrNoRows for an unknown order.
+func (s *Store) Create(orderID int64, n NewShipment) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRow("SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&status); err != nil {
+		return 0, err
+	}
+	if status != OrderPaid && status != OrderPartiallyShipped {
+		return 0, ErrOrderNotShippable
+	}
+
+	if n.LocationID != 0 {
+		var active bool
+		err := tx.QueryRow("SELECT is_active FROM locations WHERE id = $1", n.LocationID).Scan(&active)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !active) {
+			return 0, ErrUnknownLocation
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	remaining, err := unshipped(tx, orderID)
+	if err != nil {
+		return 0, err
+	}
+	items := n.Items
+	if len(items) == 0 {
+		for id, qty := range remaining {
+			if qty > 0 {
+				items = append(items, ItemQty{OrderItemID: id, Qty: qty})
+			}
+		}
+		if len(items) == 0 {
+			return 0, ErrNothingToShip
+		}
+	}
+	seen := map[int64]bool{}
+	for _, it := range items {
+		left, ok := remaining[it.OrderItemID]
+		if !ok {
+			return 0, ErrUnknownItem
+		}
+		if seen[it.OrderItemID] {
+			return 0, ErrDuplicateItem
+		}
+		seen[it.OrderItemID] = true
+		if it.Qty <= 0 || it.Qty > left {
+			return 0, ErrOverShipment
+		}
+	}
+
+	var id int64
+	err = tx.QueryRow(
+		`INSERT INTO shipments (order_id, location_id, courier, awb_number, tracking_url, created_by)
+		 VALUES ($1, NULLIF($2::bigint, 0), $3, $4, $5, NULLIF($6::bigint, 0)) RETURNING id`,
+		orderID, n.LocationID, n.Courier, n.AWBNumber, n.TrackingURL, n.CreatedBy,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicateAWB
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		_, err := tx.Exec(
+			"INSERT INTO shipment_items (shipment_id, order_item_id, qty) VALUES ($1, $2, $3)",
+			id, it.OrderItemID, it.Qty,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// unshipped returns the quantity of each order item not yet in a shipment
+func unshipped(tx *sql.Tx, orderID int64) (map[int64]int, error) {
+	rows, err := tx.Query(
+		`SELECT oi.id, oi.qty - COALESCE((
+		        SELECT SUM(si.qty) FROM shipment_items si JOIN shipments s ON s.id = si.shipment_id
+		        WHERE si.order_item_id = oi.id AND s.status <> 'cancelled'), 0)
+		 FROM order_items oi WHERE oi.order_id = $1`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	remaining := map[int64]int{}
+	for rows.Next() {
+		var id int64
+		var qty int
+		if err := rows.Scan(&id, &qty); err != nil {
+			return nil, err
+		}
+		remaining[id] = qty
+	}
+	return remaining, rows.Err()
+}
+
+// Ship marks a pending shipment as handed to the courier. The courier and AWB number must be known by now,
+// and every serialised unit must have its serial number. It returns the order's new status.
+func (s *Store) Ship(id int64, t Tracking) (string, error) {
+	tx, orderID, err := s.begin(id, StatusPending)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var courier, awb *string
+	err = tx.QueryRow(
+		`UPDATE shipments SET courier = COALESCE($2, courier), awb_number = COALESCE($3, awb_number),
+		        tracking_url = COALESCE($4, tracking_url), updated_at = NOW()
+		 WHERE id = $1 RETURNING courier, awb_number`,
+		id, t.Courier, t.AWBNumber, t.TrackingURL,
+	).Scan(&courier, &awb)
+	if isUniqueViolation(err) {
+		return "", ErrDuplicateAWB
+	}
+	if err != nil {
+		return "", err
+	}
+	if courier == nil || awb == nil {
+		return "", ErrTrackingRequired
+	}
+	if err := checkSerials(tx, id); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE shipments SET status = $2, shipped_at = NOW() WHERE id = $1", id, StatusShipped); err != nil {
+		return "", err
+	}
+	return s.finish(tx, orderID)
+}
+
+// Deliver marks a shipped shipment as delivered, registers the warranties of its items and returns the
+// order's new status.
+func (s *Store) Deliver(id int64) (string, error) {
+	tx, orderID, err := s.begin(id, StatusShipped)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE shipments SET status = $2, delivered_at = NOW(), updated_at = NOW() WHERE id = $1",
+		id, StatusDelivered,
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := s.warranties.Register(tx, id); err != nil {
+		return "", err
+	}
+	return s.finish(tx, orderID)
+}
+
+// Cancel cancels a pending shipment so its items can be shipped again and its serialised units go back in
+// stock. Shipped parcels come back as returns.
+func (s *Store) Cancel(id int64) (string, error) {
+	tx, orderID, err := s.begin(id, StatusPending)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE shipments SET status = $2, updated_at = NOW() WHERE id = $1", id, StatusCancelled); err != nil {
+		return "", err
+	}
+	if err := releaseSerials(tx, id); err != nil {
+		return "", err
+	}
+	return s.finish(tx, orderID)
+}
+
+// begin starts a transaction that locks the shipment and checks that it is in one of the allowed statuses.
+// It returns sql.ErrNoRows for an unknown shipment.
+func (s *Store) begin(id int64, allowed ...Status) (*sql.Tx, int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	orderID, status, err := lock(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+	for _, a := range allowed {
+		if status == a {
+			return tx, orderID, nil
+		}
+	}
+	tx.Rollback()
+	return nil, 0, ErrWrongStatus
+}
+
+// lock locks the shipment's order, then the shipment, so order status updates do not interleave.
+// It returns the order ID and the shipment's status.
+func lock(tx *sql.Tx, id int64) (int64, Status, error) {
+	var orderID int64
+	var status Status
+	err := tx.QueryRow("SELECT order_id FROM shipments WHERE id = $1", id).Scan(&orderID)
+	if err == nil {
+		_, err = tx.Exec("SELECT 1 FROM orders WHERE id = $1 FOR UPDATE", orderID)
+	}
+	if err == nil {
+		err = tx.QueryRow("SELECT status FROM shipments WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	}
+	return orderID, status, err
+}
+
+// finish updates the order's status and commits
+func (s *Store) finish(tx *sql.Tx, orderID int64) (string, error) {
+	status, err := syncOrderStatus(tx, orderID)
+	if err != nil {
+		return "", err
+	}
+	return status, tx.Commit()
+}
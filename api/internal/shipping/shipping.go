@@ -0,0 +1,105 @@
+// Package shipping manages the shipments an order is delivered in. An order can ship in several parcels;
+// its status follows from how much of it has been shipped and delivered.
+package shipping
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/database"
+	"finspeed/api/internal/warranty"
+)
+
+// Status is the lifecycle state of a shipment.
+type Status string
+
+const (
+	StatusPending   Status = "pending" // being packed, not yet with the courier
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+)
+
+// Order statuses set from shipments. Orders become shippable once paid.
+const (
+	OrderPaid             = "paid"
+	OrderPartiallyShipped = "partially_shipped"
+	OrderShipped          = "shipped"
+	OrderDelivered        = "delivered"
+)
+
+var (
+	ErrWrongStatus       = errors.New("shipment status does not allow this")
+	ErrOrderNotShippable = errors.New("order is not paid or already fully shipped")
+	ErrUnknownItem       = errors.New("item does not belong to the order")
+	ErrDuplicateItem     = errors.New("an order item appears more than once")
+	ErrOverShipment      = errors.New("quantity exceeds what is left to ship")
+	ErrNothingToShip     = errors.New("every item is already in a shipment")
+	ErrUnknownLocation   = errors.New("unknown or inactive location")
+	ErrTrackingRequired  = errors.New("courier and AWB number are required to ship")
+	ErrDuplicateAWB      = errors.New("AWB number is already used for this courier")
+)
+
+// ValidStatus reports whether s is a known status.
+func ValidStatus(s Status) bool {
+	switch s {
+	case StatusPending, StatusShipped, StatusDelivered, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Store reads and writes shipments. Delivered shipments register their warranties.
+type Store struct {
+	db         *database.DB
+	warranties *warranty.Store
+}
+
+func NewStore(db *database.DB, warranties *warranty.Store) *Store {
+	return &Store{db: db, warranties: warranties}
+}
+
+// syncOrderStatus derives the order's status from its shipped and delivered quantities and stores it.
+// Orders that are not paid yet, cancelled or refunded keep their status. It returns the order's status.
+func syncOrderStatus(tx *sql.Tx, orderID int64) (string, error) {
+	var ordered, shipped, delivered int
+	err := tx.QueryRow(
+		`SELECT (SELECT COALESCE(SUM(qty), 0) FROM order_items WHERE order_id = $1),
+		        COALESCE(SUM(si.qty) FILTER (WHERE s.status IN ('shipped', 'delivered')), 0),
+		        COALESCE(SUM(si.qty) FILTER (WHERE s.status = 'delivered'), 0)
+		 FROM shipments s JOIN shipment_items si ON si.shipment_id = s.id
+		 WHERE s.order_id = $1`,
+		orderID,
+	).Scan(&ordered, &shipped, &delivered)
+	if err != nil {
+		return "", err
+	}
+
+	status := OrderPaid
+	switch {
+	case ordered > 0 && delivered == ordered:
+		status = OrderDelivered
+	case ordered > 0 && shipped == ordered:
+		status = OrderShipped
+	case shipped > 0:
+		status = OrderPartiallyShipped
+	}
+
+	var current string
+	err = tx.QueryRow(
+		`UPDATE orders SET status = $2 WHERE id = $1 AND status IN ($3, $4, $5, $6) RETURNING status`,
+		orderID, status, OrderPaid, OrderPartiallyShipped, OrderShipped, OrderDelivered,
+	).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRow("SELECT status FROM orders WHERE id = $1", orderID).Scan(&current)
+	}
+	return current, err
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
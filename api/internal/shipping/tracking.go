@@ -0,0 +1,277 @@
+package shipping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"finspeed/api/internal/courier"
+)
+
+var ErrAlreadyBooked = errors.New("shipment is already booked with a courier")
+
+// Event is a tracking update from the courier.
+type Event struct {
+	Status      courier.Status `json:"status"`
+	Description *string        `json:"description,omitempty"`
+	Location    *string        `json:"location,omitempty"`
+	OccurredAt  string         `json:"occurred_at"`
+}
+
+// Update is the outcome of applying a tracking event.
+type Update struct {
+	ShipmentID int64
+	OrderID    int64
+	// Duplicate is set for events that were already recorded; nothing else changed
+	Duplicate   bool
+	Status      Status
+	Changed     bool // the shipment's status changed
+	OrderStatus string
+	// SerialsMissing is set when the event would have moved a pending shipment on but serialised units
+	// in it have no serial number; the event is recorded and the shipment stays pending
+	SerialsMissing bool
+}
+
+// loadEvents adds the tracking events of an order's shipments to list, oldest first
+func (s *Store) loadEvents(orderID int64, list []Shipment, index map[int64]int) error {
+	rows, err := s.db.Query(
+		`SELECT e.shipment_id, e.status, e.description, e.location, e.occurred_at
+		 FROM shipment_events e JOIN shipments s ON s.id = e.shipment_id
+		 WHERE s.order_id = $1
+		 ORDER BY e.occurred_at, e.id`,
+		orderID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var shipmentID int64
+		var e Event
+		if err := rows.Scan(&shipmentID, &e.Status, &e.Description, &e.Location, &e.OccurredAt); err != nil {
+			return err
+		}
+		if i, ok := index[shipmentID]; ok {
+			list[i].Events = append(list[i].Events, e)
+		}
+	}
+	return rows.Err()
+}
+
+// BookingRequest builds the courier booking for a pending shipment that is not booked yet and fully packed,
+// serial numbers included. The pickup is the code of the shipment's location, or of the default location
+// when it has none.
+func (s *Store) BookingRequest(id int64, parcel courier.Parcel) (*courier.Request, error) {
+	var orderID int64
+	var status Status
+	var ref *string
+	var pickup string
+	var orderedAt time.Time
+	var subTotal float64
+	var email string
+	var addrJSON []byte
+	err := s.db.QueryRow(
+		`SELECT s.order_id, s.status, s.provider_ref,
+		        COALESCE(l.code, (SELECT code FROM locations WHERE is_default)), o.created_at, o.subtotal,
+		        u.email, o.shipping_address_json
+		 FROM shipments s
+		 JOIN orders o ON o.id = s.order_id
+		 JOIN users u ON u.id = o.user_id
+		 LEFT JOIN locations l ON l.id = s.location_id
+		 WHERE s.id = $1`,
+		id,
+	).Scan(&orderID, &status, &ref, &pickup, &orderedAt, &subTotal, &email, &addrJSON)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusPending {
+		return nil, ErrWrongStatus
+	}
+	if ref != nil {
+		return nil, ErrAlreadyBooked
+	}
+	if err := checkSerials(s.db, id); err != nil {
+		return nil, err
+	}
+
+	req := &courier.Request{
+		Reference: fmt.Sprintf("%d-%d", orderID, id),
+		OrderedAt: orderedAt,
+		Pickup:    pickup,
+		SubTotal:  subTotal,
+		Parcel:    parcel,
+	}
+	var addr struct {
+		Name     string `json:"name"`
+		Phone    string `json:"phone"`
+		Address1 string `json:"address1"`
+		Address2 string `json:"address2"`
+		City     string `json:"city"`
+		State    string `json:"state"`
+		Pincode  string `json:"pincode"`
+		Country  string `json:"country"`
+	}
+	if err := json.Unmarshal(addrJSON, &addr); err != nil {
+		return nil, fmt.Errorf("order %d has no readable shipping address: %w", orderID, err)
+	}
+	req.Customer = courier.Address{
+		Name: addr.Name, Phone: addr.Phone, Email: email,
+		Address1: addr.Address1, Address2: addr.Address2,
+		City: addr.City, State: addr.State, Pincode: addr.Pincode, Country: addr.Country,
+	}
+	if req.Customer.Country == "" {
+		req.Customer.Country = "India"
+	}
+
+	rows, err := s.db.Query(
+		`SELECT COALESCE(p.title, ''), COALESCE(p.sku, ''), si.qty, oi.price_each
+		 FROM shipment_items si
+		 JOIN order_items oi ON oi.id = si.order_item_id
+		 LEFT JOIN products p ON p.id = oi.product_id
+		 WHERE si.shipment_id = $1
+		 ORDER BY si.id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it courier.Item
+		if err := rows.Scan(&it.Name, &it.SKU, &it.Qty, &it.Price); err != nil {
+			return nil, err
+		}
+		req.Items = append(req.Items, it)
+	}
+	return req, rows.Err()
+}
+
+// SetBooking stores the provider's booking on a pending shipment.
+func (s *Store) SetBooking(id int64, provider string, b courier.Booking) error {
+	tx, _, err := s.begin(id, StatusPending)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE shipments SET provider = $2, provider_ref = $3, courier = $4, awb_number = $5,
+		        tracking_url = NULLIF($6, ''), updated_at = NOW()
+		 WHERE id = $1 AND provider_ref IS NULL`,
+		id, provider, b.Ref, b.Courier, b.AWBNumber, b.TrackingURL,
+	)
+	if isUniqueViolation(err) {
+		return ErrDuplicateAWB
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAlreadyBooked
+	}
+	return tx.Commit()
+}
+
+// ApplyEvent records a tracking event for the shipment the provider booked under the event's AWB number
+// and moves the shipment along: any sign of movement means it shipped, and a cancellation only applies
+// before pickup. As with Ship, a pending shipment only moves on once every serialised unit has its serial
+// number. Delivered shipments register their warranties and cancelled ones release their serial numbers.
+// It returns sql.ErrNoRows if no shipment matches.
+func (s *Store) ApplyEvent(provider string, ev courier.Event) (*Update, error) {
+	var id int64
+	err := s.db.QueryRow("SELECT id FROM shipments WHERE provider = $1 AND awb_number = $2", provider, ev.AWBNumber).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	orderID, status, err := lock(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	u := &Update{ShipmentID: id, OrderID: orderID, Status: status}
+
+	result, err := tx.Exec(
+		`INSERT INTO shipment_events (shipment_id, status, description, location, occurred_at)
+		 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+		 ON CONFLICT (shipment_id, status, occurred_at) DO NOTHING`,
+		id, ev.Status, ev.Description, ev.Location, ev.OccurredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		u.Duplicate = true
+		return u, nil
+	}
+
+	next := status
+	switch ev.Status {
+	case courier.StatusDelivered:
+		if status == StatusPending || status == StatusShipped {
+			next = StatusDelivered
+		}
+	case courier.StatusCancelled:
+		if status == StatusPending {
+			next = StatusCancelled
+		}
+	default:
+		if status == StatusPending {
+			next = StatusShipped
+		}
+	}
+	if status == StatusPending && (next == StatusShipped || next == StatusDelivered) {
+		err := checkSerials(tx, id)
+		if errors.Is(err, ErrSerialsMissing) {
+			next = status
+			u.SerialsMissing = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if next != status {
+		_, err := tx.Exec(
+			`UPDATE shipments SET status = $2, updated_at = NOW(),
+			        shipped_at = CASE WHEN $2 IN ('shipped', 'delivered') THEN COALESCE(shipped_at, $3) ELSE shipped_at END,
+			        delivered_at = CASE WHEN $2 = 'delivered' THEN $3 ELSE delivered_at END
+			 WHERE id = $1`,
+			id, next, ev.OccurredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		switch next {
+		case StatusDelivered:
+			if err := s.warranties.Register(tx, id); err != nil {
+				return nil, err
+			}
+		case StatusCancelled:
+			if err := releaseSerials(tx, id); err != nil {
+				return nil, err
+			}
+		}
+		u.Status = next
+		u.Changed = true
+	}
+
+	if u.OrderStatus, err = syncOrderStatus(tx, orderID); err != nil {
+		return nil, err
+	}
+	return u, tx.Commit()
+}
+
+// Recipient returns the email address of the customer who placed the order and the name on its address.
+func (s *Store) Recipient(orderID int64) (string, string, error) {
+	var email, name string
+	err := s.db.QueryRow(
+		`SELECT u.email, COALESCE(o.shipping_address_json->>'name', u.name, '')
+		 FROM orders o JOIN users u ON u.id = o.user_id WHERE o.id = $1`,
+		orderID,
+	).Scan(&email, &name)
+	return email, name, err
+}
@@ -0,0 +1,126 @@
+// Package spreadsheet reads and writes simple tables as CSV or XLSX. Only the first worksheet of a
+// workbook is read and every cell is treated as text; formatting, formulas and dates are not interpreted.
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a supported file format.
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// MaxColumns is the most columns a row can have. Cells further right are rejected rather than padded out.
+const MaxColumns = 256
+
+var (
+	ErrUnsupportedFormat = errors.New("only .csv and .xlsx files are supported")
+	ErrTooManyRows       = errors.New("the file has too many rows")
+	ErrTooManyColumns    = fmt.Errorf("rows can have at most %d columns", MaxColumns)
+)
+
+// utf8BOM is written by Excel at the start of UTF-8 CSV files, and needed by Excel to read them as UTF-8
+const utf8BOM = "\ufeff"
+
+// FormatOf returns the format matching a file name's extension.
+func FormatOf(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CSV, nil
+	case ".xlsx":
+		return XLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Row is a non-empty row and the line it was read from, for error messages.
+type Row struct {
+	Line  int
+	Cells []string
+}
+
+// Read returns the non-empty rows of data in the given format. It stops with ErrTooManyRows once there
+// are more than maxRows of them.
+func Read(f Format, data []byte, maxRows int) ([]Row, error) {
+	switch f {
+	case CSV:
+		return readCSV(data, maxRows)
+	case XLSX:
+		return readXLSX(data, maxRows)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// Write writes the rows in the given format. sheet names the worksheet of an XLSX file.
+func Write(w io.Writer, f Format, sheet string, rows [][]string) error {
+	switch f {
+	case CSV:
+		return writeCSV(w, rows)
+	case XLSX:
+		return writeXLSX(w, sheet, rows)
+	}
+	return ErrUnsupportedFormat
+}
+
+func readCSV(data []byte, maxRows int) ([]Row, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte(utf8BOM))))
+	r.FieldsPerRecord = -1
+	var rows []Row
+	for {
+		cells, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(cells) > MaxColumns {
+			return nil, ErrTooManyColumns
+		}
+		if !isBlank(cells) {
+			if len(rows) == maxRows {
+				return nil, ErrTooManyRows
+			}
+			line, _ := r.FieldPos(0)
+			rows = append(rows, Row{Line: line, Cells: cells})
+		}
+	}
+}
+
+func isBlank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
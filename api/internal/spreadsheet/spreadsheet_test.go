@@ -0,0 +1,126 @@
+package spreadsheet
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		maxRows int
+		want    []Row
+		wantErr error
+	}{
+		{
+			name:    "rows keep their line numbers",
+			data:    "sku,name\nA1,Frame\n",
+			maxRows: 10,
+			want:    []Row{{Line: 1, Cells: []string{"sku", "name"}}, {Line: 2, Cells: []string{"A1", "Frame"}}},
+		},
+		{
+			name:    "byte order mark is stripped",
+			data:    utf8BOM + "sku\n",
+			maxRows: 10,
+			want:    []Row{{Line: 1, Cells: []string{"sku"}}},
+		},
+		{
+			name:    "blank rows are skipped",
+			data:    "sku\n , \nA1\n",
+			maxRows: 10,
+			want:    []Row{{Line: 1, Cells: []string{"sku"}}, {Line: 3, Cells: []string{"A1"}}},
+		},
+		{
+			name:    "rows may differ in length",
+			data:    "a,b,c\nd\n",
+			maxRows: 10,
+			want:    []Row{{Line: 1, Cells: []string{"a", "b", "c"}}, {Line: 2, Cells: []string{"d"}}},
+		},
+		{
+			name:    "quoted field spanning lines",
+			data:    "\"one\ntwo\",x\ny\n",
+			maxRows: 10,
+			want:    []Row{{Line: 1, Cells: []string{"one\ntwo", "x"}}, {Line: 3, Cells: []string{"y"}}},
+		},
+		{
+			name:    "exactly the row limit",
+			data:    "a\nb\n",
+			maxRows: 2,
+			want:    []Row{{Line: 1, Cells: []string{"a"}}, {Line: 2, Cells: []string{"b"}}},
+		},
+		{
+			name:    "blank rows do not count towards the limit",
+			data:    "a\n,\nb\n",
+			maxRows: 2,
+			want:    []Row{{Line: 1, Cells: []string{"a"}}, {Line: 3, Cells: []string{"b"}}},
+		},
+		{
+			name:    "over the row limit",
+			data:    "a\nb\nc\n",
+			maxRows: 2,
+			wantErr: ErrTooManyRows,
+		},
+		{
+			name:    "at the column limit",
+			data:    strings.Repeat("x,", MaxColumns-1) + "x\n",
+			maxRows: 10,
+			want:    []Row{{Line: 1, Cells: strings.Split(strings.Repeat("x,", MaxColumns-1)+"x", ",")}},
+		},
+		{
+			name:    "over the column limit",
+			data:    strings.Repeat("x,", MaxColumns) + "x\n",
+			maxRows: 10,
+			wantErr: ErrTooManyColumns,
+		},
+		{
+			name:    "empty file",
+			data:    "",
+			maxRows: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCSV([]byte(tt.data), tt.maxRows)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readCSV error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readCSV: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readCSV = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVMalformed(t *testing.T) {
+	if _, err := readCSV([]byte("\"unterminated\n"), 10); err == nil {
+		t.Error("readCSV accepted an unterminated quote")
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     Format
+		wantErr  error
+	}{
+		{"products.csv", CSV, nil},
+		{"Products.XLSX", XLSX, nil},
+		{"products.xls", "", ErrUnsupportedFormat},
+		{"products", "", ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		got, err := FormatOf(tt.filename)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("FormatOf(%q) = (%q, %v), want (%q, %v)", tt.filename, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr error
+	}{
+		{"A1", 0, nil},
+		{"Z1", 25, nil},
+		{"AA1", 26, nil},
+		{"AZ10", 51, nil},
+		{"IV1", MaxColumns - 1, nil},
+		{"IW1", 0, ErrTooManyColumns},
+		{"XFD1", 0, ErrTooManyColumns},
+	}
+	for _, tt := range tests {
+		got, err := columnIndex(tt.ref)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("columnIndex(%q) = (%d, %v), want (%d, %v)", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestColumnIndexInvalid(t *testing.T) {
+	for _, ref := range []string{"", "1", "a1", "ABCD1"} {
+		if _, err := columnIndex(ref); err == nil || errors.Is(err, ErrTooManyColumns) {
+			t.Errorf("columnIndex(%q) error = %v, want an invalid reference error", ref, err)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for col := 0; col < MaxColumns; col++ {
+		got, err := columnIndex(columnName(col) + "1")
+		if err != nil || got != col {
+			t.Fatalf("columnIndex(columnName(%d)) = (%d, %v)", col, got, err)
+		}
+	}
+}
+
+func TestReadXLSXRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"sku", "name", "price"},
+		{"007", "Frame & fork", "199.99"},
+		{"", "", ""},
+		{"", "", "gap"},
+	}
+	var b bytes.Buffer
+	if err := writeXLSX(&b, "Products", rows); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readXLSX(b.Bytes(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{
+		{Line: 1, Cells: []string{"sku", "name", "price"}},
+		{Line: 2, Cells: []string{"007", "Frame & fork", "199.99"}},
+		{Line: 4, Cells: []string{"", "", "gap"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readXLSX = %v, want %v", got, want)
+	}
+}
+
+// workbook builds a minimal workbook around the given sheetData and shared strings
+func workbook(t *testing.T, sheetData, sharedStrings string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": xlsxWorkbookRels,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	if sharedStrings != "" {
+		parts["xl/sharedStrings.xml"] = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			sharedStrings + `</sst>`
+	}
+	for name, content := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+	tests := []struct {
+		name      string
+		sheetData string
+		shared    string
+		maxRows   int
+		want      []Row
+		wantErr   error
+	}{
+		{
+			name:      "cell types",
+			sheetData: `<row r="1"><c r="A1" t="s"><v>1</v></c><c r="B1"><v>199.99000000000001</v></c><c r="C1" t="b"><v>1</v></c></row>`,
+			shared:    `<si><t>unused</t></si><si><r><t>Rich </t></r><r><t>text</t></r></si>`,
+			maxRows:   10,
+			want:      []Row{{Line: 1, Cells: []string{"Rich text", "199.99", "true"}}},
+		},
+		{
+			name:      "cells without references fill in order",
+			sheetData: `<row><c t="inlineStr"><is><t>a</t></is></c><c t="inlineStr"><is><t>b</t></is></c></row>`,
+			maxRows:   10,
+			want:      []Row{{Line: 1, Cells: []string{"a", "b"}}},
+		},
+		{
+			name:      "skipped columns are padded",
+			sheetData: `<row r="3"><c r="C3"><v>5</v></c></row>`,
+			maxRows:   10,
+			want:      []Row{{Line: 3, Cells: []string{"", "", "5"}}},
+		},
+		{
+			name:      "last column",
+			sheetData: `<row r="1"><c r="IV1"><v>1</v></c></row>`,
+			maxRows:   10,
+			want:      []Row{{Line: 1, Cells: append(make([]string, MaxColumns-1), "1")}},
+		},
+		{
+			name:      "column past the limit",
+			sheetData: `<row r="1"><c r="A1"><v>1</v></c><c r="XFD1"><v>1</v></c></row>`,
+			maxRows:   10,
+			wantErr:   ErrTooManyColumns,
+		},
+		{
+			name:      "unreferenced cells past the limit",
+			sheetData: `<row r="1">` + strings.Repeat(`<c><v>1</v></c>`, MaxColumns+1) + `</row>`,
+			maxRows:   10,
+			wantErr:   ErrTooManyColumns,
+		},
+		{
+			name:      "over the row limit",
+			sheetData: `<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2"><v>2</v></c></row>`,
+			maxRows:   1,
+			wantErr:   ErrTooManyRows,
+		},
+		{
+			name:      "blank rows do not count towards the limit",
+			sheetData: `<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2" t="inlineStr"><is><t> </t></is></c></row>`,
+			maxRows:   1,
+			want:      []Row{{Line: 1, Cells: []string{"1"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readXLSX(workbook(t, tt.sheetData, tt.shared), tt.maxRows)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readXLSX error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readXLSX: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readXLSX = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSXInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("sku,name\n")},
+		{"missing shared string", workbook(t, `<row r="1"><c r="A1" t="s"><v>3</v></c></row>`, "")},
+		{"bad cell reference", workbook(t, `<row r="1"><c r="1A"><v>1</v></c></row>`, "")},
+	}
+	for _, tt := range tests {
+		if _, err := readXLSX(tt.data, 10); err == nil {
+			t.Errorf("%s: readXLSX accepted the workbook", tt.name)
+		}
+	}
+}
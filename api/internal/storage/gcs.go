@@ -41,7 +41,19 @@ func (s *GCSStorage) publicURL(object string) string {
 }
 
 func (s *GCSStorage) SaveProductImage(ctx context.Context, productID int64, filename string, contentType string, r io.Reader) (string, error) {
-	object := path.Join("products", fmt.Sprint(productID), filename)
+	return s.save(ctx, path.Join("products", fmt.Sprint(productID), filename), contentType, r)
+}
+
+func (s *GCSStorage) SaveReturnPhoto(ctx context.Context, returnID int64, filename string, contentType string, r io.Reader) (string, error) {
+	return s.save(ctx, path.Join("returns", fmt.Sprint(returnID), filename), contentType, r)
+}
+
+func (s *GCSStorage) SaveClaimAttachment(ctx context.Context, claimID int64, filename string, contentType string, r io.Reader) (string, error) {
+	return s.save(ctx, path.Join("warranty-claims", fmt.Sprint(claimID), filename), contentType, r)
+}
+
+// save uploads r as object and returns its public URL
+func (s *GCSStorage) save(ctx context.Context, object string, contentType string, r io.Reader) (string, error) {
 	w := s.client.Bucket(s.bucket).Object(object).NewWriter(ctx)
 	w.ContentType = contentType
 	w.CacheControl = "public, max-age=31536000, immutable"
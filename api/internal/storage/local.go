@@ -21,11 +21,24 @@ func NewLocal(root, apiPrefix string) *LocalStorage {
 
 func (s *LocalStorage) SaveProductImage(ctx context.Context, productID int64, filename string, contentType string, r io.Reader) (string, error) {
 	_ = contentType // not used for local FS, but kept for interface compatibility
-	dir := filepath.Join(s.root, "products", fmt.Sprint(productID))
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	return s.save(path.Join("products", fmt.Sprint(productID)), filename, r)
+}
+
+func (s *LocalStorage) SaveReturnPhoto(ctx context.Context, returnID int64, filename string, contentType string, r io.Reader) (string, error) {
+	return s.save(path.Join("returns", fmt.Sprint(returnID)), filename, r)
+}
+
+func (s *LocalStorage) SaveClaimAttachment(ctx context.Context, claimID int64, filename string, contentType string, r io.Reader) (string, error) {
+	return s.save(path.Join("warranty-claims", fmt.Sprint(claimID)), filename, r)
+}
+
+// save writes r to dir/filename under the root and returns its URL
+func (s *LocalStorage) save(dir, filename string, r io.Reader) (string, error) {
+	fsDir := filepath.Join(s.root, filepath.FromSlash(dir))
+	if err := os.MkdirAll(fsDir, 0o755); err != nil {
 		return "", err
 	}
-	p := filepath.Join(dir, filename)
+	p := filepath.Join(fsDir, filename)
 	f, err := os.Create(p)
 	if err != nil {
 		return "", err
@@ -35,7 +48,7 @@ func (s *LocalStorage) SaveProductImage(ctx context.Context, productID int64, fi
 		return "", err
 	}
 	// Build URL with POSIX-style slashes
-	url := path.Join(s.apiPrefix, "products", fmt.Sprint(productID), filename)
+	url := path.Join(s.apiPrefix, dir, filename)
 	if !strings.HasPrefix(url, "/") {
 		url = "/" + url
 	}
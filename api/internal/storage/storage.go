@@ -8,6 +8,10 @@ import (
 type Storage interface {
 	// SaveProductImage saves the product image and returns a public URL
 	SaveProductImage(ctx context.Context, productID int64, filename string, contentType string, r io.Reader) (string, error)
+	// SaveReturnPhoto saves a photo a customer attached to a return and returns a public URL
+	SaveReturnPhoto(ctx context.Context, returnID int64, filename string, contentType string, r io.Reader) (string, error)
+	// SaveClaimAttachment saves a file a customer attached to a warranty claim and returns a public URL
+	SaveClaimAttachment(ctx context.Context, claimID int64, filename string, contentType string, r io.Reader) (string, error)
 	// DeleteByURL deletes the underlying object given its public URL. It should be idempotent.
 	DeleteByURL(ctx context.Context, url string) error
 }
@@ -0,0 +1,306 @@
+package warranty
+
+import (
+	"database/sql"
+)
+
+// ClaimStatus is the lifecycle state of a warranty claim.
+type ClaimStatus string
+
+const (
+	ClaimSubmitted ClaimStatus = "submitted"
+	ClaimInReview  ClaimStatus = "in_review"
+	ClaimApproved  ClaimStatus = "approved" // covered; the repair or replacement is under way
+	ClaimRejected  ClaimStatus = "rejected"
+	ClaimResolved  ClaimStatus = "resolved"
+)
+
+// MaxAttachments is the number of files a customer can attach to a claim.
+const MaxAttachments = 10
+
+// claimTransitions lists the statuses staff can move a claim to from each status
+var claimTransitions = map[ClaimStatus][]ClaimStatus{
+	ClaimSubmitted: {ClaimInReview, ClaimApproved, ClaimRejected},
+	ClaimInReview:  {ClaimApproved, ClaimRejected},
+	ClaimApproved:  {ClaimResolved},
+}
+
+// ValidClaimStatus reports whether s is a known status.
+func ValidClaimStatus(s ClaimStatus) bool {
+	switch s {
+	case ClaimSubmitted, ClaimInReview, ClaimApproved, ClaimRejected, ClaimResolved:
+		return true
+	}
+	return false
+}
+
+// Claim is a customer's request for repair or replacement under a warranty.
+type Claim struct {
+	ID          int64        `json:"id"`
+	WarrantyID  int64        `json:"warranty_id"`
+	UserID      int64        `json:"user_id"`
+	ProductID   int64        `json:"product_id"`
+	Title       string       `json:"title"`
+	FrameSerial *string      `json:"frame_serial,omitempty"`
+	Description string       `json:"description"`
+	Status      ClaimStatus  `json:"status"`
+	Resolution  *string      `json:"resolution,omitempty"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   *string      `json:"updated_at,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Events      []Event      `json:"events,omitempty"`
+}
+
+// Attachment is a photo or document the customer added to a claim.
+type Attachment struct {
+	ID          int64  `json:"id"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// Event is a status a claim moved to.
+type Event struct {
+	Status    ClaimStatus `json:"status"`
+	Note      *string     `json:"note,omitempty"`
+	ActorID   *int64      `json:"actor_id,omitempty"`
+	CreatedAt string      `json:"created_at"`
+}
+
+const claimQuery = `
+	SELECT c.id, c.warranty_id, c.user_id, w.product_id, COALESCE(p.title, ''), w.frame_serial, c.description,
+	       c.status, c.resolution, c.created_at, c.updated_at
+	FROM warranty_claims c
+	JOIN warranties w ON w.id = c.warranty_id
+	LEFT JOIN products p ON p.id = w.product_id`
+
+func scanClaim(row interface{ Scan(...interface{}) error }) (*Claim, error) {
+	var c Claim
+	err := row.Scan(&c.ID, &c.WarrantyID, &c.UserID, &c.ProductID, &c.Title, &c.FrameSerial, &c.Description,
+		&c.Status, &c.Resolution, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateClaim files a claim against the customer's warranty and returns its ID. The warranty must still
+// run and have no other claim open. It returns sql.ErrNoRows if the warranty is not the customer's.
+func (s *Store) CreateClaim(warrantyID, userID int64, description string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var active bool
+	err = tx.QueryRow(
+		"SELECT ends_on >= CURRENT_DATE FROM warranties WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		warrantyID, userID,
+	).Scan(&active)
+	if err != nil {
+		return 0, err
+	}
+	if !active {
+		return 0, ErrExpired
+	}
+	var open bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM warranty_claims WHERE warranty_id = $1 AND status IN ('submitted', 'in_review', 'approved'))",
+		warrantyID,
+	).Scan(&open)
+	if err != nil {
+		return 0, err
+	}
+	if open {
+		return 0, ErrClaimOpen
+	}
+
+	var id int64
+	err = tx.QueryRow(
+		"INSERT INTO warranty_claims (warranty_id, user_id, description) VALUES ($1, $2, $3) RETURNING id",
+		warrantyID, userID, description,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := addEvent(tx, id, ClaimSubmitted, nil, userID); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Claims returns a page of claims, newest first, and the total count. An empty status or a zero userID
+// or warrantyID does not filter.
+func (s *Store) Claims(status ClaimStatus, userID, warrantyID int64, limit, offset int) ([]Claim, int, error) {
+	const filter = " WHERE ($1 = '' OR c.status = $1) AND ($2::bigint = 0 OR c.user_id = $2) AND ($3::bigint = 0 OR c.warranty_id = $3)"
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM warranty_claims c"+filter, status, userID, warrantyID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(claimQuery+filter+" ORDER BY c.id DESC LIMIT $4 OFFSET $5", status, userID, warrantyID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Claim{}
+	for rows.Next() {
+		c, err := scanClaim(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *c)
+	}
+	return list, total, rows.Err()
+}
+
+// Claim returns a claim with its attachments and status history, or sql.ErrNoRows. A non-zero userID
+// must own it.
+func (s *Store) Claim(id, userID int64) (*Claim, error) {
+	c, err := scanClaim(s.db.QueryRow(claimQuery+" WHERE c.id = $1 AND ($2::bigint = 0 OR c.user_id = $2)", id, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Attachments = []Attachment{}
+	rows, err := s.db.Query(
+		"SELECT id, url, content_type, created_at FROM warranty_claim_attachments WHERE claim_id = $1 ORDER BY id",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.URL, &a.ContentType, &a.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Attachments = append(c.Attachments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT status, note, actor_id, created_at FROM warranty_claim_events WHERE claim_id = $1 ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.Status, &e.Note, &e.ActorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Events = append(c.Events, e)
+	}
+	return c, rows.Err()
+}
+
+// AddAttachment attaches an uploaded file to the customer's claim while it is being assessed.
+func (s *Store) AddAttachment(id, userID int64, url, contentType string) (*Attachment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockClaim(tx, id, userID, ClaimSubmitted, ClaimInReview); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM warranty_claim_attachments WHERE claim_id = $1", id).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= MaxAttachments {
+		return nil, ErrTooManyFiles
+	}
+
+	var a Attachment
+	err = tx.QueryRow(
+		`INSERT INTO warranty_claim_attachments (claim_id, url, content_type) VALUES ($1, $2, $3)
+		 RETURNING id, url, content_type, created_at`,
+		id, url, contentType,
+	).Scan(&a.ID, &a.URL, &a.ContentType, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, tx.Commit()
+}
+
+// SetStatus moves a claim along: submitted claims go into review or are decided, approved claims are
+// resolved once the repair or replacement is done. A note becomes the resolution shown to the customer.
+func (s *Store) SetStatus(id int64, status ClaimStatus, note *string, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current ClaimStatus
+	if err := tx.QueryRow("SELECT status FROM warranty_claims WHERE id = $1 FOR UPDATE", id).Scan(&current); err != nil {
+		return err
+	}
+	allowed := false
+	for _, next := range claimTransitions[current] {
+		if next == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return ErrWrongStatus
+	}
+
+	_, err = tx.Exec(
+		"UPDATE warranty_claims SET status = $2, resolution = COALESCE($3, resolution), updated_at = NOW() WHERE id = $1",
+		id, status, note,
+	)
+	if err != nil {
+		return err
+	}
+	if err := addEvent(tx, id, status, note, actorID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Recipient returns the email address of the customer who filed the claim and their name.
+func (s *Store) Recipient(id int64) (string, string, error) {
+	var email, name string
+	err := s.db.QueryRow(
+		`SELECT u.email, COALESCE(u.name, '')
+		 FROM warranty_claims c JOIN users u ON u.id = c.user_id WHERE c.id = $1`,
+		id,
+	).Scan(&email, &name)
+	return email, name, err
+}
+
+// lockClaim locks the claim and checks that it is in one of the allowed statuses. A non-zero userID must
+// own the claim.
+func lockClaim(tx *sql.Tx, id, userID int64, allowed ...ClaimStatus) (ClaimStatus, error) {
+	var status ClaimStatus
+	err := tx.QueryRow(
+		"SELECT status FROM warranty_claims WHERE id = $1 AND ($2::bigint = 0 OR user_id = $2) FOR UPDATE",
+		id, userID,
+	).Scan(&status)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range allowed {
+		if status == a {
+			return status, nil
+		}
+	}
+	return status, ErrWrongStatus
+}
+
+func addEvent(tx *sql.Tx, claimID int64, status ClaimStatus, note *string, actorID int64) error {
+	_, err := tx.Exec(
+		"INSERT INTO warranty_claim_events (claim_id, status, note, actor_id) VALUES ($1, $2, $3, NULLIF($4::bigint, 0))",
+		claimID, status, note, actorID,
+	)
+	return err
+}
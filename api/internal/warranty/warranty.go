@@ -0,0 +1,167 @@
+// Package warranty keeps the warranties of delivered products and the claims made against them.
+// A warranty is registered for each delivered unit of a product with warranty_months, running from
+// the delivery date.
+package warranty
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"finspeed/api/internal/database"
+)
+
+var (
+	ErrSerialTaken  = errors.New("frame serial number is registered to another warranty")
+	ErrSerialSet    = errors.New("the warranty already has a frame serial number")
+	ErrExpired      = errors.New("the warranty has expired")
+	ErrClaimOpen    = errors.New("the warranty already has an open claim")
+	ErrWrongStatus  = errors.New("claim status does not allow this")
+	ErrTooManyFiles = errors.New("the claim already has the maximum number of attachments")
+)
+
+// Warranty covers one delivered unit of a product.
+type Warranty struct {
+	ID          int64   `json:"id"`
+	OrderID     int64   `json:"order_id"`
+	OrderItemID int64   `json:"order_item_id"`
+	ShipmentID  int64   `json:"shipment_id"`
+	UserID      int64   `json:"user_id"`
+	ProductID   int64   `json:"product_id"`
+	Title       string  `json:"title"`
+	FrameSerial *string `json:"frame_serial,omitempty"`
+	StartsOn    string  `json:"starts_on"`
+	EndsOn      string  `json:"ends_on"`
+	Active      bool    `json:"active"`
+	CreatedAt   string  `json:"created_at"`
+	Claims      []Claim `json:"claims,omitempty"`
+}
+
+// Store reads and writes warranties and claims.
+type Store struct {
+	db *database.DB
+}
+
+func NewStore(db *database.DB) *Store {
+	return &Store{db: db}
+}
+
+// Register creates the warranties for a delivered shipment within tx: one per unit of each product with
+// warranty_months, starting on the delivery date. Units packed with a serial number carry it as their
+// frame serial number unless another warranty already has it. Registering a shipment again does nothing.
+func (s *Store) Register(tx *sql.Tx, shipmentID int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO warranties (order_id, order_item_id, shipment_id, unit, user_id, product_id, frame_serial, starts_on, ends_on)
+		 SELECT o.id, oi.id, s.id, u.n, o.user_id, p.id,
+		        CASE WHEN NOT EXISTS (SELECT 1 FROM warranties w WHERE upper(w.frame_serial) = upper(sn.serial)) THEN sn.serial END,
+		        s.delivered_at::date, (s.delivered_at::date + make_interval(months => p.warranty_months))::date
+		 FROM shipments s
+		 JOIN shipment_items si ON si.shipment_id = s.id
+		 JOIN order_items oi ON oi.id = si.order_item_id
+		 JOIN orders o ON o.id = oi.order_id
+		 JOIN products p ON p.id = oi.product_id
+		 CROSS JOIN LATERAL generate_series(1, si.qty) AS u(n)
+		 LEFT JOIN LATERAL (SELECT serial FROM serial_numbers WHERE shipment_item_id = si.id
+		                    ORDER BY id OFFSET u.n - 1 LIMIT 1) sn ON true
+		 WHERE s.id = $1 AND s.delivered_at IS NOT NULL AND p.warranty_months > 0
+		 ON CONFLICT (shipment_id, order_item_id, unit) DO NOTHING`,
+		shipmentID,
+	)
+	return err
+}
+
+const warrantyQuery = `
+	SELECT w.id, w.order_id, w.order_item_id, w.shipment_id, w.user_id, w.product_id, COALESCE(p.title, ''),
+	       w.frame_serial, w.starts_on::text, w.ends_on::text, w.ends_on >= CURRENT_DATE, w.created_at
+	FROM warranties w
+	LEFT JOIN products p ON p.id = w.product_id`
+
+func scanWarranty(row interface{ Scan(...interface{}) error }) (*Warranty, error) {
+	var w Warranty
+	err := row.Scan(&w.ID, &w.OrderID, &w.OrderItemID, &w.ShipmentID, &w.UserID, &w.ProductID, &w.Title,
+		&w.FrameSerial, &w.StartsOn, &w.EndsOn, &w.Active, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Warranties returns a page of warranties, newest first, and the total count. A zero userID or orderID
+// or an empty serial does not filter; the serial matches exactly, ignoring case.
+func (s *Store) Warranties(userID, orderID int64, serial string, activeOnly bool, limit, offset int) ([]Warranty, int, error) {
+	const filter = ` WHERE ($1::bigint = 0 OR w.user_id = $1) AND ($2::bigint = 0 OR w.order_id = $2)
+		AND ($3 = '' OR upper(w.frame_serial) = upper($3)) AND (NOT $4 OR w.ends_on >= CURRENT_DATE)`
+	serial = strings.TrimSpace(serial)
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM warranties w"+filter, userID, orderID, serial, activeOnly).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(warrantyQuery+filter+" ORDER BY w.id DESC LIMIT $5 OFFSET $6", userID, orderID, serial, activeOnly, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Warranty{}
+	for rows.Next() {
+		w, err := scanWarranty(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *w)
+	}
+	return list, total, rows.Err()
+}
+
+// Warranty returns a warranty with its claims, or sql.ErrNoRows. A non-zero userID must own it.
+func (s *Store) Warranty(id, userID int64) (*Warranty, error) {
+	w, err := scanWarranty(s.db.QueryRow(warrantyQuery+" WHERE w.id = $1 AND ($2::bigint = 0 OR w.user_id = $2)", id, userID))
+	if err != nil {
+		return nil, err
+	}
+	if w.Claims, _, err = s.Claims("", 0, id, 100, 0); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetSerial records the frame serial number of a warranty. Customers (a non-zero userID) can only fill
+// in a missing number; staff can also correct one.
+func (s *Store) SetSerial(id, userID int64, serial string) error {
+	var current *string
+	err := s.db.QueryRow(
+		"SELECT frame_serial FROM warranties WHERE id = $1 AND ($2::bigint = 0 OR user_id = $2)",
+		id, userID,
+	).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if userID != 0 && current != nil {
+		return ErrSerialSet
+	}
+
+	result, err := s.db.Exec(
+		`UPDATE warranties SET frame_serial = $3, updated_at = NOW()
+		 WHERE id = $1 AND ($2::bigint = 0 OR frame_serial IS NULL)`,
+		id, userID, strings.TrimSpace(serial),
+	)
+	if isUniqueViolation(err) {
+		return ErrSerialTaken
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrSerialSet
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,5 @@
+-- 000004_create_refresh_tokens.down.sql
+
+DROP TABLE IF EXISTS "revoked_tokens";
+DROP TABLE IF EXISTS "refresh_tokens";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "sessions_revoked_at";
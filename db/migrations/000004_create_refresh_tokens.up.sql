@@ -0,0 +1,28 @@
+-- 000004_create_refresh_tokens.up.sql
+
+ALTER TABLE "users" ADD COLUMN "sessions_revoked_at" timestamptz;
+
+CREATE TABLE "refresh_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "family_id" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "revoked_at" timestamptz,
+  "replaced_by" bigint REFERENCES "refresh_tokens"("id") ON DELETE SET NULL,
+  "user_agent" varchar,
+  "ip" varchar,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "refresh_tokens_user_id_idx" ON "refresh_tokens" ("user_id");
+CREATE INDEX "refresh_tokens_family_id_idx" ON "refresh_tokens" ("family_id");
+
+CREATE TABLE "revoked_tokens" (
+  "jti" varchar PRIMARY KEY,
+  "user_id" bigint REFERENCES "users"("id") ON DELETE CASCADE,
+  "expires_at" timestamptz NOT NULL,
+  "revoked_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "revoked_tokens_expires_at_idx" ON "revoked_tokens" ("expires_at");
@@ -0,0 +1,4 @@
+-- 000005_create_user_action_tokens.down.sql
+
+DROP TABLE IF EXISTS "user_action_tokens";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "email_verified_at";
@@ -0,0 +1,18 @@
+-- 000005_create_user_action_tokens.up.sql
+
+ALTER TABLE "users" ADD COLUMN "email_verified_at" timestamptz;
+
+-- Accounts created before verification existed are treated as verified
+UPDATE "users" SET "email_verified_at" = "created_at";
+
+CREATE TABLE "user_action_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+  "purpose" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "user_action_tokens_user_purpose_idx" ON "user_action_tokens" ("user_id", "purpose");
@@ -0,0 +1,5 @@
+-- 000006_add_login_rate_limiting.down.sql
+
+DROP TABLE IF EXISTS "rate_limit_counters";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "locked_until";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "failed_login_count";
@@ -0,0 +1,13 @@
+-- 000006_add_login_rate_limiting.up.sql
+
+ALTER TABLE "users" ADD COLUMN "failed_login_count" integer NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN "locked_until" timestamptz;
+
+-- Fixed-window counters shared by all API instances when RATE_LIMIT_STORE=postgres
+CREATE UNLOGGED TABLE "rate_limit_counters" (
+  "key" varchar PRIMARY KEY,
+  "count" integer NOT NULL,
+  "window_ends_at" timestamptz NOT NULL
+);
+
+CREATE INDEX "rate_limit_counters_window_ends_at_idx" ON "rate_limit_counters" ("window_ends_at");
@@ -0,0 +1,6 @@
+-- 000007_create_roles_and_permissions.down.sql
+
+ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "users_role_fkey";
+ALTER TABLE "users" ALTER COLUMN "role" DROP NOT NULL;
+DROP TABLE IF EXISTS "role_permissions";
+DROP TABLE IF EXISTS "roles";
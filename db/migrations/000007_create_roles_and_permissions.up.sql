@@ -0,0 +1,41 @@
+-- 000007_create_roles_and_permissions.up.sql
+
+CREATE TABLE "roles" (
+  "name" varchar PRIMARY KEY,
+  "description" varchar,
+  "is_system" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "role_permissions" (
+  "role" varchar NOT NULL REFERENCES "roles"("name") ON DELETE CASCADE ON UPDATE CASCADE,
+  "permission" varchar NOT NULL,
+  PRIMARY KEY ("role", "permission")
+);
+
+INSERT INTO "roles" ("name", "description", "is_system") VALUES
+  ('customer', 'Storefront customer', true),
+  ('admin', 'Full administrative access', true),
+  ('catalog_manager', 'Manages products, images and categories', true),
+  ('order_ops', 'Handles orders and fulfilment', true),
+  ('finance', 'Views orders and payments and issues refunds', true);
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+  ('admin', '*'),
+  ('catalog_manager', 'products:write'),
+  ('catalog_manager', 'categories:write'),
+  ('order_ops', 'orders:read'),
+  ('order_ops', 'orders:write'),
+  ('order_ops', 'users:read'),
+  ('finance', 'orders:read'),
+  ('finance', 'orders:refund'),
+  ('finance', 'payments:read');
+
+-- Keep any ad-hoc role values already assigned so the foreign key can be added; they carry no permissions
+INSERT INTO "roles" ("name", "description")
+SELECT DISTINCT "role", 'Imported legacy role' FROM "users"
+WHERE "role" IS NOT NULL AND "role" NOT IN (SELECT "name" FROM "roles");
+
+UPDATE "users" SET "role" = 'customer' WHERE "role" IS NULL;
+ALTER TABLE "users" ALTER COLUMN "role" SET NOT NULL;
+ALTER TABLE "users" ADD CONSTRAINT "users_role_fkey" FOREIGN KEY ("role") REFERENCES "roles"("name") ON UPDATE CASCADE;
@@ -0,0 +1,4 @@
+-- 000008_create_audit_log.down.sql
+
+DELETE FROM "role_permissions" WHERE "permission" = 'audit:read';
+DROP TABLE IF EXISTS "audit_log";
@@ -0,0 +1,23 @@
+-- 000008_create_audit_log.up.sql
+
+CREATE TABLE "audit_log" (
+  "id" bigserial PRIMARY KEY,
+  "actor_id" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "actor_email" varchar,
+  "action" varchar NOT NULL,
+  "entity_type" varchar NOT NULL,
+  "entity_id" varchar NOT NULL,
+  "before_json" jsonb,
+  "after_json" jsonb,
+  "diff_json" jsonb,
+  "ip" varchar,
+  "user_agent" varchar,
+  "request_id" varchar,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "audit_log_entity_idx" ON "audit_log" ("entity_type", "entity_id");
+CREATE INDEX "audit_log_actor_id_idx" ON "audit_log" ("actor_id");
+CREATE INDEX "audit_log_created_at_idx" ON "audit_log" ("created_at");
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES ('finance', 'audit:read');
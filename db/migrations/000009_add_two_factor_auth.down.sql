@@ -0,0 +1,6 @@
+-- 000009_add_two_factor_auth.down.sql
+
+DROP TABLE IF EXISTS "user_recovery_codes";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "totp_last_step";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "totp_enabled_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "totp_secret";
@@ -0,0 +1,17 @@
+-- 000009_add_two_factor_auth.up.sql
+
+-- totp_secret is set during enrolment and only trusted once totp_enabled_at is set.
+-- totp_last_step holds the last accepted time step so a code cannot be replayed.
+ALTER TABLE "users" ADD COLUMN "totp_secret" varchar;
+ALTER TABLE "users" ADD COLUMN "totp_enabled_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN "totp_last_step" bigint;
+
+CREATE TABLE "user_recovery_codes" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+  "code_hash" varchar NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX "user_recovery_codes_user_code_idx" ON "user_recovery_codes" ("user_id", "code_hash");
@@ -0,0 +1,4 @@
+-- 000010_create_api_keys.down.sql
+
+ALTER TABLE "audit_log" DROP COLUMN IF EXISTS "api_key_id";
+DROP TABLE IF EXISTS "api_keys";
@@ -0,0 +1,21 @@
+-- 000010_create_api_keys.up.sql
+
+-- Keys for server-to-server integrations. Only a SHA-256 hash of the key is stored;
+-- key_prefix is kept so admins can tell keys apart.
+CREATE TABLE "api_keys" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "key_prefix" varchar NOT NULL,
+  "key_hash" varchar UNIQUE NOT NULL,
+  "scopes" text[] NOT NULL DEFAULT '{}',
+  "rate_limit_per_minute" integer,
+  "created_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "expires_at" timestamptz,
+  "last_used_at" timestamptz,
+  "last_used_ip" varchar,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "audit_log" ADD COLUMN "api_key_id" bigint REFERENCES "api_keys"("id") ON DELETE SET NULL;
+CREATE INDEX "audit_log_api_key_id_idx" ON "audit_log" ("api_key_id");
@@ -0,0 +1,8 @@
+-- 000011_create_user_identities.down.sql
+
+DROP TABLE IF EXISTS "oidc_login_states";
+DROP TABLE IF EXISTS "user_identities";
+
+-- Password-less accounts get an unusable hash; they can still set a password via reset
+UPDATE "users" SET "password_hash" = '!' WHERE "password_hash" IS NULL;
+ALTER TABLE "users" ALTER COLUMN "password_hash" SET NOT NULL;
@@ -0,0 +1,30 @@
+-- 000011_create_user_identities.up.sql
+
+-- Accounts created through an external identity provider have no password until one is set via reset
+ALTER TABLE "users" ALTER COLUMN "password_hash" DROP NOT NULL;
+
+CREATE TABLE "user_identities" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+  "provider" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "email" varchar,
+  "last_login_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  UNIQUE ("provider", "subject")
+);
+
+CREATE INDEX "user_identities_user_id_idx" ON "user_identities" ("user_id");
+
+-- In-flight authorization requests: state, nonce and PKCE verifier never leave the server
+CREATE TABLE "oidc_login_states" (
+  "state_hash" varchar PRIMARY KEY,
+  "provider" varchar NOT NULL,
+  "nonce" varchar NOT NULL,
+  "code_verifier" varchar NOT NULL,
+  "link_user_id" bigint REFERENCES "users"("id") ON DELETE CASCADE,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "oidc_login_states_expires_at_idx" ON "oidc_login_states" ("expires_at");
@@ -0,0 +1,7 @@
+-- 000012_create_user_addresses.down.sql
+
+DROP TABLE IF EXISTS "user_addresses";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "pending_email";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "phone";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "name";
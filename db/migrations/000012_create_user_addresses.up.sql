@@ -0,0 +1,28 @@
+-- 000012_create_user_addresses.up.sql
+
+ALTER TABLE "users" ADD COLUMN "name" varchar;
+ALTER TABLE "users" ADD COLUMN "phone" varchar;
+-- Address awaiting confirmation through the link sent to it; "email" stays in use until then
+ALTER TABLE "users" ADD COLUMN "pending_email" varchar;
+
+CREATE TABLE "user_addresses" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "users"("id") ON DELETE CASCADE,
+  "label" varchar,
+  "name" varchar NOT NULL,
+  "phone" varchar NOT NULL,
+  "address1" varchar NOT NULL,
+  "address2" varchar,
+  "city" varchar NOT NULL,
+  "state" varchar NOT NULL,
+  "pincode" varchar(6) NOT NULL,
+  "country" varchar NOT NULL DEFAULT 'India',
+  "is_default" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "user_addresses_user_id_idx" ON "user_addresses" ("user_id");
+
+-- At most one default address per user
+CREATE UNIQUE INDEX "user_addresses_default_idx" ON "user_addresses" ("user_id") WHERE "is_default";
@@ -0,0 +1,3 @@
+-- 000013_add_user_deletion.down.sql
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "deleted_at";
@@ -0,0 +1,4 @@
+-- 000013_add_user_deletion.up.sql
+
+-- Set when a user's personal data was erased; the row stays so orders keep their foreign key
+ALTER TABLE "users" ADD COLUMN "deleted_at" timestamptz;
@@ -0,0 +1,7 @@
+-- 000014_add_archived_at.down.sql
+
+DROP INDEX IF EXISTS "products_active_created_at_idx";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "archived_at";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "archived_at";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "archived_at";
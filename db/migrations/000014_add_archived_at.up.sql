@@ -0,0 +1,8 @@
+-- 000014_add_archived_at.up.sql
+
+-- Archived rows are hidden from the storefront but stay resolvable from orders; purging deletes them for good
+ALTER TABLE "products" ADD COLUMN "archived_at" timestamptz;
+ALTER TABLE "categories" ADD COLUMN "archived_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN "archived_at" timestamptz;
+
+CREATE INDEX "products_active_created_at_idx" ON "products" ("created_at") WHERE "archived_at" IS NULL;
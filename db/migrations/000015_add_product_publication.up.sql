@@ -0,0 +1,13 @@
+-- 000015_add_product_publication.up.sql
+
+-- Existing products are already live; new ones start as drafts
+ALTER TABLE "products" ADD COLUMN "status" varchar(16) NOT NULL DEFAULT 'published'
+  CHECK ("status" IN ('draft', 'published', 'hidden'));
+ALTER TABLE "products" ALTER COLUMN "status" SET DEFAULT 'draft';
+
+ALTER TABLE "products" ADD COLUMN "publish_at" timestamptz;
+ALTER TABLE "products" ADD COLUMN "unpublish_at" timestamptz;
+ALTER TABLE "products" ADD CONSTRAINT "products_publication_window_check"
+  CHECK ("publish_at" IS NULL OR "unpublish_at" IS NULL OR "unpublish_at" > "publish_at");
+
+CREATE INDEX "products_status_idx" ON "products" ("status") WHERE "archived_at" IS NULL;
@@ -0,0 +1,8 @@
+-- 000016_add_sale_pricing.down.sql
+
+DROP TABLE IF EXISTS "price_history";
+
+ALTER TABLE "products" DROP CONSTRAINT IF EXISTS "products_sale_window_check";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "sale_ends_at";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "sale_starts_at";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "sale_price";
@@ -0,0 +1,26 @@
+-- 000016_add_sale_pricing.up.sql
+
+-- A sale price applies between sale_starts_at and sale_ends_at; either bound may be open
+ALTER TABLE "products" ADD COLUMN "sale_price" decimal(10, 2) CHECK ("sale_price" > 0);
+ALTER TABLE "products" ADD COLUMN "sale_starts_at" timestamptz;
+ALTER TABLE "products" ADD COLUMN "sale_ends_at" timestamptz;
+ALTER TABLE "products" ADD CONSTRAINT "products_sale_window_check"
+  CHECK ("sale_starts_at" IS NULL OR "sale_ends_at" IS NULL OR "sale_ends_at" > "sale_starts_at");
+
+-- One row per pricing change, holding the pricing that applied from changed_at on
+CREATE TABLE "price_history" (
+  "id" bigserial PRIMARY KEY,
+  "product_id" bigint NOT NULL REFERENCES "products"("id") ON DELETE CASCADE,
+  "price" decimal(10, 2) NOT NULL,
+  "sale_price" decimal(10, 2),
+  "sale_starts_at" timestamptz,
+  "sale_ends_at" timestamptz,
+  "changed_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "api_key_id" bigint REFERENCES "api_keys"("id") ON DELETE SET NULL,
+  "changed_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "price_history_product_id_changed_at_idx" ON "price_history" ("product_id", "changed_at" DESC);
+
+INSERT INTO "price_history" ("product_id", "price", "changed_at")
+SELECT "id", "price", "created_at" FROM "products";
@@ -0,0 +1,3 @@
+-- 000017_create_inventory_movements.down.sql
+
+DROP TABLE IF EXISTS "inventory_movements";
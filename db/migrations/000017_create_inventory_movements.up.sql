@@ -0,0 +1,23 @@
+-- 000017_create_inventory_movements.up.sql
+
+-- Every change to products.stock_qty is recorded here; stock_qty is the running balance of this ledger
+CREATE TABLE "inventory_movements" (
+  "id" bigserial PRIMARY KEY,
+  "product_id" bigint NOT NULL REFERENCES "products"("id") ON DELETE CASCADE,
+  "kind" varchar(16) NOT NULL
+    CHECK ("kind" IN ('receipt', 'sale', 'cancellation', 'adjustment', 'return', 'damage')),
+  "quantity" integer NOT NULL CHECK ("quantity" <> 0),
+  "balance_after" integer NOT NULL,
+  "reason" text,
+  "order_id" bigint REFERENCES "orders"("id") ON DELETE SET NULL,
+  "actor_id" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "api_key_id" bigint REFERENCES "api_keys"("id") ON DELETE SET NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "inventory_movements_product_id_idx" ON "inventory_movements" ("product_id", "id" DESC);
+CREATE INDEX "inventory_movements_order_id_idx" ON "inventory_movements" ("order_id") WHERE "order_id" IS NOT NULL;
+
+-- Opening balances so the ledger adds up to the stock on hand
+INSERT INTO "inventory_movements" ("product_id", "kind", "quantity", "balance_after", "reason")
+SELECT "id", 'adjustment', "stock_qty", "stock_qty", 'Opening balance' FROM "products" WHERE "stock_qty" <> 0;
@@ -0,0 +1,11 @@
+-- 000018_create_locations.down.sql
+
+DELETE FROM "role_permissions" WHERE "permission" = 'inventory:manage';
+
+DROP TABLE IF EXISTS "order_allocations";
+
+DROP INDEX IF EXISTS "inventory_movements_location_id_idx";
+ALTER TABLE "inventory_movements" DROP COLUMN IF EXISTS "location_id";
+
+DROP TABLE IF EXISTS "location_stock";
+DROP TABLE IF EXISTS "locations";
@@ -0,0 +1,65 @@
+-- 000018_create_locations.up.sql
+
+-- Warehouses and showrooms holding stock
+CREATE TABLE "locations" (
+  "id" bigserial PRIMARY KEY,
+  "code" varchar(32) UNIQUE NOT NULL,
+  "name" varchar NOT NULL,
+  "kind" varchar(16) NOT NULL DEFAULT 'warehouse' CHECK ("kind" IN ('warehouse', 'store')),
+  "address1" varchar,
+  "city" varchar NOT NULL,
+  "state" varchar NOT NULL,
+  "pincode" varchar(6) NOT NULL,
+  -- Only active locations that fulfil orders are considered by order routing
+  "fulfils_orders" boolean NOT NULL DEFAULT true,
+  "is_active" boolean NOT NULL DEFAULT true,
+  -- Receives stock changes that do not name a location, such as edits in the product editor
+  "is_default" boolean NOT NULL DEFAULT false,
+  -- Breaks ties between equally near locations; lower goes first
+  "priority" integer NOT NULL DEFAULT 100,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz
+);
+
+CREATE UNIQUE INDEX "locations_default_idx" ON "locations" ("is_default") WHERE "is_default";
+
+-- products.stock_qty stays the total across locations
+CREATE TABLE "location_stock" (
+  "location_id" bigint NOT NULL REFERENCES "locations"("id"),
+  "product_id" bigint NOT NULL REFERENCES "products"("id") ON DELETE CASCADE,
+  "quantity" integer NOT NULL DEFAULT 0 CHECK ("quantity" >= 0),
+  PRIMARY KEY ("location_id", "product_id")
+);
+
+CREATE INDEX "location_stock_product_id_idx" ON "location_stock" ("product_id");
+
+ALTER TABLE "inventory_movements" ADD COLUMN "location_id" bigint REFERENCES "locations"("id");
+
+-- Which location ships which part of an order; one item may be split across locations
+CREATE TABLE "order_allocations" (
+  "id" bigserial PRIMARY KEY,
+  "order_id" bigint NOT NULL REFERENCES "orders"("id") ON DELETE CASCADE,
+  "product_id" bigint NOT NULL REFERENCES "products"("id"),
+  "location_id" bigint NOT NULL REFERENCES "locations"("id"),
+  "qty" integer NOT NULL CHECK ("qty" > 0)
+);
+
+CREATE INDEX "order_allocations_order_id_idx" ON "order_allocations" ("order_id");
+
+-- Existing stock, movements and orders belong to the original warehouse. Update its address after migrating.
+INSERT INTO "locations" ("code", "name", "city", "state", "pincode", "is_default", "priority")
+VALUES ('main', 'Main warehouse', 'Unknown', 'Unknown', '000000', true, 1000);
+
+INSERT INTO "location_stock" ("location_id", "product_id", "quantity")
+SELECT l."id", p."id", p."stock_qty" FROM "products" p, "locations" l WHERE l."code" = 'main' AND p."stock_qty" > 0;
+
+UPDATE "inventory_movements" SET "location_id" = (SELECT "id" FROM "locations" WHERE "code" = 'main');
+ALTER TABLE "inventory_movements" ALTER COLUMN "location_id" SET NOT NULL;
+CREATE INDEX "inventory_movements_location_id_idx" ON "inventory_movements" ("location_id");
+
+INSERT INTO "order_allocations" ("order_id", "product_id", "location_id", "qty")
+SELECT oi."order_id", oi."product_id", l."id", oi."qty" FROM "order_items" oi, "locations" l WHERE l."code" = 'main';
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+  ('catalog_manager', 'inventory:manage'),
+  ('order_ops', 'inventory:manage');
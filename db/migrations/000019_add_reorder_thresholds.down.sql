@@ -0,0 +1,7 @@
+-- 000019_add_reorder_thresholds.down.sql
+
+DROP TABLE IF EXISTS "low_stock_alerts";
+
+ALTER TABLE "products"
+  DROP COLUMN IF EXISTS "reorder_qty",
+  DROP COLUMN IF EXISTS "reorder_threshold";
@@ -0,0 +1,19 @@
+-- 000019_add_reorder_thresholds.up.sql
+
+-- A product is low on stock once stock_qty is at or below reorder_threshold; NULL turns alerts off
+ALTER TABLE "products"
+  ADD COLUMN "reorder_threshold" integer CHECK ("reorder_threshold" >= 0),
+  ADD COLUMN "reorder_qty" integer CHECK ("reorder_qty" > 0);
+
+-- One open alert per product, so staff are notified once per stock-out rather than on every check
+CREATE TABLE "low_stock_alerts" (
+  "id" bigserial PRIMARY KEY,
+  "product_id" bigint NOT NULL REFERENCES "products"("id") ON DELETE CASCADE,
+  "stock_qty" integer NOT NULL,
+  "reorder_threshold" integer NOT NULL,
+  "opened_at" timestamptz NOT NULL DEFAULT (now()),
+  "notified_at" timestamptz,
+  "resolved_at" timestamptz
+);
+
+CREATE UNIQUE INDEX "low_stock_alerts_open_idx" ON "low_stock_alerts" ("product_id") WHERE "resolved_at" IS NULL;
@@ -0,0 +1,12 @@
+-- 000020_create_purchase_orders.down.sql
+
+DELETE FROM "role_permissions" WHERE "permission" IN ('purchasing:manage', 'purchasing:approve');
+
+ALTER TABLE "inventory_movements" DROP COLUMN IF EXISTS "purchase_order_id";
+ALTER TABLE "products" DROP COLUMN IF EXISTS "cost_price";
+
+DROP TABLE IF EXISTS "purchase_receipt_lines";
+DROP TABLE IF EXISTS "purchase_receipts";
+DROP TABLE IF EXISTS "purchase_order_lines";
+DROP TABLE IF EXISTS "purchase_orders";
+DROP TABLE IF EXISTS "suppliers";
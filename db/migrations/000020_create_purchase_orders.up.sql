@@ -0,0 +1,84 @@
+-- 000020_create_purchase_orders.up.sql
+
+CREATE TABLE "suppliers" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "contact_name" varchar,
+  "email" varchar,
+  "phone" varchar(20),
+  "gstin" varchar(15),
+  "address" text,
+  -- Typical days between ordering and delivery, for planning reorders
+  "lead_time_days" integer CHECK ("lead_time_days" >= 0),
+  "notes" text,
+  "is_active" boolean NOT NULL DEFAULT true,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz
+);
+
+CREATE UNIQUE INDEX "suppliers_name_key" ON "suppliers" (lower("name"));
+
+-- A PO is drafted, approved, then received in one or more receipts.
+-- Cancelling a partially received PO closes it; the outstanding quantities are no longer expected.
+CREATE TABLE "purchase_orders" (
+  "id" bigserial PRIMARY KEY,
+  "supplier_id" bigint NOT NULL REFERENCES "suppliers"("id"),
+  -- Where the goods are delivered and booked into stock
+  "location_id" bigint NOT NULL REFERENCES "locations"("id"),
+  "status" varchar(24) NOT NULL DEFAULT 'draft'
+    CHECK ("status" IN ('draft', 'approved', 'partially_received', 'received', 'closed', 'cancelled')),
+  "expected_at" date,
+  "notes" text,
+  "created_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "approved_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "approved_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz
+);
+
+CREATE INDEX "purchase_orders_supplier_id_idx" ON "purchase_orders" ("supplier_id");
+CREATE INDEX "purchase_orders_status_idx" ON "purchase_orders" ("status");
+
+CREATE TABLE "purchase_order_lines" (
+  "id" bigserial PRIMARY KEY,
+  "purchase_order_id" bigint NOT NULL REFERENCES "purchase_orders"("id") ON DELETE CASCADE,
+  "product_id" bigint NOT NULL REFERENCES "products"("id"),
+  "qty_ordered" integer NOT NULL CHECK ("qty_ordered" > 0),
+  "qty_received" integer NOT NULL DEFAULT 0 CHECK ("qty_received" >= 0),
+  "unit_cost" decimal(10, 2) NOT NULL CHECK ("unit_cost" >= 0),
+  UNIQUE ("purchase_order_id", "product_id"),
+  CHECK ("qty_received" <= "qty_ordered")
+);
+
+CREATE TABLE "purchase_receipts" (
+  "id" bigserial PRIMARY KEY,
+  "purchase_order_id" bigint NOT NULL REFERENCES "purchase_orders"("id") ON DELETE CASCADE,
+  "received_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "api_key_id" bigint REFERENCES "api_keys"("id") ON DELETE SET NULL,
+  "notes" text,
+  "received_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "purchase_receipts_purchase_order_id_idx" ON "purchase_receipts" ("purchase_order_id");
+
+-- unit_cost is what was actually paid for this delivery, which may differ from the PO
+CREATE TABLE "purchase_receipt_lines" (
+  "id" bigserial PRIMARY KEY,
+  "receipt_id" bigint NOT NULL REFERENCES "purchase_receipts"("id") ON DELETE CASCADE,
+  "line_id" bigint NOT NULL REFERENCES "purchase_order_lines"("id") ON DELETE CASCADE,
+  "product_id" bigint NOT NULL REFERENCES "products"("id"),
+  "qty" integer NOT NULL CHECK ("qty" > 0),
+  "unit_cost" decimal(10, 2) NOT NULL CHECK ("unit_cost" >= 0)
+);
+
+CREATE INDEX "purchase_receipt_lines_product_id_idx" ON "purchase_receipt_lines" ("product_id");
+
+-- Cost of the most recent receipt
+ALTER TABLE "products" ADD COLUMN "cost_price" decimal(10, 2);
+
+ALTER TABLE "inventory_movements"
+  ADD COLUMN "purchase_order_id" bigint REFERENCES "purchase_orders"("id") ON DELETE SET NULL;
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+  ('catalog_manager', 'purchasing:manage'),
+  ('finance', 'purchasing:approve');
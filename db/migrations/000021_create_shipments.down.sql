@@ -0,0 +1,7 @@
+-- 000021_create_shipments.down.sql
+
+-- Statuses derived from shipments are unknown without them
+UPDATE "orders" SET "status" = 'paid' WHERE "status" IN ('partially_shipped', 'shipped', 'delivered');
+
+DROP TABLE IF EXISTS "shipment_items";
+DROP TABLE IF EXISTS "shipments";
@@ -0,0 +1,35 @@
+-- 000021_create_shipments.up.sql
+
+-- An order ships in one or more shipments. A shipment is pending while it is packed, shipped once the
+-- courier has it and delivered on arrival. Only pending shipments can be cancelled.
+CREATE TABLE "shipments" (
+  "id" bigserial PRIMARY KEY,
+  "order_id" bigint NOT NULL REFERENCES "orders"("id") ON DELETE CASCADE,
+  -- Where the parcel leaves from
+  "location_id" bigint REFERENCES "locations"("id"),
+  "status" varchar(16) NOT NULL DEFAULT 'pending'
+    CHECK ("status" IN ('pending', 'shipped', 'delivered', 'cancelled')),
+  "courier" varchar(100),
+  -- Air waybill number, the courier's tracking number
+  "awb_number" varchar(64),
+  "tracking_url" varchar,
+  "created_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "shipped_at" timestamptz,
+  "delivered_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz,
+  CHECK ("status" IN ('pending', 'cancelled') OR ("courier" IS NOT NULL AND "awb_number" IS NOT NULL))
+);
+
+CREATE INDEX "shipments_order_id_idx" ON "shipments" ("order_id");
+CREATE UNIQUE INDEX "shipments_awb_key" ON "shipments" (lower("courier"), "awb_number") WHERE "awb_number" IS NOT NULL;
+
+CREATE TABLE "shipment_items" (
+  "id" bigserial PRIMARY KEY,
+  "shipment_id" bigint NOT NULL REFERENCES "shipments"("id") ON DELETE CASCADE,
+  "order_item_id" bigint NOT NULL REFERENCES "order_items"("id") ON DELETE CASCADE,
+  "qty" integer NOT NULL CHECK ("qty" > 0),
+  UNIQUE ("shipment_id", "order_item_id")
+);
+
+CREATE INDEX "shipment_items_order_item_id_idx" ON "shipment_items" ("order_item_id");
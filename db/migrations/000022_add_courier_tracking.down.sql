@@ -0,0 +1,10 @@
+-- 000022_add_courier_tracking.down.sql
+
+DROP TABLE IF EXISTS "shipment_events";
+
+DROP INDEX IF EXISTS "shipments_awb_number_idx";
+DROP INDEX IF EXISTS "shipments_provider_ref_key";
+
+ALTER TABLE "shipments"
+  DROP COLUMN IF EXISTS "provider_ref",
+  DROP COLUMN IF EXISTS "provider";
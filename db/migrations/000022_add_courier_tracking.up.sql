@@ -0,0 +1,21 @@
+-- 000022_add_courier_tracking.up.sql
+
+-- Shipments booked through a courier aggregator keep the provider's shipment ID for labels and cancellation
+ALTER TABLE "shipments"
+  ADD COLUMN "provider" varchar(32),
+  ADD COLUMN "provider_ref" varchar(64);
+
+CREATE UNIQUE INDEX "shipments_provider_ref_key" ON "shipments" ("provider", "provider_ref") WHERE "provider_ref" IS NOT NULL;
+CREATE INDEX "shipments_awb_number_idx" ON "shipments" ("awb_number");
+
+-- Tracking updates reported by the courier. Webhooks may be delivered more than once.
+CREATE TABLE "shipment_events" (
+  "id" bigserial PRIMARY KEY,
+  "shipment_id" bigint NOT NULL REFERENCES "shipments"("id") ON DELETE CASCADE,
+  "status" varchar(32) NOT NULL,
+  "description" text,
+  "location" varchar,
+  "occurred_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  UNIQUE ("shipment_id", "status", "occurred_at")
+);
@@ -0,0 +1,4 @@
+-- 000023_create_returns.down.sql
+
+DROP TABLE IF EXISTS "return_photos";
+DROP TABLE IF EXISTS "returns";
@@ -0,0 +1,51 @@
+-- 000023_create_returns.up.sql
+
+-- A return (RMA) sends back part of one delivered order item. Staff approve or reject the request, the
+-- customer ships the item back, and once it is received it is restocked or written off and refunded.
+CREATE TABLE "returns" (
+  "id" bigserial PRIMARY KEY,
+  "order_id" bigint NOT NULL REFERENCES "orders"("id") ON DELETE CASCADE,
+  "order_item_id" bigint NOT NULL REFERENCES "order_items"("id") ON DELETE CASCADE,
+  "user_id" bigint NOT NULL REFERENCES "users"("id"),
+  "qty" integer NOT NULL CHECK ("qty" > 0),
+  "reason" varchar(32) NOT NULL
+    CHECK ("reason" IN ('damaged', 'defective', 'wrong_size', 'wrong_item', 'not_as_described', 'changed_mind', 'other')),
+  "comment" text,
+  "status" varchar(16) NOT NULL DEFAULT 'requested'
+    CHECK ("status" IN ('requested', 'approved', 'rejected', 'shipped', 'received', 'refunded', 'cancelled')),
+  -- Shown to the customer with the approval or rejection
+  "decision_note" text,
+  "decided_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "decided_at" timestamptz,
+  -- The parcel on its way back
+  "courier" varchar(100),
+  "awb_number" varchar(64),
+  "tracking_url" varchar,
+  "shipped_at" timestamptz,
+  -- What happened to the goods on arrival
+  "disposition" varchar(16) CHECK ("disposition" IN ('restock', 'write_off')),
+  "location_id" bigint REFERENCES "locations"("id"),
+  "received_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "received_at" timestamptz,
+  "refund_amount" decimal(10, 2),
+  -- The payment provider's refund ID
+  "refund_ref" varchar,
+  "refunded_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "refunded_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz,
+  CHECK ("status" NOT IN ('received', 'refunded') OR "disposition" IS NOT NULL)
+);
+
+CREATE INDEX "returns_order_item_id_idx" ON "returns" ("order_item_id");
+CREATE INDEX "returns_user_id_idx" ON "returns" ("user_id");
+CREATE INDEX "returns_status_idx" ON "returns" ("status");
+
+CREATE TABLE "return_photos" (
+  "id" bigserial PRIMARY KEY,
+  "return_id" bigint NOT NULL REFERENCES "returns"("id") ON DELETE CASCADE,
+  "url" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "return_photos_return_id_idx" ON "return_photos" ("return_id");
@@ -0,0 +1,6 @@
+-- 000024_create_warranties.down.sql
+
+DROP TABLE IF EXISTS "warranty_claim_events";
+DROP TABLE IF EXISTS "warranty_claim_attachments";
+DROP TABLE IF EXISTS "warranty_claims";
+DROP TABLE IF EXISTS "warranties";
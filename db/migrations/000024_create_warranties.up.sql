@@ -0,0 +1,76 @@
+-- 000024_create_warranties.up.sql
+
+-- One warranty per delivered unit of a product with warranty_months, so each bike can carry its own frame
+-- serial number. The warranty runs from the delivery date.
+CREATE TABLE "warranties" (
+  "id" bigserial PRIMARY KEY,
+  "order_id" bigint NOT NULL REFERENCES "orders"("id") ON DELETE CASCADE,
+  "order_item_id" bigint NOT NULL REFERENCES "order_items"("id") ON DELETE CASCADE,
+  "shipment_id" bigint NOT NULL REFERENCES "shipments"("id") ON DELETE CASCADE,
+  "unit" integer NOT NULL CHECK ("unit" > 0),
+  "user_id" bigint NOT NULL REFERENCES "users"("id"),
+  "product_id" bigint NOT NULL REFERENCES "products"("id"),
+  "frame_serial" varchar(64),
+  "starts_on" date NOT NULL,
+  "ends_on" date NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz,
+  UNIQUE ("shipment_id", "order_item_id", "unit"),
+  CHECK ("ends_on" >= "starts_on")
+);
+
+CREATE INDEX "warranties_user_id_idx" ON "warranties" ("user_id");
+CREATE INDEX "warranties_order_id_idx" ON "warranties" ("order_id");
+-- A frame can only be registered once
+CREATE UNIQUE INDEX "warranties_frame_serial_key" ON "warranties" (upper("frame_serial")) WHERE "frame_serial" IS NOT NULL;
+
+CREATE TABLE "warranty_claims" (
+  "id" bigserial PRIMARY KEY,
+  "warranty_id" bigint NOT NULL REFERENCES "warranties"("id") ON DELETE CASCADE,
+  "user_id" bigint NOT NULL REFERENCES "users"("id"),
+  "description" text NOT NULL,
+  "status" varchar(16) NOT NULL DEFAULT 'submitted'
+    CHECK ("status" IN ('submitted', 'in_review', 'approved', 'rejected', 'resolved')),
+  -- Shown to the customer, e.g. what will be repaired or why the claim was rejected
+  "resolution" text,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz
+);
+
+CREATE INDEX "warranty_claims_warranty_id_idx" ON "warranty_claims" ("warranty_id");
+CREATE INDEX "warranty_claims_user_id_idx" ON "warranty_claims" ("user_id");
+CREATE INDEX "warranty_claims_status_idx" ON "warranty_claims" ("status");
+
+CREATE TABLE "warranty_claim_attachments" (
+  "id" bigserial PRIMARY KEY,
+  "claim_id" bigint NOT NULL REFERENCES "warranty_claims"("id") ON DELETE CASCADE,
+  "url" varchar NOT NULL,
+  "content_type" varchar(64) NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "warranty_claim_attachments_claim_id_idx" ON "warranty_claim_attachments" ("claim_id");
+
+-- Every status a claim went through, with who moved it there
+CREATE TABLE "warranty_claim_events" (
+  "id" bigserial PRIMARY KEY,
+  "claim_id" bigint NOT NULL REFERENCES "warranty_claims"("id") ON DELETE CASCADE,
+  "status" varchar(16) NOT NULL,
+  "note" text,
+  "actor_id" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX "warranty_claim_events_claim_id_idx" ON "warranty_claim_events" ("claim_id");
+
+-- Register warranties for what was delivered before warranties were tracked
+INSERT INTO "warranties" ("order_id", "order_item_id", "shipment_id", "unit", "user_id", "product_id", "starts_on", "ends_on")
+SELECT o."id", oi."id", s."id", u.n, o."user_id", p."id", s."delivered_at"::date,
+       (s."delivered_at"::date + make_interval(months => p."warranty_months"))::date
+FROM "shipments" s
+JOIN "shipment_items" si ON si."shipment_id" = s."id"
+JOIN "order_items" oi ON oi."id" = si."order_item_id"
+JOIN "orders" o ON o."id" = oi."order_id"
+JOIN "products" p ON p."id" = oi."product_id"
+CROSS JOIN LATERAL generate_series(1, si."qty") AS u(n)
+WHERE s."status" = 'delivered' AND s."delivered_at" IS NOT NULL AND p."warranty_months" > 0;
@@ -0,0 +1,5 @@
+-- 000025_add_serial_numbers.down.sql
+
+DROP TABLE IF EXISTS "serial_numbers";
+
+ALTER TABLE "products" DROP COLUMN IF EXISTS "is_serialised";
@@ -0,0 +1,22 @@
+-- 000025_add_serial_numbers.up.sql
+
+-- Serialised products, such as bikes with a frame serial number, are tracked unit by unit
+ALTER TABLE "products" ADD COLUMN "is_serialised" boolean NOT NULL DEFAULT false;
+
+-- One row per serialised unit. A unit is in stock at its location until it is packed into a shipment;
+-- cancelling the shipment puts it back in stock.
+CREATE TABLE "serial_numbers" (
+  "id" bigserial PRIMARY KEY,
+  "product_id" bigint NOT NULL REFERENCES "products"("id") ON DELETE CASCADE,
+  "serial" varchar(64) NOT NULL,
+  "location_id" bigint NOT NULL REFERENCES "locations"("id"),
+  "shipment_item_id" bigint REFERENCES "shipment_items"("id") ON DELETE SET NULL,
+  "created_by" bigint REFERENCES "users"("id") ON DELETE SET NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz
+);
+
+-- Serial numbers are matched ignoring case, as they are read off frames by hand
+CREATE UNIQUE INDEX "serial_numbers_serial_key" ON "serial_numbers" (upper("serial"));
+CREATE INDEX "serial_numbers_product_id_idx" ON "serial_numbers" ("product_id", "location_id");
+CREATE INDEX "serial_numbers_shipment_item_id_idx" ON "serial_numbers" ("shipment_item_id");
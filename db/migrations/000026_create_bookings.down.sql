@@ -0,0 +1,14 @@
+-- 000026_create_bookings.down.sql
+
+DELETE FROM "role_permissions" WHERE "permission" = 'bookings:manage';
+
+DELETE FROM "payments" WHERE "booking_id" IS NOT NULL;
+ALTER TABLE "payments"
+  DROP CONSTRAINT IF EXISTS "payments_order_or_booking",
+  DROP COLUMN IF EXISTS "booking_id",
+  ALTER COLUMN "order_id" SET NOT NULL;
+
+DROP TABLE IF EXISTS "bookings";
+DROP TABLE IF EXISTS "booking_closures";
+DROP TABLE IF EXISTS "booking_hours";
+DROP TABLE IF EXISTS "service_types";
@@ -0,0 +1,86 @@
+-- 000026_create_bookings.up.sql
+
+-- What customers can book: workshop services and test rides. Prepayment through Razorpay is either not
+-- offered, optional or required to confirm the booking.
+CREATE TABLE "service_types" (
+  "id" bigserial PRIMARY KEY,
+  "code" varchar(50) NOT NULL UNIQUE,
+  "name" varchar(200) NOT NULL,
+  "kind" varchar(16) NOT NULL CHECK ("kind" IN ('service', 'test_ride')),
+  "description" text,
+  "duration_minutes" integer NOT NULL CHECK ("duration_minutes" > 0 AND "duration_minutes" <= 480),
+  "price" decimal(10, 2) NOT NULL DEFAULT 0 CHECK ("price" >= 0),
+  "prepayment" varchar(16) NOT NULL DEFAULT 'none' CHECK ("prepayment" IN ('none', 'optional', 'required')),
+  "is_active" boolean NOT NULL DEFAULT true,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz,
+  CHECK ("prepayment" = 'none' OR "price" > 0)
+);
+
+-- Weekly opening hours for bookings of each kind at a location. The day is cut into slots of slot_minutes
+-- from opens_at, and capacity is how many bookings can run at once, e.g. mechanics or demo bikes.
+CREATE TABLE "booking_hours" (
+  "id" bigserial PRIMARY KEY,
+  "location_id" bigint NOT NULL REFERENCES "locations"("id") ON DELETE CASCADE,
+  "kind" varchar(16) NOT NULL CHECK ("kind" IN ('service', 'test_ride')),
+  -- 0 is Sunday
+  "weekday" smallint NOT NULL CHECK ("weekday" BETWEEN 0 AND 6),
+  "opens_at" time NOT NULL,
+  "closes_at" time NOT NULL,
+  "slot_minutes" integer NOT NULL DEFAULT 30 CHECK ("slot_minutes" BETWEEN 5 AND 240),
+  "capacity" integer NOT NULL CHECK ("capacity" > 0),
+  UNIQUE ("location_id", "kind", "weekday"),
+  CHECK ("closes_at" > "opens_at")
+);
+
+-- Days a location takes no bookings, e.g. public holidays
+CREATE TABLE "booking_closures" (
+  "id" bigserial PRIMARY KEY,
+  "location_id" bigint NOT NULL REFERENCES "locations"("id") ON DELETE CASCADE,
+  "date" date NOT NULL,
+  "reason" varchar(200),
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  UNIQUE ("location_id", "date")
+);
+
+-- A booking waits for payment when prepayment is required and is confirmed otherwise
+CREATE TABLE "bookings" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "users"("id"),
+  "service_type_id" bigint NOT NULL REFERENCES "service_types"("id"),
+  "location_id" bigint NOT NULL REFERENCES "locations"("id"),
+  -- The bike to ride or service, when the customer names one
+  "product_id" bigint REFERENCES "products"("id") ON DELETE SET NULL,
+  "starts_at" timestamptz NOT NULL,
+  "ends_at" timestamptz NOT NULL,
+  "status" varchar(16) NOT NULL DEFAULT 'confirmed'
+    CHECK ("status" IN ('pending_payment', 'confirmed', 'completed', 'no_show', 'cancelled')),
+  "price" decimal(10, 2) NOT NULL DEFAULT 0,
+  "notes" text,
+  -- Razorpay payment ID once paid
+  "payment_id" varchar,
+  "paid_at" timestamptz,
+  "refund_ref" varchar,
+  "refunded_at" timestamptz,
+  "cancel_reason" text,
+  "cancelled_at" timestamptz,
+  "reminder_sent_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz,
+  CHECK ("ends_at" > "starts_at")
+);
+
+CREATE INDEX "bookings_location_starts_at_idx" ON "bookings" ("location_id", "starts_at");
+CREATE INDEX "bookings_user_id_idx" ON "bookings" ("user_id");
+CREATE INDEX "bookings_reminder_idx" ON "bookings" ("starts_at") WHERE "status" = 'confirmed' AND "reminder_sent_at" IS NULL;
+
+-- A payment is for an order or a booking
+ALTER TABLE "payments"
+  ALTER COLUMN "order_id" DROP NOT NULL,
+  ADD COLUMN "booking_id" bigint REFERENCES "bookings"("id"),
+  ADD CONSTRAINT "payments_order_or_booking" CHECK (("order_id" IS NULL) <> ("booking_id" IS NULL));
+
+CREATE INDEX "payments_booking_id_idx" ON "payments" ("booking_id");
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+  ('order_ops', 'bookings:manage');
@@ -0,0 +1,4 @@
+-- 000027_bind_booking_payments.down.sql
+
+DROP INDEX IF EXISTS "bookings_payment_id_idx";
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "razorpay_order_id";
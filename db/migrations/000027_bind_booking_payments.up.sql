@@ -0,0 +1,7 @@
+-- 000027_bind_booking_payments.up.sql
+
+-- The Razorpay order a booking is paid through; checkout results for any other order are refused
+ALTER TABLE "bookings" ADD COLUMN "razorpay_order_id" varchar;
+
+-- A payment confirms at most one booking
+CREATE UNIQUE INDEX "bookings_payment_id_idx" ON "bookings" ("payment_id");
@@ -0,0 +1,4 @@
+-- 000028_case_insensitive_emails.down.sql
+
+DROP INDEX IF EXISTS "users_email_key";
+ALTER TABLE "users" ADD CONSTRAINT "users_email_key" UNIQUE ("email");
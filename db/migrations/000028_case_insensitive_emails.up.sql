@@ -0,0 +1,7 @@
+-- 000028_case_insensitive_emails.up.sql
+
+-- Emails are stored lowercased and looked up with LOWER(email); uniqueness ignores case so that rows
+-- written before addresses were lowercased cannot be registered again in another case. The index keeps
+-- the old constraint's name, which sign-up recognises as a duplicate email.
+ALTER TABLE "users" DROP CONSTRAINT "users_email_key";
+CREATE UNIQUE INDEX "users_email_key" ON "users" (lower("email"));
@@ -0,0 +1,3 @@
+-- 000029_create_return_serials.down.sql
+
+DROP TABLE IF EXISTS "return_serials";
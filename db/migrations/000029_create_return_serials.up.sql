@@ -0,0 +1,11 @@
+-- 000029_create_return_serials.up.sql
+
+-- The serialised units that came back on a return. Restocked units are released from their shipment into
+-- stock at the return's location; written-off units stay recorded against the shipment they left in.
+CREATE TABLE "return_serials" (
+  "return_id" bigint NOT NULL REFERENCES "returns"("id") ON DELETE CASCADE,
+  "serial_number_id" bigint NOT NULL REFERENCES "serial_numbers"("id") ON DELETE CASCADE,
+  PRIMARY KEY ("return_id", "serial_number_id")
+);
+
+CREATE INDEX "return_serials_serial_number_id_idx" ON "return_serials" ("serial_number_id");
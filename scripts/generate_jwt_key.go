@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Generates a PKCS#8 PEM private key for JWT signing. Save the output as
+// <kid>.pem in the directory referenced by JWT_KEYS_DIR.
+func main() {
+	alg := "ed25519"
+	if len(os.Args) > 1 {
+		alg = os.Args[1]
+	}
+
+	var key interface{}
+	switch alg {
+	case "ed25519":
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Printf("Error generating key: %v\n", err)
+			os.Exit(1)
+		}
+		key = priv
+	case "rsa":
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			fmt.Printf("Error generating key: %v\n", err)
+			os.Exit(1)
+		}
+		key = priv
+	default:
+		fmt.Println("Usage: go run generate_jwt_key.go [ed25519|rsa]")
+		os.Exit(1)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		fmt.Printf("Error encoding key: %v\n", err)
+		os.Exit(1)
+	}
+	pem.Encode(os.Stdout, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// A minimal OpenID Connect provider for local development and testing. It approves every
+// authorization request without a login page. The identity comes from the login_hint query
+// parameter (an email), so different users can be simulated.
+//
+//	go run scripts/mock_oidc_provider.go            # listens on :9999
+//
+// Configure the API with:
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_DISCOVERY_URL=http://localhost:9999
+//	OIDC_MOCK_CLIENT_ID=finspeed-local
+//	OIDC_MOCK_CLIENT_SECRET=secret
+//
+// Append &login_hint=someone@example.com to the authorization URL to pick the user.
+// Add &email_verified=false to simulate an unverified email.
+func main() {
+	addr := ":9999"
+	if v := os.Getenv("MOCK_OIDC_ADDR"); v != "" {
+		addr = v
+	}
+	issuer := "http://localhost" + addr
+	if v := os.Getenv("MOCK_OIDC_ISSUER"); v != "" {
+		issuer = v
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("failed to generate key: %v", err)
+	}
+
+	type grant struct {
+		clientID, redirectURI, nonce, challenge, email string
+		verified                                       bool
+	}
+	var mu sync.Mutex
+	grants := map[string]grant{}
+
+	http.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	http.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "mock", "use": "sig", "alg": "RS256",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	http.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+			return
+		}
+		email := q.Get("login_hint")
+		if email == "" {
+			email = "mock.user@example.com"
+		}
+		code := randomHex()
+		mu.Lock()
+		grants[code] = grant{
+			clientID: q.Get("client_id"), redirectURI: q.Get("redirect_uri"), nonce: q.Get("nonce"),
+			challenge: q.Get("code_challenge"), email: email, verified: q.Get("email_verified") != "false",
+		}
+		mu.Unlock()
+
+		target, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		params := target.Query()
+		params.Set("code", code)
+		params.Set("state", q.Get("state"))
+		target.RawQuery = params.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	})
+
+	http.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		g, ok := grants[r.PostForm.Get("code")]
+		delete(grants, r.PostForm.Get("code"))
+		mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || b64(sum[:]) != g.challenge || r.PostForm.Get("redirect_uri") != g.redirectURI {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		now := time.Now()
+		idToken, err := signRS256(key, map[string]interface{}{
+			"iss": issuer, "aud": g.clientID, "sub": "mock|" + g.email, "email": g.email,
+			"email_verified": g.verified, "nonce": g.nonce, "iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": randomHex(), "token_type": "Bearer", "expires_in": 300, "id_token": idToken,
+		})
+	})
+
+	log.Printf("Mock OIDC provider listening on %s (issuer %s)", addr, issuer)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+func signRS256(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "mock"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64(sig), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func randomHex() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}